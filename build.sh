@@ -50,9 +50,9 @@ function build()
     fi
 
     if [[ -z $2 || "$2" == "release" ]]; then
-        go build -o bin/$1 src/nicemqtt.go
+        go build -o bin/$1 ./src
     elif [[ "$2" == "debug" ]];then
-        go build -o bin/$1 -gcflags="-N -l" src/nicemqtt.go
+        go build -o bin/$1 -gcflags="-N -l" ./src
     else
         echo "Usage:$0 [debug|release]"
         echo "build failed!"
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// ACLRule single allow or deny rule
+// Rule applies to client if all of non-empty Username, ClientID and Project match.
+// Topic may contain wildcards as well as %u and %c which are replaced with
+// username and client id respectively
+type ACLRule struct {
+	Action   string   `json:"action"`
+	Username string   `json:"username,omitempty"`
+	ClientID string   `json:"clientid,omitempty"`
+	Project  string   `json:"project,omitempty"`
+	Topic    string   `json:"topic"`
+	Access   []string `json:"access"`
+}
+
+// ACLConfig content of the acl file
+type ACLConfig struct {
+	// Default either allow or deny, used when none of rules matched
+	// if empty decision is passed to next provider
+	Default string    `json:"default"`
+	Rules   []ACLRule `json:"rules"`
+}
+
+type aclRule struct {
+	ACLRule
+	allow  bool
+	access AccessType
+}
+
+type aclAuth struct {
+	sync.RWMutex
+	rules    []aclRule
+	def      error
+	userInfo func(string) *User
+}
+
+// NewACL allocate topic ACL provider
+// userInfo used to resolve project of the user for rules keyed by project
+func NewACL(userInfo func(string) *User) *aclAuth {
+	return &aclAuth{
+		def:      ErrNotFound,
+		userInfo: userInfo,
+	}
+}
+
+// LoadACLConfig read acl rules from json file
+func LoadACLConfig(path string) (*ACLConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &ACLConfig{}
+	if err = json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// SetRules replace rules
+// rules are evaluated in given order, first matching rule wins
+func (a *aclAuth) SetRules(def string, rules []ACLRule) error {
+	var defStatus error
+
+	switch def {
+	case "":
+		defStatus = ErrNotFound
+	case "allow":
+		defStatus = StatusAllow
+	case "deny":
+		defStatus = StatusDeny
+	default:
+		return ErrInvalidArgs
+	}
+
+	list := make([]aclRule, 0, len(rules))
+
+	for _, r := range rules {
+		rule := aclRule{
+			ACLRule: r,
+		}
+
+		switch r.Action {
+		case "allow":
+			rule.allow = true
+		case "deny":
+		default:
+			log.Error("acl: invalid rule action:%q", r.Action)
+			return ErrInvalidArgs
+		}
+
+		for _, acc := range r.Access {
+			switch acc {
+			case "read":
+				rule.access |= AccessRead
+			case "write":
+				rule.access |= AccessWrite
+			case "subscribe":
+				rule.access |= AccessSubscribe
+			default:
+				log.Error("acl: invalid rule access:%q", acc)
+				return ErrInvalidArgs
+			}
+		}
+
+		if len(r.Topic) == 0 || rule.access == 0 {
+			log.Error("acl: rule must have topic and access, rule:%v", r)
+			return ErrInvalidArgs
+		}
+
+		list = append(list, rule)
+	}
+
+	a.Lock()
+	a.rules = list
+	a.def = defStatus
+	a.Unlock()
+
+	return nil
+}
+
+// nolint: golint
+func (a *aclAuth) Password(clientID, user, password string) error {
+	return StatusDeny
+}
+
+// nolint: golint
+func (a *aclAuth) GetUser(user string) *User {
+	return nil
+}
+
+// nolint: golint
+func (a *aclAuth) ACL(clientID, user, topic string, access AccessType) error {
+	project := ""
+	projectResolved := false
+
+	a.RLock()
+	defer a.RUnlock()
+
+	for i := range a.rules {
+		r := &a.rules[i]
+
+		if r.access&access == 0 {
+			continue
+		}
+
+		if (len(r.Username) > 0 && r.Username != user) || (len(r.ClientID) > 0 && r.ClientID != clientID) {
+			continue
+		}
+
+		if len(r.Project) > 0 {
+			if !projectResolved {
+				projectResolved = true
+				if u := a.userInfo(user); u != nil {
+					project = u.ProjectId
+				}
+			}
+
+			if r.Project != project {
+				continue
+			}
+		}
+
+		pattern := strings.Replace(r.Topic, "%u", user, -1)
+		pattern = strings.Replace(pattern, "%c", clientID, -1)
+
+		var match bool
+		if access == AccessSubscribe {
+			match = aclFilterCovered(pattern, topic)
+		} else {
+			match = aclTopicMatch(pattern, topic)
+		}
+
+		if match {
+			if r.allow {
+				return StatusAllow
+			}
+
+			return StatusDeny
+		}
+	}
+
+	return a.def
+}
+
+// nolint: golint
+func (a *aclAuth) Shutdown() error {
+	a.Lock()
+	defer a.Unlock()
+	a.rules = nil
+	return nil
+}
+
+// aclTopicMatch check if topic name matches pattern
+// [MQTT-4.7.2-1] wildcards at first level do not match topics starting with $
+func aclTopicMatch(pattern, topic string) bool {
+	pLevels := strings.Split(pattern, "/")
+	tLevels := strings.Split(topic, "/")
+
+	if strings.HasPrefix(topic, "$") && (pLevels[0] == "+" || pLevels[0] == "#") {
+		return false
+	}
+
+	for i, p := range pLevels {
+		if p == "#" {
+			return true
+		}
+
+		if i >= len(tLevels) {
+			return false
+		}
+
+		if p != "+" && p != tLevels[i] {
+			return false
+		}
+	}
+
+	return len(pLevels) == len(tLevels)
+}
+
+// aclFilterCovered check if every topic matched by filter is also matched by pattern
+func aclFilterCovered(pattern, filter string) bool {
+	pLevels := strings.Split(pattern, "/")
+	fLevels := strings.Split(filter, "/")
+
+	if strings.HasPrefix(filter, "$") && (pLevels[0] == "+" || pLevels[0] == "#") {
+		return false
+	}
+
+	for i, p := range pLevels {
+		if p == "#" {
+			return true
+		}
+
+		if i >= len(fLevels) {
+			// "a/#" matches "a" as well so filter "a/#" is not covered by pattern "a/+"
+			return false
+		}
+
+		switch f := fLevels[i]; {
+		case f == "#":
+			return false
+		case p == "+":
+		case p != f:
+			return false
+		}
+	}
+
+	return len(pLevels) == len(fLevels)
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestACLTopicMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		match   bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a/b", "a/b/c", false},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/+/c", "a/b/c", true},
+		{"a/#", "a", true},
+		{"a/#", "a/b/c", true},
+		{"#", "a/b", true},
+		{"+/b", "a/b", true},
+		{"#", "$SYS/broker", false},
+		{"+/broker", "$SYS/broker", false},
+		{"$SYS/#", "$SYS/broker", true},
+		{"a/+", "a/", true},
+	}
+
+	for _, tt := range tests {
+		if match := aclTopicMatch(tt.pattern, tt.topic); match != tt.match {
+			t.Errorf("pattern %q, topic %q: got %v, want %v", tt.pattern, tt.topic, match, tt.match)
+		}
+	}
+}
+
+func TestACLFilterCovered(t *testing.T) {
+	tests := []struct {
+		pattern string
+		filter  string
+		covered bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/+", "a/b", true},
+		{"a/+", "a/+", true},
+		{"a/#", "a/+/c", true},
+		{"a/#", "a/#", true},
+		{"#", "a/#", true},
+		{"a/b", "a/+", false},
+		{"a/+", "a/#", false},
+		{"a/+/c", "a/+/#", false},
+		{"a/b", "a/b/c", false},
+		{"#", "$SYS/#", false},
+		{"$SYS/#", "$SYS/broker/+", true},
+	}
+
+	for _, tt := range tests {
+		if covered := aclFilterCovered(tt.pattern, tt.filter); covered != tt.covered {
+			t.Errorf("pattern %q, filter %q: got %v, want %v", tt.pattern, tt.filter, covered, tt.covered)
+		}
+	}
+}
+
+func newTestACL(t *testing.T, def string, rules []ACLRule) *aclAuth {
+	users := map[string]*User{
+		"u1": {Name: "u1", ProjectId: "p1"},
+		"u2": {Name: "u2", ProjectId: "p2"},
+	}
+
+	a := NewACL(func(user string) *User { return users[user] })
+	if err := a.SetRules(def, rules); err != nil {
+		t.Fatalf("set rules: %v", err)
+	}
+
+	return a
+}
+
+func TestACLRules(t *testing.T) {
+	a := newTestACL(t, "", []ACLRule{
+		{Action: "deny", Username: "u1", Topic: "devices/blocked/#", Access: []string{"read", "write", "subscribe"}},
+		{Action: "allow", Topic: "devices/%c/#", Access: []string{"read", "write", "subscribe"}},
+		{Action: "allow", Topic: "users/%u/+", Access: []string{"write"}},
+		{Action: "allow", ClientID: "c1", Topic: "clients/only", Access: []string{"read"}},
+		{Action: "allow", Project: "p1", Topic: "projects/p1/#", Access: []string{"subscribe"}},
+		{Action: "deny", Topic: "#", Access: []string{"subscribe"}},
+	})
+
+	tests := []struct {
+		name     string
+		clientID string
+		user     string
+		topic    string
+		access   AccessType
+		status   error
+	}{
+		{"client id substitution", "c1", "u1", "devices/c1/temp", AccessWrite, StatusAllow},
+		{"client id of another client", "c1", "u1", "devices/c2/temp", AccessWrite, ErrNotFound},
+		{"subscribe own filter", "c1", "u1", "devices/c1/#", AccessSubscribe, StatusAllow},
+		{"username substitution", "c1", "u1", "users/u1/x", AccessWrite, StatusAllow},
+		{"username of another user", "c1", "u1", "users/u2/x", AccessWrite, ErrNotFound},
+		{"write only rule not read", "c1", "u1", "users/u1/x", AccessRead, ErrNotFound},
+		{"client id rule", "c1", "u2", "clients/only", AccessRead, StatusAllow},
+		{"client id rule other client", "c2", "u2", "clients/only", AccessRead, ErrNotFound},
+		{"project rule", "c2", "u1", "projects/p1/a", AccessSubscribe, StatusAllow},
+		{"project rule other project", "c2", "u2", "projects/p1/a", AccessSubscribe, StatusDeny},
+		{"first matching rule wins", "blocked", "u1", "devices/blocked/a", AccessWrite, StatusDeny},
+		{"deny of other user skipped", "blocked", "u2", "devices/blocked/a", AccessWrite, StatusAllow},
+		{"subscribe wider than allowed", "c1", "u1", "devices/#", AccessSubscribe, StatusDeny},
+	}
+
+	for _, tt := range tests {
+		if status := a.ACL(tt.clientID, tt.user, tt.topic, tt.access); status != tt.status {
+			t.Errorf("%s: got %v, want %v", tt.name, status, tt.status)
+		}
+	}
+}
+
+func TestACLDefault(t *testing.T) {
+	rules := []ACLRule{{Action: "allow", Topic: "a", Access: []string{"read"}}}
+
+	for def, status := range map[string]error{"": ErrNotFound, "allow": StatusAllow, "deny": StatusDeny} {
+		a := newTestACL(t, def, rules)
+
+		if s := a.ACL("c", "u", "b", AccessRead); s != status {
+			t.Errorf("default %q: got %v, want %v", def, s, status)
+		}
+	}
+
+	if err := NewACL(nil).SetRules("maybe", nil); err != ErrInvalidArgs {
+		t.Errorf("invalid default: got %v, want %v", err, ErrInvalidArgs)
+	}
+}
+
+func TestACLInvalidRules(t *testing.T) {
+	tests := []ACLRule{
+		{Action: "permit", Topic: "a", Access: []string{"read"}},
+		{Action: "allow", Topic: "a", Access: []string{"publish"}},
+		{Action: "allow", Topic: "", Access: []string{"read"}},
+		{Action: "allow", Topic: "a"},
+	}
+
+	for _, r := range tests {
+		if err := NewACL(nil).SetRules("", []ACLRule{r}); err != ErrInvalidArgs {
+			t.Errorf("rule %+v: got %v, want %v", r, err, ErrInvalidArgs)
+		}
+	}
+}
+
+func TestManagerACLDefault(t *testing.T) {
+	t.Cleanup(func() {
+		SetACLDefault("") // nolint: errcheck
+	})
+
+	a := newTestACL(t, "", []ACLRule{{Action: "deny", Topic: "secret", Access: []string{"write"}}})
+
+	tests := []struct {
+		def       string
+		providers []IFace
+		topic     string
+		status    error
+	}{
+		{"", []IFace{NewSimpleAuth()}, "a", StatusAllow},
+		{"", []IFace{NewSimpleAuth(), a}, "a", StatusAllow},
+		{"", []IFace{NewSimpleAuth(), a}, "secret", StatusDeny},
+		{"allow", []IFace{a}, "a", StatusAllow},
+		{"deny", []IFace{NewSimpleAuth(), a}, "a", StatusDeny},
+		{"deny", []IFace{}, "a", StatusDeny},
+	}
+
+	for _, tt := range tests {
+		if err := SetACLDefault(tt.def); err != nil {
+			t.Fatalf("set default %q: %v", tt.def, err)
+		}
+
+		m := &Manager{p: tt.providers}
+		if status := m.ACL("c", "u", tt.topic, AccessWrite); status != tt.status {
+			t.Errorf("default %q, providers %d, topic %s: got %v, want %v", tt.def, len(tt.providers), tt.topic, status, tt.status)
+		}
+	}
+
+	if err := SetACLDefault("maybe"); err != ErrInvalidArgs {
+		t.Errorf("invalid default: got %v, want %v", err, ErrInvalidArgs)
+	}
+}
@@ -1,6 +1,12 @@
 package auth
 
-import "logs"
+import (
+	"crypto/x509"
+	"net"
+	"time"
+
+	"logs"
+)
 
 // AccessType acl type
 type AccessType int
@@ -13,8 +19,9 @@ type Error int
 
 // nolint: golint
 const (
-	AccessRead  AccessType = 1
-	AccessWrite AccessType = 2
+	AccessRead      AccessType = 1
+	AccessWrite     AccessType = 2
+	AccessSubscribe AccessType = 4
 )
 
 // nolint: golint
@@ -23,6 +30,14 @@ const (
 	StatusDeny
 )
 
+// Fields of the client certificate usable as identity of the connection
+const (
+	// CertCN subject common name
+	CertCN = "cn"
+	// CertSAN first of subject alternative names, DNS name, email, URI or IP in that order
+	CertSAN = "san"
+)
+
 // nolint: golint
 const (
 	ErrInvalidArgs Error = iota
@@ -54,6 +69,10 @@ var (
 // Permissions check session permissions
 type Permissions interface {
 	// ACL check access type for client id with username
+	// AccessRead and AccessWrite are checked against topic name,
+	// AccessSubscribe is checked against topic filter
+	// Providers return StatusAllow or StatusDeny if they have decision
+	// and ErrNotFound otherwise
 	ACL(clientID, username, topic string, accessType AccessType) error
 }
 
@@ -74,6 +93,95 @@ type IFace interface {
 	GetUser(user string) *User
 }
 
+// Peer remote end of the client connection
+type Peer struct {
+	// IP address of the client without port
+	IP string
+	// Cert verified certificate of the client, nil if client has not presented one
+	Cert *x509.Certificate
+}
+
+// PeerIFace optional interface of the providers taking client connection into account
+// Manager bound to peer calls these instead of Password and ACL
+type PeerIFace interface {
+	PeerPassword(peer *Peer, clientID, user, password string) error
+	PeerACL(peer *Peer, clientID, user, topic string, accessType AccessType) error
+}
+
+// ExpiryIFace optional interface of the providers issuing credentials valid for limited time
+type ExpiryIFace interface {
+	// Expiry time credentials of the client expire at, zero if they do not expire
+	Expiry(clientID, user string) time.Time
+}
+
+// ClientUserIFace optional interface of the providers taking user info from credentials of the connection
+type ClientUserIFace interface {
+	// ClientUser user info of the client authenticated last, nil if there is none
+	ClientUser(clientID, user string) *User
+}
+
+// ChallengeIFace optional interface of the providers supporting MQTT 5 enhanced authentication
+// [MQTT-4.12] challenge/response exchange of AUTH packets keyed by authentication method
+type ChallengeIFace interface {
+	// AuthMethod name of the authentication method, e.g. SCRAM-SHA-256
+	AuthMethod() string
+	// NewExchange start exchange with client
+	NewExchange(clientID string) Exchange
+}
+
+// Exchange state of the single challenge/response authentication
+type Exchange interface {
+	// Step process authentication data received from client
+	// returns data to be sent to client along with nil if exchange continues,
+	// StatusAllow once client is authenticated or StatusDeny
+	Step(data []byte) ([]byte, error)
+	// User name of the authenticated user
+	User() string
+}
+
+// NewPeer peer of the connection with given remote address
+func NewPeer(addr net.Addr) *Peer {
+	p := &Peer{}
+
+	if addr != nil {
+		if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+			p.IP = host
+		} else {
+			p.IP = addr.String()
+		}
+	}
+
+	return p
+}
+
+// CertName value of the certificate field, CertCN or CertSAN
+// empty if peer has no certificate or field is not set
+func (p *Peer) CertName(field string) string {
+	if p == nil || p.Cert == nil {
+		return ""
+	}
+
+	c := p.Cert
+
+	switch field {
+	case CertCN:
+		return c.Subject.CommonName
+	case CertSAN:
+		switch {
+		case len(c.DNSNames) > 0:
+			return c.DNSNames[0]
+		case len(c.EmailAddresses) > 0:
+			return c.EmailAddresses[0]
+		case len(c.URIs) > 0:
+			return c.URIs[0].String()
+		case len(c.IPAddresses) > 0:
+			return c.IPAddresses[0].String()
+		}
+	}
+
+	return ""
+}
+
 // Type return string representation of the type
 func (t AccessType) Type() string {
 	switch t {
@@ -81,6 +189,8 @@ func (t AccessType) Type() string {
 		return "read"
 	case AccessWrite:
 		return "write"
+	case AccessSubscribe:
+		return "subscribe"
 	}
 
 	return ""
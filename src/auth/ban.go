@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of the ban list entries
+const (
+	BanClientID = "clientid"
+	BanUsername = "username"
+	// BanIP value is either ip address or CIDR
+	BanIP = "ip"
+)
+
+var (
+	// ErrBanInvalid unknown kind or invalid ip/CIDR of the ban
+	ErrBanInvalid = errors.New("auth: invalid ban")
+)
+
+// Ban entry of the ban list
+type Ban struct {
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	Reason string `json:"reason,omitempty"`
+	// Expires ban is lifted at, zero for permanent ban
+	Expires time.Time `json:"expires,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// BanStore persistent storage of the ban list
+type BanStore interface {
+	LoadBans() ([]Ban, error)
+	// SaveBan add or replace ban with same kind and value
+	SaveBan(b *Ban) error
+	DeleteBan(kind, value string) error
+}
+
+type banNet struct {
+	ban *Ban
+	net *net.IPNet
+}
+
+// BanList bans of client ids, usernames, ip addresses and networks
+// expired bans are ignored and removed from store on next change or listing
+type BanList struct {
+	lock    sync.RWMutex
+	store   BanStore
+	entries map[string]*Ban
+	nets    []banNet
+}
+
+// NewBanList load bans from store, store might be nil to keep bans in memory only
+func NewBanList(store BanStore) (*BanList, error) {
+	b := &BanList{
+		store:   store,
+		entries: make(map[string]*Ban),
+	}
+
+	if store != nil {
+		bans, err := store.LoadBans()
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range bans {
+			ban := bans[i]
+			if err = ban.validate(); err != nil {
+				log.Error("ban %s:%s dropped, err:%s", ban.Kind, ban.Value, err.Error())
+				continue
+			}
+			b.put(&ban)
+		}
+
+		b.lock.Lock()
+		b.expire(time.Now())
+		b.lock.Unlock()
+	}
+
+	return b, nil
+}
+
+// Add ban or replace ban with same kind and value
+func (b *BanList) Add(ban Ban) error {
+	if err := ban.validate(); err != nil {
+		return err
+	}
+
+	if ban.Created.IsZero() {
+		ban.Created = time.Now()
+	}
+
+	if b.store != nil {
+		if err := b.store.SaveBan(&ban); err != nil {
+			return err
+		}
+	}
+
+	b.put(&ban)
+
+	b.lock.Lock()
+	b.expire(time.Now())
+	b.lock.Unlock()
+
+	return nil
+}
+
+// Remove ban, ErrNotFound if there is no such ban
+func (b *BanList) Remove(kind, value string) error {
+	ban := Ban{Kind: kind, Value: value}
+	if err := ban.validate(); err != nil {
+		return err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if _, ok := b.entries[ban.key()]; !ok {
+		return ErrNotFound
+	}
+
+	if b.store != nil {
+		if err := b.store.DeleteBan(ban.Kind, ban.Value); err != nil {
+			return err
+		}
+	}
+
+	b.remove(ban.key())
+
+	return nil
+}
+
+// List bans in effect
+func (b *BanList) List() []Ban {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.expire(time.Now())
+
+	list := make([]Ban, 0, len(b.entries))
+	for _, ban := range b.entries {
+		list = append(list, *ban)
+	}
+
+	return list
+}
+
+// Banned ban matching any of client id, username or ip, nil if there is none
+// empty values are not checked
+func (b *BanList) Banned(clientID, username, ip string) *Ban {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	now := time.Now()
+
+	for _, k := range []Ban{{Kind: BanClientID, Value: clientID}, {Kind: BanUsername, Value: username}, {Kind: BanIP, Value: ip}} {
+		if len(k.Value) == 0 {
+			continue
+		}
+
+		if ban, ok := b.entries[k.key()]; ok && ban.active(now) {
+			return ban
+		}
+	}
+
+	if addr := net.ParseIP(ip); addr != nil {
+		for _, n := range b.nets {
+			if n.ban.active(now) && n.net.Contains(addr) {
+				return n.ban
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *BanList) put(ban *Ban) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.remove(ban.key())
+
+	b.entries[ban.key()] = ban
+
+	if ban.Kind == BanIP && strings.Contains(ban.Value, "/") {
+		_, n, _ := net.ParseCIDR(ban.Value)
+		b.nets = append(b.nets, banNet{ban: ban, net: n})
+	}
+}
+
+// remove ban from memory, lock must be held
+func (b *BanList) remove(key string) {
+	if _, ok := b.entries[key]; !ok {
+		return
+	}
+
+	delete(b.entries, key)
+
+	for i := range b.nets {
+		if b.nets[i].ban.key() == key {
+			b.nets = append(b.nets[:i], b.nets[i+1:]...)
+			break
+		}
+	}
+}
+
+// expire drop expired bans from memory and store, lock must be held
+func (b *BanList) expire(now time.Time) {
+	for key, ban := range b.entries {
+		if ban.active(now) {
+			continue
+		}
+
+		if b.store != nil {
+			if err := b.store.DeleteBan(ban.Kind, ban.Value); err != nil {
+				log.Error("delete expired ban %s:%s, err:%s", ban.Kind, ban.Value, err.Error())
+				continue
+			}
+		}
+
+		b.remove(key)
+	}
+}
+
+func (b *Ban) validate() error {
+	if len(b.Value) == 0 {
+		return ErrBanInvalid
+	}
+
+	switch b.Kind {
+	case BanClientID, BanUsername:
+	case BanIP:
+		if strings.Contains(b.Value, "/") {
+			_, n, err := net.ParseCIDR(b.Value)
+			if err != nil {
+				return ErrBanInvalid
+			}
+			// keep network address only, e.g. 10.0.0.1/8 is stored as 10.0.0.0/8
+			b.Value = n.String()
+		} else if ip := net.ParseIP(b.Value); ip != nil {
+			b.Value = ip.String()
+		} else {
+			return ErrBanInvalid
+		}
+	default:
+		return ErrBanInvalid
+	}
+
+	return nil
+}
+
+func (b *Ban) key() string {
+	return b.Kind + ":" + b.Value
+}
+
+func (b *Ban) active(now time.Time) bool {
+	return b.Expires.IsZero() || now.Before(b.Expires)
+}
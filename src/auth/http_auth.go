@@ -0,0 +1,429 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPEndpoint request made to check credentials or access
+// URL and values of Params may contain placeholders:
+//
+//	%c client id, %u username, %P password, %a peer ip, %t topic, %A access type
+type HTTPEndpoint struct {
+	URL string `json:"url"`
+	// Method GET or POST, POST by default
+	// GET puts Params into query, POST into body
+	Method string `json:"method"`
+	// Params sent with request, all of the placeholders under their own names by default
+	Params map[string]string `json:"params"`
+	// ContentType of POST body, either json or form, json by default
+	ContentType string `json:"content_type"`
+}
+
+// HTTPConfig of the http auth provider
+// Endpoints answer 2xx to allow, 401 or 403 to deny, 404 to pass decision to next provider.
+// User endpoint answers with json object {"name": "", "project_id": ""}.
+// Endpoint without url is not asked, decision is passed to next provider
+type HTTPConfig struct {
+	Password HTTPEndpoint      `json:"password"`
+	ACL      HTTPEndpoint      `json:"acl"`
+	User     HTTPEndpoint      `json:"user"`
+	Headers  map[string]string `json:"headers"`
+	// Timeout of the single request in seconds, 5 by default
+	Timeout int `json:"timeout"`
+	// CacheTTL seconds allow decisions and users are cached for, 0 disables caching
+	CacheTTL int `json:"cache_ttl"`
+	// DenyTTL seconds deny and not found decisions are cached for, 0 disables negative caching
+	DenyTTL int `json:"deny_ttl"`
+	// CacheSize max cached decisions, 10000 by default
+	CacheSize int `json:"cache_size"`
+	// FailOpen allow access if endpoint is not reachable or answers unexpected status
+	// otherwise access is denied
+	FailOpen bool `json:"fail_open"`
+}
+
+type httpCacheEntry struct {
+	status  error
+	user    *User
+	expires time.Time
+}
+
+type httpAuth struct {
+	HTTPConfig
+	client *http.Client
+	lock   sync.Mutex
+	cache  map[string]*httpCacheEntry
+}
+
+type httpRequest struct {
+	peer     *Peer
+	clientID string
+	user     string
+	password string
+	topic    string
+	access   AccessType
+}
+
+var errHTTPUnexpectedStatus = errors.New("auth: unexpected http status")
+
+var httpDefaultParams = map[string]string{
+	"clientid": "%c",
+	"username": "%u",
+	"password": "%P",
+	"ipaddr":   "%a",
+	"topic":    "%t",
+	"access":   "%A",
+}
+
+var _ IFace = (*httpAuth)(nil)
+var _ PeerIFace = (*httpAuth)(nil)
+
+// NewHTTPAuth allocate provider delegating decisions to http endpoints
+func NewHTTPAuth(c HTTPConfig) (*httpAuth, error) {
+	for _, e := range []*HTTPEndpoint{&c.Password, &c.ACL, &c.User} {
+		if len(e.URL) == 0 {
+			continue
+		}
+
+		if u, err := url.Parse(e.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, ErrInvalidArgs
+		}
+
+		if e.Params == nil {
+			e.Params = httpDefaultParams
+		}
+
+		e.Method = strings.ToUpper(e.Method)
+
+		switch e.Method {
+		case "":
+			e.Method = http.MethodPost
+		case http.MethodGet, http.MethodPost:
+		default:
+			return nil, ErrInvalidArgs
+		}
+
+		switch e.ContentType {
+		case "":
+			e.ContentType = "json"
+		case "json", "form":
+		default:
+			return nil, ErrInvalidArgs
+		}
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = 5
+	}
+
+	if c.CacheSize <= 0 {
+		c.CacheSize = 10000
+	}
+
+	return &httpAuth{
+		HTTPConfig: c,
+		client:     &http.Client{Timeout: time.Duration(c.Timeout) * time.Second},
+		cache:      make(map[string]*httpCacheEntry),
+	}, nil
+}
+
+// Password check credentials without peer
+func (a *httpAuth) Password(clientID, user, password string) error {
+	return a.PeerPassword(nil, clientID, user, password)
+}
+
+// ACL check access without peer
+func (a *httpAuth) ACL(clientID, user, topic string, access AccessType) error {
+	return a.PeerACL(nil, clientID, user, topic, access)
+}
+
+// PeerPassword ask password endpoint
+func (a *httpAuth) PeerPassword(peer *Peer, clientID, user, password string) error {
+	if len(a.HTTPConfig.Password.URL) == 0 {
+		return ErrNotFound
+	}
+
+	r := &httpRequest{peer: peer, clientID: clientID, user: user, password: password}
+
+	return a.decision(&a.HTTPConfig.Password, r)
+}
+
+// PeerACL ask acl endpoint
+func (a *httpAuth) PeerACL(peer *Peer, clientID, user, topic string, access AccessType) error {
+	if len(a.HTTPConfig.ACL.URL) == 0 {
+		return ErrNotFound
+	}
+
+	r := &httpRequest{peer: peer, clientID: clientID, user: user, topic: topic, access: access}
+
+	return a.decision(&a.HTTPConfig.ACL, r)
+}
+
+// GetUser ask user endpoint
+func (a *httpAuth) GetUser(user string) *User {
+	if len(a.HTTPConfig.User.URL) == 0 {
+		return nil
+	}
+
+	r := &httpRequest{user: user}
+	key := r.key("user")
+
+	if e := a.cached(key); e != nil {
+		return e.user
+	}
+
+	resp, err := a.do(&a.HTTPConfig.User, r)
+	if err != nil {
+		log.Error("http auth: get user:%s, err:%s", user, err.Error())
+		return nil
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body) // nolint: errcheck
+		if resp.StatusCode == http.StatusNotFound {
+			a.store(key, &httpCacheEntry{status: ErrNotFound}, a.DenyTTL)
+		}
+		return nil
+	}
+
+	info := struct {
+		Name      string `json:"name"`
+		ProjectID string `json:"project_id"`
+	}{}
+
+	if err = json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		log.Error("http auth: decode user:%s, err:%s", user, err.Error())
+		return nil
+	}
+
+	if len(info.Name) == 0 {
+		info.Name = user
+	}
+
+	u := &User{
+		Name:      info.Name,
+		ProjectId: info.ProjectID,
+	}
+
+	a.store(key, &httpCacheEntry{status: StatusAllow, user: u}, a.CacheTTL)
+
+	return u
+}
+
+// Shutdown drop cached decisions
+func (a *httpAuth) Shutdown() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.cache = make(map[string]*httpCacheEntry)
+
+	return nil
+}
+
+func (a *httpAuth) decision(e *HTTPEndpoint, r *httpRequest) error {
+	kind := "acl"
+	if e == &a.HTTPConfig.Password {
+		kind = "password"
+	}
+
+	key := r.key(kind)
+
+	if c := a.cached(key); c != nil {
+		return c.status
+	}
+
+	resp, err := a.do(e, r)
+	if err != nil {
+		log.Error("http auth: %s clientId:%s, err:%s", kind, r.clientID, err.Error())
+		return a.failure()
+	}
+
+	io.Copy(ioutil.Discard, resp.Body) // nolint: errcheck
+	resp.Body.Close()                  // nolint: errcheck
+
+	var status error
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		status = StatusAllow
+		a.store(key, &httpCacheEntry{status: status}, a.CacheTTL)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		status = StatusDeny
+		a.store(key, &httpCacheEntry{status: status}, a.DenyTTL)
+	case resp.StatusCode == http.StatusNotFound:
+		status = ErrNotFound
+		a.store(key, &httpCacheEntry{status: status}, a.DenyTTL)
+	default:
+		log.Error("http auth: %s clientId:%s, status:%s", kind, r.clientID, resp.Status)
+		status = a.failure()
+	}
+
+	return status
+}
+
+// failure decision when endpoint did not answer
+func (a *httpAuth) failure() error {
+	if a.FailOpen {
+		return StatusAllow
+	}
+
+	return StatusDeny
+}
+
+func (a *httpAuth) do(e *HTTPEndpoint, r *httpRequest) (*http.Response, error) {
+	replacer := r.replacer(url.QueryEscape)
+
+	var req *http.Request
+	var err error
+
+	if e.Method == http.MethodGet {
+		u := replacer.Replace(e.URL)
+
+		if len(e.Params) > 0 {
+			if strings.Contains(u, "?") {
+				u += "&"
+			} else {
+				u += "?"
+			}
+			u += r.values(e.Params).Encode()
+		}
+
+		req, err = http.NewRequest(http.MethodGet, u, nil)
+	} else {
+		var body []byte
+		var contentType string
+
+		values := r.values(e.Params)
+
+		if e.ContentType == "form" {
+			body = []byte(values.Encode())
+			contentType = "application/x-www-form-urlencoded"
+		} else {
+			obj := make(map[string]string)
+			for k := range values {
+				obj[k] = values.Get(k)
+			}
+			if body, err = json.Marshal(obj); err != nil {
+				return nil, err
+			}
+			contentType = "application/json"
+		}
+
+		if req, err = http.NewRequest(http.MethodPost, replacer.Replace(e.URL), bytes.NewReader(body)); err == nil {
+			req.Header.Set("Content-Type", contentType)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range a.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 500 {
+		io.Copy(ioutil.Discard, resp.Body) // nolint: errcheck
+		resp.Body.Close()                  // nolint: errcheck
+		return nil, errHTTPUnexpectedStatus
+	}
+
+	return resp, nil
+}
+
+func (a *httpAuth) cached(key string) *httpCacheEntry {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if e, ok := a.cache[key]; ok {
+		if time.Now().Before(e.expires) {
+			return e
+		}
+		delete(a.cache, key)
+	}
+
+	return nil
+}
+
+func (a *httpAuth) store(key string, e *httpCacheEntry, ttl int) {
+	if ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+	e.expires = now.Add(time.Duration(ttl) * time.Second)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if len(a.cache) >= a.CacheSize {
+		for k, v := range a.cache {
+			if now.After(v.expires) {
+				delete(a.cache, k)
+			}
+		}
+
+		// every entry is still valid, start over
+		if len(a.cache) >= a.CacheSize {
+			a.cache = make(map[string]*httpCacheEntry)
+		}
+	}
+
+	a.cache[key] = e
+}
+
+func (r *httpRequest) ip() string {
+	if r.peer == nil {
+		return ""
+	}
+
+	return r.peer.IP
+}
+
+// key of the cached decision, password is hashed to not keep it in memory
+func (r *httpRequest) key(kind string) string {
+	h := sha256.New()
+	for _, v := range []string{kind, r.ip(), r.clientID, r.user, r.password, r.topic, r.access.Type()} {
+		h.Write([]byte(v)) // nolint: errcheck
+		h.Write([]byte{0}) // nolint: errcheck
+	}
+
+	return string(h.Sum(nil))
+}
+
+func (r *httpRequest) replacer(escape func(string) string) *strings.Replacer {
+	return strings.NewReplacer(
+		"%c", escape(r.clientID),
+		"%u", escape(r.user),
+		"%P", escape(r.password),
+		"%a", escape(r.ip()),
+		"%t", escape(r.topic),
+		"%A", escape(r.access.Type()),
+	)
+}
+
+func (r *httpRequest) values(params map[string]string) url.Values {
+	replacer := r.replacer(func(s string) string { return s })
+
+	values := url.Values{}
+	for k, v := range params {
+		values.Set(k, replacer.Replace(v))
+	}
+
+	return values
+}
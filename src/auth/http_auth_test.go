@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestHTTPAuth provider asking password endpoint served by handler
+func newTestHTTPAuth(t *testing.T, c HTTPConfig, handler http.HandlerFunc) *httpAuth {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c.Password.URL = srv.URL + "/password"
+
+	a, err := NewHTTPAuth(c)
+	if err != nil {
+		t.Fatalf("new http auth: %v", err)
+	}
+
+	return a
+}
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		code     int
+		failOpen bool
+		status   error
+	}{
+		{http.StatusOK, false, StatusAllow},
+		{http.StatusNoContent, false, StatusAllow},
+		{http.StatusUnauthorized, true, StatusDeny},
+		{http.StatusForbidden, true, StatusDeny},
+		{http.StatusNotFound, false, ErrNotFound},
+		{http.StatusNotFound, true, ErrNotFound},
+		{http.StatusBadRequest, false, StatusDeny},
+		{http.StatusBadRequest, true, StatusAllow},
+		{http.StatusInternalServerError, false, StatusDeny},
+		{http.StatusInternalServerError, true, StatusAllow},
+		{http.StatusServiceUnavailable, true, StatusAllow},
+	}
+
+	for _, tt := range tests {
+		a := newTestHTTPAuth(t, HTTPConfig{FailOpen: tt.failOpen}, func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(tt.code)
+		})
+
+		if status := a.Password("c1", "u1", "p1"); status != tt.status {
+			t.Errorf("status %d, fail open %v: got %v, want %v", tt.code, tt.failOpen, status, tt.status)
+		}
+	}
+}
+
+func TestHTTPTimeout(t *testing.T) {
+	for _, failOpen := range []bool{false, true} {
+		a := newTestHTTPAuth(t, HTTPConfig{FailOpen: failOpen}, func(w http.ResponseWriter, r *http.Request) {
+			// body is read for server to notice client gone
+			io.Copy(ioutil.Discard, r.Body) // nolint: errcheck
+
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		})
+		a.client.Timeout = 50 * time.Millisecond
+
+		want := StatusDeny
+		if failOpen {
+			want = StatusAllow
+		}
+
+		if status := a.Password("c1", "u1", "p1"); status != want {
+			t.Errorf("fail open %v: got %v, want %v", failOpen, status, want)
+		}
+	}
+}
+
+func TestHTTPCache(t *testing.T) {
+	var requests int32
+
+	a := newTestHTTPAuth(t, HTTPConfig{CacheTTL: 60, DenyTTL: 60}, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		params := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&params) // nolint: errcheck
+
+		if params["password"] != "good" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	})
+
+	tests := []struct {
+		password string
+		status   error
+		requests int32
+	}{
+		{"good", StatusAllow, 1},
+		{"good", StatusAllow, 1},
+		// allowed decision is not reused for another password
+		{"bad", StatusDeny, 2},
+		{"bad", StatusDeny, 2},
+		{"good", StatusAllow, 2},
+		{"other", StatusDeny, 3},
+	}
+
+	for i, tt := range tests {
+		if status := a.Password("c1", "u1", tt.password); status != tt.status {
+			t.Errorf("%d: password %s: got %v, want %v", i, tt.password, status, tt.status)
+		}
+
+		if n := atomic.LoadInt32(&requests); n != tt.requests {
+			t.Errorf("%d: password %s: %d requests, want %d", i, tt.password, n, tt.requests)
+		}
+	}
+
+	// dropped cache asks endpoint again
+	a.Shutdown() // nolint: errcheck
+
+	if status := a.Password("c1", "u1", "good"); status != StatusAllow || atomic.LoadInt32(&requests) != 4 {
+		t.Errorf("after shutdown: got %v with %d requests", status, atomic.LoadInt32(&requests))
+	}
+}
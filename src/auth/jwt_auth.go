@@ -0,0 +1,570 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWTConfig of the jwt auth provider
+// Token is sent as password of CONNECT. At least one of key files must be set
+type JWTConfig struct {
+	// SecretFile file with shared secret of HS256 tokens
+	SecretFile string `json:"secret_file"`
+	// PublicKeyFile PEM file with RSA or EC public keys or certificates of RS256 and ES256 tokens
+	PublicKeyFile string `json:"public_key_file"`
+	// JWKSFile json web key set with RSA, EC and oct keys
+	JWKSFile string `json:"jwks_file"`
+	// Issuer and Audience if set token must have matching iss and aud
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience"`
+	// Leeway seconds of clock skew allowed checking exp and nbf
+	Leeway int `json:"leeway"`
+	// UsernameClaim claim username must equal to, sub by default. Token without the claim is rejected
+	UsernameClaim string `json:"username_claim"`
+	// ClientIDClaim if set client id must equal to value of the claim
+	ClientIDClaim string `json:"clientid_claim"`
+	// ProjectClaim claim holding project of the user, project_id by default
+	ProjectClaim string `json:"project_claim"`
+	// PublishClaim and SubscribeClaim claims holding topic filters token is allowed to publish
+	// and subscribe to, publish and subscribe by default. Filters may contain %u and %c
+	// If token has no such claim decision is passed to next provider
+	PublishClaim   string `json:"publish_claim"`
+	SubscribeClaim string `json:"subscribe_claim"`
+}
+
+type jwtKey struct {
+	kid string
+	// key is []byte, *rsa.PublicKey or *ecdsa.PublicKey
+	key interface{}
+}
+
+// jwtSession claims of the token client has been authenticated with
+type jwtSession struct {
+	user      string
+	project   string
+	publish   []string
+	subscribe []string
+	expires   time.Time
+}
+
+type jwtAuth struct {
+	JWTConfig
+	keys      []jwtKey
+	lock      sync.RWMutex
+	sessions  map[string]*jwtSession
+	lastSweep time.Time
+}
+
+var (
+	errJWTMalformed = errors.New("auth: malformed token")
+	errJWTAlgorithm = errors.New("auth: unsupported token algorithm")
+	errJWTSignature = errors.New("auth: invalid token signature")
+	errJWTClaims    = errors.New("auth: invalid token claims")
+)
+
+var _ IFace = (*jwtAuth)(nil)
+var _ ExpiryIFace = (*jwtAuth)(nil)
+var _ ClientUserIFace = (*jwtAuth)(nil)
+
+// NewJWTAuth allocate provider validating tokens with keys from config files
+func NewJWTAuth(c JWTConfig) (*jwtAuth, error) {
+	a := &jwtAuth{
+		sessions: make(map[string]*jwtSession),
+	}
+
+	if len(c.SecretFile) > 0 {
+		data, err := ioutil.ReadFile(c.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if data = bytes.TrimSpace(data); len(data) == 0 {
+			return nil, ErrInvalidArgs
+		}
+
+		a.keys = append(a.keys, jwtKey{key: data})
+	}
+
+	if len(c.PublicKeyFile) > 0 {
+		keys, err := jwtLoadPEM(c.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		a.keys = append(a.keys, keys...)
+	}
+
+	if len(c.JWKSFile) > 0 {
+		keys, err := jwtLoadJWKS(c.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+
+		a.keys = append(a.keys, keys...)
+	}
+
+	if len(a.keys) == 0 {
+		return nil, ErrInvalidArgs
+	}
+
+	if len(c.UsernameClaim) == 0 {
+		c.UsernameClaim = "sub"
+	}
+
+	if len(c.ProjectClaim) == 0 {
+		c.ProjectClaim = "project_id"
+	}
+
+	if len(c.PublishClaim) == 0 {
+		c.PublishClaim = "publish"
+	}
+
+	if len(c.SubscribeClaim) == 0 {
+		c.SubscribeClaim = "subscribe"
+	}
+
+	a.JWTConfig = c
+
+	return a, nil
+}
+
+// Password validate token given as password
+func (a *jwtAuth) Password(clientID, user, password string) error {
+	claims, err := a.verify(password)
+	if err != nil {
+		log.Debug("jwt: clientId:%s, err:%s", clientID, err.Error())
+		return StatusDeny
+	}
+
+	now := time.Now()
+	leeway := time.Duration(a.Leeway) * time.Second
+
+	var expires time.Time
+
+	if v, ok := claims["exp"]; ok {
+		exp, ok := v.(float64)
+		if !ok {
+			return StatusDeny
+		}
+
+		if expires = time.Unix(int64(exp), 0); !now.Before(expires.Add(leeway)) {
+			log.Debug("jwt: token expired, clientId:%s", clientID)
+			return StatusDeny
+		}
+	}
+
+	if v, ok := claims["nbf"]; ok {
+		nbf, ok := v.(float64)
+		if !ok || now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+			log.Debug("jwt: token not valid yet, clientId:%s", clientID)
+			return StatusDeny
+		}
+	}
+
+	if len(a.Issuer) > 0 && jwtString(claims, "iss") != a.Issuer {
+		return StatusDeny
+	}
+
+	if len(a.Audience) > 0 && !jwtAudience(claims, a.Audience) {
+		return StatusDeny
+	}
+
+	// token issued to another user must not be accepted
+	if name := jwtString(claims, a.UsernameClaim); len(name) == 0 || name != user {
+		return StatusDeny
+	}
+
+	if len(a.ClientIDClaim) > 0 && jwtString(claims, a.ClientIDClaim) != clientID {
+		return StatusDeny
+	}
+
+	ses := &jwtSession{
+		user:    user,
+		project: jwtString(claims, a.ProjectClaim),
+		expires: expires,
+	}
+
+	if ses.publish, err = jwtStrings(claims, a.PublishClaim); err != nil {
+		return StatusDeny
+	}
+
+	if ses.subscribe, err = jwtStrings(claims, a.SubscribeClaim); err != nil {
+		return StatusDeny
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.sweep(now)
+	a.sessions[clientID] = ses
+
+	return StatusAllow
+}
+
+// ACL check topic against lists of the token client has been authenticated with
+func (a *jwtAuth) ACL(clientID, user, topic string, access AccessType) error {
+	a.lock.RLock()
+	ses, ok := a.sessions[clientID]
+	a.lock.RUnlock()
+
+	if !ok || ses.user != user || ses.expired(time.Now()) {
+		return ErrNotFound
+	}
+
+	list := ses.subscribe
+	if access == AccessWrite {
+		list = ses.publish
+	}
+
+	if list == nil {
+		return ErrNotFound
+	}
+
+	for _, p := range list {
+		pattern := strings.Replace(p, "%u", user, -1)
+		pattern = strings.Replace(pattern, "%c", clientID, -1)
+
+		var match bool
+		if access == AccessSubscribe {
+			match = aclFilterCovered(pattern, topic)
+		} else {
+			match = aclTopicMatch(pattern, topic)
+		}
+
+		if match {
+			return StatusAllow
+		}
+	}
+
+	return StatusDeny
+}
+
+// GetUser tokens of the same user might carry different projects, see ClientUser
+func (a *jwtAuth) GetUser(user string) *User {
+	return nil
+}
+
+// ClientUser user with project from token client has been authenticated with
+func (a *jwtAuth) ClientUser(clientID, user string) *User {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	if ses, ok := a.sessions[clientID]; ok && ses.user == user && !ses.expired(time.Now()) {
+		return &User{
+			Name:      user,
+			ProjectId: ses.project,
+		}
+	}
+
+	return nil
+}
+
+// Expiry time token of the client expires at
+func (a *jwtAuth) Expiry(clientID, user string) time.Time {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	if ses, ok := a.sessions[clientID]; ok && ses.user == user {
+		return ses.expires
+	}
+
+	return time.Time{}
+}
+
+// Shutdown drop claims of authenticated clients
+func (a *jwtAuth) Shutdown() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.sessions = make(map[string]*jwtSession)
+
+	return nil
+}
+
+// sweep drop claims of expired tokens, once a minute at most
+func (a *jwtAuth) sweep(now time.Time) {
+	if now.Sub(a.lastSweep) < time.Minute {
+		return
+	}
+
+	a.lastSweep = now
+
+	for id, ses := range a.sessions {
+		if ses.expired(now) {
+			delete(a.sessions, id)
+		}
+	}
+}
+
+func (s *jwtSession) expired(now time.Time) bool {
+	return !s.expires.IsZero() && now.After(s.expires)
+}
+
+// verify check signature of the token and return its claims
+func (a *jwtAuth) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errJWTMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	if err := jwtDecodeSegment(parts[0], &header); err != nil {
+		return nil, errJWTMalformed
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errJWTMalformed
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	verified := false
+
+	for _, k := range a.keys {
+		if len(header.Kid) > 0 && len(k.kid) > 0 && header.Kid != k.kid {
+			continue
+		}
+
+		switch key := k.key.(type) {
+		case []byte:
+			if header.Alg == "HS256" {
+				mac := hmac.New(sha256.New, key)
+				mac.Write([]byte(parts[0] + "." + parts[1])) // nolint: errcheck
+				verified = hmac.Equal(mac.Sum(nil), sig)
+			}
+		case *rsa.PublicKey:
+			if header.Alg == "RS256" {
+				verified = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+			}
+		case *ecdsa.PublicKey:
+			if header.Alg == "ES256" && key.Curve == elliptic.P256() && len(sig) == 64 {
+				r := new(big.Int).SetBytes(sig[:32])
+				s := new(big.Int).SetBytes(sig[32:])
+				verified = ecdsa.Verify(key, digest[:], r, s)
+			}
+		}
+
+		if verified {
+			break
+		}
+	}
+
+	if !verified {
+		switch header.Alg {
+		case "HS256", "RS256", "ES256":
+			return nil, errJWTSignature
+		default:
+			return nil, errJWTAlgorithm
+		}
+	}
+
+	claims := make(map[string]interface{})
+	if err = jwtDecodeSegment(parts[1], &claims); err != nil {
+		return nil, errJWTClaims
+	}
+
+	return claims, nil
+}
+
+func jwtDecodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func jwtString(claims map[string]interface{}, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// jwtStrings claim holding list of strings, nil if claim is not set
+func jwtStrings(claims map[string]interface{}, name string) ([]string, error) {
+	v, ok := claims[name]
+	if !ok {
+		return nil, nil
+	}
+
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, errJWTClaims
+	}
+
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, errJWTClaims
+		}
+		list = append(list, s)
+	}
+
+	return list, nil
+}
+
+// jwtAudience aud claim is either string or array of strings
+func jwtAudience(claims map[string]interface{}, aud string) bool {
+	switch v := claims["aud"].(type) {
+	case string:
+		return v == aud
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s == aud {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func jwtLoadPEM(path string) ([]jwtKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []jwtKey
+
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+
+		var key interface{}
+
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			keys = append(keys, jwtKey{key: key})
+		default:
+			return nil, errJWTAlgorithm
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrInvalidArgs
+	}
+
+	return keys, nil
+}
+
+func jwtLoadJWKS(path string) ([]jwtKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+
+	if err = json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	var keys []jwtKey
+
+	b64 := base64.RawURLEncoding
+
+	for _, k := range set.Keys {
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+
+		var key interface{}
+
+		switch k.Kty {
+		case "RSA":
+			n, e1 := b64.DecodeString(k.N)
+			e, e2 := b64.DecodeString(k.E)
+			if e1 != nil || e2 != nil {
+				return nil, errJWTMalformed
+			}
+			key = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, e1 := b64.DecodeString(k.X)
+			y, e2 := b64.DecodeString(k.Y)
+			if e1 != nil || e2 != nil {
+				return nil, errJWTMalformed
+			}
+			key = &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		case "oct":
+			secret, e1 := b64.DecodeString(k.K)
+			if e1 != nil {
+				return nil, errJWTMalformed
+			}
+			key = secret
+		default:
+			continue
+		}
+
+		keys = append(keys, jwtKey{kid: k.Kid, key: key})
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrInvalidArgs
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const jwtTestSecret = "secret"
+
+// jwtToken HS256 token with claims signed by secret
+func jwtToken(claims map[string]interface{}, secret string) string {
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	b64 := base64.RawURLEncoding
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed)) // nolint: errcheck
+
+	return signed + "." + b64.EncodeToString(mac.Sum(nil))
+}
+
+func newTestJWTAuth(t *testing.T, c JWTConfig) *jwtAuth {
+	c.SecretFile = filepath.Join(t.TempDir(), "secret")
+	if err := ioutil.WriteFile(c.SecretFile, []byte(jwtTestSecret+"\n"), 0600); err != nil {
+		t.Fatalf("write secret: %v", err)
+	}
+
+	a, err := NewJWTAuth(c)
+	if err != nil {
+		t.Fatalf("new jwt auth: %v", err)
+	}
+
+	return a
+}
+
+func TestJWTPassword(t *testing.T) {
+	a := newTestJWTAuth(t, JWTConfig{ClientIDClaim: "cid"})
+
+	exp := float64(time.Now().Add(time.Hour).Unix())
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		secret string
+		user   string
+		status error
+	}{
+		{"valid", map[string]interface{}{"sub": "u1", "cid": "c1", "exp": exp}, jwtTestSecret, "u1", StatusAllow},
+		{"no sub", map[string]interface{}{"cid": "c1", "exp": exp}, jwtTestSecret, "u1", StatusDeny},
+		{"sub of another user", map[string]interface{}{"sub": "u2", "cid": "c1"}, jwtTestSecret, "u1", StatusDeny},
+		{"empty username", map[string]interface{}{"sub": "", "cid": "c1"}, jwtTestSecret, "", StatusDeny},
+		{"client id mismatch", map[string]interface{}{"sub": "u1", "cid": "c2"}, jwtTestSecret, "u1", StatusDeny},
+		{"expired", map[string]interface{}{"sub": "u1", "cid": "c1", "exp": float64(time.Now().Add(-time.Hour).Unix())}, jwtTestSecret, "u1", StatusDeny},
+		{"bad signature", map[string]interface{}{"sub": "u1", "cid": "c1"}, "other", "u1", StatusDeny},
+	}
+
+	for _, tt := range tests {
+		if status := a.Password("c1", tt.user, jwtToken(tt.claims, tt.secret)); status != tt.status {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.status, status)
+		}
+	}
+}
+
+func TestJWTUsernameClaim(t *testing.T) {
+	a := newTestJWTAuth(t, JWTConfig{UsernameClaim: "name"})
+
+	if status := a.Password("c1", "u1", jwtToken(map[string]interface{}{"sub": "u1"}, jwtTestSecret)); status != StatusDeny {
+		t.Errorf("token without configured claim: expected %v, got %v", StatusDeny, status)
+	}
+
+	if status := a.Password("c1", "u1", jwtToken(map[string]interface{}{"name": "u1"}, jwtTestSecret)); status != StatusAllow {
+		t.Errorf("token with configured claim: expected %v, got %v", StatusAllow, status)
+	}
+}
+
+func TestJWTConnectionUser(t *testing.T) {
+	a := newTestJWTAuth(t, JWTConfig{})
+
+	if err := Register("jwt-test", a); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	defer UnRegister("jwt-test")
+
+	m, err := NewManager([]string{"jwt-test"}, false)
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+
+	// same user connects with tokens of different projects
+	m1 := m.WithPeer(&Peer{IP: "10.0.0.1"})
+	m2 := m.WithPeer(&Peer{IP: "10.0.0.2"})
+
+	if status := m1.Password("c1", "u1", jwtToken(map[string]interface{}{"sub": "u1", "project_id": "p1"}, jwtTestSecret)); status != StatusAllow {
+		t.Fatalf("connection 1: %v", status)
+	}
+
+	if status := m2.Password("c2", "u1", jwtToken(map[string]interface{}{"sub": "u1", "project_id": "p2"}, jwtTestSecret)); status != StatusAllow {
+		t.Fatalf("connection 2: %v", status)
+	}
+
+	for _, tt := range []struct {
+		m       *Manager
+		project string
+	}{{m1, "p1"}, {m2, "p2"}} {
+		if u := tt.m.FetchUser("u1"); u == nil || u.ProjectId != tt.project {
+			t.Errorf("expected project %s, got %+v", tt.project, u)
+		}
+	}
+
+	// user of the token is not known outside of connection
+	if u := m.FetchUser("u1"); u != nil {
+		t.Errorf("unexpected user %+v", u)
+	}
+}
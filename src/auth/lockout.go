@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLockoutEntries stale entries are swept once lockout tracks more keys than that
+const maxLockoutEntries = 100000
+
+// lockIPPrefix keys of peer ip, counted against IPThreshold
+const lockIPPrefix = "ip:"
+
+// LockoutConfig of the failed login counters
+type LockoutConfig struct {
+	// Threshold failed attempts in a row key is locked after, 5 by default, negative disables lockout
+	Threshold int
+	// IPThreshold failed attempts in a row ip is locked after, 100 by default
+	// ip might be shared by many clients behind NAT, so it is much higher than Threshold
+	IPThreshold int
+	// Base lock duration once threshold is reached, doubles with every further failure up to Max
+	Base time.Duration
+	Max  time.Duration
+	// Window failures are forgotten after key has not failed for that long
+	Window time.Duration
+}
+
+type lockEntry struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+// Lockout failed login counters keyed by username, client id and ip
+// key failed Threshold times in a row is locked for Base, every further failure doubles lock time
+type Lockout struct {
+	lock    sync.Mutex
+	c       LockoutConfig
+	entries map[string]*lockEntry
+}
+
+// NewLockout allocate failed login counters
+func NewLockout(c LockoutConfig) *Lockout {
+	l := &Lockout{
+		entries: make(map[string]*lockEntry),
+	}
+
+	l.SetConfig(c)
+
+	return l
+}
+
+// SetConfig replace configuration, counters are kept
+func (l *Lockout) SetConfig(c LockoutConfig) {
+	if c.Threshold == 0 {
+		c.Threshold = 5
+	}
+
+	if c.IPThreshold <= 0 {
+		c.IPThreshold = 100
+	}
+
+	if c.Base <= 0 {
+		c.Base = time.Minute
+	}
+
+	if c.Max < c.Base {
+		c.Max = time.Hour
+		if c.Max < c.Base {
+			c.Max = c.Base
+		}
+	}
+
+	if c.Window <= 0 {
+		c.Window = 15 * time.Minute
+	}
+
+	l.lock.Lock()
+	l.c = c
+	l.lock.Unlock()
+}
+
+// Locked time lock of any of keys ends at, false if none of them is locked
+func (l *Lockout) Locked(keys ...string) (time.Time, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.c.Threshold < 0 {
+		return time.Time{}, false
+	}
+
+	now := time.Now()
+
+	var until time.Time
+
+	for _, k := range keys {
+		if e, ok := l.entries[k]; ok && now.Before(e.until) && e.until.After(until) {
+			until = e.until
+		}
+	}
+
+	return until, !until.IsZero()
+}
+
+// Failure count failed attempt of every key
+func (l *Lockout) Failure(keys ...string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.c.Threshold < 0 {
+		return
+	}
+
+	now := time.Now()
+
+	if len(l.entries) >= maxLockoutEntries {
+		l.sweep(now)
+	}
+
+	for _, k := range keys {
+		e, ok := l.entries[k]
+		if !ok || now.Sub(e.last) > l.c.Window && now.After(e.until) {
+			e = &lockEntry{}
+			l.entries[k] = e
+		}
+
+		e.failures++
+		e.last = now
+
+		if n := e.failures - l.threshold(k); n >= 0 {
+			d := l.c.Base
+			for i := 0; i < n && d < l.c.Max; i++ {
+				d *= 2
+			}
+
+			if d > l.c.Max {
+				d = l.c.Max
+			}
+
+			e.until = now.Add(d)
+
+			log.Warn("login locked, key:%s, failures:%d, until:%s", k, e.failures, e.until.Format(time.RFC3339))
+		}
+	}
+}
+
+// Success reset counters of keys
+func (l *Lockout) Success(keys ...string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for _, k := range keys {
+		delete(l.entries, k)
+	}
+}
+
+// threshold failed attempts key is locked after
+func (l *Lockout) threshold(k string) int {
+	if strings.HasPrefix(k, lockIPPrefix) {
+		return l.c.IPThreshold
+	}
+
+	return l.c.Threshold
+}
+
+// sweep drop entries which are neither locked nor within window
+func (l *Lockout) sweep(now time.Time) {
+	for k, e := range l.entries {
+		if now.After(e.until) && now.Sub(e.last) > l.c.Window {
+			delete(l.entries, k)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// lockedFor duration key is locked for from now, zero if it is not locked
+func lockedFor(l *Lockout, key string) time.Duration {
+	until, ok := l.Locked(key)
+	if !ok {
+		return 0
+	}
+
+	return time.Until(until)
+}
+
+func TestLockoutThreshold(t *testing.T) {
+	l := NewLockout(LockoutConfig{Threshold: 3, Base: time.Minute, Max: time.Hour})
+
+	for i := 1; i < 3; i++ {
+		l.Failure("username:u1")
+		if _, ok := l.Locked("username:u1"); ok {
+			t.Fatalf("locked after %d failures", i)
+		}
+	}
+
+	l.Failure("username:u1")
+	if _, ok := l.Locked("username:u1"); !ok {
+		t.Fatalf("not locked after 3 failures")
+	}
+
+	if _, ok := l.Locked("username:u2", "clientid:c1"); ok {
+		t.Errorf("other keys locked")
+	}
+
+	if _, ok := l.Locked("clientid:c1", "username:u1"); !ok {
+		t.Errorf("any of locked keys must lock")
+	}
+
+	l.Success("username:u1")
+	if _, ok := l.Locked("username:u1"); ok {
+		t.Errorf("locked after success")
+	}
+
+	l.Failure("username:u1")
+	if _, ok := l.Locked("username:u1"); ok {
+		t.Errorf("counter not reset by success")
+	}
+}
+
+func TestLockoutDisabled(t *testing.T) {
+	l := NewLockout(LockoutConfig{Threshold: -1})
+
+	for i := 0; i < 10; i++ {
+		l.Failure("username:u1")
+	}
+
+	if _, ok := l.Locked("username:u1"); ok {
+		t.Errorf("locked with negative threshold")
+	}
+}
+
+func TestLockoutBackoff(t *testing.T) {
+	l := NewLockout(LockoutConfig{Threshold: 2, Base: time.Minute, Max: 5 * time.Minute})
+
+	l.Failure("username:u1")
+
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		l.Failure("username:u1")
+
+		if d := lockedFor(l, "username:u1"); d > want || d < want-time.Second {
+			t.Errorf("locked for %s, want %s", d, want)
+		}
+	}
+}
+
+func TestLockoutWindow(t *testing.T) {
+	l := NewLockout(LockoutConfig{Threshold: 3, Base: time.Minute, Window: time.Minute})
+
+	l.Failure("username:u1")
+	l.Failure("username:u1")
+
+	// last failure is out of window, counting starts over
+	l.entries["username:u1"].last = time.Now().Add(-2 * time.Minute)
+
+	l.Failure("username:u1")
+	if _, ok := l.Locked("username:u1"); ok {
+		t.Fatalf("failures out of window counted")
+	}
+
+	if n := l.entries["username:u1"].failures; n != 1 {
+		t.Errorf("failures %d, want 1", n)
+	}
+
+	l.Failure("username:u1")
+	l.Failure("username:u1")
+	if _, ok := l.Locked("username:u1"); !ok {
+		t.Fatalf("not locked after 3 failures within window")
+	}
+
+	// lock expired and key has not failed within window, entry is swept
+	e := l.entries["username:u1"]
+	e.until = time.Now().Add(-time.Second)
+	e.last = time.Now().Add(-2 * time.Minute)
+
+	if _, ok := l.Locked("username:u1"); ok {
+		t.Errorf("locked after lock expired")
+	}
+
+	l.sweep(time.Now())
+	if _, ok := l.entries["username:u1"]; ok {
+		t.Errorf("stale entry not swept")
+	}
+}
+
+func TestLockoutIPThreshold(t *testing.T) {
+	l := NewLockout(LockoutConfig{Threshold: 2, IPThreshold: 5})
+
+	for i := 0; i < 4; i++ {
+		l.Failure(lockIPPrefix + "10.0.0.1")
+	}
+
+	if _, ok := l.Locked(lockIPPrefix + "10.0.0.1"); ok {
+		t.Fatalf("ip locked before ip threshold")
+	}
+
+	l.Failure(lockIPPrefix + "10.0.0.1")
+	if _, ok := l.Locked(lockIPPrefix + "10.0.0.1"); !ok {
+		t.Errorf("ip not locked after ip threshold")
+	}
+}
+
+func TestManagerLockout(t *testing.T) {
+	a := NewSimpleAuth()
+	a.AddUser(map[string]string{"name": "u1", "password": "p1", "project_id": "p"})
+	a.AddUser(map[string]string{"name": "u2", "password": "p2", "project_id": "p"})
+
+	m := &Manager{p: []IFace{a}}
+	m.SetGuard(nil, NewLockout(LockoutConfig{Threshold: 2, IPThreshold: 5}))
+
+	peer := &Peer{IP: "10.0.0.1"}
+
+	// clients sharing ip fail with their own credentials
+	for i := 0; i < 4; i++ {
+		id := strconv.Itoa(i)
+		if err := m.WithPeer(peer).Password("c"+id, "other"+id, "bad"); err != StatusDeny {
+			t.Fatalf("bad password: %v", err)
+		}
+	}
+
+	if err := m.WithPeer(peer).Password("c1", "u1", "p1"); err != StatusAllow {
+		t.Fatalf("login from shared ip denied before ip threshold: %v", err)
+	}
+
+	other := &Peer{IP: "10.0.0.2"}
+
+	for i := 0; i < 2; i++ {
+		m.WithPeer(other).Password("c6", "u1", "bad") // nolint: errcheck
+	}
+
+	if err := m.WithPeer(peer).Password("c1", "u1", "p1"); err != StatusDeny {
+		t.Errorf("locked username allowed: %v", err)
+	}
+
+	if err := m.WithPeer(other).Password("c7", "u2", "p2"); err != StatusAllow {
+		t.Errorf("username lock blocked another user: %v", err)
+	}
+
+	// ip reaches its threshold, every client behind it is locked
+	m.WithPeer(peer).Password("c4", "other4", "bad") // nolint: errcheck
+
+	if err := m.WithPeer(peer).Password("c5", "u2", "p2"); err != StatusDeny {
+		t.Errorf("locked ip allowed: %v", err)
+	}
+}
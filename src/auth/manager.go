@@ -3,16 +3,53 @@ package auth
 import (
 	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 )
 
 // Manager auth
 type Manager struct {
 	p         []IFace
 	anonymous bool
+	peer      *Peer
+	// owner provider accepted credentials of the connection, manager bound to peer only
+	owner IFace
+	// user info owner took from credentials of the connection, if any
+	user *User
+	// exchange enhanced authentication in progress and provider started it
+	exchange         Exchange
+	exchangeProvider IFace
+	authUser         string
+	// certUsername and certClientID fields of the client certificate used as identity
+	certUsername string
+	certClientID string
+	// bans and lockout shared by all of connections, nil if not used
+	bans    *BanList
+	lockout *Lockout
+	// exchangeClientID client id of the connection exchange is started for
+	exchangeClientID string
 }
 
 var providers = make(map[string]IFace)
 
+// aclDeny non-zero if access none of providers has decision on is denied, see SetACLDefault
+var aclDeny int32
+
+// SetACLDefault decision of Manager.ACL when none of providers has one, either allow or deny
+// empty is allow, so listeners without acl provider keep granting everything
+func SetACLDefault(def string) error {
+	switch def {
+	case "", "allow":
+		atomic.StoreInt32(&aclDeny, 0)
+	case "deny":
+		atomic.StoreInt32(&aclDeny, 1)
+	default:
+		return ErrInvalidArgs
+	}
+
+	return nil
+}
+
 // Register auth provider
 func Register(name string, i IFace) error {
 	if name == "" && i == nil {
@@ -51,6 +88,87 @@ func NewManager(p []string, allowAnonymous bool) (*Manager, error) {
 	return &m, nil
 }
 
+// WithPeer copy of the manager passing peer to providers implementing PeerIFace
+// copy is used by single connection and remembers provider accepted its credentials
+func (m *Manager) WithPeer(peer *Peer) *Manager {
+	c := *m
+	c.peer = peer
+	c.owner = nil
+	c.user = nil
+	c.exchange = nil
+	c.exchangeProvider = nil
+	c.exchangeClientID = ""
+	c.authUser = ""
+
+	return &c
+}
+
+// SetCertIdentity fields of the verified client certificate, CertCN or CertSAN,
+// taking place of username and client id sent by client, empty to not use certificate.
+// Connection with certificate derived username is authenticated by certificate itself
+func (m *Manager) SetCertIdentity(username, clientID string) error {
+	for _, f := range []string{username, clientID} {
+		switch f {
+		case "", CertCN, CertSAN:
+		default:
+			return ErrInvalidArgs
+		}
+	}
+
+	m.certUsername = username
+	m.certClientID = clientID
+
+	return nil
+}
+
+// CertUsername username derived from certificate of the peer, empty if there is none
+func (m *Manager) CertUsername() string {
+	if len(m.certUsername) == 0 {
+		return ""
+	}
+
+	return m.peer.CertName(m.certUsername)
+}
+
+// CertClientID client id derived from certificate of the peer, empty if there is none
+func (m *Manager) CertClientID() string {
+	if len(m.certClientID) == 0 {
+		return ""
+	}
+
+	return m.peer.CertName(m.certClientID)
+}
+
+// SetGuard ban list checked before credentials and counters of failed logins, either might be nil
+func (m *Manager) SetGuard(bans *BanList, lockout *Lockout) {
+	m.bans = bans
+	m.lockout = lockout
+}
+
+// Banned ban matching client id, username or ip of the peer, nil if there is none
+func (m *Manager) Banned(clientID, user string) *Ban {
+	if m.bans == nil {
+		return nil
+	}
+
+	ip := ""
+	if m.peer != nil {
+		ip = m.peer.IP
+	}
+
+	return m.bans.Banned(clientID, user, ip)
+}
+
+// BannedPeer ban matching ip of the connection, nil if there is none
+// checked once connection accepted, before anything is read from it
+func (m *Manager) BannedPeer(peer *Peer) *Ban {
+	if m.bans == nil || peer == nil {
+		return nil
+	}
+
+	return m.bans.Banned("", "", peer.IP)
+}
+
 // AllowAnonymous allow anonymous connections
 func (m *Manager) AllowAnonymous() error {
 	if m.anonymous {
@@ -61,22 +179,51 @@ func (m *Manager) AllowAnonymous() error {
 }
 
 // Password authentication
+// Username, client id and ip failed too many times in a row are locked and denied without asking providers,
+// ip is locked after IPThreshold failures as it might be shared by many clients
 func (m *Manager) Password(clientID, user, password string) error {
+	if cu := m.CertUsername(); len(cu) > 0 && cu == user {
+		return StatusAllow
+	}
+
 	if user == "" && m.anonymous {
 		return StatusAllow
-	} else {
-		for _, p := range m.p {
-			if status := p.Password(clientID, user, password); status == StatusAllow {
-				return status
+	}
+
+	if m.locked(clientID, user) {
+		return StatusDeny
+	}
+
+	for _, p := range m.p {
+		if status := m.password(p, clientID, user, password); status == StatusAllow {
+			if m.peer != nil {
+				m.owner = p
+				if cu, ok := p.(ClientUserIFace); ok {
+					m.user = cu.ClientUser(clientID, user)
+				}
 			}
+			m.loginSucceeded(clientID, user)
+			return status
 		}
 	}
 
+	m.loginFailed(clientID, user)
+
 	return StatusDeny
 }
 
-// Password authentication
+// FetchUser user info, provider accepted credentials of the connection is asked first
 func (m *Manager) FetchUser(user string) *User {
+	if m.user != nil && m.user.Name == user {
+		return m.user
+	}
+
+	if m.owner != nil {
+		if u := m.owner.GetUser(user); u != nil {
+			return u
+		}
+	}
+
 	for _, p := range m.p {
 		if user := p.GetUser(user); user != nil {
 			return user
@@ -85,13 +232,146 @@ func (m *Manager) FetchUser(user string) *User {
 	return nil
 }
 
+// AuthStart begin enhanced authentication of the connection with method
+// ErrUnknownProvider if none of providers supports method, see AuthContinue for results.
+// Must be called on manager bound to peer only
+func (m *Manager) AuthStart(method, clientID string, data []byte) ([]byte, error) {
+	for _, p := range m.p {
+		if c, ok := p.(ChallengeIFace); ok && c.AuthMethod() == method {
+			if m.locked(clientID, "") {
+				return nil, StatusDeny
+			}
+			m.exchange = c.NewExchange(clientID)
+			m.exchangeProvider = p
+			m.exchangeClientID = clientID
+			return m.AuthContinue(data)
+		}
+	}
+
+	return nil, ErrUnknownProvider
+}
+
+// AuthContinue next step of the exchange started by AuthStart
+// returns data for client along with nil if exchange continues, StatusAllow or StatusDeny once it finished
+func (m *Manager) AuthContinue(data []byte) ([]byte, error) {
+	if m.exchange == nil {
+		return nil, StatusDeny
+	}
+
+	resp, err := m.exchange.Step(data)
+
+	switch err {
+	case nil:
+		return resp, nil
+	case StatusAllow:
+		m.owner = m.exchangeProvider
+		m.authUser = m.exchange.User()
+		m.loginSucceeded(m.exchangeClientID, m.authUser)
+	default:
+		err = StatusDeny
+		m.loginFailed(m.exchangeClientID, m.exchange.User())
+	}
+
+	m.exchange = nil
+	m.exchangeProvider = nil
+
+	return resp, err
+}
+
+// AuthUser user authenticated by last successful exchange
+func (m *Manager) AuthUser() string {
+	return m.authUser
+}
+
+// Expiry time credentials of the connection expire at, zero if they do not expire
+func (m *Manager) Expiry(clientID, user string) time.Time {
+	if e, ok := m.owner.(ExpiryIFace); ok {
+		return e.Expiry(clientID, user)
+	}
+
+	return time.Time{}
+}
+
 // ACL check permissions
+// Providers are asked in order they were given to manager and first one having decision wins.
+// If none of providers has decision SetACLDefault decides, access is granted by default.
+// Providers issuing time limited credentials have decision on connections they authenticated only
 func (m *Manager) ACL(clientID, user, topic string, access AccessType) error {
 	for _, p := range m.p {
-		if status := p.ACL(clientID, user, topic, access); status == StatusAllow {
+		if _, ok := p.(ExpiryIFace); ok && m.peer != nil && p != m.owner {
+			continue
+		}
+
+		switch status := m.acl(p, clientID, user, topic, access); status {
+		case StatusAllow, StatusDeny:
 			return status
 		}
 	}
 
-	return StatusDeny
+	if atomic.LoadInt32(&aclDeny) != 0 {
+		return StatusDeny
+	}
+
+	return StatusAllow
+}
+
+// lockKeys counters of the login attempt, empty values are not counted
+func (m *Manager) lockKeys(clientID, user string, ip bool) []string {
+	var keys []string
+
+	if len(user) > 0 {
+		keys = append(keys, "username:"+user)
+	}
+
+	if len(clientID) > 0 {
+		keys = append(keys, "clientid:"+clientID)
+	}
+
+	if ip && m.peer != nil && len(m.peer.IP) > 0 {
+		keys = append(keys, lockIPPrefix+m.peer.IP)
+	}
+
+	return keys
+}
+
+func (m *Manager) locked(clientID, user string) bool {
+	if m.lockout == nil {
+		return false
+	}
+
+	if until, ok := m.lockout.Locked(m.lockKeys(clientID, user, true)...); ok {
+		log.Debug("login locked, clientId:%s, user:%s, until:%s", clientID, user, until.Format(time.RFC3339))
+		return true
+	}
+
+	return false
+}
+
+func (m *Manager) loginFailed(clientID, user string) {
+	if m.lockout != nil {
+		m.lockout.Failure(m.lockKeys(clientID, user, true)...)
+	}
+}
+
+// loginSucceeded reset counters of username and client id, ip might be shared by many clients and keeps counting
+func (m *Manager) loginSucceeded(clientID, user string) {
+	if m.lockout != nil {
+		m.lockout.Success(m.lockKeys(clientID, user, false)...)
+	}
+}
+
+func (m *Manager) password(p IFace, clientID, user, password string) error {
+	if pp, ok := p.(PeerIFace); ok {
+		return pp.PeerPassword(m.peer, clientID, user, password)
+	}
+
+	return p.Password(clientID, user, password)
+}
+
+func (m *Manager) acl(p IFace, clientID, user, topic string, access AccessType) error {
+	if pp, ok := p.(PeerIFace); ok {
+		return pp.PeerACL(m.peer, clientID, user, topic, access)
+	}
+
+	return p.ACL(clientID, user, topic, access)
 }
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestCertIdentity(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "dev1"}, DNSNames: []string{"dev1.example.com"}}
+
+	m := &Manager{}
+	if err := m.SetCertIdentity(CertCN, CertSAN); err != nil {
+		t.Fatalf("set cert identity: %v", err)
+	}
+
+	if err := m.SetCertIdentity("serial", ""); err != ErrInvalidArgs {
+		t.Errorf("unknown field: got %v, want %v", err, ErrInvalidArgs)
+	}
+
+	tests := []struct {
+		name     string
+		peer     *Peer
+		username string
+		clientID string
+	}{
+		{"certificate", &Peer{IP: "10.0.0.1", Cert: cert}, "dev1", "dev1.example.com"},
+		{"missing certificate", &Peer{IP: "10.0.0.1"}, "", ""},
+		{"no peer", nil, "", ""},
+	}
+
+	for _, tt := range tests {
+		p := m.WithPeer(tt.peer)
+
+		if u := p.CertUsername(); u != tt.username {
+			t.Errorf("%s: username %q, want %q", tt.name, u, tt.username)
+		}
+
+		if id := p.CertClientID(); id != tt.clientID {
+			t.Errorf("%s: client id %q, want %q", tt.name, id, tt.clientID)
+		}
+	}
+
+	// identity is not taken from certificate unless configured
+	if u := (&Manager{}).WithPeer(&Peer{Cert: cert}).CertUsername(); u != "" {
+		t.Errorf("username %q taken from certificate without identity set", u)
+	}
+}
+
+func TestCertPassword(t *testing.T) {
+	a := NewSimpleAuth()
+	a.AddUser(map[string]string{"name": "u1", "password": "p1", "project_id": "p"})
+
+	m := &Manager{p: []IFace{a}}
+	m.SetCertIdentity(CertCN, "") // nolint: errcheck
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "dev1"}}
+
+	tests := []struct {
+		name     string
+		peer     *Peer
+		user     string
+		password string
+		status   error
+	}{
+		{"certificate username", &Peer{Cert: cert}, "dev1", "", StatusAllow},
+		{"other username", &Peer{Cert: cert}, "dev2", "", StatusDeny},
+		{"provider credentials", &Peer{Cert: cert}, "u1", "p1", StatusAllow},
+		{"missing certificate", &Peer{}, "dev1", "", StatusDeny},
+		{"missing certificate credentials", &Peer{}, "u1", "p1", StatusAllow},
+	}
+
+	for _, tt := range tests {
+		if status := m.WithPeer(tt.peer).Password("c1", tt.user, tt.password); status != tt.status {
+			t.Errorf("%s: got %v, want %v", tt.name, status, tt.status)
+		}
+	}
+}
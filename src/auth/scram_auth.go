@@ -0,0 +1,367 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SCRAMSHA256 authentication method of SCRAM-SHA-256, RFC 7677
+const SCRAMSHA256 = "SCRAM-SHA-256"
+
+// SCRAMIterations default iteration count of derived credentials
+const SCRAMIterations = 4096
+
+// SCRAMCredential salted credential of the user, password itself is never stored
+type SCRAMCredential struct {
+	Salt       []byte
+	Iterations int
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// SCRAMUser entry of the scram credentials file
+type SCRAMUser struct {
+	Name string `json:"name"`
+	// Credential in RFC 5803 format SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>
+	Credential string `json:"credential"`
+	ProjectID  string `json:"project_id"`
+}
+
+type scramUser struct {
+	cred      *SCRAMCredential
+	projectID string
+}
+
+type scramAuth struct {
+	sync.RWMutex
+	users map[string]*scramUser
+}
+
+// scramExchange server side of the single SCRAM conversation
+type scramExchange struct {
+	a               *scramAuth
+	step            int
+	user            string
+	cred            *SCRAMCredential
+	gs2Header       string
+	clientFirstBare string
+	serverFirst     string
+	nonce           string
+}
+
+var errSCRAMFormat = errors.New("auth: invalid scram message")
+
+var _ IFace = (*scramAuth)(nil)
+var _ ChallengeIFace = (*scramAuth)(nil)
+
+// NewSCRAMAuth allocate SCRAM-SHA-256 provider, users are added with AddUser or LoadSCRAMUsers
+func NewSCRAMAuth() *scramAuth {
+	return &scramAuth{
+		users: make(map[string]*scramUser),
+	}
+}
+
+// NewSCRAMCredential derive credential from password with random salt
+func NewSCRAMCredential(password string, iterations int) (*SCRAMCredential, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return newSCRAMCredential(password, salt, iterations), nil
+}
+
+func newSCRAMCredential(password string, salt []byte, iterations int) *SCRAMCredential {
+	salted := scramHi([]byte(password), salt, iterations)
+
+	c := &SCRAMCredential{
+		Salt:       salt,
+		Iterations: iterations,
+		ServerKey:  scramHMAC(salted, []byte("Server Key")),
+	}
+
+	clientKey := scramHMAC(salted, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+	c.StoredKey = storedKey[:]
+
+	return c
+}
+
+// ParseSCRAMCredential parse credential in RFC 5803 format
+func ParseSCRAMCredential(s string) (*SCRAMCredential, error) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 3 || parts[0] != SCRAMSHA256 {
+		return nil, errSCRAMFormat
+	}
+
+	salt := strings.Split(parts[1], ":")
+	keys := strings.Split(parts[2], ":")
+	if len(salt) != 2 || len(keys) != 2 {
+		return nil, errSCRAMFormat
+	}
+
+	c := &SCRAMCredential{}
+
+	var err error
+
+	if c.Iterations, err = strconv.Atoi(salt[0]); err != nil || c.Iterations <= 0 {
+		return nil, errSCRAMFormat
+	}
+
+	b64 := base64.StdEncoding
+
+	if c.Salt, err = b64.DecodeString(salt[1]); err != nil {
+		return nil, errSCRAMFormat
+	}
+
+	if c.StoredKey, err = b64.DecodeString(keys[0]); err != nil || len(c.StoredKey) != sha256.Size {
+		return nil, errSCRAMFormat
+	}
+
+	if c.ServerKey, err = b64.DecodeString(keys[1]); err != nil || len(c.ServerKey) != sha256.Size {
+		return nil, errSCRAMFormat
+	}
+
+	return c, nil
+}
+
+// String credential in RFC 5803 format
+func (c *SCRAMCredential) String() string {
+	b64 := base64.StdEncoding
+
+	return SCRAMSHA256 + "$" + strconv.Itoa(c.Iterations) + ":" + b64.EncodeToString(c.Salt) +
+		"$" + b64.EncodeToString(c.StoredKey) + ":" + b64.EncodeToString(c.ServerKey)
+}
+
+// LoadSCRAMUsers read json array of users with credentials from file
+func LoadSCRAMUsers(path string) ([]SCRAMUser, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []SCRAMUser
+	if err = json.Unmarshal(data, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// AddUser derive credential of the user from password
+func (a *scramAuth) AddUser(name, password, projectID string) error {
+	c, err := NewSCRAMCredential(password, SCRAMIterations)
+	if err != nil {
+		return err
+	}
+
+	a.SetCredential(name, c, projectID)
+
+	return nil
+}
+
+// SetCredential add or replace user with salted credential
+func (a *scramAuth) SetCredential(name string, c *SCRAMCredential, projectID string) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.users[name] = &scramUser{
+		cred:      c,
+		projectID: projectID,
+	}
+}
+
+// DelUser remove user
+func (a *scramAuth) DelUser(name string) {
+	a.Lock()
+	defer a.Unlock()
+
+	delete(a.users, name)
+}
+
+// Password SCRAM users authenticate with AUTH exchange only
+func (a *scramAuth) Password(clientID, user, password string) error {
+	return StatusDeny
+}
+
+// ACL provider has no decision on permissions
+func (a *scramAuth) ACL(clientID, user, topic string, access AccessType) error {
+	return ErrNotFound
+}
+
+// GetUser user with project
+func (a *scramAuth) GetUser(user string) *User {
+	a.RLock()
+	defer a.RUnlock()
+
+	if u, ok := a.users[user]; ok {
+		return &User{
+			Name:      user,
+			ProjectId: u.projectID,
+		}
+	}
+
+	return nil
+}
+
+// Shutdown drop users
+func (a *scramAuth) Shutdown() error {
+	a.Lock()
+	defer a.Unlock()
+
+	a.users = make(map[string]*scramUser)
+
+	return nil
+}
+
+// AuthMethod SCRAM-SHA-256
+func (a *scramAuth) AuthMethod() string {
+	return SCRAMSHA256
+}
+
+// NewExchange start conversation with client
+func (a *scramAuth) NewExchange(clientID string) Exchange {
+	return &scramExchange{a: a}
+}
+
+func (a *scramAuth) credential(user string) *SCRAMCredential {
+	a.RLock()
+	defer a.RUnlock()
+
+	if u, ok := a.users[user]; ok {
+		return u.cred
+	}
+
+	return nil
+}
+
+// Step client-first message is answered with server-first, client-final with server-final
+func (e *scramExchange) Step(data []byte) ([]byte, error) {
+	e.step++
+
+	switch e.step {
+	case 1:
+		return e.clientFirst(string(data))
+	case 2:
+		return e.clientFinal(string(data))
+	}
+
+	return nil, StatusDeny
+}
+
+// User authenticated user
+func (e *scramExchange) User() string {
+	return e.user
+}
+
+// clientFirst gs2-header client-first-message-bare, e.g. n,,n=user,r=nonce
+func (e *scramExchange) clientFirst(msg string) ([]byte, error) {
+	// channel binding is not supported, client must send either n or y flag without authzid
+	if !strings.HasPrefix(msg, "n,,") && !strings.HasPrefix(msg, "y,,") {
+		return nil, StatusDeny
+	}
+
+	e.gs2Header = msg[:3]
+	e.clientFirstBare = msg[3:]
+
+	attrs := strings.Split(e.clientFirstBare, ",")
+	if len(attrs) < 2 || !strings.HasPrefix(attrs[0], "n=") || !strings.HasPrefix(attrs[1], "r=") || len(attrs[1]) == 2 {
+		return nil, StatusDeny
+	}
+
+	// saslname escapes , and = as =2C and =3D
+	e.user = strings.NewReplacer("=2C", ",", "=3D", "=").Replace(attrs[0][2:])
+
+	if e.cred = e.a.credential(e.user); e.cred == nil {
+		log.Debug("scram: unknown user:%s", e.user)
+		return nil, StatusDeny
+	}
+
+	nonce := make([]byte, 18)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, StatusDeny
+	}
+
+	e.nonce = attrs[1][2:] + base64.StdEncoding.EncodeToString(nonce)
+	e.serverFirst = "r=" + e.nonce + ",s=" + base64.StdEncoding.EncodeToString(e.cred.Salt) + ",i=" + strconv.Itoa(e.cred.Iterations)
+
+	return []byte(e.serverFirst), nil
+}
+
+// clientFinal c=channel-binding,r=nonce,p=proof
+func (e *scramExchange) clientFinal(msg string) ([]byte, error) {
+	i := strings.LastIndex(msg, ",p=")
+	if i < 0 {
+		return nil, StatusDeny
+	}
+
+	withoutProof := msg[:i]
+
+	proof, err := base64.StdEncoding.DecodeString(msg[i+3:])
+	if err != nil || len(proof) != sha256.Size {
+		return nil, StatusDeny
+	}
+
+	attrs := strings.Split(withoutProof, ",")
+	if len(attrs) < 2 ||
+		attrs[0] != "c="+base64.StdEncoding.EncodeToString([]byte(e.gs2Header)) ||
+		attrs[1] != "r="+e.nonce {
+		return nil, StatusDeny
+	}
+
+	authMessage := []byte(e.clientFirstBare + "," + e.serverFirst + "," + withoutProof)
+
+	// ClientKey = ClientProof XOR HMAC(StoredKey, AuthMessage), StoredKey = H(ClientKey)
+	clientKey := scramHMAC(e.cred.StoredKey, authMessage)
+	for j := range clientKey {
+		clientKey[j] ^= proof[j]
+	}
+
+	storedKey := sha256.Sum256(clientKey)
+	if !hmac.Equal(storedKey[:], e.cred.StoredKey) {
+		log.Debug("scram: invalid proof, user:%s", e.user)
+		return nil, StatusDeny
+	}
+
+	serverSignature := scramHMAC(e.cred.ServerKey, authMessage)
+
+	return []byte("v=" + base64.StdEncoding.EncodeToString(serverSignature)), StatusAllow
+}
+
+func scramHMAC(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data) // nolint: errcheck
+	return mac.Sum(nil)
+}
+
+// scramHi PBKDF2 with HMAC-SHA-256 producing single block, RFC 5802 Hi()
+func scramHi(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, password)
+
+	mac.Write(salt)               // nolint: errcheck
+	mac.Write([]byte{0, 0, 0, 1}) // nolint: errcheck
+	u := mac.Sum(nil)
+
+	result := make([]byte, len(u))
+	copy(result, u)
+
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u) // nolint: errcheck
+		u = mac.Sum(u[:0])
+
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+
+	return result
+}
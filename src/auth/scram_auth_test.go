@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// RFC 7677 section 3 example conversation
+const (
+	rfcClientFirst = "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"
+	rfcServerFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+	rfcClientFinal = "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	rfcServerFinal = "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="
+)
+
+func newRFCExchange(t *testing.T) *scramExchange {
+	salt, _ := base64.StdEncoding.DecodeString("W22ZaJ0SNY7soEsUEjb6gQ==")
+
+	a := NewSCRAMAuth()
+	a.SetCredential("user", newSCRAMCredential("pencil", salt, 4096), "p1")
+
+	e := a.NewExchange("c1").(*scramExchange)
+
+	resp, err := e.Step([]byte(rfcClientFirst))
+	if err != nil {
+		t.Fatalf("client first: %v", err)
+	}
+
+	if !strings.HasPrefix(string(resp), "r=rOprNGfwEbeRWgbNEkqO") || !strings.HasSuffix(string(resp), ",s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096") {
+		t.Fatalf("unexpected server first %s", resp)
+	}
+
+	// server nonce is random, put nonce of the example in place
+	e.nonce = strings.TrimPrefix(strings.Split(rfcServerFirst, ",")[0], "r=")
+	e.serverFirst = rfcServerFirst
+
+	return e
+}
+
+func TestSCRAMRFC7677(t *testing.T) {
+	e := newRFCExchange(t)
+
+	resp, err := e.Step([]byte(rfcClientFinal))
+	if err != StatusAllow {
+		t.Fatalf("client final: expected %v, got %v", StatusAllow, err)
+	}
+
+	if string(resp) != rfcServerFinal {
+		t.Errorf("server final: expected %s, got %s", rfcServerFinal, resp)
+	}
+
+	if e.User() != "user" {
+		t.Errorf("expected user, got %s", e.User())
+	}
+
+	// conversation is over
+	if _, err = e.Step([]byte(rfcClientFinal)); err != StatusDeny {
+		t.Errorf("step after final: expected %v, got %v", StatusDeny, err)
+	}
+}
+
+func TestSCRAMRejected(t *testing.T) {
+	proof := strings.LastIndex(rfcClientFinal, ",p=")
+
+	tests := []struct {
+		name  string
+		final string
+	}{
+		{"bad proof", rfcClientFinal[:proof] + ",p=" + base64.StdEncoding.EncodeToString(make([]byte, 32))},
+		{"nonce mismatch", strings.Replace(rfcClientFinal, "k0,p=", "k1,p=", 1)},
+		{"channel binding mismatch", strings.Replace(rfcClientFinal, "c=biws", "c=eSws", 1)},
+		{"no proof", rfcClientFinal[:proof]},
+	}
+
+	for _, tt := range tests {
+		e := newRFCExchange(t)
+
+		if resp, err := e.Step([]byte(tt.final)); err != StatusDeny || resp != nil {
+			t.Errorf("%s: expected %v, got %v", tt.name, StatusDeny, err)
+		}
+	}
+}
+
+func TestSCRAMClientFirst(t *testing.T) {
+	a := NewSCRAMAuth()
+	if err := a.AddUser("user", "pencil", ""); err != nil {
+		t.Fatalf("add user: %v", err)
+	}
+
+	for _, msg := range []string{
+		"n,,n=unknown,r=abc",
+		"p=tls-unique,,n=user,r=abc",
+		"n,a=admin,n=user,r=abc",
+		"n,,n=user,r=",
+		"n,,r=abc",
+	} {
+		if _, err := a.NewExchange("c1").Step([]byte(msg)); err != StatusDeny {
+			t.Errorf("%s: expected %v, got %v", msg, StatusDeny, err)
+		}
+	}
+}
+
+func TestSCRAMCredentialFormat(t *testing.T) {
+	c, err := NewSCRAMCredential("pencil", SCRAMIterations)
+	if err != nil {
+		t.Fatalf("new credential: %v", err)
+	}
+
+	parsed, err := ParseSCRAMCredential(c.String())
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if parsed.String() != c.String() {
+		t.Errorf("credential changed after parse: %s", parsed)
+	}
+
+	for _, s := range []string{"", "SCRAM-SHA-1$4096:c2FsdA==$a:b", "SCRAM-SHA-256$0:c2FsdA==$a:b", "SCRAM-SHA-256$4096:c2FsdA==$YQ==:YQ=="} {
+		if _, err = ParseSCRAMCredential(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
@@ -81,7 +81,7 @@ func (a *simpleAuth) Password(clientID, user, password string) error {
 
 // nolint: golint
 func (a *simpleAuth) ACL(clientID, user, topic string, access AccessType) error {
-	return StatusAllow
+	return ErrNotFound
 }
 
 // nolint: golint
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"auth"
+	"orm"
+	"time"
+)
+
+var (
+	banList *auth.BanList
+	lockout *auth.Lockout
+)
+
+// dbBans ban list kept in ban table
+type dbBans struct{}
+
+var _ auth.BanStore = (*dbBans)(nil)
+
+// lockoutConfig lockout section of the config, durations in seconds
+type lockoutConfig struct {
+	// Threshold failed logins in a row, negative disables lockout
+	Threshold int `json:"threshold"`
+	// IPThreshold failed logins in a row from single ip
+	IPThreshold int `json:"ip_threshold"`
+	Base        int `json:"base"`
+	Max         int `json:"max"`
+	Window      int `json:"window"`
+}
+
+// LoadBans implements auth.BanStore
+func (d *dbBans) LoadBans() ([]auth.Ban, error) {
+	var rows []Ban
+
+	if _, err := orm.NewOrm().QueryTable("ban").All(&rows); err != nil {
+		return nil, err
+	}
+
+	bans := make([]auth.Ban, 0, len(rows))
+	for _, r := range rows {
+		b := auth.Ban{
+			Kind:    r.Kind,
+			Value:   r.Value,
+			Reason:  r.Reason,
+			Created: r.Created,
+		}
+		if r.Expires > 0 {
+			b.Expires = time.Unix(r.Expires, 0)
+		}
+		bans = append(bans, b)
+	}
+
+	return bans, nil
+}
+
+// SaveBan implements auth.BanStore
+func (d *dbBans) SaveBan(b *auth.Ban) error {
+	o := orm.NewOrm()
+
+	if err := d.delete(o, b.Kind, b.Value); err != nil {
+		return err
+	}
+
+	row := &Ban{
+		Kind:    b.Kind,
+		Value:   b.Value,
+		Reason:  b.Reason,
+		Created: b.Created,
+	}
+
+	if !b.Expires.IsZero() {
+		row.Expires = b.Expires.Unix()
+	}
+
+	_, err := o.Insert(row)
+
+	return err
+}
+
+// DeleteBan implements auth.BanStore
+func (d *dbBans) DeleteBan(kind, value string) error {
+	return d.delete(orm.NewOrm(), kind, value)
+}
+
+func (d *dbBans) delete(o orm.Ormer, kind, value string) error {
+	_, err := o.QueryTable("ban").Filter("kind", kind).Filter("value", value).Delete()
+	return err
+}
+
+// loadLockout read lockout section, defaults of auth.LockoutConfig apply if it is absent
+func loadLockout() (auth.LockoutConfig, error) {
+	lc := lockoutConfig{}
+
+	if _, err := config.GetObject("lockout", &lc); err != nil {
+		return auth.LockoutConfig{}, err
+	}
+
+	return auth.LockoutConfig{
+		Threshold:   lc.Threshold,
+		IPThreshold: lc.IPThreshold,
+		Base:        time.Duration(lc.Base) * time.Second,
+		Max:         time.Duration(lc.Max) * time.Second,
+		Window:      time.Duration(lc.Window) * time.Second,
+	}, nil
+}
+
+// loadGuard create lockout and ban list restored from database
+func loadGuard() error {
+	lc, err := loadLockout()
+	if err != nil {
+		return err
+	}
+
+	if banList, err = auth.NewBanList(&dbBans{}); err != nil {
+		return err
+	}
+
+	lockout = auth.NewLockout(lc)
+
+	return nil
+}
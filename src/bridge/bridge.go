@@ -0,0 +1,769 @@
+package bridge
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+	"github.com/VolantMQ/vlapi/subscriber"
+	"logs"
+	"topics/types"
+	"types"
+)
+
+const (
+	// maxInflight QoS1/2 messages sent to remote broker and not acknowledged yet
+	maxInflight = 100
+
+	// replayBatch persisted messages taken out of persistence at once on connect
+	replayBatch = maxInflight
+
+	// subscription options of v5.0
+	optionNoLocal         mqttp.SubscriptionOptions = 0x04
+	optionRetainPublished mqttp.SubscriptionOptions = 0x08
+
+	// originProperty user property key of the origin tag
+	originProperty = "nicemqtt-origin"
+)
+
+var (
+	log = logs.GetLogger()
+
+	errLinkDown = errors.New("bridge: link is down")
+)
+
+// Bridge forwards messages of configured topics between local and remote brokers
+type Bridge interface {
+	// Shutdown disconnect from remote broker
+	// messages not delivered yet are kept in persistence and sent once bridge started again
+	Shutdown() error
+}
+
+type packetID interface {
+	SetPacketID(mqttp.IDType)
+}
+
+type impl struct {
+	Config
+	topics      topicsTypes.SubscriberInterface
+	persist     persistence.Packets
+	bufferID    []byte
+	out         chan *mqttp.Publish
+	quit        chan struct{}
+	subSignal   chan topicsTypes.SubscribeResp
+	unSubSignal chan topicsTypes.UnSubscribeResp
+	window      chan struct{}
+	wg          sync.WaitGroup
+	access      sync.WaitGroup
+	onStop      sync.Once
+	lock        sync.Mutex
+	// inflight packets sent to remote broker waiting for acknowledgment
+	inflight map[mqttp.IDType]mqttp.IFace
+	// received QoS2 messages waiting for PUBREL
+	received map[mqttp.IDType]bool
+	lastID   mqttp.IDType
+}
+
+var _ topicsTypes.Subscriber = (*impl)(nil)
+
+// New subscribe local topics and start connecting to remote broker
+func New(c Config, topics topicsTypes.SubscriberInterface, persist persistence.Sessions) (Bridge, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	s := &impl{
+		Config:      c,
+		topics:      topics,
+		persist:     persist,
+		bufferID:    []byte(types.BridgeSessionPrefix + c.Name),
+		out:         make(chan *mqttp.Publish, 1024),
+		quit:        make(chan struct{}),
+		subSignal:   make(chan topicsTypes.SubscribeResp),
+		unSubSignal: make(chan topicsTypes.UnSubscribeResp),
+		window:      make(chan struct{}, maxInflight),
+		inflight:    make(map[mqttp.IDType]mqttp.IFace),
+		received:    make(map[mqttp.IDType]bool),
+	}
+
+	err := persist.Create(s.bufferID, &persistence.SessionBase{
+		Timestamp: time.Now().Format(time.RFC3339),
+		Version:   byte(c.Version),
+	})
+
+	if err != nil && err != persistence.ErrAlreadyExists {
+		return nil, err
+	}
+
+	var subscribed []string
+
+	for i := range s.Topics {
+		t := &s.Topics[i]
+		if !t.out() {
+			continue
+		}
+
+		// local messages published by bridge itself are not sent back
+		s.topics.Subscribe(topicsTypes.SubscribeReq{
+			Filter: t.localFilter(),
+			S:      s,
+			Params: &vlsubscriber.SubscriptionParams{
+				Ops: mqttp.SubscriptionOptions(t.QoS) | optionNoLocal | optionRetainPublished,
+			},
+			Chan: s.subSignal,
+		})
+
+		if resp := <-s.subSignal; resp.Err != nil {
+			s.unsubscribe(subscribed)
+			return nil, resp.Err
+		}
+
+		subscribed = append(subscribed, t.localFilter())
+	}
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s, nil
+}
+
+// Shutdown bridge
+func (s *impl) Shutdown() error {
+	s.onStop.Do(func() {
+		var filters []string
+		for i := range s.Topics {
+			if s.Topics[i].out() {
+				filters = append(filters, s.Topics[i].localFilter())
+			}
+		}
+
+		s.unsubscribe(filters)
+		s.access.Wait()
+
+		close(s.quit)
+		s.wg.Wait()
+
+		for drained := false; !drained; {
+			select {
+			case pkt := <-s.out:
+				s.buffer(pkt)
+			default:
+				drained = true
+			}
+		}
+
+		// messages remote has not acknowledged yet are sent again on next start
+		for _, pkt := range s.inflightPackets() {
+			if p, ok := pkt.(*mqttp.Publish); ok {
+				s.buffer(p)
+			}
+		}
+	})
+
+	return nil
+}
+
+func (s *impl) unsubscribe(filters []string) {
+	for _, f := range filters {
+		s.topics.UnSubscribe(topicsTypes.UnSubscribeReq{
+			Filter: f,
+			S:      s,
+			Chan:   s.unSubSignal,
+		})
+
+		if resp := <-s.unSubSignal; resp.Err != nil {
+			log.Error("bridge %s: unsubscribe %s, err:%s", s.Name, f, resp.Err.Error())
+		}
+	}
+}
+
+// Acquire prevent bridge being stopped before active writes finished
+func (s *impl) Acquire() {
+	s.access.Add(1)
+}
+
+// Release bridge once topics provider finished write
+func (s *impl) Release() {
+	s.access.Done()
+}
+
+// Hash returns address of the bridge
+// used as publish id of forwarded messages for No Local check
+func (s *impl) Hash() uintptr {
+	return uintptr(unsafe.Pointer(s))
+}
+
+// GetID client id of the bridge at remote broker
+func (s *impl) GetID() string {
+	return s.ClientID
+}
+
+// IsOnline bridge accepts messages regardless of remote connection state
+func (s *impl) IsOnline() bool {
+	return true
+}
+
+// Publish forward local message to remote broker
+func (s *impl) Publish(p *mqttp.Publish, grantedQoS mqttp.QosType, ops mqttp.SubscriptionOptions, ids []uint32) error {
+	remote, ok := s.remoteTopic(p.Topic())
+	if !ok {
+		return nil
+	}
+
+	pkt, err := p.Clone(s.Version)
+	if err != nil {
+		return err
+	}
+
+	if err = pkt.SetTopic(remote); err != nil {
+		return err
+	}
+
+	if pkt.QoS() > grantedQoS {
+		pkt.SetQoS(grantedQoS) // nolint: errcheck
+	}
+
+	if s.Version == mqttp.ProtocolV50 {
+		if tag, found := origin(pkt); !found {
+			pairs := []mqttp.StringPair{{K: originProperty, V: s.Origin}}
+			if prop := pkt.PropertyGet(mqttp.PropertyUserProperty); prop != nil {
+				existing, _ := prop.AsStringPairs()
+				pairs = append(existing, pairs...)
+			}
+
+			if err = pkt.PropertySet(mqttp.PropertyUserProperty, pairs); err != nil {
+				return err
+			}
+		} else if tag == s.Origin {
+			return nil
+		}
+	}
+
+	select {
+	case s.out <- pkt:
+	default:
+		s.buffer(pkt)
+	}
+
+	return nil
+}
+
+// origin tag of the message if any
+func origin(pkt *mqttp.Publish) (string, bool) {
+	prop := pkt.PropertyGet(mqttp.PropertyUserProperty)
+	if prop == nil {
+		return "", false
+	}
+
+	pairs, _ := prop.AsStringPairs()
+	for _, p := range pairs {
+		if p.K == originProperty {
+			return p.V, true
+		}
+	}
+
+	return "", false
+}
+
+// remoteTopic map local topic to remote
+func (s *impl) remoteTopic(topic string) (string, bool) {
+	for i := range s.Topics {
+		t := &s.Topics[i]
+		if t.out() && topicsTypes.TopicMatch(t.localFilter(), topic) {
+			return t.RemotePrefix + strings.TrimPrefix(topic, t.LocalPrefix), true
+		}
+	}
+
+	return "", false
+}
+
+// localTopic map remote topic to local along with max QoS of the mapping
+func (s *impl) localTopic(topic string) (string, mqttp.QosType, bool) {
+	for i := range s.Topics {
+		t := &s.Topics[i]
+		if t.in() && topicsTypes.TopicMatch(t.remoteFilter(), topic) {
+			return t.LocalPrefix + strings.TrimPrefix(topic, t.RemotePrefix), mqttp.QosType(t.QoS), true
+		}
+	}
+
+	return "", mqttp.QoS0, false
+}
+
+// buffer persist message to be sent once link is up
+func (s *impl) buffer(pkt *mqttp.Publish) {
+	if pkt.QoS() != mqttp.QoS0 {
+		// make sure message has some IDType to prevent encode error
+		pkt.SetPacketID(0)
+	}
+
+	data, err := mqttp.Encode(pkt)
+	if err != nil {
+		log.Error("bridge %s: encode message for persistence, err:%s", s.Name, err.Error())
+		return
+	}
+
+	if err = s.persist.PacketStoreQoS12(s.bufferID, &persistence.PersistedPacket{Data: data}); err != nil {
+		log.Error("bridge %s: persist message, err:%s", s.Name, err.Error())
+	}
+}
+
+// run connect to remote broker and reconnect with backoff once connection lost
+func (s *impl) run() {
+	defer s.wg.Done()
+
+	delay := s.ReconnectMin
+
+	for {
+		l, err := s.connect()
+		if err == nil {
+			log.Info("bridge %s: connected to %s", s.Name, s.Address)
+			delay = s.ReconnectMin
+
+			if !s.serve(l) {
+				return
+			}
+
+			log.Warn("bridge %s: connection to %s lost", s.Name, s.Address)
+		} else {
+			log.Error("bridge %s: connect to %s, err:%s", s.Name, s.Address, err.Error())
+		}
+
+		if !s.wait(delay) {
+			return
+		}
+
+		if delay *= 2; delay > s.ReconnectMax {
+			delay = s.ReconnectMax
+		}
+	}
+}
+
+// wait delay before reconnect attempt, messages forwarded meanwhile are persisted
+// returns false if bridge is stopping
+func (s *impl) wait(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case pkt := <-s.out:
+			s.buffer(pkt)
+		case <-timer.C:
+			return true
+		case <-s.quit:
+			return false
+		}
+	}
+}
+
+// connect establish session with remote broker and subscribe to remote topics
+func (s *impl) connect() (*link, error) {
+	l, err := dial(s.Address, s.TLS, s.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	req := mqttp.NewConnect(s.Version)
+	req.SetClean(s.CleanSession)
+	req.SetKeepAlive(uint16(s.KeepAlive / time.Second))
+
+	if err = req.SetClientID([]byte(s.ClientID)); err == nil && len(s.Username) > 0 {
+		err = req.SetCredentials([]byte(s.Username), []byte(s.Password))
+	}
+
+	if err == nil {
+		err = l.write(req)
+	}
+
+	var resp mqttp.IFace
+	if err == nil {
+		resp, err = l.readPacket(dialTimeout)
+	}
+
+	if err == nil {
+		if ack, ok := resp.(*mqttp.ConnAck); !ok {
+			err = mqttp.CodeProtocolError
+		} else if rc := ack.ReturnCode(); rc != mqttp.CodeSuccess {
+			err = rc
+		}
+	}
+
+	if err == nil {
+		err = s.subscribe(l)
+	}
+
+	if err != nil {
+		l.close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (s *impl) subscribe(l *link) error {
+	req := mqttp.NewSubscribe(s.Version)
+	count := 0
+
+	for i := range s.Topics {
+		t := &s.Topics[i]
+		if !t.in() {
+			continue
+		}
+
+		ops := mqttp.SubscriptionOptions(t.QoS)
+		if s.Version == mqttp.ProtocolV50 {
+			// messages bridge publishes to remote broker are not sent back
+			ops |= optionNoLocal | optionRetainPublished
+		}
+
+		topic, err := mqttp.NewSubscribeTopic([]byte(t.remoteFilter()), ops)
+		if err != nil {
+			return err
+		}
+
+		if err = req.AddTopic(topic); err != nil {
+			return err
+		}
+
+		count++
+	}
+
+	s.lock.Lock()
+	// subscriptions of previous connection are made again
+	for id, pkt := range s.inflight {
+		if _, ok := pkt.(*mqttp.Subscribe); ok {
+			delete(s.inflight, id)
+		}
+	}
+	s.lock.Unlock()
+
+	if count == 0 {
+		return nil
+	}
+
+	s.acquireID(req)
+
+	return l.write(req)
+}
+
+// serve exchange messages with remote broker until connection lost
+// returns false if bridge is stopping
+func (s *impl) serve(l *link) bool {
+	go s.reader(l)
+
+	stopped := false
+
+	defer func() {
+		if stopped {
+			l.write(mqttp.NewDisconnect(s.Version)) // nolint: errcheck
+		}
+		l.close()
+		<-l.done
+	}()
+
+	for _, pkt := range s.inflightPackets() {
+		if p, ok := pkt.(*mqttp.Publish); ok {
+			p.SetDup(true)
+		}
+
+		if l.write(pkt) != nil {
+			return true
+		}
+	}
+
+	s.replay(l)
+
+	ping := time.NewTicker(s.KeepAlive / 2)
+	defer ping.Stop()
+
+	for {
+		select {
+		case pkt := <-s.out:
+			if err := s.send(l, pkt); err != nil {
+				s.buffer(pkt)
+			}
+		case <-ping.C:
+			l.write(mqttp.NewPingReq(s.Version)) // nolint: errcheck
+		case <-l.done:
+			return true
+		case <-s.quit:
+			stopped = true
+			return false
+		}
+	}
+}
+
+// replay send messages persisted while link was down
+// send blocks on inflight window, thus every batch is taken out of persistence first
+// and sent once persistence finished iteration
+func (s *impl) replay(l *link) {
+	for {
+		var batch []*mqttp.Publish
+
+		err := s.persist.PacketsForEachQoS12(s.bufferID, nil, func(_ interface{}, entry *persistence.PersistedPacket) (bool, error) {
+			if len(batch) == replayBatch {
+				return false, nil
+			}
+
+			pkt, _, err := mqttp.Decode(s.Version, entry.Data)
+			if err != nil {
+				log.Error("bridge %s: decode persisted message, err:%s", s.Name, err.Error())
+				return true, nil
+			}
+
+			if p, ok := pkt.(*mqttp.Publish); ok {
+				batch = append(batch, p)
+			}
+
+			return true, nil
+		})
+
+		if err != nil {
+			log.Error("bridge %s: load persisted messages, err:%s", s.Name, err.Error())
+		}
+
+		if len(batch) == 0 {
+			return
+		}
+
+		for i, p := range batch {
+			if s.send(l, p) != nil {
+				// link lost, messages not sent go back to persistence
+				for _, rest := range batch[i:] {
+					s.buffer(rest)
+				}
+				return
+			}
+		}
+	}
+}
+
+// send message to remote broker
+// QoS1/2 messages are kept until acknowledged, thus error is returned only if message has not been sent
+func (s *impl) send(l *link, pkt *mqttp.Publish) error {
+	if pkt.QoS() == mqttp.QoS0 {
+		return l.write(pkt)
+	}
+
+	select {
+	case s.window <- struct{}{}:
+	case <-l.done:
+		return errLinkDown
+	case <-s.quit:
+		return errLinkDown
+	}
+
+	s.acquireID(pkt)
+
+	l.write(pkt) // nolint: errcheck
+
+	return nil
+}
+
+// acquireID assign free packet id and put packet into inflight
+func (s *impl) acquireID(pkt mqttp.IFace) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for {
+		s.lastID++
+		if s.lastID == 0 {
+			s.lastID = 1
+		}
+
+		if _, ok := s.inflight[s.lastID]; !ok {
+			break
+		}
+	}
+
+	pkt.(packetID).SetPacketID(s.lastID)
+	s.inflight[s.lastID] = pkt
+}
+
+// release inflight packet acknowledged by remote broker
+func (s *impl) release(id mqttp.IDType) {
+	s.lock.Lock()
+	pkt, ok := s.inflight[id]
+	delete(s.inflight, id)
+	s.lock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if _, sub := pkt.(*mqttp.Subscribe); !sub {
+		select {
+		case <-s.window:
+		default:
+		}
+	}
+}
+
+// inflightPackets snapshot of inflight packets in order of packet id
+func (s *impl) inflightPackets() []mqttp.IFace {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ids := make([]int, 0, len(s.inflight))
+	for id, pkt := range s.inflight {
+		if _, sub := pkt.(*mqttp.Subscribe); !sub {
+			ids = append(ids, int(id))
+		}
+	}
+
+	sort.Ints(ids)
+
+	packets := make([]mqttp.IFace, 0, len(ids))
+	for _, id := range ids {
+		packets = append(packets, s.inflight[mqttp.IDType(id)])
+	}
+
+	return packets
+}
+
+// reader process packets from remote broker until connection closed
+func (s *impl) reader(l *link) {
+	defer close(l.done)
+	defer l.close()
+
+	// remote broker must respond within keep alive
+	timeout := s.KeepAlive + s.KeepAlive/2
+
+	for {
+		pkt, err := l.readPacket(timeout)
+		if err == nil {
+			err = s.onPacket(l, pkt)
+		}
+
+		if err != nil {
+			select {
+			case <-s.quit:
+			default:
+				log.Warn("bridge %s: read, err:%s", s.Name, err.Error())
+			}
+			return
+		}
+	}
+}
+
+func (s *impl) onPacket(l *link, pkt mqttp.IFace) error {
+	switch m := pkt.(type) {
+	case *mqttp.Publish:
+		return s.onPublish(l, m)
+	case *mqttp.Ack:
+		id, _ := m.ID()
+
+		switch m.Type() {
+		case mqttp.PUBACK, mqttp.PUBCOMP:
+			s.release(id)
+		case mqttp.PUBREC:
+			if s.Version == mqttp.ProtocolV50 && m.Reason() >= mqttp.CodeUnspecifiedError {
+				s.release(id)
+				return nil
+			}
+
+			rel := mqttp.NewPubRel(s.Version)
+			rel.SetPacketID(id)
+
+			s.lock.Lock()
+			s.inflight[id] = rel
+			s.lock.Unlock()
+
+			return l.write(rel)
+		case mqttp.PUBREL:
+			s.lock.Lock()
+			delete(s.received, id)
+			s.lock.Unlock()
+
+			comp := mqttp.NewPubComp(s.Version)
+			comp.SetPacketID(id)
+
+			return l.write(comp)
+		}
+	case *mqttp.SubAck:
+		id, _ := m.ID()
+		s.release(id)
+
+		for _, rc := range m.ReturnCodes() {
+			if rc >= mqttp.CodeUnspecifiedError {
+				log.Error("bridge %s: subscription rejected by %s, code:%d", s.Name, s.Address, rc)
+			}
+		}
+	case *mqttp.Disconnect:
+		return errors.New("bridge: disconnected by remote")
+	}
+
+	return nil
+}
+
+// onPublish deliver remote message to local subscribers and acknowledge it
+func (s *impl) onPublish(l *link, pkt *mqttp.Publish) error {
+	id, _ := pkt.ID()
+	qos := pkt.QoS()
+
+	deliver := true
+
+	if qos == mqttp.QoS2 {
+		s.lock.Lock()
+		deliver = !s.received[id]
+		s.received[id] = true
+		s.lock.Unlock()
+	}
+
+	if deliver {
+		s.deliver(pkt)
+	}
+
+	switch qos {
+	case mqttp.QoS1:
+		ack := mqttp.NewPubAck(s.Version)
+		ack.SetPacketID(id)
+		return l.write(ack)
+	case mqttp.QoS2:
+		rec := mqttp.NewPubRec(s.Version)
+		rec.SetPacketID(id)
+		return l.write(rec)
+	}
+
+	return nil
+}
+
+func (s *impl) deliver(pkt *mqttp.Publish) {
+	if tag, ok := origin(pkt); ok && tag == s.Origin {
+		// message left this broker and came back over another bridge
+		return
+	}
+
+	topic, maxQoS, ok := s.localTopic(pkt.Topic())
+	if !ok {
+		return
+	}
+
+	if err := pkt.SetTopic(topic); err != nil {
+		log.Error("bridge %s: set local topic, err:%s", s.Name, err.Error())
+		return
+	}
+
+	if pkt.QoS() > maxQoS {
+		pkt.SetQoS(maxQoS) // nolint: errcheck
+	}
+
+	// message is not forwarded back to remote broker by No Local of local subscriptions
+	pkt.SetPublishID(s.Hash())
+	pkt.SetPublisher(s.ClientID)
+
+	if pkt.Retain() {
+		if err := s.topics.Retain(pkt); err != nil {
+			log.Error("bridge %s: retain message, err:%s", s.Name, err.Error())
+		}
+	}
+
+	if err := s.topics.Publish(pkt); err != nil {
+		log.Error("bridge %s: publish message, err:%s", s.Name, err.Error())
+	}
+}
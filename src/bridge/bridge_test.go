@@ -0,0 +1,409 @@
+package bridge
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/VolantMQ/vlapi/plugin/persistence/mem"
+	"topics/types"
+	"types"
+)
+
+// local topics manager collecting messages bridge delivers locally
+type local struct {
+	published chan *mqttp.Publish
+}
+
+func (l *local) Publish(m interface{}) error {
+	l.published <- m.(*mqttp.Publish)
+	return nil
+}
+
+func (l *local) Subscribe(req topicsTypes.SubscribeReq) error {
+	go func() {
+		req.Chan <- topicsTypes.SubscribeResp{Granted: req.Params.Ops.QoS()}
+	}()
+	return nil
+}
+
+func (l *local) UnSubscribe(req topicsTypes.UnSubscribeReq) error {
+	go func() {
+		req.Chan <- topicsTypes.UnSubscribeResp{}
+	}()
+	return nil
+}
+
+func (l *local) Retain(types.RetainObject) error { return nil }
+
+func (l *local) Retained(string) ([]*mqttp.Publish, error) { return nil, nil }
+
+// remote broker side of connections bridge dials
+type remote struct {
+	lock    sync.Mutex
+	conns   []net.Conn
+	stopped bool
+	accept  chan net.Conn
+}
+
+func newRemote() *remote {
+	r := &remote{accept: make(chan net.Conn, 4)}
+
+	dialConn = func(string, *tls.Config) (net.Conn, error) {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		if r.stopped {
+			return nil, errors.New("remote stopped")
+		}
+
+		client, server := net.Pipe()
+		r.conns = append(r.conns, server)
+		r.accept <- server
+
+		return client, nil
+	}
+
+	return r
+}
+
+func (r *remote) stop() {
+	r.lock.Lock()
+	r.stopped = true
+	for _, c := range r.conns {
+		c.Close() // nolint: errcheck
+	}
+	r.lock.Unlock()
+}
+
+// session of the remote broker with connected bridge
+type session struct {
+	t *testing.T
+	*link
+}
+
+func (s *session) read() mqttp.IFace {
+	pkt, err := s.readPacket(5 * time.Second)
+	if err != nil {
+		s.t.Fatalf("remote read: %v", err)
+	}
+
+	return pkt
+}
+
+func (s *session) readPublish() *mqttp.Publish {
+	pkt, ok := s.read().(*mqttp.Publish)
+	if !ok {
+		s.t.Fatalf("remote expected PUBLISH")
+	}
+
+	return pkt
+}
+
+func (s *session) readAck(typ mqttp.Type, id mqttp.IDType) {
+	pkt := s.read()
+
+	if ack, ok := pkt.(*mqttp.Ack); !ok || ack.Type() != typ {
+		s.t.Fatalf("remote expected %s, got %s", typ.Name(), pkt.Type().Name())
+	}
+
+	if got, _ := pkt.ID(); got != id {
+		s.t.Fatalf("remote expected %s id %d, got %d", typ.Name(), id, got)
+	}
+}
+
+func (s *session) send(pkt mqttp.IFace) {
+	if err := s.write(pkt); err != nil {
+		s.t.Fatalf("remote write: %v", err)
+	}
+}
+
+func (s *session) ack(pkt *mqttp.Ack, id mqttp.IDType) {
+	pkt.SetPacketID(id)
+	s.send(pkt)
+}
+
+// connected accept connection of the bridge, check CONNECT and grant SUBSCRIBE
+// remote subscriptions of the bridge are returned along with options
+func (r *remote) connected(t *testing.T, v mqttp.ProtocolVersion, clientID string) (*session, map[string]mqttp.SubscriptionOptions) {
+	var conn net.Conn
+
+	select {
+	case conn = <-r.accept:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("bridge did not connect")
+	}
+
+	s := &session{t: t, link: &link{conn: conn, rd: bufio.NewReader(conn), version: v, done: make(chan struct{})}}
+
+	req, ok := s.read().(*mqttp.Connect)
+	if !ok {
+		t.Fatalf("remote expected CONNECT")
+	}
+
+	if req.Version() != v || string(req.ClientID()) != clientID {
+		t.Errorf("unexpected CONNECT version:%d, client id:%s", req.Version(), req.ClientID())
+	}
+
+	ack := mqttp.NewConnAck(v)
+	ack.SetReturnCode(mqttp.CodeSuccess) // nolint: errcheck
+	s.send(ack)
+
+	filters := map[string]mqttp.SubscriptionOptions{}
+
+	sub, ok := s.read().(*mqttp.Subscribe)
+	if !ok {
+		t.Fatalf("remote expected SUBSCRIBE")
+	}
+
+	var codes []mqttp.ReasonCode
+	sub.ForEachTopic(func(tp *mqttp.Topic) error { // nolint: errcheck
+		filters[tp.Full()] = tp.Ops()
+		codes = append(codes, mqttp.ReasonCode(tp.Ops().QoS()))
+		return nil
+	})
+
+	id, _ := sub.ID()
+	suback := mqttp.NewSubAck(v)
+	suback.SetPacketID(id)
+	suback.AddReturnCodes(codes) // nolint: errcheck
+	s.send(suback)
+
+	return s, filters
+}
+
+func testConfig(v mqttp.ProtocolVersion) Config {
+	return Config{
+		Name:         "test",
+		Address:      "remote:1883",
+		Version:      v,
+		ReconnectMin: 10 * time.Millisecond,
+		ReconnectMax: 10 * time.Millisecond,
+		Topics: []Topic{
+			{Pattern: "out/#", Direction: DirectionOut, QoS: 2, LocalPrefix: "l/", RemotePrefix: "r/"},
+			{Pattern: "in/#", Direction: DirectionIn, QoS: 2, LocalPrefix: "l/", RemotePrefix: "r/"},
+		},
+	}
+}
+
+func startBridge(t *testing.T, cfg Config) (*impl, *local, *remote) {
+	r := newRemote()
+	l := &local{published: make(chan *mqttp.Publish, 16)}
+
+	p, _ := persistenceMem.Load(nil, nil)
+	persist, _ := p.Sessions()
+
+	b, err := New(cfg, l, persist)
+	if err != nil {
+		t.Fatalf("new bridge: %v", err)
+	}
+
+	t.Cleanup(func() {
+		r.stop()
+		b.Shutdown() // nolint: errcheck
+		dialConn = nil
+	})
+
+	return b.(*impl), l, r
+}
+
+func localMessage(topic string, qos mqttp.QosType, payload string) *mqttp.Publish {
+	pkt := mqttp.NewPublish(mqttp.ProtocolV50)
+	pkt.Set(topic, []byte(payload), qos, false, false) // nolint: errcheck
+
+	return pkt
+}
+
+func remoteMessage(v mqttp.ProtocolVersion, topic string, qos mqttp.QosType, id mqttp.IDType) *mqttp.Publish {
+	pkt := mqttp.NewPublish(v)
+	pkt.Set(topic, []byte("remote"), qos, false, false) // nolint: errcheck
+	if qos != mqttp.QoS0 {
+		pkt.SetPacketID(id)
+	}
+
+	return pkt
+}
+
+func (l *local) next(t *testing.T) *mqttp.Publish {
+	select {
+	case pkt := <-l.published:
+		return pkt
+	case <-time.After(5 * time.Second):
+		t.Fatalf("message is not delivered locally")
+	}
+
+	return nil
+}
+
+func TestBridgeBothDirectionsV311(t *testing.T) {
+	cfg := testConfig(mqttp.ProtocolV311)
+	cfg.Topics[0].Direction = DirectionBoth
+
+	if err := cfg.validate(); err != ErrBothDirections {
+		t.Errorf("expected %v, got %v", ErrBothDirections, err)
+	}
+
+	cfg = testConfig(mqttp.ProtocolV50)
+	cfg.Topics[0].Direction = DirectionBoth
+
+	if err := cfg.validate(); err != nil {
+		t.Errorf("v5.0 both directions: unexpected error %v", err)
+	}
+}
+
+func TestBridgeConnect(t *testing.T) {
+	for _, v := range []mqttp.ProtocolVersion{mqttp.ProtocolV311, mqttp.ProtocolV50} {
+		b, _, r := startBridge(t, testConfig(v))
+
+		_, filters := r.connected(t, v, "nicemqtt-bridge-test")
+
+		ops, ok := filters["r/in/#"]
+		if !ok || len(filters) != 1 {
+			t.Fatalf("v%d: unexpected remote subscriptions %v", v, filters)
+		}
+
+		// v5.0 remote does not send messages of the bridge back
+		if ops.QoS() != mqttp.QoS2 || ops.NL() != (v == mqttp.ProtocolV50) {
+			t.Errorf("v%d: unexpected subscription options %#x", v, ops.Raw())
+		}
+
+		r.stop()
+		b.Shutdown() // nolint: errcheck
+	}
+}
+
+func TestBridgeForwardOut(t *testing.T) {
+	for _, v := range []mqttp.ProtocolVersion{mqttp.ProtocolV311, mqttp.ProtocolV50} {
+		b, _, r := startBridge(t, testConfig(v))
+		s, _ := r.connected(t, v, "nicemqtt-bridge-test")
+
+		// topic outside of mappings is not forwarded
+		b.Publish(localMessage("l/other", mqttp.QoS1, "x"), mqttp.QoS2, 0, nil) // nolint: errcheck
+		b.Publish(localMessage("l/out/a", mqttp.QoS1, "1"), mqttp.QoS2, 0, nil) // nolint: errcheck
+		b.Publish(localMessage("l/out/b", mqttp.QoS2, "2"), mqttp.QoS2, 0, nil) // nolint: errcheck
+
+		pkt := s.readPublish()
+		id1, _ := pkt.ID()
+		if pkt.Topic() != "r/out/a" || pkt.QoS() != mqttp.QoS1 || string(pkt.Payload()) != "1" {
+			t.Errorf("v%d: unexpected publish %s qos:%d", v, pkt.Topic(), pkt.QoS())
+		}
+
+		pkt = s.readPublish()
+		id2, _ := pkt.ID()
+		if pkt.Topic() != "r/out/b" || pkt.QoS() != mqttp.QoS2 {
+			t.Errorf("v%d: unexpected publish %s qos:%d", v, pkt.Topic(), pkt.QoS())
+		}
+
+		s.ack(mqttp.NewPubAck(v), id1)
+		s.ack(mqttp.NewPubRec(v), id2)
+		s.readAck(mqttp.PUBREL, id2)
+		s.ack(mqttp.NewPubComp(v), id2)
+
+		// QoS0 is not kept inflight
+		b.Publish(localMessage("l/out/c", mqttp.QoS0, "3"), mqttp.QoS2, 0, nil) // nolint: errcheck
+		if pkt = s.readPublish(); pkt.Topic() != "r/out/c" {
+			t.Errorf("v%d: unexpected publish %s", v, pkt.Topic())
+		}
+
+		// acknowledgments are processed by reader asynchronously
+		for deadline := time.Now().Add(5 * time.Second); len(b.inflightPackets()) != 0; {
+			if time.Now().After(deadline) {
+				t.Fatalf("v%d: messages left inflight after acknowledgment", v)
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		r.stop()
+		b.Shutdown() // nolint: errcheck
+	}
+}
+
+func TestBridgeForwardIn(t *testing.T) {
+	for _, v := range []mqttp.ProtocolVersion{mqttp.ProtocolV311, mqttp.ProtocolV50} {
+		b, l, r := startBridge(t, testConfig(v))
+		s, _ := r.connected(t, v, "nicemqtt-bridge-test")
+
+		s.send(remoteMessage(v, "r/in/a", mqttp.QoS1, 7))
+		s.readAck(mqttp.PUBACK, 7)
+
+		if pkt := l.next(t); pkt.Topic() != "l/in/a" || pkt.PublishID() != b.Hash() {
+			t.Errorf("v%d: unexpected local message %s", v, pkt.Topic())
+		}
+
+		// QoS2 retransmitted before PUBREL is delivered once
+		s.send(remoteMessage(v, "r/in/b", mqttp.QoS2, 8))
+		s.readAck(mqttp.PUBREC, 8)
+
+		dup := remoteMessage(v, "r/in/b", mqttp.QoS2, 8)
+		dup.SetDup(true)
+		s.send(dup)
+		s.readAck(mqttp.PUBREC, 8)
+
+		s.ack(mqttp.NewPubRel(v), 8)
+		s.readAck(mqttp.PUBCOMP, 8)
+
+		if pkt := l.next(t); pkt.Topic() != "l/in/b" || pkt.QoS() != mqttp.QoS2 {
+			t.Errorf("v%d: unexpected local message %s", v, pkt.Topic())
+		}
+
+		select {
+		case pkt := <-l.published:
+			t.Errorf("v%d: duplicate delivered %s", v, pkt.Topic())
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		r.stop()
+		b.Shutdown() // nolint: errcheck
+	}
+}
+
+func TestBridgeReplay(t *testing.T) {
+	v := mqttp.ProtocolV50
+	b, _, r := startBridge(t, testConfig(v))
+	s, _ := r.connected(t, v, "nicemqtt-bridge-test")
+
+	b.Publish(localMessage("l/out/1", mqttp.QoS1, "1"), mqttp.QoS2, 0, nil) // nolint: errcheck
+	if pkt := s.readPublish(); pkt.Dup() {
+		t.Errorf("first delivery must not be duplicate")
+	}
+
+	// connection lost before acknowledgment
+	s.conn.Close() // nolint: errcheck
+
+	// messages forwarded while link is down are persisted
+	for _, p := range []string{"2", "3"} {
+		b.Publish(localMessage("l/out/"+p, mqttp.QoS1, p), mqttp.QoS2, 0, nil) // nolint: errcheck
+	}
+
+	s, _ = r.connected(t, v, "nicemqtt-bridge-test")
+
+	pkt := s.readPublish()
+	if pkt.Topic() != "r/out/1" || !pkt.Dup() {
+		t.Errorf("unacknowledged message must be sent again with DUP, got %s dup:%v", pkt.Topic(), pkt.Dup())
+	}
+
+	id, _ := pkt.ID()
+	s.ack(mqttp.NewPubAck(v), id)
+
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		pkt = s.readPublish()
+		got[pkt.Topic()] = true
+
+		id, _ = pkt.ID()
+		s.ack(mqttp.NewPubAck(v), id)
+	}
+
+	if !got["r/out/2"] || !got["r/out/3"] {
+		t.Errorf("persisted messages are not replayed: %v", got)
+	}
+
+	if n, _ := b.persist.PacketCountQoS12(b.bufferID); n != 0 {
+		t.Errorf("%d replayed messages left in persistence", n)
+	}
+}
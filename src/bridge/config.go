@@ -0,0 +1,177 @@
+package bridge
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+	"topics/types"
+)
+
+// Directions messages of the topic are forwarded in
+const (
+	// DirectionOut local messages are forwarded to remote broker
+	DirectionOut = "out"
+	// DirectionIn remote messages are forwarded to local broker
+	DirectionIn = "in"
+	// DirectionBoth messages are forwarded in both directions
+	DirectionBoth = "both"
+)
+
+var (
+	// ErrInvalidName bridge name is not set
+	ErrInvalidName = errors.New("bridge: name is not set")
+	// ErrInvalidAddress address of remote broker is not set
+	ErrInvalidAddress = errors.New("bridge: address is not set")
+	// ErrInvalidVersion protocol version is not one of 3.1.1 or 5.0
+	ErrInvalidVersion = errors.New("bridge: unsupported protocol version")
+	// ErrNoTopics bridge has nothing to forward
+	ErrNoTopics = errors.New("bridge: topics are not set")
+	// ErrInvalidTopic topic mapping is invalid
+	ErrInvalidTopic = errors.New("bridge: invalid topic")
+	// ErrBothDirections direction both used with 3.1.1
+	ErrBothDirections = errors.New("bridge: direction both requires protocol version 5.0")
+)
+
+// Topic mapping between local and remote topics
+// message published to LocalPrefix+Pattern locally is forwarded to RemotePrefix+Pattern remotely
+// and vice versa for in direction
+type Topic struct {
+	// Pattern topic filter relative to prefixes
+	Pattern string `json:"pattern"`
+	// Direction one of in, out or both, out by default
+	Direction string `json:"direction"`
+	// QoS max QoS messages are forwarded with
+	QoS          int    `json:"qos"`
+	LocalPrefix  string `json:"local_prefix"`
+	RemotePrefix string `json:"remote_prefix"`
+}
+
+// Config of the bridge
+type Config struct {
+	// Name unique name of the bridge, used as key of buffered messages
+	Name string
+	// Address host:port of remote broker
+	Address string
+	// Version protocol version of connection to remote broker, 3.1.1 by default
+	Version mqttp.ProtocolVersion
+	// ClientID client id at remote broker, nicemqtt-bridge-{Name} by default
+	ClientID     string
+	Username     string
+	Password     string
+	CleanSession bool
+	KeepAlive    time.Duration
+	// TLS if set connection to remote broker is encrypted
+	TLS *tls.Config
+	// ReconnectMin and ReconnectMax delay before reconnect attempt, doubles after every failure
+	ReconnectMin time.Duration
+	ReconnectMax time.Duration
+	// Origin tag put into user property of forwarded messages, v5.0 only
+	// messages carrying own tag are not forwarded back, ClientID by default
+	Origin string
+	Topics []Topic
+}
+
+func (t *Topic) in() bool {
+	return t.Direction == DirectionIn || t.Direction == DirectionBoth
+}
+
+func (t *Topic) out() bool {
+	return t.Direction == DirectionOut || t.Direction == DirectionBoth
+}
+
+// localFilter filter of the topic in local broker
+func (t *Topic) localFilter() string {
+	return t.LocalPrefix + t.Pattern
+}
+
+// remoteFilter filter of the topic in remote broker
+func (t *Topic) remoteFilter() string {
+	return t.RemotePrefix + t.Pattern
+}
+
+func (t *Topic) validate() error {
+	if len(t.Direction) == 0 {
+		t.Direction = DirectionOut
+	}
+
+	switch t.Direction {
+	case DirectionOut, DirectionIn, DirectionBoth:
+	default:
+		return ErrInvalidTopic
+	}
+
+	if !mqttp.QosType(t.QoS).IsValid() {
+		return ErrInvalidTopic
+	}
+
+	if len(t.Pattern) == 0 || !topicsTypes.TopicSubscribeRegexp.MatchString(t.Pattern) {
+		return ErrInvalidTopic
+	}
+
+	if strings.ContainsAny(t.LocalPrefix+t.RemotePrefix, topicsTypes.MWC+topicsTypes.SWC) {
+		return ErrInvalidTopic
+	}
+
+	return nil
+}
+
+func (c *Config) validate() error {
+	if len(c.Name) == 0 {
+		return ErrInvalidName
+	}
+
+	if len(c.Address) == 0 {
+		return ErrInvalidAddress
+	}
+
+	switch c.Version {
+	case 0:
+		c.Version = mqttp.ProtocolV311
+	case mqttp.ProtocolV311, mqttp.ProtocolV50:
+	default:
+		return ErrInvalidVersion
+	}
+
+	if len(c.Topics) == 0 {
+		return ErrNoTopics
+	}
+
+	for i := range c.Topics {
+		if err := c.Topics[i].validate(); err != nil {
+			return err
+		}
+
+		// 3.1.1 has no No Local, remote broker sends forwarded messages back to the bridge
+		if c.Version == mqttp.ProtocolV311 && c.Topics[i].Direction == DirectionBoth {
+			return ErrBothDirections
+		}
+	}
+
+	if len(c.ClientID) == 0 {
+		c.ClientID = "nicemqtt-bridge-" + c.Name
+	}
+
+	if len(c.Origin) == 0 {
+		c.Origin = c.ClientID
+	}
+
+	if c.KeepAlive <= 0 {
+		c.KeepAlive = 60 * time.Second
+	}
+
+	if c.ReconnectMin <= 0 {
+		c.ReconnectMin = time.Second
+	}
+
+	if c.ReconnectMax < c.ReconnectMin {
+		c.ReconnectMax = 60 * time.Second
+		if c.ReconnectMax < c.ReconnectMin {
+			c.ReconnectMax = c.ReconnectMin
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package bridge
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+// dialTimeout time to establish connection and get CONNACK
+const dialTimeout = 10 * time.Second
+
+// link single connection to remote broker
+type link struct {
+	conn    net.Conn
+	rd      *bufio.Reader
+	version mqttp.ProtocolVersion
+	wLock   sync.Mutex
+	done    chan struct{}
+	onClose sync.Once
+}
+
+// dialConn open connection to remote broker, replaced by tests
+var dialConn = func(address string, tlsConfig *tls.Config) (net.Conn, error) {
+	d := &net.Dialer{Timeout: dialTimeout}
+
+	if tlsConfig != nil {
+		return tls.DialWithDialer(d, "tcp", address, tlsConfig)
+	}
+
+	return d.Dial("tcp", address)
+}
+
+func dial(address string, tlsConfig *tls.Config, version mqttp.ProtocolVersion) (*link, error) {
+	conn, err := dialConn(address, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &link{
+		conn:    conn,
+		rd:      bufio.NewReader(conn),
+		version: version,
+		done:    make(chan struct{}),
+	}, nil
+}
+
+func (l *link) write(pkt mqttp.IFace) error {
+	buf, err := mqttp.Encode(pkt)
+	if err != nil {
+		return err
+	}
+
+	l.wLock.Lock()
+	defer l.wLock.Unlock()
+
+	if _, err = l.conn.Write(buf); err != nil {
+		l.close()
+	}
+
+	return err
+}
+
+func (l *link) close() {
+	l.onClose.Do(func() {
+		l.conn.Close() // nolint: errcheck, gas
+	})
+}
+
+// readPacket read fixed header, remaining length and decode whole packet
+func (l *link) readPacket(timeout time.Duration) (mqttp.IFace, error) {
+	if err := l.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 1, 5)
+
+	b, err := l.rd.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	header[0] = b
+
+	// max length of remaining length is 4 bytes
+	for {
+		if len(header) == 5 {
+			return nil, mqttp.CodeProtocolError
+		}
+
+		if b, err = l.rd.ReadByte(); err != nil {
+			return nil, err
+		}
+
+		header = append(header, b)
+
+		if b < 0x80 {
+			break
+		}
+	}
+
+	remLen, _ := binary.Uvarint(header[1:])
+
+	buf := make([]byte, len(header)+int(remLen))
+	copy(buf, header)
+
+	if _, err = io.ReadFull(l.rd, buf[len(header):]); err != nil {
+		return nil, err
+	}
+
+	pkt, _, err := mqttp.Decode(l.version, buf)
+
+	return pkt, err
+}
@@ -0,0 +1,319 @@
+package clients
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"time"
+
+	"auth"
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+	"systree"
+)
+
+var (
+	// ErrSessionNotFound neither active nor persisted session with given id exists
+	ErrSessionNotFound = errors.New("clients: session not found")
+
+	// ErrSessionActive session has active connection
+	ErrSessionActive = errors.New("clients: session is active")
+)
+
+// ClientInfo connected client as reported by admin API
+type ClientInfo struct {
+	ID          string `json:"id"`
+	Address     string `json:"address"`
+	Username    string `json:"username"`
+	Protocol    string `json:"protocol"`
+	KeepAlive   uint16 `json:"keep_alive"`
+	ConnectedAt string `json:"connected_at"`
+	// Rate messages and bytes per second client publishes at
+	Rate RateInfo `json:"rate"`
+}
+
+// RateInfo current publish rate of the client
+type RateInfo struct {
+	Messages float64 `json:"messages"`
+	Bytes    float64 `json:"bytes"`
+}
+
+// SubscriptionInfo single subscription of the session
+type SubscriptionInfo struct {
+	Filter            string `json:"filter"`
+	QoS               byte   `json:"qos"`
+	Granted           byte   `json:"granted"`
+	ID                uint32 `json:"id,omitempty"`
+	NoLocal           bool   `json:"no_local"`
+	RetainAsPublished bool   `json:"retain_as_published"`
+	RetainHandling    byte   `json:"retain_handling"`
+}
+
+// QueuedInfo count of messages waiting for delivery
+type QueuedInfo struct {
+	QoS0  uint64 `json:"qos0"`
+	QoS12 uint64 `json:"qos12"`
+	UnAck uint64 `json:"unack"`
+	// Dropped messages discarded as offline queue was full
+	Dropped uint64 `json:"dropped"`
+}
+
+// SessionInfo session details as reported by admin API
+type SessionInfo struct {
+	ID            string             `json:"id"`
+	Online        bool               `json:"online"`
+	Persisted     bool               `json:"persisted"`
+	Client        *ClientInfo        `json:"client,omitempty"`
+	Subscriptions []SubscriptionInfo `json:"subscriptions"`
+	Queued        QueuedInfo         `json:"queued"`
+}
+
+func protocolName(v mqttp.ProtocolVersion) string {
+	switch v {
+	case mqttp.ProtocolV31:
+		return "v3.1"
+	case mqttp.ProtocolV311:
+		return "v3.1.1"
+	case mqttp.ProtocolV50:
+		return "v5.0"
+	}
+
+	return "unknown"
+}
+
+func (s *session) info() ClientInfo {
+	msgs, bytes := s.conn.Rates()
+
+	return ClientInfo{
+		ID:          s.id,
+		Address:     s.address,
+		Username:    s.username,
+		Protocol:    protocolName(s.version),
+		KeepAlive:   s.keepAlive,
+		ConnectedAt: s.connectedAt.Format(time.RFC3339),
+		Rate: RateInfo{
+			Messages: msgs,
+			Bytes:    bytes,
+		},
+	}
+}
+
+func (m *Manager) loadSessionContainer(id string) *container {
+	if val, ok := m.sessions.Load(id); ok {
+		return val.(*container)
+	}
+
+	return nil
+}
+
+// Clients list connected clients ordered by client id
+// returns requested page and total count of connected clients
+func (m *Manager) Clients(offset, limit int) ([]ClientInfo, int) {
+	var list []ClientInfo
+
+	m.sessions.Range(func(k, v interface{}) bool {
+		if ses := v.(*container).session(); ses != nil {
+			list = append(list, ses.info())
+		}
+
+		return true
+	})
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	total := len(list)
+
+	if offset > total {
+		offset = total
+	}
+
+	if limit > 0 && offset+limit < total {
+		list = list[offset : offset+limit]
+	} else {
+		list = list[offset:]
+	}
+
+	return list, total
+}
+
+// Session details of either active or persisted session
+func (m *Manager) Session(id string) (*SessionInfo, error) {
+	info := &SessionInfo{
+		ID:            id,
+		Persisted:     m.persistence.Exists([]byte(id)),
+		Subscriptions: []SubscriptionInfo{},
+	}
+
+	cont := m.loadSessionContainer(id)
+
+	if cont == nil && !info.Persisted {
+		return nil, ErrSessionNotFound
+	}
+
+	if cont != nil {
+		ses, sub := cont.snapshot()
+
+		if ses != nil {
+			client := ses.info()
+			info.Online = true
+			info.Client = &client
+
+			qos0, qos12, unAck := ses.conn.Queued()
+			info.Queued.QoS0 = uint64(qos0)
+			info.Queued.QoS12 = uint64(qos12)
+			info.Queued.UnAck = uint64(unAck)
+		}
+
+		if sub != nil {
+			for filter, params := range sub.SubscriptionsCopy() {
+				info.Subscriptions = append(info.Subscriptions, SubscriptionInfo{
+					Filter:            filter,
+					QoS:               byte(params.Ops.QoS()),
+					Granted:           byte(params.Granted),
+					ID:                params.ID,
+					NoLocal:           params.Ops.NL(),
+					RetainAsPublished: params.Ops.RAP(),
+					RetainHandling:    byte(params.Ops.RetainHandling()),
+				})
+			}
+
+			sort.Slice(info.Subscriptions, func(i, j int) bool {
+				return info.Subscriptions[i].Filter < info.Subscriptions[j].Filter
+			})
+		}
+	}
+
+	info.Queued.Dropped = m.offlineDropped(id)
+
+	// offline messages are kept by persistence
+	if !info.Online && info.Persisted {
+		info.Queued.QoS0, _ = m.persistence.PacketCountQoS0([]byte(id))
+		info.Queued.QoS12, _ = m.persistence.PacketCountQoS12([]byte(id))
+		info.Queued.UnAck, _ = m.persistence.PacketCountUnAck([]byte(id))
+	}
+
+	return info, nil
+}
+
+// Disconnect close connection of the active session
+// session state is kept or wiped accordingly to its expiry settings
+func (m *Manager) Disconnect(id string) error {
+	cont := m.loadSessionContainer(id)
+	if cont == nil {
+		return ErrSessionNotFound
+	}
+
+	ses := cont.session()
+	if ses == nil {
+		return ErrSessionNotFound
+	}
+
+	log.Info("disconnect by administrative action, clientId:%s", id)
+	ses.stop(mqttp.CodeAdministrativeAction)
+
+	return nil
+}
+
+// DisconnectUser stop active sessions authenticated as username, returns count of stopped sessions
+func (m *Manager) DisconnectUser(username string) int {
+	return m.disconnect(func(ses *session) bool {
+		return ses.username == username
+	})
+}
+
+// DisconnectBanned stop active sessions matching any of bans, returns count of stopped sessions
+func (m *Manager) DisconnectBanned(bans *auth.BanList) int {
+	return m.disconnect(func(ses *session) bool {
+		ip := ses.address
+		if host, _, err := net.SplitHostPort(ses.address); err == nil {
+			ip = host
+		}
+
+		return bans.Banned(ses.id, ses.username, ip) != nil
+	})
+}
+
+// disconnect stop active sessions selected by match
+func (m *Manager) disconnect(match func(*session) bool) int {
+	var list []*session
+
+	m.sessions.Range(func(k, v interface{}) bool {
+		if ses := v.(*container).session(); ses != nil && match(ses) {
+			list = append(list, ses)
+		}
+
+		return true
+	})
+
+	for _, ses := range list {
+		log.Info("disconnect by administrative action, clientId:%s, user:%s", ses.id, ses.username)
+		ses.stop(mqttp.CodeAdministrativeAction)
+	}
+
+	return len(list)
+}
+
+// DeleteSession wipe state of the offline session including subscriptions, pending expiry and persisted messages
+func (m *Manager) DeleteSession(id string) error {
+	var ns string
+
+	cont := m.loadSessionContainer(id)
+
+	if cont != nil {
+		// prevent connection with same id picking up container while it is being removed
+		cont.acquire()
+		defer cont.release()
+
+		cont.rmLock.Lock()
+		if cont.ses != nil || cont.removed {
+			active := cont.ses != nil
+			cont.rmLock.Unlock()
+
+			if active {
+				return ErrSessionActive
+			}
+
+			return ErrSessionNotFound
+		}
+
+		cont.removed = true
+		cont.rmLock.Unlock()
+
+		if val := cont.expiry.Load(); val != nil {
+			exp := val.(*expiry)
+			ns = exp.namespace
+			if exp.cancel() {
+				m.expiryCount.Done()
+			}
+		}
+
+		if cont.sub != nil {
+			cont.sub.Offline(true)
+			cont.setSubscriber(nil)
+		}
+
+		m.sessions.Delete(id)
+		m.offline.Delete(id)
+		m.sessionsCount.Done()
+	} else if !m.persistence.Exists([]byte(id)) {
+		return ErrSessionNotFound
+	}
+
+	if err := m.persistence.Delete([]byte(id)); err != nil && err != persistence.ErrNotFound {
+		log.Error("delete session, clientId:%s, err:%s", id, err.Error())
+		return err
+	}
+
+	state := &systree.SessionDeletedStatus{
+		Timestamp: time.Now().Format(time.RFC3339),
+		Reason:    "deleted",
+	}
+
+	m.Systree.Sessions().Removed(ns, id, state)
+
+	log.Info("session deleted by administrative action, clientId:%s", id)
+
+	return nil
+}
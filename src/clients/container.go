@@ -41,6 +41,21 @@ func (s *container) session() *session {
 	return s.ses
 }
 
+// snapshot session and subscriber of the container consistent with concurrent connect and disconnect
+func (s *container) snapshot() (*session, *subscriber.Type) {
+	s.rmLock.RLock()
+	defer s.rmLock.RUnlock()
+
+	return s.ses, s.sub
+}
+
+// setSubscriber replace subscriber of the container
+func (s *container) setSubscriber(sub *subscriber.Type) {
+	s.rmLock.Lock()
+	s.sub = sub
+	s.rmLock.Unlock()
+}
+
 func (s *container) swap(from *container) *container {
 	s.ses = from.ses
 
@@ -52,11 +67,14 @@ func (s *container) swap(from *container) *container {
 func (s *container) subscriber(cleanStart bool, c subscriber.Config) *subscriber.Type {
 	if cleanStart && s.sub != nil {
 		s.sub.Offline(true)
-		s.sub = nil
+		s.setSubscriber(nil)
 	}
 
 	if s.sub == nil {
-		s.sub = subscriber.New(c)
+		s.setSubscriber(subscriber.New(c))
+	} else {
+		s.sub.SetPermissions(c.Permissions, c.Username)
+		s.sub.SetNamespace(c.Namespace)
 	}
 
 	return s.sub
@@ -11,12 +11,13 @@ import (
 )
 
 type expiryEvent interface {
-	sessionTimer(string, bool)
+	sessionTimer(string, string, bool)
 }
 
 type expiryConfig struct {
 	expiryEvent
 	id            string
+	namespace     string
 	createdAt     time.Time
 	expiringSince time.Time
 	messenger     types.TopicMessenger
@@ -109,10 +110,10 @@ func (s *expiry) timerCallback() {
 	if s.expireIn == nil {
 		// 2.a session has processed delayed will and there is nothing to do
 		// completely shutdown the session
-		s.sessionTimer(s.id, false)
+		s.sessionTimer(s.id, s.namespace, false)
 	} else if *s.expireIn == 0 {
 		// session has expired. WIPE IT
-		s.sessionTimer(s.id, true)
+		s.sessionTimer(s.id, s.namespace, true)
 	} else {
 		// restart timer and wait again
 		val := *s.expireIn
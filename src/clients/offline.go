@@ -0,0 +1,198 @@
+package clients
+
+import (
+	"errors"
+	"sync"
+
+	"common"
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+)
+
+// Policies applied once offline queue of the session is full
+const (
+	// OverflowDropOldest remove oldest messages to fit new one, messages of the same QoS go first
+	OverflowDropOldest = "drop_oldest"
+	// OverflowDropNewest discard message which does not fit
+	OverflowDropNewest = "drop_newest"
+	// OverflowDropQoS0 remove oldest QoS0 messages to fit new one, QoS1/2 messages are never removed
+	OverflowDropQoS0 = "drop_qos0"
+)
+
+var errEvicted = errors.New("evicted")
+
+// offlineQueue accounting of messages persisted for offline session
+type offlineQueue struct {
+	lock sync.Mutex
+	// loaded false until counts are read from persistence
+	// session being online drains persisted queues, so counts are read again once it goes offline
+	loaded      bool
+	count       [2]int
+	bytes       [2]int
+	dropped     uint64
+	offlineQoS0 bool
+}
+
+// indexes of QoS0 and QoS1/2 queues
+const (
+	queueQoS0 = iota
+	queueQoS12
+)
+
+func (m *Manager) offlineQueue(id string) *offlineQueue {
+	val, _ := m.offline.LoadOrStore(id, &offlineQueue{offlineQoS0: common.CurrentLimits().OfflineQoS0})
+	return val.(*offlineQueue)
+}
+
+// offlineConnected session is online, its persisted queues are drained
+func (m *Manager) offlineConnected(id string, offlineQoS0 bool) {
+	q := m.offlineQueue(id)
+
+	q.lock.Lock()
+	q.loaded = false
+	q.offlineQoS0 = offlineQoS0
+	q.lock.Unlock()
+}
+
+// offlineDropped count of messages dropped from offline queue of the session
+func (m *Manager) offlineDropped(id string) uint64 {
+	if val, ok := m.offline.Load(id); ok {
+		q := val.(*offlineQueue)
+
+		q.lock.Lock()
+		defer q.lock.Unlock()
+
+		return q.dropped
+	}
+
+	return 0
+}
+
+// load counts of messages persistence holds for the session
+func (q *offlineQueue) load(id []byte, p persistence.Packets) {
+	q.count = [2]int{}
+	q.bytes = [2]int{}
+
+	counter := func(queue int) persistence.PacketLoader {
+		return func(_ interface{}, pkt *persistence.PersistedPacket) (bool, error) {
+			q.count[queue]++
+			q.bytes[queue] += len(pkt.Data)
+			return false, nil
+		}
+	}
+
+	p.PacketsForEachQoS0(id, nil, counter(queueQoS0))   // nolint: errcheck
+	p.PacketsForEachQoS12(id, nil, counter(queueQoS12)) // nolint: errcheck
+
+	q.loaded = true
+}
+
+// fits true if message of given size is within limits once messages of skipped queues are removed
+func (q *offlineQueue) fits(l *common.Limits, size int, skip ...int) bool {
+	count, bytes := q.count, q.bytes
+	for _, i := range skip {
+		count[i], bytes[i] = 0, 0
+	}
+
+	return (l.OfflineQueueMax <= 0 || count[0]+count[1]+1 <= l.OfflineQueueMax) &&
+		(l.OfflineQueueBytes <= 0 || bytes[0]+bytes[1]+size <= l.OfflineQueueBytes)
+}
+
+// evict remove oldest messages of the queue until message of given size fits
+// queue is walked without changes, then oldest messages are dropped by single persistence call
+func (m *Manager) evict(l *common.Limits, id []byte, q *offlineQueue, queue int, size int) {
+	forEach, drop := m.persistence.PacketsForEachQoS0, m.persistence.PacketsDropQoS0
+	if queue == queueQoS12 {
+		forEach, drop = m.persistence.PacketsForEachQoS12, m.persistence.PacketsDropQoS12
+	}
+
+	count, bytes := 0, 0
+
+	forEach(id, nil, func(_ interface{}, pkt *persistence.PersistedPacket) (bool, error) { // nolint: errcheck
+		if q.fits(l, size) {
+			return false, errEvicted
+		}
+
+		count++
+		bytes += len(pkt.Data)
+		q.count[queue]--
+		q.bytes[queue] -= len(pkt.Data)
+
+		return false, nil
+	})
+
+	if count == 0 {
+		return
+	}
+
+	if err := drop(id, count); err != nil {
+		log.Error("drop offline messages, clientId:%s, err:%s", string(id), err.Error())
+		// messages are kept, so new one does not fit
+		q.count[queue] += count
+		q.bytes[queue] += bytes
+		return
+	}
+
+	q.dropped += uint64(count)
+	for i := 0; i < count; i++ {
+		m.Systree.Offline().Dropped()
+	}
+}
+
+// enqueueOffline apply limits of the offline queue to message about to be persisted
+// returns false if message must be dropped
+func (m *Manager) enqueueOffline(id string, p *mqttp.Publish, size int) bool {
+	q := m.offlineQueue(id)
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	queue := queueQoS12
+	if p.QoS() == mqttp.QoS0 {
+		if !q.offlineQoS0 {
+			return false
+		}
+		queue = queueQoS0
+	}
+
+	l := common.CurrentLimits()
+
+	if l.OfflineQueueMax > 0 || l.OfflineQueueBytes > 0 {
+		if !q.loaded {
+			q.load([]byte(id), m.persistence)
+		}
+
+		if !q.fits(l, size) {
+			// messages are removed only if that makes room for the new one
+			var order []int
+
+			switch l.OfflineOverflow {
+			case OverflowDropNewest:
+			case OverflowDropQoS0:
+				if q.fits(l, size, queueQoS0) {
+					order = []int{queueQoS0}
+				}
+			default:
+				if q.fits(l, size, queueQoS0, queueQoS12) {
+					order = []int{queue, 1 - queue}
+				}
+			}
+
+			for _, i := range order {
+				m.evict(l, []byte(id), q, i, size)
+			}
+
+			if !q.fits(l, size) {
+				q.dropped++
+				m.Systree.Offline().Dropped()
+				log.Debug("offline queue is full, message dropped, clientId:%s, topic:%s", id, p.Topic())
+				return false
+			}
+		}
+	}
+
+	q.count[queue]++
+	q.bytes[queue] += size
+
+	return true
+}
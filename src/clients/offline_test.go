@@ -0,0 +1,206 @@
+package clients
+
+import (
+	"errors"
+	"testing"
+
+	"common"
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+	persistenceMem "github.com/VolantMQ/vlapi/plugin/persistence/mem"
+	"systree"
+)
+
+type offlineMessage struct {
+	payload string
+	qos     mqttp.QosType
+}
+
+func newOfflineManager(t *testing.T, max int, overflow string) *Manager {
+	prev := common.CurrentLimits()
+	t.Cleanup(func() {
+		common.SetLimits(prev)
+	})
+
+	l := *prev
+	l.OfflineQueueMax, l.OfflineQueueBytes, l.OfflineOverflow = max, 0, overflow
+	common.SetLimits(&l)
+
+	p, _ := persistenceMem.Load(nil, nil)
+	persist, _ := p.Sessions()
+
+	if err := persist.Create([]byte("c"), &persistence.SessionBase{Version: byte(mqttp.ProtocolV311)}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	tree, _, _, err := systree.NewTree("$SYS/servers/test")
+	if err != nil {
+		t.Fatalf("systree: %v", err)
+	}
+
+	return &Manager{
+		persistence: persist,
+		Config:      Config{Systree: tree},
+	}
+}
+
+// offlinePayloads payloads of QoS0 and QoS1/2 messages persisted for session in order
+func offlinePayloads(t *testing.T, m *Manager) (qos0 []string, qos12 []string) {
+	loader := func(out *[]string) persistence.PacketLoader {
+		return func(_ interface{}, pkt *persistence.PersistedPacket) (bool, error) {
+			msg, _, err := mqttp.Decode(mqttp.ProtocolV311, pkt.Data)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+
+			*out = append(*out, string(msg.(*mqttp.Publish).Payload()))
+			return false, nil
+		}
+	}
+
+	m.persistence.PacketsForEachQoS0([]byte("c"), nil, loader(&qos0))   // nolint: errcheck
+	m.persistence.PacketsForEachQoS12([]byte("c"), nil, loader(&qos12)) // nolint: errcheck
+
+	return qos0, qos12
+}
+
+func persistOffline(m *Manager, msg offlineMessage) {
+	pkt := mqttp.NewPublish(mqttp.ProtocolV311)
+	pkt.Set("t", []byte(msg.payload), msg.qos, false, false) // nolint: errcheck
+
+	m.sessionPersistPublish("c", pkt)
+}
+
+func equalPayloads(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestOfflineOverflow(t *testing.T) {
+	tests := []struct {
+		name      string
+		overflow  string
+		messages  []offlineMessage
+		wantQoS0  []string
+		wantQoS12 []string
+		dropped   uint64
+	}{
+		{"drop_oldest same qos", OverflowDropOldest,
+			[]offlineMessage{{"a", mqttp.QoS0}, {"b", mqttp.QoS1}, {"c", mqttp.QoS2}, {"d", mqttp.QoS1}},
+			[]string{"a"}, []string{"c", "d"}, 1},
+		{"drop_oldest qos0", OverflowDropOldest,
+			[]offlineMessage{{"a", mqttp.QoS0}, {"b", mqttp.QoS1}, {"c", mqttp.QoS2}, {"d", mqttp.QoS0}},
+			[]string{"d"}, []string{"b", "c"}, 1},
+		{"drop_oldest other qos", OverflowDropOldest,
+			[]offlineMessage{{"a", mqttp.QoS0}, {"b", mqttp.QoS0}, {"c", mqttp.QoS0}, {"d", mqttp.QoS1}},
+			[]string{"b", "c"}, []string{"d"}, 1},
+		{"drop_newest", OverflowDropNewest,
+			[]offlineMessage{{"a", mqttp.QoS0}, {"b", mqttp.QoS1}, {"c", mqttp.QoS2}, {"d", mqttp.QoS1}, {"e", mqttp.QoS0}},
+			[]string{"a"}, []string{"b", "c"}, 2},
+		{"drop_qos0", OverflowDropQoS0,
+			[]offlineMessage{{"a", mqttp.QoS0}, {"b", mqttp.QoS1}, {"c", mqttp.QoS2}, {"d", mqttp.QoS1}},
+			nil, []string{"b", "c", "d"}, 1},
+		{"drop_qos0 keeps qos12", OverflowDropQoS0,
+			[]offlineMessage{{"a", mqttp.QoS0}, {"b", mqttp.QoS1}, {"c", mqttp.QoS2}, {"d", mqttp.QoS1}, {"e", mqttp.QoS2}, {"f", mqttp.QoS0}},
+			nil, []string{"b", "c", "d"}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newOfflineManager(t, 3, tt.overflow)
+
+			for _, msg := range tt.messages {
+				persistOffline(m, msg)
+			}
+
+			qos0, qos12 := offlinePayloads(t, m)
+
+			if !equalPayloads(qos0, tt.wantQoS0) {
+				t.Errorf("qos0 %v, want %v", qos0, tt.wantQoS0)
+			}
+
+			if !equalPayloads(qos12, tt.wantQoS12) {
+				t.Errorf("qos12 %v, want %v", qos12, tt.wantQoS12)
+			}
+
+			if n := m.offlineDropped("c"); n != tt.dropped {
+				t.Errorf("dropped %d, want %d", n, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestOfflineQoS0Disabled(t *testing.T) {
+	m := newOfflineManager(t, 0, OverflowDropOldest)
+	m.offlineConnected("c", false)
+
+	persistOffline(m, offlineMessage{"a", mqttp.QoS0})
+	persistOffline(m, offlineMessage{"b", mqttp.QoS1})
+
+	qos0, qos12 := offlinePayloads(t, m)
+	if len(qos0) != 0 || !equalPayloads(qos12, []string{"b"}) {
+		t.Errorf("persisted qos0 %v, qos12 %v, want qos1 only", qos0, qos12)
+	}
+}
+
+// dropRecorder persistence recording drops of the oldest QoS1/2 messages
+type dropRecorder struct {
+	persistence.Sessions
+	drops []int
+	err   error
+}
+
+func (d *dropRecorder) PacketsDropQoS12(id []byte, count int) error {
+	if d.err != nil {
+		return d.err
+	}
+
+	d.drops = append(d.drops, count)
+	return d.Sessions.PacketsDropQoS12(id, count)
+}
+
+func TestOfflineEvictDrop(t *testing.T) {
+	m := newOfflineManager(t, 3, OverflowDropOldest)
+	rec := &dropRecorder{Sessions: m.persistence, err: errors.New("disk full")}
+	m.persistence = rec
+
+	for _, p := range []string{"a", "b", "c", "d"} {
+		persistOffline(m, offlineMessage{p, mqttp.QoS1})
+	}
+
+	// messages failed to be dropped are kept and new one does not fit
+	if _, qos12 := offlinePayloads(t, m); !equalPayloads(qos12, []string{"a", "b", "c"}) {
+		t.Errorf("qos12 %v after failed drop, want [a b c]", qos12)
+	}
+
+	if n := m.offlineDropped("c"); n != 1 {
+		t.Errorf("dropped %d, want 1", n)
+	}
+
+	rec.err = nil
+
+	persistOffline(m, offlineMessage{"e", mqttp.QoS1})
+	persistOffline(m, offlineMessage{"f", mqttp.QoS1})
+
+	if _, qos12 := offlinePayloads(t, m); !equalPayloads(qos12, []string{"c", "e", "f"}) {
+		t.Errorf("qos12 %v, want [c e f]", qos12)
+	}
+
+	// oldest message is dropped by single call per new message instead of rewriting queue
+	if len(rec.drops) != 2 || rec.drops[0] != 1 || rec.drops[1] != 1 {
+		t.Errorf("drops %v, want [1 1]", rec.drops)
+	}
+
+	if n := m.offlineDropped("c"); n != 3 {
+		t.Errorf("dropped %d, want 3", n)
+	}
+}
@@ -2,6 +2,7 @@ package clients
 
 import (
 	"logs"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/VolantMQ/vlapi/mqttp"
 	"github.com/VolantMQ/vlapi/plugin/persistence"
 	"github.com/VolantMQ/vlapi/subscriber"
+	"hooks"
 	"types"
 )
 
@@ -19,7 +21,7 @@ var (
 
 type sessionEvents interface {
 	sessionOffline(string, bool, *expiryConfig)
-	connectionClosed(string, mqttp.ReasonCode)
+	connectionClosed(string, string, mqttp.ReasonCode)
 	subscriberShutdown(string, vlsubscriber.IFace)
 }
 
@@ -29,9 +31,12 @@ type sessionPreConfig struct {
 	messenger   types.TopicMessenger
 	conn        connection.Session
 	persistence persistence.Packets
-	permissions auth.Permissions
+	permissions *auth.Manager
 	username    string
 	projectId   string
+	// namespace topic namespace of the project, empty if project isolation is off
+	namespace string
+	hooks     hooks.Sink
 }
 
 type sessionConfig struct {
@@ -41,7 +46,14 @@ type sessionConfig struct {
 	expireIn            *uint32
 	durable             bool
 	sharedSubscriptions bool
-	version             mqttp.ProtocolVersion
+	// wildcardSubscriptions and subscriptionIDs availability advertised in CONNACK
+	wildcardSubscriptions bool
+	subscriptionIDs       bool
+	version               mqttp.ProtocolVersion
+	address               string
+	keepAlive             uint16
+	// connectedAt time current connection of the session was established
+	connectedAt time.Time
 }
 
 type session struct {
@@ -49,6 +61,8 @@ type session struct {
 	idLock  *sync.Mutex
 	lock    sync.Mutex
 	stopReq types.Once
+	// authTimer stops session once credentials of the connection expire
+	authTimer *time.Timer
 	sessionConfig
 }
 
@@ -76,10 +90,47 @@ func (s *session) stop(reason mqttp.ReasonCode) {
 	})
 }
 
+// expireAt stop session when credentials of the connection expire
+func (s *session) expireAt(t time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.authTimer = time.AfterFunc(time.Until(t), func() {
+		log.Info("credentials expired, clientId:%s", s.id)
+		s.stop(mqttp.CodeNotAuthorized)
+	})
+}
+
+// newEvent hook event of the session client
+func (s *session) newEvent(t string) *hooks.Event {
+	e := hooks.NewEvent(t, s.id)
+	e.Username = s.username
+	e.Namespace = s.namespace
+
+	return e
+}
+
 // SignalPublish process PUBLISH packet from client
 func (s *session) SignalPublish(pkt *mqttp.Publish) error {
 	log.Debug("publish pkt:%v", pkt)
 	pkt.SetPublishID(s.subscriber.Hash())
+	pkt.SetPublisher(s.id)
+
+	if s.hooks != nil {
+		e := s.newEvent(hooks.EventPublished)
+		e.Topic = pkt.Topic()
+		e.QoS = byte(pkt.QoS())
+		e.Retain = pkt.Retain()
+		e.Payload = pkt.Payload()
+		s.hooks.Notify(e)
+	}
+
+	if len(s.namespace) > 0 {
+		if err := pkt.SetTopic(types.NamespaceTopic(s.namespace, pkt.Topic())); err != nil {
+			log.Error("set namespace topic, clientId:%s, err:%s", s.id, err.Error())
+			return nil
+		}
+	}
 
 	// [MQTT-3.3.1.3]
 	if pkt.Retain() {
@@ -122,6 +173,11 @@ func (s *session) SignalSubscribe(pkt *mqttp.Subscribe) (mqttp.IFace, error) {
 
 	// V5.0 [MQTT-3.8.2.1.2]
 	if prop := pkt.PropertyGet(mqttp.PropertySubscriptionIdentifier); prop != nil {
+		// [MQTT-3.2.2.3.12] identifiers are not allowed if server told it does not support them
+		if !s.subscriptionIDs {
+			return nil, mqttp.CodeSubscriptionIDNotSupported
+		}
+
 		if v, e := prop.AsInt(); e == nil {
 			subsID = v
 		}
@@ -148,17 +204,37 @@ func (s *session) SignalSubscribe(pkt *mqttp.Subscribe) (mqttp.IFace, error) {
 	err = pkt.ForEachTopic(func(t *mqttp.Topic) error {
 		log.Info("subscribe topic:%s", t.Filter())
 		var reason mqttp.ReasonCode
-		if e := s.permissions.ACL(s.id, s.username, t.Filter(), auth.AccessRead); e == auth.StatusAllow {
+
+		// [MQTT-3.2.2.3.11] wildcard filters are refused if server told it does not support them
+		if !s.wildcardSubscriptions && strings.ContainsAny(t.Filter(), "#+") {
+			reason = mqttp.QosFailure
+			if s.version == mqttp.ProtocolV50 {
+				reason = mqttp.CodeWildcardSubscriptionsNotSupported
+			}
+
+			retCodes = append(retCodes, reason)
+			return nil
+		}
+
+		if e := guardNamespace(s.permissions, s.namespace).ACL(s.id, s.username, t.Filter(), auth.AccessSubscribe); e == auth.StatusAllow {
 			params := vlsubscriber.SubscriptionParams{
 				ID:  subsID,
 				Ops: t.Ops(),
 			}
 
-			if retained, e := s.subscriber.Subscribe(t.Filter(), &params); e != nil {
+			// shared subscriptions are kept with $share/{ShareName}/ prefix
+			if retained, e := s.subscriber.Subscribe(types.NamespaceFilter(s.namespace, t.Full()), &params); e != nil {
 				reason = mqttp.QosFailure
 			} else {
 				reason = mqttp.ReasonCode(params.Granted)
 				retainedPublishes = append(retainedPublishes, retained...)
+
+				if s.hooks != nil {
+					e := s.newEvent(hooks.EventSubscribed)
+					e.Topic = t.Full()
+					e.QoS = byte(params.Granted)
+					s.hooks.Notify(e)
+				}
 			}
 		} else {
 			// [MQTT-3.9.3]
@@ -180,6 +256,9 @@ func (s *session) SignalSubscribe(pkt *mqttp.Subscribe) (mqttp.IFace, error) {
 	// Now put retained messages into publish queue
 	for _, rp := range retainedPublishes {
 		if p, e := rp.Clone(s.version); e == nil {
+			if topic, ok := types.StripNamespace(s.namespace, p.Topic()); !ok || p.SetTopic(topic) != nil {
+				continue
+			}
 			p.SetRetain(true)
 			s.conn.Publish(s.id, p)
 		} else {
@@ -197,10 +276,14 @@ func (s *session) SignalUnSubscribe(pkt *mqttp.UnSubscribe) (mqttp.IFace, error)
 
 	pkt.ForEachTopic(func(t *mqttp.Topic) error {
 		reason := mqttp.CodeSuccess
-		if e := s.permissions.ACL(s.id, s.username, t.Full(), auth.AccessRead); e == auth.StatusAllow {
-			if e = s.subscriber.UnSubscribe(t.Full()); e != nil {
+		if e := s.permissions.ACL(s.id, s.username, t.Filter(), auth.AccessSubscribe); e == auth.StatusAllow {
+			if e = s.subscriber.UnSubscribe(types.NamespaceFilter(s.namespace, t.Full())); e != nil {
 				log.Error("unsubscribe from topic, clientId:%s, err:%s", s.id, e.Error())
 				reason = mqttp.CodeNoSubscriptionExisted
+			} else if s.hooks != nil {
+				e := s.newEvent(hooks.EventUnsubscribed)
+				e.Topic = t.Full()
+				s.hooks.Notify(e)
 			}
 		} else {
 			// [MQTT-3.9.3]
@@ -227,6 +310,43 @@ func (s *session) SignalUnSubscribe(pkt *mqttp.UnSubscribe) (mqttp.IFace, error)
 	return resp, nil
 }
 
+// signalAuth process AUTH packet of re-authentication
+// client must authenticate with same method and as same user connection was established with
+func (s *session) signalAuth(params *connection.AuthParams) (mqttp.IFace, error) {
+	var data []byte
+	var status error
+
+	if params.Reason == mqttp.CodeReAuthenticate {
+		data, status = s.permissions.AuthStart(params.AuthMethod, s.id, params.AuthData)
+	} else {
+		data, status = s.permissions.AuthContinue(params.AuthData)
+	}
+
+	if status == auth.StatusAllow && s.permissions.AuthUser() != s.username {
+		status = auth.StatusDeny
+	}
+
+	pkt := mqttp.NewAuth(s.version)
+
+	switch status {
+	case nil:
+		pkt.SetReasonCode(mqttp.CodeContinueAuthentication) // nolint: errcheck
+	case auth.StatusAllow:
+		pkt.SetReasonCode(mqttp.CodeSuccess) // nolint: errcheck
+	default:
+		// [MQTT-4.12.1-2] connection is closed with DISCONNECT if re-authentication fails
+		log.Info("re-authentication failed, clientId:%s", s.id)
+		return nil, mqttp.CodeNotAuthorized
+	}
+
+	pkt.PropertySet(mqttp.PropertyAuthMethod, params.AuthMethod) // nolint: errcheck
+	if len(data) > 0 {
+		pkt.PropertySet(mqttp.PropertyAuthData, data) // nolint: errcheck
+	}
+
+	return pkt, nil
+}
+
 // SignalDisconnect process DISCONNECT packet from client
 func (s *session) SignalDisconnect(pkt *mqttp.Disconnect) (mqttp.IFace, error) {
 	var err error
@@ -271,6 +391,13 @@ func (s *session) SignalOffline() {
 
 // SignalConnectionClose net connection has been closed
 func (s *session) SignalConnectionClose(params connection.DisconnectParams) {
+	s.lock.Lock()
+	if s.authTimer != nil {
+		s.authTimer.Stop()
+		s.authTimer = nil
+	}
+	s.lock.Unlock()
+
 	// If session expiry is set to 0, the Session ends when the Network Connection is closed
 	if s.expireIn != nil && *s.expireIn == 0 {
 		s.durable = true
@@ -292,7 +419,13 @@ func (s *session) SignalConnectionClose(params connection.DisconnectParams) {
 		s.will = nil
 	}
 
-	s.connectionClosed(s.id, params.Reason)
+	s.connectionClosed(s.id, s.namespace, params.Reason)
+
+	if s.hooks != nil {
+		e := s.newEvent(hooks.EventDisconnected)
+		e.Reason = params.Reason.Desc()
+		s.hooks.Notify(e)
+	}
 
 	keepContainer := (s.durable && s.subscriber.HasSubscriptions()) || (willIn > 0)
 
@@ -315,6 +448,7 @@ func (s *session) SignalConnectionClose(params connection.DisconnectParams) {
 		if willIn > 0 || (s.expireIn != nil && *s.expireIn > 0) {
 			exp = &expiryConfig{
 				id:        s.id,
+				namespace: s.namespace,
 				createdAt: s.createdAt,
 				messenger: s.messenger,
 				will:      s.will,
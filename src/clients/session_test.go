@@ -0,0 +1,233 @@
+package clients
+
+import (
+	"testing"
+
+	"auth"
+	"common"
+	"connection"
+	"github.com/VolantMQ/vlapi/mqttp"
+	"subscriber"
+	"topics/memLockFree"
+	"topics/types"
+	"types"
+)
+
+// newTopics in-memory topics provider, stopped once test finishes
+func newTopics(t *testing.T) topicsTypes.Provider {
+	p, err := memLockFree.NewMemProvider(topicsTypes.NewMemConfig())
+	if err != nil {
+		t.Fatalf("topics provider: %v", err)
+	}
+
+	t.Cleanup(func() {
+		p.Shutdown() // nolint: errcheck
+	})
+
+	return p
+}
+
+// allowAll auth provider granting every access
+type allowAll struct{}
+
+func (allowAll) ACL(clientID, user, topic string, access auth.AccessType) error {
+	return auth.StatusAllow
+}
+
+func (allowAll) Password(clientID, user, password string) error { return auth.StatusAllow }
+
+func (allowAll) Shutdown() error { return nil }
+
+func (allowAll) GetUser(user string) *auth.User { return nil }
+
+func init() {
+	auth.Register("allow", allowAll{}) // nolint: errcheck
+}
+
+func newTestSession(t *testing.T, v mqttp.ProtocolVersion, wildcard bool, maxQoS mqttp.QosType) *session {
+	permissions, _ := auth.NewManager([]string{"allow"}, false)
+
+	s := newSession(sessionPreConfig{
+		id:          "c",
+		permissions: permissions,
+	})
+
+	s.sessionConfig = sessionConfig{
+		subscriber:            subscriber.New(subscriber.Config{ID: "c", Topics: newTopics(t), Version: v, MaxQoS: maxQoS}),
+		wildcardSubscriptions: wildcard,
+		version:               v,
+	}
+
+	return s
+}
+
+func subscribe(t *testing.T, s *session, filters map[string]mqttp.QosType, order []string) []mqttp.ReasonCode {
+	pkt := mqttp.NewSubscribe(s.version)
+	pkt.SetPacketID(1)
+
+	for _, f := range order {
+		topic, err := mqttp.NewSubscribeTopic([]byte(f), mqttp.SubscriptionOptions(filters[f]))
+		if err != nil {
+			t.Fatalf("topic %s: %v", f, err)
+		}
+
+		if err = pkt.AddTopic(topic); err != nil {
+			t.Fatalf("topic %s: %v", f, err)
+		}
+	}
+
+	resp, err := s.SignalSubscribe(pkt)
+	if err != nil {
+		t.Fatalf("v%d: subscribe: %v", s.version, err)
+	}
+
+	return resp.(*mqttp.SubAck).ReturnCodes()
+}
+
+func TestSubscribeCapabilities(t *testing.T) {
+	filters := map[string]mqttp.QosType{
+		"a/b": mqttp.QoS2,
+		"a/+": mqttp.QoS1,
+		"a/#": mqttp.QoS0,
+		"c":   mqttp.QoS0,
+	}
+	order := []string{"a/b", "a/+", "a/#", "c"}
+
+	tests := []struct {
+		version  mqttp.ProtocolVersion
+		wildcard bool
+		maxQoS   mqttp.QosType
+		codes    []mqttp.ReasonCode
+	}{
+		{mqttp.ProtocolV311, true, mqttp.QoS2, []mqttp.ReasonCode{0x02, 0x01, 0x00, 0x00}},
+		{mqttp.ProtocolV311, false, mqttp.QoS1, []mqttp.ReasonCode{0x01, mqttp.QosFailure, mqttp.QosFailure, 0x00}},
+		{mqttp.ProtocolV50, true, mqttp.QoS0, []mqttp.ReasonCode{0x00, 0x00, 0x00, 0x00}},
+		{mqttp.ProtocolV50, false, mqttp.QoS1, []mqttp.ReasonCode{0x01, mqttp.CodeWildcardSubscriptionsNotSupported,
+			mqttp.CodeWildcardSubscriptionsNotSupported, 0x00}},
+	}
+
+	for _, tt := range tests {
+		s := newTestSession(t, tt.version, tt.wildcard, tt.maxQoS)
+		codes := subscribe(t, s, filters, order)
+
+		if len(codes) != len(tt.codes) {
+			t.Fatalf("v%d: expected %d return codes, got %d", tt.version, len(tt.codes), len(codes))
+		}
+
+		for i := range codes {
+			if codes[i] != tt.codes[i] {
+				t.Errorf("v%d: wildcard %v, max QoS%d, filter %s: expected %#x, got %#x",
+					tt.version, tt.wildcard, tt.maxQoS, order[i], byte(tt.codes[i]), byte(codes[i]))
+			}
+		}
+
+		if _, ok := s.subscriber.Subscriptions()["a/+"]; ok != tt.wildcard {
+			t.Errorf("v%d: wildcard %v: unexpected wildcard subscription state", tt.version, tt.wildcard)
+		}
+	}
+}
+
+func TestSubscribeIDNotSupported(t *testing.T) {
+	s := newTestSession(t, mqttp.ProtocolV50, true, mqttp.QoS2)
+
+	pkt := mqttp.NewSubscribe(mqttp.ProtocolV50)
+	pkt.SetPacketID(1)
+	if err := pkt.PropertySet(mqttp.PropertySubscriptionIdentifier, uint32(1)); err != nil {
+		t.Fatalf("set subscription identifier: %v", err)
+	}
+
+	if _, err := s.SignalSubscribe(pkt); err != mqttp.CodeSubscriptionIDNotSupported {
+		t.Errorf("expected %v, got %v", mqttp.CodeSubscriptionIDNotSupported, err)
+	}
+}
+
+func TestSubscribeForeignNamespace(t *testing.T) {
+	common.ProjectIsolation = true
+	defer func() { common.ProjectIsolation = false }()
+
+	filters := map[string]mqttp.QosType{
+		"a/b":           mqttp.QoS1,
+		"$project/p2/#": mqttp.QoS1,
+		"$SYS/#":        mqttp.QoS0,
+	}
+	order := []string{"a/b", "$project/p2/#", "$SYS/#"}
+
+	expected := map[mqttp.ProtocolVersion][]mqttp.ReasonCode{
+		mqttp.ProtocolV311: {0x01, mqttp.QosFailure, mqttp.QosFailure},
+		mqttp.ProtocolV50:  {0x01, mqttp.CodeNotAuthorized, mqttp.CodeNotAuthorized},
+	}
+
+	for v, codes := range expected {
+		s := newTestSession(t, v, true, mqttp.QoS2)
+
+		for i, c := range subscribe(t, s, filters, order) {
+			if c != codes[i] {
+				t.Errorf("v%d: filter %s: expected %#x, got %#x", v, order[i], byte(codes[i]), byte(c))
+			}
+		}
+	}
+
+	// clients of project have filters placed into own namespace
+	s := newTestSession(t, mqttp.ProtocolV50, true, mqttp.QoS2)
+	s.namespace = "p1"
+
+	if c := subscribe(t, s, filters, []string{"$project/p2/#"}); c[0] != 0x01 {
+		t.Errorf("namespaced client: expected granted QoS1, got %#x", byte(c[0]))
+	}
+
+	if _, ok := s.subscriber.Subscriptions()[types.NamespaceFilter("p1", "$project/p2/#")]; !ok {
+		t.Errorf("namespaced client: filter not placed into namespace")
+	}
+}
+
+// plainExchange authentication method finishing at first step with user sent as data
+type plainExchange struct {
+	allowAll
+	user string
+}
+
+func (*plainExchange) AuthMethod() string { return "PLAIN-TEST" }
+
+func (*plainExchange) NewExchange(string) auth.Exchange { return &plainExchange{} }
+
+func (e *plainExchange) Step(data []byte) ([]byte, error) {
+	e.user = string(data)
+	return nil, auth.StatusAllow
+}
+
+func (e *plainExchange) User() string { return e.user }
+
+func TestReAuthDifferentUser(t *testing.T) {
+	auth.Register("plain-test", &plainExchange{}) // nolint: errcheck
+	defer auth.UnRegister("plain-test")
+
+	m, _ := auth.NewManager([]string{"plain-test"}, false)
+
+	s := newTestSession(t, mqttp.ProtocolV50, true, mqttp.QoS2)
+	s.username = "user"
+	s.permissions = m.WithPeer(&auth.Peer{})
+
+	for _, tt := range []struct {
+		user string
+		err  error
+	}{
+		{"user", nil},
+		{"other", mqttp.CodeNotAuthorized},
+	} {
+		resp, err := s.signalAuth(&connection.AuthParams{
+			AuthMethod: "PLAIN-TEST",
+			AuthData:   []byte(tt.user),
+			Reason:     mqttp.CodeReAuthenticate,
+		})
+
+		if err != tt.err {
+			t.Errorf("re-authenticate as %s: expected %v, got %v", tt.user, tt.err, err)
+		}
+
+		if err == nil {
+			if pkt, ok := resp.(*mqttp.Auth); !ok || pkt.ReasonCode() != mqttp.CodeSuccess {
+				t.Errorf("re-authenticate as %s: expected AUTH success", tt.user)
+			}
+		}
+	}
+}
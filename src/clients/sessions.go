@@ -6,8 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/schollz/progressbar"
+	"hooks"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -38,6 +40,8 @@ type Config struct {
 	Systree          systree.Provider
 	OnReplaceAttempt func(string, bool)
 	NodeName         string
+	// Hooks receives client and message events, nil if no hooks configured
+	Hooks hooks.Sink
 }
 
 type preloadConfig struct {
@@ -47,11 +51,13 @@ type preloadConfig struct {
 
 // Manager clients manager
 type Manager struct {
-	persistence     persistence.Sessions
-	quit            chan struct{}
-	sessionsCount   sync.WaitGroup
-	expiryCount     sync.WaitGroup
-	sessions        sync.Map
+	persistence   persistence.Sessions
+	quit          chan struct{}
+	sessionsCount sync.WaitGroup
+	expiryCount   sync.WaitGroup
+	sessions      sync.Map
+	// offline accounting of offline queues by session id
+	offline         sync.Map
 	plSubscribers   map[string]vlsubscriber.IFace
 	allowedVersions map[mqttp.ProtocolVersion]bool
 	Config
@@ -177,6 +183,15 @@ func (m *Manager) Stop() error {
 
 		if ses != nil {
 			ses.stop(mqttp.CodeServerShuttingDown)
+
+			// container of durable session is kept when its connection stopped
+			wrap.rmLock.Lock()
+			kept := !wrap.removed
+			wrap.rmLock.Unlock()
+
+			if kept {
+				m.sessionsCount.Done()
+			}
 		} else {
 			m.sessionsCount.Done()
 		}
@@ -225,7 +240,8 @@ func (m *Manager) GetSubscriber(id string) (vlsubscriber.IFace, error) {
 
 	if !ok {
 		sub = subscriber.New(subscriber.Config{
-			ID: id,
+			ID:     id,
+			MaxQoS: common.MaxQoS,
 			//OfflinePublish: m.pluginPublish,
 		})
 		m.plSubscribers[id] = sub
@@ -241,6 +257,10 @@ func (m *Manager) LoadSession(context interface{}, id []byte, state *persistence
 
 	defer ctx.bar.Add(1)
 
+	if strings.HasPrefix(sID, types.BridgeSessionPrefix) {
+		return nil
+	}
+
 	if len(state.Errors) != 0 {
 		log.Error("Session load, clientID:%s , err:%v", sID, state.Errors)
 		// if err := m.persistence.SubscriptionsDelete(id); err != nil && err != persistence.ErrNotFound {
@@ -275,18 +295,32 @@ func (m *Manager) LoadSession(context interface{}, id []byte, state *persistence
 		}
 	}
 
-	m.Systree.Sessions().Created(sID, status)
+	m.Systree.Sessions().Created("", sID, status)
 	return nil
 }
 
 // OnConnection implements transport.Handler interface and handles incoming connection
-func (m *Manager) OnConnection(conn transport.Conn, authMngr *auth.Manager) (err error) {
+func (m *Manager) OnConnection(conn transport.Conn, lCfg *transport.Config) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Println(r)
 			err = errors.New("panic")
 		}
 	}()
+
+	peer := auth.NewPeer(conn.RemoteAddr())
+	peer.Cert = conn.PeerCertificate()
+
+	authMngr := lCfg.AuthManager.WithPeer(peer)
+
+	// limits might be replaced by reload meanwhile, so connection is set up with single snapshot
+	limits := common.CurrentLimits()
+
+	offlineQoS0 := limits.OfflineQoS0
+	if lCfg.OfflineQoS0 != nil {
+		offlineQoS0 = *lCfg.OfflineQoS0
+	}
+
 	cn := connection.New(
 		connection.OnAuth(m.onAuth),
 		connection.NetConn(conn),
@@ -294,13 +328,20 @@ func (m *Manager) OnConnection(conn transport.Conn, authMngr *auth.Manager) (err
 		connection.RxQuota(int32(common.ReceiveMax)),
 		connection.Metric(m.Systree.Metric().Packets()),
 		connection.RetainAvailable(common.RetainAvailable),
-		connection.OfflineQoS0(common.OfflineQoS0),
+		connection.MaxQoS(common.MaxQoS),
+		connection.OfflineQoS0(offlineQoS0),
 		connection.MaxTxPacketSize(types.DefaultMaxPacketSize),
 		connection.MaxRxPacketSize(common.MaxPacketSize),
 		connection.MaxRxTopicAlias(common.MaxTopicAlias),
 		connection.MaxTxTopicAlias(0),
 		connection.KeepAlive(common.ConnectTimeout),
 		connection.Persistence(m.persistence),
+		connection.RetransmitMetric(m.Systree.Metric().Retransmit()),
+		connection.StoreMetric(m.Systree.Queued()),
+		connection.AckTimeout(limits.AckTimeout),
+		connection.AckMaxTimeout(limits.AckMaxTimeout),
+		connection.AckBackoff(limits.AckBackoff),
+		connection.AckRetries(limits.AckRetries),
 	)
 
 	var connParams *connection.ConnectParams
@@ -314,7 +355,7 @@ func (m *Manager) OnConnection(conn transport.Conn, authMngr *auth.Manager) (err
 				connParams = obj
 				resp, e = m.processConnect(cn, connParams, authMngr)
 			case connection.AuthParams:
-				resp, e = m.processAuth(connParams, obj)
+				resp, e = m.processAuth(connParams, obj, authMngr)
 			case error:
 				e = obj
 			default:
@@ -336,7 +377,7 @@ func (m *Manager) OnConnection(conn transport.Conn, authMngr *auth.Manager) (err
 		}
 	}
 
-	m.newSession(cn, connParams, ack, authMngr)
+	m.newSession(cn, conn.RemoteAddr().String(), connParams, ack, authMngr, lCfg.RateLimit, offlineQoS0)
 
 	return nil
 }
@@ -353,8 +394,41 @@ func (m *Manager) processConnect(cn connection.Initial, params *connection.Conne
 		return nil, reason
 	}
 
+	// identity of the verified client certificate takes place of one sent by client
+	if id := authMngr.CertClientID(); len(id) > 0 && id != params.ID {
+		params.ID = id
+		params.IDGen = true
+	}
+
+	if user := authMngr.CertUsername(); len(user) > 0 {
+		params.Username = []byte(user)
+	}
+
+	if reason := checkWill(params); reason != mqttp.CodeSuccess {
+		pkt := mqttp.NewConnAck(params.Version)
+		pkt.SetReturnCode(reason) // nolint: errcheck
+
+		return pkt, nil
+	}
+
+	if ban := authMngr.Banned(params.ID, string(params.Username)); ban != nil {
+		log.Info("connection refused, clientId:%s banned as %s:%s", params.ID, ban.Kind, ban.Value)
+
+		reason := mqttp.CodeRefusedNotAuthorized
+		if params.Version == mqttp.ProtocolV50 {
+			reason = mqttp.CodeBanned
+		}
+
+		pkt := mqttp.NewConnAck(params.Version)
+		pkt.SetReturnCode(reason) // nolint: errcheck
+
+		return pkt, nil
+	}
+
 	if len(params.AuthMethod) > 0 {
-		// TODO(troian): verify method is allowed
+		// [MQTT-4.12] enhanced authentication, CONNECT carries first step of the exchange
+		data, status := authMngr.AuthStart(params.AuthMethod, params.ID, params.AuthData)
+		resp = m.authResponse(params, authMngr, data, status)
 	} else {
 		var reason mqttp.ReasonCode
 
@@ -375,33 +449,83 @@ func (m *Manager) processConnect(cn connection.Initial, params *connection.Conne
 	return resp, nil
 }
 
-func (m *Manager) processAuth(params *connection.ConnectParams, auth connection.AuthParams) (mqttp.IFace, error) {
-	var resp mqttp.IFace
+func (m *Manager) processAuth(params *connection.ConnectParams, authParams connection.AuthParams, authMngr *auth.Manager) (mqttp.IFace, error) {
+	data, status := authMngr.AuthContinue(authParams.AuthData)
 
-	return resp, nil
+	return m.authResponse(params, authMngr, data, status), nil
+}
+
+// authResponse AUTH packet if exchange continues, CONNACK once it finished
+func (m *Manager) authResponse(params *connection.ConnectParams, authMngr *auth.Manager, data []byte, status error) mqttp.IFace {
+	if status == nil {
+		pkt := mqttp.NewAuth(params.Version)
+		pkt.SetReasonCode(mqttp.CodeContinueAuthentication)          // nolint: errcheck
+		pkt.PropertySet(mqttp.PropertyAuthMethod, params.AuthMethod) // nolint: errcheck
+		pkt.PropertySet(mqttp.PropertyAuthData, data)                // nolint: errcheck
+
+		return pkt
+	}
+
+	reason := mqttp.CodeSuccess
+
+	switch status {
+	case auth.StatusAllow:
+		// user authenticated by exchange takes place of username, if client has sent one they must match
+		user := authMngr.AuthUser()
+		if len(params.Username) > 0 && string(params.Username) != user {
+			reason = mqttp.CodeNotAuthorized
+		} else {
+			params.Username = []byte(user)
+		}
+	case auth.ErrUnknownProvider:
+		reason = mqttp.CodeBadAuthMethod
+	default:
+		reason = mqttp.CodeNotAuthorized
+	}
+
+	pkt := mqttp.NewConnAck(params.Version)
+	pkt.SetReturnCode(reason) // nolint: errcheck
+
+	if reason == mqttp.CodeSuccess {
+		pkt.PropertySet(mqttp.PropertyAuthMethod, params.AuthMethod) // nolint: errcheck
+		if len(data) > 0 {
+			pkt.PropertySet(mqttp.PropertyAuthData, data) // nolint: errcheck
+		}
+	}
+
+	return pkt
 }
 
 // newSession create new session with provided established connection
-func (m *Manager) newSession(cn connection.Initial, params *connection.ConnectParams, ack *mqttp.ConnAck, authMngr *auth.Manager) {
+func (m *Manager) newSession(cn connection.Initial, address string, params *connection.ConnectParams, ack *mqttp.ConnAck, authMngr *auth.Manager,
+	limit *types.RateLimit, offlineQoS0 bool) {
 	var ses *session
 	var err error
 
-	defer func() {
-		keepAlive := int(params.KeepAlive)
-		if common.Force || params.KeepAlive > 0 {
-			if common.Force {
-				keepAlive = common.Period
-			}
-		}
+	keepAlive := int(params.KeepAlive)
+	if common.Force {
+		keepAlive = common.Period
+	}
 
+	defer func() {
 		if cn.Acknowledge(ack,
 			connection.KeepAlive(keepAlive),
-			connection.Permissions(authMngr)) {
+			connection.Permissions(guardNamespace(authMngr, projectNamespace(authMngr, string(params.Username)))),
+			connection.ID(params.ID),
+			connection.Username(string(params.Username)),
+			connection.RateLimit(rateLimit(string(params.Username), limit))) {
+
+			// drop connection once its credentials expire, e.g. jwt token
+			if expires := authMngr.Expiry(params.ID, string(params.Username)); !expires.IsZero() {
+				ses.expireAt(expires)
+			}
+
+			m.offlineConnected(params.ID, offlineQoS0)
 
 			ses.start()
 
-			// fixme(troian): add remote address
 			status := &systree.ClientConnectStatus{
+				Address:           address,
 				Username:          string(params.Username),
 				Timestamp:         time.Now().Format(time.RFC3339),
 				ReceiveMaximum:    uint32(params.SendQuota),
@@ -415,7 +539,16 @@ func (m *Manager) newSession(cn connection.Initial, params *connection.ConnectPa
 				Durable:           params.Durable,
 			}
 
-			m.Systree.Clients().Connected(params.ID, status)
+			ns := projectNamespace(authMngr, string(params.Username))
+			m.Systree.Clients().Connected(ns, params.ID, status)
+
+			if m.Hooks != nil {
+				e := hooks.NewEvent(hooks.EventConnected, params.ID)
+				e.Username = status.Username
+				e.Namespace = ns
+				e.Address = address
+				m.Hooks.Notify(e)
+			}
 		}
 	}()
 
@@ -444,13 +577,33 @@ func (m *Manager) newSession(cn connection.Initial, params *connection.ConnectPa
 	var info *containerInfo
 	if info, err = m.loadContainer(cn.Session(), params, authMngr); err == nil {
 		ses = info.ses
+
+		will := params.Will
+		if will != nil && guardNamespace(authMngr, ses.namespace).ACL(params.ID, string(params.Username), will.Topic(), auth.AccessWrite) != auth.StatusAllow {
+			log.Debug("will message dropped as not authorized, clientId:%s, topic:%s", params.ID, will.Topic())
+			will = nil
+		}
+
+		if will != nil && len(ses.namespace) > 0 {
+			if err = will.SetTopic(types.NamespaceTopic(ses.namespace, will.Topic())); err != nil {
+				log.Error("set will namespace topic, clientId:%s, err:%s", params.ID, err.Error())
+				will = nil
+			}
+		}
+
 		config := sessionConfig{
-			sessionEvents: m,
-			expireIn:      params.ExpireIn,
-			will:          params.Will,
-			durable:       params.Durable,
-			version:       params.Version,
-			subscriber:    info.sub,
+			sessionEvents:         m,
+			expireIn:              params.ExpireIn,
+			will:                  will,
+			durable:               params.Durable,
+			sharedSubscriptions:   common.SubsShared,
+			wildcardSubscriptions: common.SubsWildcard,
+			subscriptionIDs:       common.SubsID,
+			version:               params.Version,
+			subscriber:            info.sub,
+			address:               address,
+			keepAlive:             uint16(keepAlive),
+			connectedAt:           time.Now(),
 		}
 
 		ses.configure(config)
@@ -471,8 +624,19 @@ func (m *Manager) newSession(cn connection.Initial, params *connection.ConnectPa
 	}
 }
 
+// onAuth AUTH packet of established connection, [MQTT-4.12.1] re-authentication
 func (m *Manager) onAuth(id string, params *connection.AuthParams) (mqttp.IFace, error) {
-	return nil, nil
+	cont := m.loadSessionContainer(id)
+	if cont == nil {
+		return nil, mqttp.CodeNotAuthorized
+	}
+
+	ses := cont.session()
+	if ses == nil {
+		return nil, mqttp.CodeNotAuthorized
+	}
+
+	return ses.signalAuth(params)
 }
 
 func (m *Manager) checkServerStatus(v mqttp.ProtocolVersion, resp *mqttp.ConnAck) {
@@ -495,12 +659,98 @@ func (m *Manager) checkServerStatus(v mqttp.ProtocolVersion, resp *mqttp.ConnAck
 	}
 }
 
+// checkWill apply maximum QoS and retain availability to will message
+// v5 connection is refused if will exceeds capabilities, v3 will is downgraded
+func checkWill(params *connection.ConnectParams) mqttp.ReasonCode {
+	will := params.Will
+	if will == nil {
+		return mqttp.CodeSuccess
+	}
+
+	if will.QoS() > common.MaxQoS {
+		// [MQTT-3.2.2-12]
+		if params.Version >= mqttp.ProtocolV50 {
+			return mqttp.CodeNotSupportedQoS
+		}
+		will.SetQoS(common.MaxQoS) // nolint: errcheck
+	}
+
+	if will.Retain() && !common.RetainAvailable {
+		// [MQTT-3.2.2-13]
+		if params.Version >= mqttp.ProtocolV50 {
+			return mqttp.CodeRetainNotSupported
+		}
+		will.SetRetain(false)
+	}
+
+	return mqttp.CodeSuccess
+}
+
+// rateLimit limits of the user if set, otherwise limits of the listener or global ones
+func rateLimit(username string, listener *types.RateLimit) types.RateLimit {
+	limits := common.CurrentLimits()
+
+	if l, ok := limits.UserRateLimits[username]; ok {
+		return l
+	}
+
+	if listener != nil {
+		return *listener
+	}
+
+	return limits.RateLimit
+}
+
+// namespaceGuard permissions of the client refusing topics of project namespaces
+// used for clients without namespace while project isolation is on
+type namespaceGuard struct {
+	auth.Permissions
+}
+
+// ACL deny topics of project namespaces before asking permissions of the client
+func (g namespaceGuard) ACL(clientID, user, topic string, access auth.AccessType) error {
+	if types.EscapesNamespace("", topic) {
+		return auth.StatusDeny
+	}
+
+	return g.Permissions.ACL(clientID, user, topic, access)
+}
+
+// guardNamespace permissions of the client of namespace ns
+func guardNamespace(p auth.Permissions, ns string) auth.Permissions {
+	if common.ProjectIsolation && len(ns) == 0 {
+		return namespaceGuard{p}
+	}
+
+	return p
+}
+
+// projectNamespace topic namespace of the user project
+// empty if project isolation is off or user does not belong to any project
+func projectNamespace(authMngr *auth.Manager, username string) string {
+	if !common.ProjectIsolation {
+		return ""
+	}
+
+	if user := authMngr.FetchUser(username); user != nil {
+		return user.ProjectId
+	}
+
+	return ""
+}
+
 // allocContainer
 func (m *Manager) allocContainer(id string, username string, authMngr *auth.Manager, createdAt time.Time, cn connection.Session) *container {
 	var userId string
 	if user := authMngr.FetchUser(username); user != nil {
 		userId = user.ProjectId
 	}
+
+	var ns string
+	if common.ProjectIsolation {
+		ns = userId
+	}
+
 	ses := newSession(sessionPreConfig{
 		id:          id,
 		createdAt:   createdAt,
@@ -510,6 +760,8 @@ func (m *Manager) allocContainer(id string, username string, authMngr *auth.Mana
 		permissions: authMngr,
 		username:    username,
 		projectId:   userId,
+		namespace:   ns,
+		hooks:       m.Hooks,
 	})
 
 	cont := &container{
@@ -606,6 +858,10 @@ func (m *Manager) loadContainer(cn connection.Session, params *connection.Connec
 			OfflinePublish: m.sessionPersistPublish,
 			Topics:         m.TopicsMgr,
 			Version:        params.Version,
+			Permissions:    guardNamespace(authMngr, newContainer.ses.namespace),
+			Username:       string(params.Username),
+			Namespace:      newContainer.ses.namespace,
+			MaxQoS:         common.MaxQoS,
 		})
 
 	if params.CleanStart {
@@ -636,7 +892,7 @@ func (m *Manager) loadContainer(cn connection.Session, params *connection.Connec
 				Durable:   params.Durable,
 				Timestamp: time.Now().Format(time.RFC3339),
 			}
-			m.Systree.Sessions().Created(params.ID, status)
+			m.Systree.Sessions().Created(newContainer.ses.namespace, params.ID, status)
 		}
 
 		cont = &containerInfo{
@@ -706,25 +962,25 @@ func (m *Manager) writeSessionProperties(resp *mqttp.ConnAck, id string) error {
 		return err
 	}
 
+	// [MQTT-3.2.2.3.14] client must use keep alive server has overridden
 	if common.Force {
-		log.Error("lhl not Support")
-		//if err := resp.PropertySet(mqttp.PropertyServerKeepAlive, m.KeepAlive); err != nil {
-		//	return err
-		//}
+		if err := resp.PropertySet(mqttp.PropertyServerKeepAlive, uint16(common.Period)); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (m *Manager) connectionClosed(id string, reason mqttp.ReasonCode) {
-	m.Systree.Clients().Disconnected(id, reason)
+func (m *Manager) connectionClosed(id string, ns string, reason mqttp.ReasonCode) {
+	m.Systree.Clients().Disconnected(ns, id, reason)
 }
 
 func (m *Manager) subscriberShutdown(id string, sub vlsubscriber.IFace) {
 	sub.Offline(true)
 	if val, ok := m.sessions.Load(id); ok {
 		wrap := val.(*container)
-		wrap.sub = nil
+		wrap.setSubscriber(nil)
 	} else {
 		log.Error("subscriber shutdown. container not found, id:%s", id)
 	}
@@ -734,6 +990,10 @@ func (m *Manager) sessionOffline(id string, keep bool, expCfg *expiryConfig) {
 	if obj, ok := m.sessions.Load(id); ok {
 		if cont, kk := obj.(*container); kk {
 			cont.rmLock.Lock()
+			var ns string
+			if cont.ses != nil {
+				ns = cont.ses.namespace
+			}
 			cont.ses = nil
 
 			if keep {
@@ -752,8 +1012,9 @@ func (m *Manager) sessionOffline(id string, keep bool, expCfg *expiryConfig) {
 						Reason:    "",
 					}
 
-					m.Systree.Sessions().Removed(id, state)
+					m.Systree.Sessions().Removed(ns, id, state)
 					m.sessions.Delete(id)
+					m.offline.Delete(id)
 					m.sessionsCount.Done()
 					cont.removed = true
 				}
@@ -768,7 +1029,7 @@ func (m *Manager) sessionOffline(id string, keep bool, expCfg *expiryConfig) {
 	}
 }
 
-func (m *Manager) sessionTimer(id string, expired bool) {
+func (m *Manager) sessionTimer(id string, ns string, expired bool) {
 	rs := "shutdown"
 	if expired {
 		rs = "expired"
@@ -776,6 +1037,7 @@ func (m *Manager) sessionTimer(id string, expired bool) {
 		m.persistence.Delete([]byte(id))
 
 		m.sessions.Delete(id)
+		m.offline.Delete(id)
 		m.sessionsCount.Done()
 	}
 
@@ -784,7 +1046,7 @@ func (m *Manager) sessionTimer(id string, expired bool) {
 		Reason:    rs,
 	}
 
-	m.Systree.Sessions().Removed(id, state)
+	m.Systree.Sessions().Removed(ns, id, state)
 
 	if expired {
 		m.expiryCount.Done()
@@ -793,12 +1055,17 @@ func (m *Manager) sessionTimer(id string, expired bool) {
 
 func (m *Manager) configurePersistedSubscribers(ctx *loadContext) {
 	for id, t := range ctx.preloadConfigs {
+		if t.sub == nil {
+			continue
+		}
+
 		sub := subscriber.New(
 			subscriber.Config{
 				ID:             id,
 				Topics:         m.TopicsMgr,
 				OfflinePublish: m.sessionPersistPublish,
 				Version:        t.sub.version,
+				MaxQoS:         common.MaxQoS,
 			})
 
 		for topic, ops := range t.sub.topics {
@@ -820,6 +1087,10 @@ func (m *Manager) configurePersistedSubscribers(ctx *loadContext) {
 
 func (m *Manager) configurePersistedExpiry(ctx *loadContext) {
 	for id, t := range ctx.preloadConfigs {
+		if t.exp == nil {
+			continue
+		}
+
 		cont := &container{
 			removable: true,
 			removed:   false,
@@ -833,6 +1104,8 @@ func (m *Manager) configurePersistedExpiry(ctx *loadContext) {
 		if c, present := m.sessions.LoadOrStore(id, cont); present {
 			cnt := c.(*container)
 			cnt.expiry.Store(exp)
+		} else {
+			m.sessionsCount.Add(1)
 		}
 
 		exp.start()
@@ -952,8 +1225,7 @@ func (m *Manager) decodeSubscriber(ctx *loadContext, id string, from []byte) err
 	offset := 0
 	version := mqttp.ProtocolVersion(from[offset])
 	offset++
-	remaining := len(from) - 1
-	for offset != remaining {
+	for offset < len(from) {
 		t, total, e := mqttp.ReadLPBytes(from[offset:])
 		if e != nil {
 			return e
@@ -1048,6 +1320,10 @@ func (m *Manager) sessionPersistPublish(id string, p *mqttp.Publish) {
 		return
 	}
 
+	if !m.enqueueOffline(id, p, len(pkt.Data)) {
+		return
+	}
+
 	if p.QoS() == mqttp.QoS0 {
 		err = m.persistence.PacketStoreQoS0([]byte(id), pkt)
 	} else {
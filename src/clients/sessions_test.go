@@ -0,0 +1,134 @@
+package clients
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"auth"
+	"common"
+	"connection"
+	"github.com/VolantMQ/vlapi/mqttp"
+	"types"
+)
+
+func TestRateLimitPrecedence(t *testing.T) {
+	prev := common.CurrentLimits()
+	t.Cleanup(func() {
+		common.SetLimits(prev)
+	})
+
+	global := types.RateLimit{Messages: 1}
+	listener := types.RateLimit{Messages: 10}
+	user := types.RateLimit{Messages: 100, Policy: types.RatePolicyDisconnect}
+
+	l := *prev
+	l.RateLimit = global
+	l.UserRateLimits = map[string]types.RateLimit{"u1": user}
+	common.SetLimits(&l)
+
+	tests := []struct {
+		name     string
+		username string
+		listener *types.RateLimit
+		want     types.RateLimit
+	}{
+		{"user over listener", "u1", &listener, user},
+		{"user over global", "u1", nil, user},
+		{"listener over global", "u2", &listener, listener},
+		{"global", "u2", nil, global},
+		{"anonymous", "", nil, global},
+	}
+
+	for _, tt := range tests {
+		if got := rateLimit(tt.username, tt.listener); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConnectCertIdentity(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "dev1"}, DNSNames: []string{"dev1.example.com"}}
+
+	am, err := auth.NewManager(nil, false)
+	if err != nil {
+		t.Fatalf("auth manager: %v", err)
+	}
+
+	if err = am.SetCertIdentity(auth.CertCN, auth.CertSAN); err != nil {
+		t.Fatalf("set cert identity: %v", err)
+	}
+
+	m := &Manager{allowedVersions: map[mqttp.ProtocolVersion]bool{mqttp.ProtocolV311: true}}
+
+	tests := []struct {
+		name     string
+		cert     *x509.Certificate
+		id       string
+		username string
+		idGen    bool
+		code     mqttp.ReasonCode
+	}{
+		// certificate username is authenticated by certificate, password is not checked
+		{"certificate", cert, "dev1.example.com", "dev1", true, mqttp.CodeSuccess},
+		{"missing certificate", nil, "c1", "u1", false, mqttp.CodeRefusedBadUsernameOrPassword},
+	}
+
+	for _, tt := range tests {
+		params := &connection.ConnectParams{
+			ID:       "c1",
+			Username: []byte("u1"),
+			Password: []byte("bad"),
+			Version:  mqttp.ProtocolV311,
+		}
+
+		resp, err := m.processConnect(nil, params, am.WithPeer(&auth.Peer{IP: "10.0.0.1", Cert: tt.cert}))
+		if err != nil {
+			t.Fatalf("%s: process connect: %v", tt.name, err)
+		}
+
+		if params.ID != tt.id || string(params.Username) != tt.username || params.IDGen != tt.idGen {
+			t.Errorf("%s: client id %q, username %q, generated %v, want %q, %q, %v",
+				tt.name, params.ID, params.Username, params.IDGen, tt.id, tt.username, tt.idGen)
+		}
+
+		if ack, ok := resp.(*mqttp.ConnAck); !ok || ack.ReturnCode() != tt.code {
+			t.Errorf("%s: response %v, want connack %v", tt.name, resp, tt.code)
+		}
+	}
+}
+
+func TestConnAckServerKeepAlive(t *testing.T) {
+	period, force := common.Period, common.Force
+	t.Cleanup(func() {
+		common.Period, common.Force = period, force
+	})
+
+	common.Period = 30
+
+	for _, forced := range []bool{false, true} {
+		common.Force = forced
+
+		ack := mqttp.NewConnAck(mqttp.ProtocolV50)
+		if err := (&Manager{}).writeSessionProperties(ack, ""); err != nil {
+			t.Fatalf("write properties: %v", err)
+		}
+
+		prop := ack.PropertyGet(mqttp.PropertyServerKeepAlive)
+
+		if !forced {
+			if prop != nil {
+				t.Errorf("server keep alive sent while not forced")
+			}
+			continue
+		}
+
+		if prop == nil {
+			t.Fatalf("forced keep alive is not sent")
+		}
+
+		if v, err := prop.AsShort(); err != nil || v != 30 {
+			t.Errorf("server keep alive %d, err:%v, want 30", v, err)
+		}
+	}
+}
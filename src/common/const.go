@@ -7,17 +7,20 @@ var (
 
 	// options
 	ConnectTimeout = 2
-	OfflineQoS0 = true
 	SessionDups = true
 	RetainAvailable = true
 	SubsOverlap = false
 	SubsID = false
-	SubsShared = false
+	SubsShared = true
+	// SharedStrategy dispatch of shared subscriptions: round_robin, random or sticky
+	SharedStrategy = "round_robin"
 	SubsWildcard = true
 	ReceiveMax = 65535
 	MaxPacketSize uint32 = 268435455
 	MaxTopicAlias uint16 = 65535
 	MaxQoS mqttp.QosType = 2
+	// ProjectIsolation place topics of every client into namespace of its project
+	ProjectIsolation = false
 
 	// keepAlive:
 	Period = 60
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"sync/atomic"
+
+	"types"
+)
+
+// Limits settings changed by config reload while connections are served
+// snapshot must not be modified once published by SetLimits
+type Limits struct {
+	// retransmission of unacknowledged QoS1/2 messages, AckTimeout 0 disables it
+	AckTimeout    int
+	AckMaxTimeout int
+	AckBackoff    float64
+	AckRetries    int
+
+	// RateLimit limits of every client unless listener or user has own ones
+	RateLimit types.RateLimit
+	// UserRateLimits limits by username, take precedence over limits of listener
+	UserRateLimits map[string]types.RateLimit
+
+	OfflineQoS0 bool
+	// OfflineQueueMax and OfflineQueueBytes limits of messages persisted for offline session, 0 is unlimited
+	OfflineQueueMax   int
+	OfflineQueueBytes int
+	// OfflineOverflow policy once offline queue is full: drop_oldest, drop_newest or drop_qos0
+	OfflineOverflow string
+}
+
+var limits atomic.Value
+
+func init() {
+	SetLimits(&Limits{
+		AckTimeout:      types.DefaultAckTimeout,
+		AckMaxTimeout:   120,
+		AckBackoff:      2.0,
+		AckRetries:      types.DefaultTimeoutRetries,
+		OfflineQoS0:     true,
+		OfflineOverflow: "drop_oldest",
+	})
+}
+
+// CurrentLimits snapshot of limits in effect, must not be modified
+func CurrentLimits() *Limits {
+	return limits.Load().(*Limits)
+}
+
+// SetLimits publish new snapshot of limits, connections accepted afterwards use it
+func SetLimits(l *Limits) {
+	limits.Store(l)
+}
@@ -114,6 +114,50 @@ func (c *Config) GetBoolWithDefault(key string, defaultVal bool) bool {
 	return val.(bool)
 }
 
+func (c *Config) GetStringSliceWithDefault(key string, defaultVal []string) []string {
+	val, ok := c.data[key]
+	if !ok {
+		return defaultVal
+	}
+	//类型不符时返回默认值
+	items, ok := val.([]interface{})
+	if !ok {
+		return defaultVal
+	}
+	list := make([]string, 0)
+	for _, v := range items {
+		str, ok := v.(string)
+		if !ok {
+			return defaultVal
+		}
+		list = append(list, str)
+	}
+	return list
+}
+
+// GetObject decode value of the key into v, which must be pointer to struct or slice
+// return false if key is not found
+func (c *Config) GetObject(key string, v interface{}) (bool, error) {
+	val, ok := c.data[key]
+	if !ok {
+		return false, nil
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return true, err
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+// Keys top level keys of the config
+func (c *Config) Keys() []string {
+	keys := make([]string, 0, len(c.data))
+	for k := range c.data {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
 func (c *Config) GetJson() string {
 	return c.rawData
 }
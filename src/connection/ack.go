@@ -2,30 +2,61 @@ package connection
 
 import (
 	"sync"
+	"time"
 
 	"github.com/VolantMQ/vlapi/mqttp"
 )
 
 type onRelease func(o, n mqttp.IFace)
 
+// ackEntry message waiting for acknowledgment
+// deadline and retries are touched by retransmit routine only
+type ackEntry struct {
+	pkt      mqttp.IFace
+	deadline time.Time
+	retries  int
+}
+
 type ackQueue struct {
 	messages  sync.Map
 	onRelease onRelease
+	// timeout of the first acknowledgment, zero if messages are not tracked for retransmission
+	timeout time.Duration
 }
 
 func (a *ackQueue) store(pkt mqttp.IFace) bool {
 	id, _ := pkt.ID()
-	a.messages.Store(id, pkt)
+
+	e := &ackEntry{
+		pkt: pkt,
+	}
+
+	if a.timeout > 0 {
+		e.deadline = time.Now().Add(a.timeout)
+	}
+
+	a.messages.Store(id, e)
 
 	return true
 }
 
+// count of messages waiting for acknowledgment
+func (a *ackQueue) count() int {
+	cnt := 0
+	a.messages.Range(func(k, v interface{}) bool {
+		cnt++
+		return true
+	})
+
+	return cnt
+}
+
 func (a *ackQueue) release(pkt mqttp.IFace) {
 	id, _ := pkt.ID()
 
 	if value, ok := a.messages.Load(id); ok {
-		if orig, k := value.(mqttp.IFace); k && a.onRelease != nil {
-			a.onRelease(orig, pkt)
+		if e, k := value.(*ackEntry); k && a.onRelease != nil {
+			a.onRelease(e.pkt, pkt)
 		}
 		a.messages.Delete(id)
 	}
@@ -0,0 +1,236 @@
+package connection
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"auth"
+	"github.com/VolantMQ/vlapi/mqttp"
+	persistenceMem "github.com/VolantMQ/vlapi/plugin/persistence/mem"
+)
+
+// pipeConn server side of in-memory connection
+type pipeConn struct {
+	net.Conn
+}
+
+func (pipeConn) PeerCertificate() *x509.Certificate { return nil }
+
+type nopMetric struct{}
+
+func (nopMetric) Sent(mqttp.Type) {}
+
+func (nopMetric) Received(mqttp.Type) {}
+
+type allowAll struct{}
+
+func (allowAll) ACL(clientID, username, topic string, accessType auth.AccessType) error {
+	return auth.StatusAllow
+}
+
+// recorder session callbacks keeping published messages
+type recorder struct {
+	published chan *mqttp.Publish
+	closed    chan DisconnectParams
+}
+
+func (r *recorder) SignalPublish(p *mqttp.Publish) error {
+	r.published <- p
+	return nil
+}
+
+func (r *recorder) SignalSubscribe(*mqttp.Subscribe) (mqttp.IFace, error) { return nil, nil }
+
+func (r *recorder) SignalUnSubscribe(*mqttp.UnSubscribe) (mqttp.IFace, error) { return nil, nil }
+
+func (r *recorder) SignalDisconnect(*mqttp.Disconnect) (mqttp.IFace, error) {
+	return nil, mqttp.CodeSuccess
+}
+
+func (r *recorder) SignalOnline() {}
+
+func (r *recorder) SignalOffline() {}
+
+func (r *recorder) SignalConnectionClose(params DisconnectParams) {
+	r.closed <- params
+}
+
+// readFrame single control packet as it is on the wire
+func readFrame(t *testing.T, c net.Conn) []byte {
+	c.SetReadDeadline(time.Now().Add(5 * time.Second)) // nolint: errcheck
+
+	frame := make([]byte, 1, 5)
+	if _, err := io.ReadFull(c, frame); err != nil {
+		t.Fatalf("read fixed header: %v", err)
+	}
+
+	// remaining length is variable byte integer of up to 4 bytes
+	for {
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(c, b); err != nil {
+			t.Fatalf("read remaining length: %v", err)
+		}
+
+		frame = append(frame, b[0])
+		if b[0] < 0x80 {
+			break
+		}
+	}
+
+	remaining, _ := binary.Uvarint(frame[1:])
+
+	body := make([]byte, remaining)
+	if _, err := io.ReadFull(c, body); err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+
+	return append(frame, body...)
+}
+
+func writeFrame(t *testing.T, c net.Conn, frame []byte) {
+	c.SetWriteDeadline(time.Now().Add(5 * time.Second)) // nolint: errcheck
+
+	if _, err := c.Write(frame); err != nil {
+		t.Fatalf("write %x: %v", frame, err)
+	}
+}
+
+func expectFrame(t *testing.T, c net.Conn, name string, want []byte) {
+	if got := readFrame(t, c); !bytes.Equal(got, want) {
+		t.Errorf("%s: got % x, want % x", name, got, want)
+	}
+}
+
+// TestConformanceQoS2 CONNECT, PUBLISH QoS2 and DISCONNECT exchange checked byte by byte
+func TestConformanceQoS2(t *testing.T) {
+	tests := []struct {
+		name    string
+		version mqttp.ProtocolVersion
+		connect []byte
+		connack []byte
+		publish []byte
+		pubrec  []byte
+		pubrel  []byte
+		pubcomp []byte
+	}{
+		{
+			name:    "v3.1.1",
+			version: mqttp.ProtocolV311,
+			// protocol name MQTT, level 4, clean session, keep alive 60, client id c1
+			connect: []byte{0x10, 0x0e, 0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0x02, 0x00, 0x3c, 0x00, 0x02, 'c', '1'},
+			connack: []byte{0x20, 0x02, 0x00, 0x00},
+			// QoS2, topic a/b, packet id 1, payload hi
+			publish: []byte{0x34, 0x09, 0x00, 0x03, 'a', '/', 'b', 0x00, 0x01, 'h', 'i'},
+			pubrec:  []byte{0x50, 0x02, 0x00, 0x01},
+			pubrel:  []byte{0x62, 0x02, 0x00, 0x01},
+			pubcomp: []byte{0x70, 0x02, 0x00, 0x01},
+		},
+		{
+			name:    "v5",
+			version: mqttp.ProtocolV50,
+			// same as v3.1.1 with level 5 and empty properties
+			connect: []byte{0x10, 0x0f, 0x00, 0x04, 'M', 'Q', 'T', 'T', 0x05, 0x02, 0x00, 0x3c, 0x00, 0x00, 0x02, 'c', '1'},
+			connack: []byte{0x20, 0x03, 0x00, 0x00, 0x00},
+			publish: []byte{0x34, 0x0a, 0x00, 0x03, 'a', '/', 'b', 0x00, 0x01, 0x00, 'h', 'i'},
+			// reason code success and empty properties might be omitted [MQTT-3.5.2.1]
+			pubrec:  []byte{0x50, 0x02, 0x00, 0x01},
+			pubrel:  []byte{0x62, 0x02, 0x00, 0x01},
+			pubcomp: []byte{0x70, 0x02, 0x00, 0x01},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, client := net.Pipe()
+			defer client.Close() // nolint: errcheck
+
+			p, _ := persistenceMem.Load(nil, nil)
+			persist, _ := p.Sessions()
+
+			r := &recorder{
+				published: make(chan *mqttp.Publish, 1),
+				closed:    make(chan DisconnectParams, 1),
+			}
+
+			cn := New(
+				NetConn(pipeConn{srv}),
+				Metric(nopMetric{}),
+				Persistence(persist),
+				RxQuota(10),
+				MaxRxPacketSize(1024),
+				AttachSession(r),
+			)
+
+			ch, err := cn.Accept()
+			if err != nil {
+				t.Fatalf("accept: %v", err)
+			}
+
+			writeFrame(t, client, tt.connect)
+
+			var params *ConnectParams
+
+			select {
+			case v := <-ch:
+				var ok bool
+				if params, ok = v.(*ConnectParams); !ok {
+					t.Fatalf("expected connect params, got %v", v)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("connect not received")
+			}
+
+			if params.ID != "c1" || params.Version != tt.version || !params.CleanStart || params.KeepAlive != 60 {
+				t.Errorf("unexpected connect params %+v", params)
+			}
+
+			ack := mqttp.NewConnAck(tt.version)
+			ack.SetReturnCode(mqttp.CodeSuccess) // nolint: errcheck
+
+			go cn.Acknowledge(ack, Permissions(allowAll{}), ID(params.ID))
+
+			expectFrame(t, client, "CONNACK", tt.connack)
+
+			writeFrame(t, client, tt.publish)
+			expectFrame(t, client, "PUBREC", tt.pubrec)
+
+			// [MQTT-4.3.3] message is delivered once released
+			select {
+			case pkt := <-r.published:
+				t.Fatalf("message published before PUBREL: %v", pkt)
+			default:
+			}
+
+			writeFrame(t, client, tt.pubrel)
+			expectFrame(t, client, "PUBCOMP", tt.pubcomp)
+
+			select {
+			case pkt := <-r.published:
+				if pkt.Topic() != "a/b" || string(pkt.Payload()) != "hi" || pkt.QoS() != mqttp.QoS2 {
+					t.Errorf("unexpected message topic:%s, payload:%s, qos:%d", pkt.Topic(), pkt.Payload(), pkt.QoS())
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("message not published")
+			}
+
+			writeFrame(t, client, []byte{0xe0, 0x00})
+
+			select {
+			case <-r.closed:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("connection not closed on DISCONNECT")
+			}
+
+			// server closes network connection without sending anything else
+			client.SetReadDeadline(time.Now().Add(5 * time.Second)) // nolint: errcheck
+			if n, err := client.Read(make([]byte, 1)); err != io.EOF {
+				t.Errorf("expected EOF after DISCONNECT, got %d bytes, err:%v", n, err)
+			}
+		})
+	}
+}
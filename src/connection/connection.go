@@ -164,6 +164,7 @@ type SessionCallbacks interface {
 type impl struct {
 	SessionCallbacks
 	id               string
+	username         string
 	conn             transport.Conn
 	metric           systree.PacketsMetric
 	permissions      auth.Permissions
@@ -172,6 +173,7 @@ type impl struct {
 	callStop         func(error) bool
 	tx               *writer
 	rx               *reader
+	limiter          *rateLimiter
 	quit             chan struct{}
 	connect          chan interface{}
 	onStart          types.Once
@@ -186,6 +188,7 @@ type impl struct {
 	maxRxTopicAlias  uint16
 	version          mqttp.ProtocolVersion
 	retainAvailable  bool
+	maxQoS           mqttp.QosType
 }
 
 type unacknowledged struct {
@@ -214,6 +217,10 @@ type Session interface {
 	baseAPI
 	Publish(string, *mqttp.Publish)
 	SetOptions(opts ...Option) error
+	// Queued count of QoS0 and QoS1/2 messages waiting for delivery and count of unacknowledged messages
+	Queued() (int, int, int)
+	// Rates messages and bytes per second client publishes at
+	Rates() (float64, float64)
 }
 
 var _ Initial = (*impl)(nil)
@@ -228,10 +235,12 @@ func New(opts ...Option) Initial {
 	}()
 
 	s := &impl{
-		state: stateConnecting,
-		quit:  make(chan struct{}),
-		tx:    newWriter(),
-		rx:    newReader(),
+		state:   stateConnecting,
+		quit:    make(chan struct{}),
+		tx:      newWriter(),
+		rx:      newReader(),
+		limiter: newRateLimiter(),
+		maxQoS:  mqttp.QoS2,
 	}
 
 	s.onConnClose = s.onConnectionCloseStage1
@@ -244,6 +253,8 @@ func New(opts ...Option) Initial {
 	s.rx.setOptions(
 		rdOnConnClose(s.onConnectionClose),
 		rdProcessIncoming(s.processIncoming),
+		rdLimiter(s.limiter),
+		rdQuit(s.quit),
 	)
 
 	for _, opt := range opts {
@@ -363,6 +374,22 @@ func (s *impl) Publish(id string, pkt *mqttp.Publish) {
 	s.tx.send(pkt)
 }
 
+// Queued ...
+func (s *impl) Queued() (int, int, int) {
+	// writer is released once connection closed
+	tx := s.tx
+	if tx == nil {
+		return 0, 0, 0
+	}
+
+	return tx.qos0Messages.Length(), tx.qos12Messages.Length(), tx.pubOut.count()
+}
+
+// Rates ...
+func (s *impl) Rates() (float64, float64) {
+	return s.limiter.rates()
+}
+
 func genClientID() string {
 	b := make([]byte, 15)
 	if _, err := io.ReadFull(rand.Reader, b); err != nil {
@@ -394,6 +421,7 @@ func (s *impl) onConnect(pkt *mqttp.Connect) (mqttp.IFace, error) {
 		}
 
 		params.Username, params.Password = pkt.Credentials()
+		s.username = string(params.Username)
 		s.version = params.Version
 
 		s.readConnProperties(pkt, params)
@@ -477,7 +505,17 @@ func (s *impl) onAuth(pkt *mqttp.Auth) (mqttp.IFace, error) {
 		return nil, nil
 	}
 
-	return s.signalAuth(s.id, &params)
+	resp, err := s.signalAuth(s.id, &params)
+	if err == nil {
+		// [MQTT-4.12.1] connection stays in re-auth until server answers with Success
+		if a, ok := resp.(*mqttp.Auth); ok && a.ReasonCode() == mqttp.CodeContinueAuthentication {
+			s.state = stateReAuth
+		} else {
+			s.state = stateConnected
+		}
+	}
+
+	return resp, err
 }
 
 func (s *impl) readConnProperties(req *mqttp.Connect, params *ConnectParams) {
@@ -592,27 +630,6 @@ func (s *impl) publishToTopic(p *mqttp.Publish) error {
 	// receives a PUBLISH packet with the RETAIN flag is set to 1, then it uses the DISCONNECT Reason
 	// Code of 0x9A (Retain not supported) as described in section 4.13.
 	if s.version >= mqttp.ProtocolV50 {
-		// [MQTT-3.3.2.3.4]
-		if prop := p.PropertyGet(mqttp.PropertyTopicAlias); prop != nil {
-			if val, err := prop.AsShort(); err == nil {
-				if len(p.Topic()) != 0 {
-					// renew alias with new topic
-					s.rx.topicAlias[val] = p.Topic()
-				} else {
-					if topic, kk := s.rx.topicAlias[val]; kk {
-						// do not check for error as topic has been validated when arrived
-						if err = p.SetTopic(topic); err != nil {
-							log.Error("publish to topic, s.id:%v, topic:%v, err:%v", s.id, topic, err.Error())
-						}
-					} else {
-						return mqttp.CodeInvalidTopicAlias
-					}
-				}
-			} else {
-				return mqttp.CodeInvalidTopicAlias
-			}
-		}
-
 		// [MQTT-3.3.2.3.3]
 		if prop := p.PropertyGet(mqttp.PropertyPublicationExpiry); prop != nil {
 			if val, err := prop.AsInt(); err == nil {
@@ -627,6 +644,31 @@ func (s *impl) publishToTopic(p *mqttp.Publish) error {
 	return s.SignalPublish(p)
 }
 
+// resolveTopicAlias v5.0 [MQTT-3.3.2.3.4] either renew alias or restore topic from it
+func (s *impl) resolveTopicAlias(p *mqttp.Publish) error {
+	if prop := p.PropertyGet(mqttp.PropertyTopicAlias); prop != nil {
+		if val, err := prop.AsShort(); err == nil {
+			if len(p.Topic()) != 0 {
+				// renew alias with new topic
+				s.rx.topicAlias[val] = p.Topic()
+			} else {
+				if topic, kk := s.rx.topicAlias[val]; kk {
+					// do not check for error as topic has been validated when arrived
+					if err = p.SetTopic(topic); err != nil {
+						log.Error("publish to topic, s.id:%v, topic:%v, err:%v", s.id, topic, err.Error())
+					}
+				} else {
+					return mqttp.CodeInvalidTopicAlias
+				}
+			}
+		} else {
+			return mqttp.CodeInvalidTopicAlias
+		}
+	}
+
+	return nil
+}
+
 // onReleaseIn ack process for incoming messages
 func (s *impl) onReleaseIn(o, n mqttp.IFace) {
 	switch p := o.(type) {
@@ -745,6 +787,13 @@ func (s *impl) onPublish(pkt *mqttp.Publish) (mqttp.IFace, error) {
 	var err error
 	reason := mqttp.CodeSuccess
 
+	// publish with QoS above maximum advertised in CONNACK is protocol violation
+	// v5 clients get DISCONNECT with CodeNotSupportedQoS, v3 connection is closed
+	if pkt.QoS() > s.maxQoS {
+		log.Debug("publish QoS not supported, clientId:%s, qos:%d", s.id, pkt.QoS())
+		return nil, mqttp.CodeNotSupportedQoS
+	}
+
 	if s.version >= mqttp.ProtocolV50 {
 		if !s.retainAvailable && pkt.Retain() {
 			return nil, mqttp.CodeRetainNotSupported
@@ -755,6 +804,11 @@ func (s *impl) onPublish(pkt *mqttp.Publish) (mqttp.IFace, error) {
 				return nil, mqttp.CodeInvalidTopicAlias
 			}
 		}
+
+		// topic must be known before access check
+		if err = s.resolveTopicAlias(pkt); err != nil {
+			return nil, err
+		}
 	}
 
 	var resp mqttp.IFace
@@ -763,9 +817,14 @@ func (s *impl) onPublish(pkt *mqttp.Publish) (mqttp.IFace, error) {
 	// To deal with V3.1.1 two ways left:
 	//   - ignore the message but send acks
 	//   - return error leading to disconnect
-	// TODO: publish permissions
-	if e := s.permissions.ACL(s.id, "", pkt.Topic(), auth.AccessWrite); e != auth.StatusAllow {
-		reason = mqttp.CodeRefusedNotAuthorized
+	// V3.1.1 goes first way, thus client is not aware message has been dropped
+	denied := false
+	if e := s.permissions.ACL(s.id, s.username, pkt.Topic(), auth.AccessWrite); e != auth.StatusAllow {
+		denied = true
+		log.Debug("publish denied, clientId:%s, topic:%s", s.id, pkt.Topic())
+		if s.version >= mqttp.ProtocolV50 {
+			reason = mqttp.CodeNotAuthorized
+		}
 	}
 
 	switch pkt.QoS() {
@@ -773,7 +832,6 @@ func (s *impl) onPublish(pkt *mqttp.Publish) (mqttp.IFace, error) {
 		if s.rxQuota == 0 {
 			err = mqttp.CodeReceiveMaximumExceeded
 		} else {
-			s.rxQuota--
 			r := mqttp.NewPubRec(s.version)
 			id, _ := pkt.ID()
 
@@ -784,11 +842,15 @@ func (s *impl) onPublish(pkt *mqttp.Publish) (mqttp.IFace, error) {
 			// [MQTT-4.3.3-9]
 			// store incoming QoS 2 message before sending PUBREC as theoretically PUBREL
 			// might come before store in case message store done after write PUBREC
+			// v5.0 [MQTT-4.9] PUBREC with failure reason ends the flow so quota is not used
 			if reason < mqttp.CodeUnspecifiedError {
-				s.pubIn.store(pkt)
+				s.rxQuota--
+				if !denied {
+					s.pubIn.store(pkt)
+				}
 			}
 
-			r.SetReason(mqttp.CodeSuccess)
+			r.SetReason(reason)
 		}
 	case mqttp.QoS1:
 		if s.rxQuota == 0 {
@@ -804,7 +866,7 @@ func (s *impl) onPublish(pkt *mqttp.Publish) (mqttp.IFace, error) {
 		r.SetReason(reason)
 		resp = r
 
-		if reason >= mqttp.CodeUnspecifiedError {
+		if denied {
 			break
 		}
 
@@ -812,7 +874,10 @@ func (s *impl) onPublish(pkt *mqttp.Publish) (mqttp.IFace, error) {
 	case mqttp.QoS0: // QoS 0
 		// [MQTT-4.3.1]
 		// [MQTT-4.3.2-4]
-		// TODO(troian): ignore if publish permissions not validated
+		if denied {
+			break
+		}
+
 		if err = s.publishToTopic(pkt); err != nil {
 			log.Error("Couldn't publish message. clientId:%v, qos:%v, err:%v", s.id, uint8(pkt.QoS()), err.Error())
 		}
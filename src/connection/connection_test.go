@@ -0,0 +1,55 @@
+package connection
+
+import (
+	"testing"
+
+	"auth"
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+type denyAll struct{}
+
+func (denyAll) ACL(clientID, username, topic string, accessType auth.AccessType) error {
+	return auth.StatusDeny
+}
+
+func newPublish(t *testing.T, v mqttp.ProtocolVersion, qos mqttp.QosType) *mqttp.Publish {
+	p := mqttp.NewPublish(v)
+	if err := p.SetQoS(qos); err != nil {
+		t.Fatalf("set QoS: %v", err)
+	}
+	if err := p.SetTopic("a/b"); err != nil {
+		t.Fatalf("set topic: %v", err)
+	}
+	p.SetPacketID(1)
+	return p
+}
+
+func TestPublishMaxQoS(t *testing.T) {
+	for _, v := range []mqttp.ProtocolVersion{mqttp.ProtocolV311, mqttp.ProtocolV50} {
+		s := &impl{
+			version:     v,
+			maxQoS:      mqttp.QoS1,
+			rxQuota:     1,
+			permissions: denyAll{},
+		}
+
+		if _, err := s.onPublish(newPublish(t, v, mqttp.QoS2)); err != mqttp.CodeNotSupportedQoS {
+			t.Errorf("v%d: QoS2 publish above max QoS1: expected %v, got %v", v, mqttp.CodeNotSupportedQoS, err)
+		}
+
+		resp, err := s.onPublish(newPublish(t, v, mqttp.QoS1))
+		if err != nil {
+			t.Errorf("v%d: QoS1 publish within max QoS1: unexpected error %v", v, err)
+		} else if _, ok := resp.(*mqttp.Ack); !ok || resp.Type() != mqttp.PUBACK {
+			t.Errorf("v%d: QoS1 publish within max QoS1: expected PUBACK, got %v", v, resp)
+		}
+	}
+}
+
+func TestPublishDefaultMaxQoS(t *testing.T) {
+	s := New().(*impl)
+	if s.maxQoS != mqttp.QoS2 {
+		t.Errorf("default max QoS: expected %d, got %d", mqttp.QoS2, s.maxQoS)
+	}
+}
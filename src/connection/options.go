@@ -9,6 +9,7 @@ import (
 	"github.com/VolantMQ/vlapi/plugin/persistence"
 	"systree"
 	"transport"
+	"types"
 )
 
 // OnAuthCb ...
@@ -103,6 +104,13 @@ func RetainAvailable(val bool) Option {
 	}
 }
 
+func MaxQoS(val mqttp.QosType) Option {
+	return func(t *impl) error {
+		t.maxQoS = val
+		return nil
+	}
+}
+
 func OnAuth(val OnAuthCb) Option {
 	return func(t *impl) error {
 		t.signalAuth = val
@@ -145,3 +153,75 @@ func Permissions(val auth.Permissions) Option {
 		return nil
 	}
 }
+
+// ID client id of the connection, might differ from one client has sent
+func ID(val string) Option {
+	return func(t *impl) error {
+		t.id = val
+		return nil
+	}
+}
+
+// Username user connection is authenticated as, may differ from CONNECT after enhanced authentication
+func Username(val string) Option {
+	return func(t *impl) error {
+		t.username = val
+		return nil
+	}
+}
+
+// RateLimit limits of PUBLISH messages received from client, see types.RateLimit
+func RateLimit(val types.RateLimit) Option {
+	return func(t *impl) error {
+		t.limiter.setLimit(val)
+		return nil
+	}
+}
+
+// RetransmitMetric metric of resent messages
+func RetransmitMetric(val systree.RetransmitMetric) Option {
+	return func(t *impl) error {
+		wrRetransmitMetric(val)(t.tx)
+		return nil
+	}
+}
+
+// StoreMetric statistic of messages queued for delivery
+func StoreMetric(val systree.StoreStat) Option {
+	return func(t *impl) error {
+		wrStoreMetric(val)(t.tx)
+		return nil
+	}
+}
+
+// AckTimeout seconds to wait acknowledgment of QoS1/2 message before it resent, 0 disables retransmission
+func AckTimeout(val int) Option {
+	return func(t *impl) error {
+		wrAckTimeout(time.Duration(val) * time.Second)(t.tx)
+		return nil
+	}
+}
+
+// AckMaxTimeout upper limit of acknowledgment timeout grown by backoff, seconds
+func AckMaxTimeout(val int) Option {
+	return func(t *impl) error {
+		wrAckMaxTimeout(time.Duration(val) * time.Second)(t.tx)
+		return nil
+	}
+}
+
+// AckBackoff multiplier applied to acknowledgment timeout after each retry
+func AckBackoff(val float64) Option {
+	return func(t *impl) error {
+		wrAckBackoff(val)(t.tx)
+		return nil
+	}
+}
+
+// AckRetries count of retransmissions before connection closed
+func AckRetries(val int) Option {
+	return func(t *impl) error {
+		wrAckRetries(val)(t.tx)
+		return nil
+	}
+}
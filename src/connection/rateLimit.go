@@ -0,0 +1,127 @@
+package connection
+
+import (
+	"sync"
+	"time"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+	"types"
+)
+
+// rateWindow period current rates are measured over
+const rateWindow = time.Second
+
+// rateLimiter token buckets of inbound messages and bytes
+// it measures current rates reported by admin API even if no limit is set
+type rateLimiter struct {
+	lock     sync.Mutex
+	limit    types.RateLimit
+	msgs     float64
+	bytes    float64
+	last     time.Time
+	winStart time.Time
+	winMsgs  float64
+	winBytes float64
+	msgRate  float64
+	byteRate float64
+}
+
+func newRateLimiter() *rateLimiter {
+	now := time.Now()
+
+	return &rateLimiter{
+		last:     now,
+		winStart: now,
+	}
+}
+
+// setLimit replace limits, bucket starts full
+func (r *rateLimiter) setLimit(limit types.RateLimit) {
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+
+	if limit.Policy == "" {
+		limit.Policy = types.RatePolicyThrottle
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.limit = limit
+	r.msgs = limit.Messages * limit.Burst
+	r.bytes = limit.Bytes * limit.Burst
+	r.last = time.Now()
+}
+
+// roll close measurement window once it is over
+func (r *rateLimiter) roll(now time.Time) {
+	if elapsed := now.Sub(r.winStart); elapsed >= rateWindow {
+		r.msgRate = r.winMsgs / elapsed.Seconds()
+		r.byteRate = r.winBytes / elapsed.Seconds()
+		r.winMsgs = 0
+		r.winBytes = 0
+		r.winStart = now
+	}
+}
+
+// take tokens of the message of given size
+// returns time reader must pause for to get back within limit
+// or error if limit exceeded and policy is to disconnect
+func (r *rateLimiter) take(size int) (time.Duration, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+
+	r.roll(now)
+	r.winMsgs++
+	r.winBytes += float64(size)
+
+	elapsed := now.Sub(r.last).Seconds()
+	r.last = now
+
+	var wait float64
+
+	if l := r.limit.Messages; l > 0 {
+		r.msgs = minFloat(r.msgs+elapsed*l, l*r.limit.Burst) - 1
+		if r.msgs < 0 {
+			if r.limit.Policy == types.RatePolicyDisconnect {
+				return 0, mqttp.CodeMessageRateTooHigh
+			}
+			wait = -r.msgs / l
+		}
+	}
+
+	if l := r.limit.Bytes; l > 0 {
+		r.bytes = minFloat(r.bytes+elapsed*l, l*r.limit.Burst) - float64(size)
+		if r.bytes < 0 {
+			if r.limit.Policy == types.RatePolicyDisconnect {
+				return 0, mqttp.CodeQuotaExceeded
+			}
+			if w := -r.bytes / l; w > wait {
+				wait = w
+			}
+		}
+	}
+
+	return time.Duration(wait * float64(time.Second)), nil
+}
+
+// rates messages and bytes per second received during last measurement window
+func (r *rateLimiter) rates() (float64, float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.roll(time.Now())
+
+	return r.msgRate, r.byteRate
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,177 @@
+package connection
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+	"types"
+)
+
+// near true if d is within tolerance of expected duration
+func near(d, expected time.Duration) bool {
+	const tolerance = 20 * time.Millisecond
+
+	return d >= expected-tolerance && d <= expected+tolerance
+}
+
+func newTestLimiter(limit types.RateLimit) *rateLimiter {
+	r := newRateLimiter()
+	r.setLimit(limit)
+
+	return r
+}
+
+func TestRateLimiterNoLimit(t *testing.T) {
+	r := newRateLimiter()
+
+	for i := 0; i < 1000; i++ {
+		if wait, err := r.take(1 << 20); wait != 0 || err != nil {
+			t.Fatalf("take %d: wait %v, err %v", i, wait, err)
+		}
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	r := newTestLimiter(types.RateLimit{Messages: 10, Burst: 2})
+
+	// bucket starts full holding burst seconds worth of messages
+	for i := 0; i < 20; i++ {
+		if wait, err := r.take(1); wait != 0 || err != nil {
+			t.Fatalf("take %d within burst: wait %v, err %v", i, wait, err)
+		}
+	}
+
+	// one message over the limit waits for a single token
+	if wait, _ := r.take(1); !near(wait, 100*time.Millisecond) {
+		t.Errorf("wait %v, want 100ms", wait)
+	}
+
+	// each further message waits one more token
+	if wait, _ := r.take(1); !near(wait, 200*time.Millisecond) {
+		t.Errorf("wait %v, want 200ms", wait)
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	r := newTestLimiter(types.RateLimit{Messages: 10, Burst: 2})
+
+	for i := 0; i < 20; i++ {
+		r.take(1) // nolint: errcheck
+	}
+
+	// a second later 10 tokens are back
+	r.last = r.last.Add(-time.Second)
+
+	for i := 0; i < 10; i++ {
+		if wait, _ := r.take(1); wait != 0 {
+			t.Fatalf("take %d after refill: wait %v", i, wait)
+		}
+	}
+
+	if wait, _ := r.take(1); wait == 0 {
+		t.Errorf("take over refilled tokens without wait")
+	}
+
+	// refill is capped by burst however long client was idle
+	r.last = r.last.Add(-time.Hour)
+
+	for i := 0; i < 20; i++ {
+		if wait, _ := r.take(1); wait != 0 {
+			t.Fatalf("take %d after idle: wait %v", i, wait)
+		}
+	}
+
+	if wait, _ := r.take(1); !near(wait, 100*time.Millisecond) {
+		t.Errorf("wait %v after idle, want 100ms", wait)
+	}
+}
+
+func TestRateLimiterBytes(t *testing.T) {
+	// burst defaults to 1 second
+	r := newTestLimiter(types.RateLimit{Messages: 1000, Bytes: 100})
+
+	if wait, _ := r.take(100); wait != 0 {
+		t.Errorf("take within bytes limit: wait %v", wait)
+	}
+
+	if wait, _ := r.take(50); !near(wait, 500*time.Millisecond) {
+		t.Errorf("wait %v, want 500ms", wait)
+	}
+
+	// longer of messages and bytes waits is taken
+	r = newTestLimiter(types.RateLimit{Messages: 1, Bytes: 1000})
+	r.take(10) // nolint: errcheck
+
+	if wait, _ := r.take(10); !near(wait, time.Second) {
+		t.Errorf("wait %v, want 1s", wait)
+	}
+}
+
+func TestRateLimiterDisconnect(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit types.RateLimit
+		sizes []int
+		err   error
+	}{
+		{"messages", types.RateLimit{Messages: 2, Policy: types.RatePolicyDisconnect}, []int{1, 1, 1}, mqttp.CodeMessageRateTooHigh},
+		{"bytes", types.RateLimit{Bytes: 10, Policy: types.RatePolicyDisconnect}, []int{6, 6}, mqttp.CodeQuotaExceeded},
+	}
+
+	for _, tt := range tests {
+		r := newTestLimiter(tt.limit)
+
+		var err error
+		for i, size := range tt.sizes {
+			var wait time.Duration
+			if wait, err = r.take(size); wait != 0 {
+				t.Errorf("%s: take %d waits %v with disconnect policy", tt.name, i, wait)
+			}
+		}
+
+		if err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestReaderThrottle(t *testing.T) {
+	pkt := newPublish(t, mqttp.ProtocolV311, mqttp.QoS0)
+
+	s := &reader{
+		limiter: newTestLimiter(types.RateLimit{Messages: 10}),
+		quit:    make(chan struct{}),
+	}
+
+	for i := 0; i < 10; i++ {
+		s.throttle(pkt) // nolint: errcheck
+	}
+
+	// reader pauses for the wait limiter asks for
+	start := time.Now()
+	if err := s.throttle(pkt); err != nil {
+		t.Fatalf("throttle: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond || elapsed > time.Second {
+		t.Errorf("paused for %v, want about 100ms", elapsed)
+	}
+
+	// pause is cut short once connection is closing
+	close(s.quit)
+
+	start = time.Now()
+	s.throttle(pkt) // nolint: errcheck
+
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("paused for %v while closing", elapsed)
+	}
+
+	s.limiter = newTestLimiter(types.RateLimit{Messages: 1, Policy: types.RatePolicyDisconnect})
+	s.throttle(pkt) // nolint: errcheck
+
+	if err := s.throttle(pkt); err != mqttp.CodeMessageRateTooHigh {
+		t.Errorf("throttle over disconnect limit: got %v, want %v", err, mqttp.CodeMessageRateTooHigh)
+	}
+}
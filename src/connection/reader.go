@@ -16,6 +16,8 @@ type reader struct {
 	connect           chan interface{}
 	onConnectionClose signalConnectionClose
 	processIncoming   signalIncoming
+	limiter           *rateLimiter
+	quit              chan struct{}
 	metric            systree.PacketsMetric
 	wg                sync.WaitGroup
 	connWg            sync.WaitGroup
@@ -79,12 +81,40 @@ func (s *reader) routine() {
 		}
 
 		s.metric.Received(pkt.Type())
+
+		if pkt.Type() == mqttp.PUBLISH {
+			if err = s.throttle(pkt); err != nil {
+				return
+			}
+		}
+
 		if err = s.processIncoming(pkt); err != nil {
 			return
 		}
 	}
 }
 
+// throttle account PUBLISH in rate limiter and pause reading if client is over its limit
+// no further packets are read during pause, so client is held back by TCP flow control
+func (s *reader) throttle(pkt mqttp.IFace) error {
+	size, _ := pkt.Size()
+
+	wait, err := s.limiter.take(size)
+	if err != nil || wait <= 0 {
+		return err
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-s.quit:
+	}
+
+	return nil
+}
+
 func (s *reader) connectionRoutine() {
 	defer s.connWg.Done()
 
@@ -99,8 +129,10 @@ func (s *reader) connectionRoutine() {
 
 	if pkt, err := s.readPacket(buf); err == nil {
 		s.metric.Received(pkt.Type())
-		err = s.processIncoming(pkt)
-		log.Debug("processIncoming: %v", err)
+		if err = s.processIncoming(pkt); err != nil {
+			log.Debug("processIncoming: %v", err)
+			s.connect <- err
+		}
 	} else {
 		log.Error("readPacket err: %v", err.Error())
 		s.connect <- err
@@ -73,3 +73,17 @@ func rdVersion(val mqttp.ProtocolVersion) readerOption {
 		return nil
 	}
 }
+
+func rdLimiter(val *rateLimiter) readerOption {
+	return func(t *reader) error {
+		t.limiter = val
+		return nil
+	}
+}
+
+func rdQuit(val chan struct{}) readerOption {
+	return func(t *reader) error {
+		t.quit = val
+		return nil
+	}
+}
@@ -18,6 +18,9 @@ import (
 
 const maxPacketCount = 0xFFFF
 
+// ackCheckPeriod how often unacknowledged messages are checked for timeout
+var ackCheckPeriod = time.Second
+
 type writerOption func(*writer) error
 
 type writer struct {
@@ -25,6 +28,8 @@ type writer struct {
 	onConnectionClose signalConnectionClose
 	conn              transport.Conn
 	metric            systree.PacketsMetric
+	rtMetric          systree.RetransmitMetric
+	storeMetric       systree.StoreStat
 	persist           persistence.Packets
 	flow              flow
 	pubOut            ackQueue
@@ -39,6 +44,9 @@ type writer struct {
 	onStart           sync.Once
 	onStop            types.Once
 	running           uint32
+	ackRetries        int
+	ackBackoff        float64
+	ackMaxTimeout     time.Duration
 	packetMaxSize     uint32
 	topicAliasCurrMax uint16
 	topicAliasMax     uint16
@@ -101,20 +109,119 @@ func (s *writer) start(start bool) {
 
 			ctx.unAck = false
 
-			ctx.count = s.qos12Messages.Length()
+			// count is number of packets queue can take yet
+			ctx.count = 0xFFFF - s.qos12Messages.Length()
 
 			if ctx.count > 0 {
 				s.persist.PacketsForEachQoS12([]byte(s.id), ctx, s.packetLoader)
 			}
 
 			ctx.packets = s.qos0Messages
-			ctx.count = s.qos0Messages.Length()
+			ctx.count = 0xFFFF - s.qos0Messages.Length()
 
-			s.persist.PacketsForEachQoS0([]byte(s.id), ctx, s.packetLoader)
+			if ctx.count > 0 {
+				s.persist.PacketsForEachQoS0([]byte(s.id), ctx, s.packetLoader)
+			}
 
 			s.signalAndRun()
+
+			if s.pubOut.timeout > 0 {
+				s.wg.Add(1)
+				go s.retransmitRoutine()
+			}
+		}
+	})
+}
+
+// retransmit wrap packet resent from ack queue so routine writes it with DUP set
+type retransmit struct {
+	mqttp.IFace
+}
+
+// retransmitRoutine periodically check messages waiting for acknowledgment
+// and resend ones timed out, connection is closed once retries exhausted
+func (s *writer) retransmitRoutine() {
+	var err error
+
+	ticker := time.NewTicker(ackCheckPeriod)
+
+	defer func() {
+		ticker.Stop()
+		s.wg.Done()
+
+		if err != nil {
+			s.onConnectionClose(err)
+		}
+	}()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case now := <-ticker.C:
+			if err = s.retransmit(now); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *writer) retransmit(now time.Time) error {
+	var err error
+
+	s.pubOut.messages.Range(func(k, v interface{}) bool {
+		e, ok := v.(*ackEntry)
+		if !ok || now.Before(e.deadline) {
+			return true
+		}
+
+		if e.retries >= s.ackRetries {
+			log.Warn("acknowledgment not received, clientId:%s, type:%s, retries:%d", s.id, e.pkt.Type().Name(), e.retries)
+			if s.rtMetric != nil {
+				s.rtMetric.Exhausted()
+			}
+			err = mqttp.CodeUnspecifiedError
+			return false
+		}
+
+		e.retries++
+		e.deadline = now.Add(s.ackDelay(e.retries))
+
+		// v5.0 [MQTT-4.4.0-1] messages are resent on reconnect only
+		// client which does not acknowledge them is disconnected once retries exhausted
+		if s.version >= mqttp.ProtocolV50 {
+			return true
 		}
+
+		pkt := e.pkt
+		if u, k := pkt.(*unacknowledged); k {
+			pkt = u.IFace
+		}
+
+		s.sendGeneric(&retransmit{pkt})
+
+		if s.rtMetric != nil {
+			s.rtMetric.Resent(pkt.Type())
+		}
+
+		return true
 	})
+
+	return err
+}
+
+// ackDelay timeout of acknowledgment after given retry
+func (s *writer) ackDelay(retry int) time.Duration {
+	delay := float64(s.pubOut.timeout)
+	for i := 0; i < retry && s.ackBackoff > 1; i++ {
+		delay *= s.ackBackoff
+	}
+
+	if s.ackMaxTimeout > 0 && delay > float64(s.ackMaxTimeout) {
+		return s.ackMaxTimeout
+	}
+
+	return time.Duration(delay)
 }
 
 func (s *writer) packetLoader(c interface{}, entry *persistence.PersistedPacket) (bool, error) {
@@ -148,6 +255,7 @@ func (s *writer) packetLoader(c interface{}, entry *persistence.PersistedPacket)
 		}
 	}
 
+	s.stored(pkt)
 	ctx.packets.Add(pkt)
 
 	ctx.count--
@@ -200,6 +308,7 @@ func (s *writer) sendGeneric(pkt mqttp.IFace) {
 }
 
 func (s *writer) sendQoS0(pkt mqttp.IFace) {
+	s.stored(pkt)
 	s.qos0Messages.Add(pkt)
 	// if (atomic.LoadUint32(&s.qos0Redirect) == 0) && (s.qos0Messages.Length() > 0) {
 	// 	s.qos0Messages.Add(pkt)
@@ -216,6 +325,7 @@ func (s *writer) sendQoS0(pkt mqttp.IFace) {
 }
 
 func (s *writer) sendQoS12(pkt mqttp.IFace) {
+	s.stored(pkt)
 	s.qos12Messages.Add(pkt)
 	// if (atomic.LoadUint32(&s.qos12Redirect) == 0) && (maxPacketCount-s.qos12Messages.Length() > 0) {
 	// 	s.qos12Messages.Add(pkt)
@@ -331,6 +441,12 @@ func (s *writer) routine() {
 		if len(packets) > 0 {
 			for _, p := range packets {
 				switch pack := p.(type) {
+				case *retransmit:
+					// DUP is set here as packet may still be encoded by previous attempt
+					p = pack.IFace
+					if pub, ok := p.(*mqttp.Publish); ok {
+						pub.SetDup(true)
+					}
 				case *mqttp.Publish:
 					if _, expireLeft, expired := pack.Expired(); expired {
 						continue
@@ -384,6 +500,7 @@ func (s *writer) popPackets() []mqttp.IFace {
 		}
 
 		if pkt := s.qos0Messages.Remove(); pkt != nil {
+			s.released(pkt)
 			p := pkt.(mqttp.IFace)
 			packets = append(packets, p)
 		}
@@ -444,6 +561,8 @@ func (s *writer) releaseID(id mqttp.IDType) {
 // onAckTimeout if publish message has not been acknowledged withing specified ackTimeout
 // server should mark it as a dup and send again
 func (s *writer) onReleaseOut(o, n mqttp.IFace) {
+	s.released(o)
+
 	switch n.Type() {
 	case mqttp.PUBACK:
 		fallthrough
@@ -453,6 +572,33 @@ func (s *writer) onReleaseOut(o, n mqttp.IFace) {
 	}
 }
 
+// queuedSize payload bytes of the queued publish message
+func queuedSize(pkt interface{}) (uint64, bool) {
+	if u, ok := pkt.(*unacknowledged); ok {
+		pkt = u.IFace
+	}
+
+	if p, ok := pkt.(*mqttp.Publish); ok {
+		return uint64(len(p.Payload())), true
+	}
+
+	return 0, false
+}
+
+// stored account publish message queued for delivery
+func (s *writer) stored(pkt interface{}) {
+	if size, ok := queuedSize(pkt); ok && s.storeMetric != nil {
+		s.storeMetric.Stored(size)
+	}
+}
+
+// released account publish message either delivered or handed over to persistence
+func (s *writer) released(pkt interface{}) {
+	if size, ok := queuedSize(pkt); ok && s.storeMetric != nil {
+		s.storeMetric.Released(size)
+	}
+}
+
 func (s *writer) encodeForPersistence(pkt mqttp.IFace) *persistence.PersistedPacket {
 	pPkt := &persistence.PersistedPacket{}
 
@@ -532,18 +678,21 @@ func (s *writer) getQueuedPackets() persistence.PersistedPackets {
 	var m interface{}
 
 	for m = s.qos0Messages.Remove(); m != nil; m = s.qos0Messages.Remove() {
+		s.released(m)
 		if s.offlineQoS0 {
 			packets.QoS0 = append(packets.QoS0, packetEncode(m))
 		}
 	}
 
 	for m = s.qos12Messages.Remove(); m != nil; m = s.qos12Messages.Remove() {
+		s.released(m)
 		packets.QoS12 = append(packets.QoS12, packetEncode(m))
 	}
 
 	s.pubOut.messages.Range(func(k, v interface{}) bool {
-		if pkt, ok := v.(mqttp.IFace); ok {
-			packets.UnAck = append(packets.UnAck, packetEncode(&unacknowledged{pkt}))
+		if e, ok := v.(*ackEntry); ok {
+			s.released(e.pkt)
+			packets.UnAck = append(packets.UnAck, packetEncode(&unacknowledged{e.pkt}))
 		}
 
 		s.pubOut.messages.Delete(k)
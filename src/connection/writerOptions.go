@@ -1,6 +1,8 @@
 package connection
 
 import (
+	"time"
+
 	"github.com/VolantMQ/vlapi/mqttp"
 	"github.com/VolantMQ/vlapi/plugin/persistence"
 	"systree"
@@ -86,3 +88,45 @@ func wrOfflineQoS0(val bool) writerOption {
 		return nil
 	}
 }
+
+func wrRetransmitMetric(val systree.RetransmitMetric) writerOption {
+	return func(t *writer) error {
+		t.rtMetric = val
+		return nil
+	}
+}
+
+func wrStoreMetric(val systree.StoreStat) writerOption {
+	return func(t *writer) error {
+		t.storeMetric = val
+		return nil
+	}
+}
+
+func wrAckTimeout(val time.Duration) writerOption {
+	return func(t *writer) error {
+		t.pubOut.timeout = val
+		return nil
+	}
+}
+
+func wrAckMaxTimeout(val time.Duration) writerOption {
+	return func(t *writer) error {
+		t.ackMaxTimeout = val
+		return nil
+	}
+}
+
+func wrAckBackoff(val float64) writerOption {
+	return func(t *writer) error {
+		t.ackBackoff = val
+		return nil
+	}
+}
+
+func wrAckRetries(val int) writerOption {
+	return func(t *writer) error {
+		t.ackRetries = val
+		return nil
+	}
+}
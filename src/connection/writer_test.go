@@ -0,0 +1,226 @@
+package connection
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+	persistenceMem "github.com/VolantMQ/vlapi/plugin/persistence/mem"
+)
+
+// retransmitMetric counts of resent messages and exhausted retries
+type retransmitMetric struct {
+	lock      sync.Mutex
+	resent    int
+	exhausted int
+}
+
+func (m *retransmitMetric) Resent(mqttp.Type) {
+	m.lock.Lock()
+	m.resent++
+	m.lock.Unlock()
+}
+
+func (m *retransmitMetric) Exhausted() {
+	m.lock.Lock()
+	m.exhausted++
+	m.lock.Unlock()
+}
+
+// newRetransmitWriter writer which is not running, resent packets stay in its queue
+func newRetransmitWriter(v mqttp.ProtocolVersion, timeout, max time.Duration, backoff float64, retries int) (*writer, *retransmitMetric) {
+	w := newWriter()
+	close(w.quit)
+
+	m := &retransmitMetric{}
+
+	w.version = v
+	w.rtMetric = m
+	w.pubOut.timeout = timeout
+	w.ackMaxTimeout = max
+	w.ackBackoff = backoff
+	w.ackRetries = retries
+
+	return w, m
+}
+
+func TestAckDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		max     time.Duration
+		backoff float64
+		delays  []time.Duration
+	}{
+		{"backoff capped", 300 * time.Millisecond, 2, []time.Duration{100, 200, 300, 300}},
+		{"backoff uncapped", 0, 2, []time.Duration{100, 200, 400, 800}},
+		{"no backoff", 300 * time.Millisecond, 1, []time.Duration{100, 100, 100, 100}},
+	}
+
+	for _, tt := range tests {
+		w, _ := newRetransmitWriter(mqttp.ProtocolV311, 100*time.Millisecond, tt.max, tt.backoff, 3)
+
+		for retry, d := range tt.delays {
+			if delay := w.ackDelay(retry); delay != d*time.Millisecond {
+				t.Errorf("%s: retry %d delay %v, want %v", tt.name, retry, delay, d*time.Millisecond)
+			}
+		}
+	}
+}
+
+func TestRetransmit(t *testing.T) {
+	w, m := newRetransmitWriter(mqttp.ProtocolV311, 100*time.Millisecond, 300*time.Millisecond, 2, 3)
+
+	pkt := newPublish(t, mqttp.ProtocolV311, mqttp.QoS1)
+	w.pubOut.store(pkt)
+
+	val, _ := w.pubOut.messages.Load(mqttp.IDType(1))
+	now := val.(*ackEntry).deadline
+
+	// timeout grows 100ms, 200ms, 300ms capped by max timeout
+	steps := []time.Duration{0, 200 * time.Millisecond, 300 * time.Millisecond}
+
+	for i, step := range steps {
+		now = now.Add(step)
+
+		if err := w.retransmit(now.Add(-time.Millisecond)); err != nil || w.gMessages.Length() != i {
+			t.Fatalf("retry %d: resent before timeout, err:%v", i+1, err)
+		}
+
+		if err := w.retransmit(now); err != nil {
+			t.Fatalf("retry %d: %v", i+1, err)
+		}
+
+		if w.gMessages.Length() != i+1 {
+			t.Fatalf("retry %d: queued %d, want %d", i+1, w.gMessages.Length(), i+1)
+		}
+	}
+
+	// DUP is set by writer routine, packet stored for ack is passed as is
+	if r, ok := w.gMessages.Peek().(*retransmit); !ok || r.IFace != pkt {
+		t.Errorf("queued %T, want retransmit of stored publish", w.gMessages.Peek())
+	}
+
+	// retries are exhausted once last timeout passes
+	if err := w.retransmit(now.Add(299 * time.Millisecond)); err != nil {
+		t.Errorf("closed before last timeout: %v", err)
+	}
+
+	if err := w.retransmit(now.Add(300 * time.Millisecond)); err != mqttp.CodeUnspecifiedError {
+		t.Errorf("exhausted retries: got %v, want %v", err, mqttp.CodeUnspecifiedError)
+	}
+
+	if m.resent != 3 || m.exhausted != 1 {
+		t.Errorf("resent %d, exhausted %d, want 3 and 1", m.resent, m.exhausted)
+	}
+
+	// acknowledged message is not resent
+	w.pubOut.release(pkt)
+
+	if err := w.retransmit(now.Add(time.Hour)); err != nil {
+		t.Errorf("released message: %v", err)
+	}
+}
+
+func TestRetransmitV5(t *testing.T) {
+	w, m := newRetransmitWriter(mqttp.ProtocolV50, 100*time.Millisecond, 0, 2, 1)
+
+	w.pubOut.store(newPublish(t, mqttp.ProtocolV50, mqttp.QoS1))
+
+	now := time.Now().Add(time.Second)
+
+	// [MQTT-4.4.0-1] nothing is resent while connected, client is disconnected once timeouts run out
+	if err := w.retransmit(now); err != nil || w.gMessages.Length() != 0 {
+		t.Fatalf("first timeout: err %v, queued %d", err, w.gMessages.Length())
+	}
+
+	if err := w.retransmit(now.Add(time.Second)); err != mqttp.CodeUnspecifiedError {
+		t.Errorf("exhausted retries: got %v, want %v", err, mqttp.CodeUnspecifiedError)
+	}
+
+	if m.resent != 0 || m.exhausted != 1 {
+		t.Errorf("resent %d, exhausted %d, want 0 and 1", m.resent, m.exhausted)
+	}
+}
+
+// TestRetransmitRoutine unacknowledged publish is resent over connection with DUP set and connection closed after retries
+func TestRetransmitRoutine(t *testing.T) {
+	period := ackCheckPeriod
+	ackCheckPeriod = 10 * time.Millisecond
+	t.Cleanup(func() {
+		ackCheckPeriod = period
+	})
+
+	srv, client := net.Pipe()
+	defer client.Close() // nolint: errcheck
+
+	p, _ := persistenceMem.Load(nil, nil)
+	persist, _ := p.Sessions()
+
+	r := &recorder{
+		published: make(chan *mqttp.Publish, 1),
+		closed:    make(chan DisconnectParams, 1),
+	}
+
+	cn := New(
+		NetConn(pipeConn{srv}),
+		Metric(nopMetric{}),
+		Persistence(persist),
+		RxQuota(10),
+		MaxRxPacketSize(1024),
+		AttachSession(r),
+		AckRetries(2),
+		AckBackoff(1),
+		func(t *impl) error {
+			wrAckTimeout(50 * time.Millisecond)(t.tx)
+			return nil
+		},
+	)
+
+	ch, err := cn.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+
+	writeFrame(t, client, []byte{0x10, 0x0e, 0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0x02, 0x00, 0x3c, 0x00, 0x02, 'c', '1'})
+
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("connect not received")
+	}
+
+	ack := mqttp.NewConnAck(mqttp.ProtocolV311)
+	ack.SetReturnCode(mqttp.CodeSuccess) // nolint: errcheck
+
+	go cn.Acknowledge(ack, Permissions(allowAll{}), ID("c1"))
+
+	expectFrame(t, client, "CONNACK", []byte{0x20, 0x02, 0x00, 0x00})
+
+	pkt := mqttp.NewPublish(mqttp.ProtocolV311)
+	pkt.Set("a/b", []byte("hi"), mqttp.QoS1, false, false) // nolint: errcheck
+
+	cn.(*impl).Publish("c1", pkt)
+
+	// QoS1, topic a/b, packet id 1, payload hi, resent with DUP flag
+	publish := []byte{0x32, 0x09, 0x00, 0x03, 'a', '/', 'b', 0x00, 0x01, 'h', 'i'}
+	resent := append([]byte{0x3a}, publish[1:]...)
+
+	start := time.Now()
+
+	expectFrame(t, client, "PUBLISH", publish)
+	expectFrame(t, client, "first resend", resent)
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("resent after %v, want not before ack timeout of 50ms", elapsed)
+	}
+
+	expectFrame(t, client, "second resend", resent)
+
+	select {
+	case <-r.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("connection not closed after retries exhausted")
+	}
+}
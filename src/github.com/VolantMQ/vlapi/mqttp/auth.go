@@ -48,7 +48,7 @@ func (msg *Auth) ReasonCode() ReasonCode {
 
 // SetReasonCode set authentication reason code
 func (msg *Auth) SetReasonCode(c ReasonCode) error {
-	if msg.authReason.IsValidForType(msg.mType) {
+	if !c.IsValidForType(msg.mType) {
 		return ErrInvalidMessageType
 	}
 
@@ -60,12 +60,25 @@ func (msg *Auth) SetReasonCode(c ReasonCode) error {
 // decode message
 func (msg *Auth) decodeMessage(from []byte) (int, error) {
 	offset := 0
+
+	// [MQTT-3.15.2.1] reason code and properties can be omitted if reason code is 0x00 (Success)
+	if msg.remLen < 1 {
+		msg.authReason = CodeSuccess
+		return offset, nil
+	}
+
 	msg.authReason = ReasonCode(from[offset])
 
 	if !msg.authReason.IsValidForType(msg.mType) {
 		return offset, CodeProtocolError
 	}
 
+	offset++
+
+	if msg.remLen < 2 {
+		return offset, nil
+	}
+
 	n, err := msg.properties.decode(msg.Type(), from[offset:])
 	return offset + n, err
 }
@@ -73,6 +86,8 @@ func (msg *Auth) decodeMessage(from []byte) (int, error) {
 func (msg *Auth) encodeMessage(to []byte) (int, error) {
 	offset := 0
 	to[offset] = byte(msg.authReason)
+	offset++
+
 	n, err := msg.properties.encode(to[offset:])
 
 	return offset + n, err
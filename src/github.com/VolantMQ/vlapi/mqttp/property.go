@@ -347,6 +347,13 @@ func (p *property) Set(t Type, id PropertyID, val interface{}) error {
 	}
 
 	fn := propertyCalcLen[propertyTypeMap[id]]
+
+	// replaced value does not contribute to length anymore
+	if old, ok := p.properties[id]; ok {
+		l, _ := fn(id, old)
+		p.len -= l
+	}
+
 	l, _ := fn(id, val)
 	p.len += l
 	p.properties[id] = val
@@ -26,6 +26,7 @@ type Publish struct {
 	payload   []byte
 	topic     string
 	publishID uintptr
+	publisher string
 	expireAt  time.Time
 }
 
@@ -71,7 +72,7 @@ func (msg *Publish) Expired() (time.Time, uint32, bool) {
 // qos, topic, payload, retain and properties
 func (msg *Publish) Clone(v ProtocolVersion) (*Publish, error) {
 	// message version should be same as session as encode/decode depends on it
-	pkt := NewPublish(msg.version)
+	pkt := NewPublish(v)
 
 	// [MQTT-3.3.1-9]
 	// [MQTT-3.3.1-3]
@@ -130,6 +131,16 @@ func (msg *Publish) SetPublishID(id uintptr) {
 	msg.publishID = id
 }
 
+// Publisher get client id of the message originator
+func (msg *Publish) Publisher() string {
+	return msg.publisher
+}
+
+// SetPublisher internally used client id of the originator to pick shared subscriber
+func (msg *Publish) SetPublisher(id string) {
+	msg.publisher = id
+}
+
 // Set topic/payload/qos/retained/bool
 func (msg *Publish) Set(t string, p []byte, q QosType, r bool, d bool) error {
 	if !ValidTopic([]byte(t)) {
@@ -72,20 +72,22 @@ func NewTopic(topic []byte) (*Topic, error) {
 	}
 
 	if bytes.HasPrefix(topic, dollarPrefix) {
-		if idx := bytes.Index(topic, topicSep); idx == 0 {
+		if idx := bytes.Index(topic, topicSep); idx > 0 {
 			t.dollarPrefix = topic[:idx]
 
-			if bytes.Compare(t.dollarPrefix, sharePrefix) == 0 {
+			if bytes.Equal(t.dollarPrefix, sharePrefix) {
 				if !SharedTopicRegexp.Copy().Match(topic) {
 					return nil, CodeProtocolError
 				}
 
-				sIdx := bytes.Index(topic[idx:], topicSep)
+				sIdx := idx + 1 + bytes.Index(topic[idx+1:], topicSep)
 				t.shareName = topic[idx+1 : sIdx]
 				t.filter = topic[sIdx+1:]
 			}
-		} else {
+		} else if bytes.Equal(topic, sharePrefix) {
 			return nil, CodeProtocolError
+		} else {
+			t.dollarPrefix = topic
 		}
 	}
 
@@ -65,64 +65,53 @@ func (s *sessions) SubscriptionsDelete(id []byte) error {
 	return nil
 }
 
-func (s *sessions) PacketsForEachQoS0(id []byte, ctx interface{}, load persistence.PacketLoader) error {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
+// packetsForEach load packets in order they were stored, packets loader asked to remove are dropped
+func packetsForEach(packets []*persistence.PersistedPacket, ctx interface{}, load persistence.PacketLoader) []*persistence.PersistedPacket {
+	left := packets[:0]
+
+	for i, pkt := range packets {
+		rm, err := load(ctx, pkt)
+		if !rm {
+			left = append(left, pkt)
+		}
 
-	if ses, loaded := s.entries[string(id)]; loaded {
-		for i := len(ses.QoS0) - 1; i >= 0; i-- {
-			rm, err := load(ctx, ses.QoS0[i])
+		if err != nil {
+			left = append(left, packets[i+1:]...)
+			break
+		}
+	}
 
-			if rm {
-				ses.QoS0 = append(ses.QoS0[:i], ses.QoS0[i+1:]...)
-			}
+	return left
+}
 
-			if err != nil {
-				break
-			}
-		}
+func (s *sessions) PacketsForEachQoS0(id []byte, ctx interface{}, load persistence.PacketLoader) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if ses, loaded := s.entries[string(id)]; loaded {
+		ses.QoS0 = packetsForEach(ses.QoS0, ctx, load)
 	}
 
 	return nil
 }
 
 func (s *sessions) PacketsForEachQoS12(id []byte, ctx interface{}, load persistence.PacketLoader) error {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
 	if ses, loaded := s.entries[string(id)]; loaded {
-		for i := len(ses.QoS12) - 1; i >= 0; i-- {
-			rm, err := load(ctx, ses.QoS12[i])
-
-			if rm {
-				ses.QoS12 = append(ses.QoS12[:i], ses.QoS12[i+1:]...)
-			}
-
-			if err != nil {
-				break
-			}
-		}
+		ses.QoS12 = packetsForEach(ses.QoS12, ctx, load)
 	}
 
 	return nil
 }
 
 func (s *sessions) PacketsForEachUnAck(id []byte, ctx interface{}, load persistence.PacketLoader) error {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
 	if ses, loaded := s.entries[string(id)]; loaded {
-		for i := len(ses.UnAck) - 1; i >= 0; i-- {
-			rm, err := load(ctx, ses.UnAck[i])
-
-			if rm {
-				ses.UnAck = append(ses.UnAck[:i], ses.UnAck[i+1:]...)
-			}
-
-			if err != nil {
-				break
-			}
-		}
+		ses.UnAck = packetsForEach(ses.UnAck, ctx, load)
 	}
 
 	return nil
@@ -191,6 +180,38 @@ func (s *sessions) PacketsDelete(id []byte) error {
 	return persistence.ErrNotFound
 }
 
+func packetsDrop(packets []*persistence.PersistedPacket, count int) []*persistence.PersistedPacket {
+	if count >= len(packets) {
+		return []*persistence.PersistedPacket{}
+	}
+
+	return append([]*persistence.PersistedPacket{}, packets[count:]...)
+}
+
+func (s *sessions) PacketsDropQoS0(id []byte, count int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if ses, loaded := s.entries[string(id)]; loaded {
+		ses.QoS0 = packetsDrop(ses.QoS0, count)
+		return nil
+	}
+
+	return persistence.ErrNotFound
+}
+
+func (s *sessions) PacketsDropQoS12(id []byte, count int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if ses, loaded := s.entries[string(id)]; loaded {
+		ses.QoS12 = packetsDrop(ses.QoS12, count)
+		return nil
+	}
+
+	return persistence.ErrNotFound
+}
+
 func (s *sessions) PacketStoreQoS0(id []byte, pkt *persistence.PersistedPacket) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -106,6 +106,10 @@ type Packets interface {
 	PacketsForEachUnAck(id []byte, ctx interface{}, loader PacketLoader) error
 	PacketsStore(id []byte, packets PersistedPackets) error
 	PacketsDelete(id []byte) error
+	// PacketsDropQoS0 and PacketsDropQoS12 remove count oldest packets of the queue
+	// whole queue is removed if it holds less packets
+	PacketsDropQoS0(id []byte, count int) error
+	PacketsDropQoS12(id []byte, count int) error
 }
 
 // Subscriptions session subscriptions interface
@@ -0,0 +1,120 @@
+package hooks
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"topics/types"
+)
+
+// Event types posted to hooks
+const (
+	// EventConnected client connection acknowledged
+	EventConnected = "client.connected"
+	// EventDisconnected client connection closed
+	EventDisconnected = "client.disconnected"
+	// EventSubscribed client subscribed to topic filter
+	EventSubscribed = "session.subscribed"
+	// EventUnsubscribed client unsubscribed from topic filter
+	EventUnsubscribed = "session.unsubscribed"
+	// EventPublished client published message
+	EventPublished = "message.published"
+)
+
+// SignatureHeader HMAC-SHA256 of the request body, sha256={hex} format
+const SignatureHeader = "X-Nicemqtt-Signature"
+
+var (
+	// ErrInvalidURL url of the hook is not valid http(s) url
+	ErrInvalidURL = errors.New("hooks: invalid url")
+	// ErrInvalidEvent unknown event type
+	ErrInvalidEvent = errors.New("hooks: invalid event")
+	// ErrInvalidTopic invalid topic filter
+	ErrInvalidTopic = errors.New("hooks: invalid topic")
+)
+
+var eventTypes = map[string]bool{
+	EventConnected:    true,
+	EventDisconnected: true,
+	EventSubscribed:   true,
+	EventUnsubscribed: true,
+	EventPublished:    true,
+}
+
+// Config of the single hook
+type Config struct {
+	// Name used in logs, URL by default
+	Name string
+	// URL events are POSTed to
+	URL string
+	// Events types posted to hook, all by default
+	Events []string
+	// Topics filters of subscribe, unsubscribe and publish events, all topics by default
+	// filters are matched against topics as seen by client, without project namespace
+	Topics []string
+	// Payload put payload of published messages into event
+	Payload bool
+	// Secret if set body is signed with HMAC-SHA256 in SignatureHeader
+	Secret  string
+	Headers map[string]string
+	// QueueSize events waiting for delivery, new events are dropped once queue is full
+	QueueSize int
+	// Retries attempts after failed delivery, negative disables retries
+	Retries int
+	// Timeout of the single request
+	Timeout time.Duration
+	// BackoffMin and BackoffMax delay before retry, doubles after every failure
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+}
+
+func (c *Config) validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return ErrInvalidURL
+	}
+
+	for _, e := range c.Events {
+		if !eventTypes[e] {
+			return ErrInvalidEvent
+		}
+	}
+
+	for _, t := range c.Topics {
+		if len(t) == 0 || !topicsTypes.TopicSubscribeRegexp.MatchString(t) {
+			return ErrInvalidTopic
+		}
+	}
+
+	if len(c.Name) == 0 {
+		c.Name = c.URL
+	}
+
+	if c.QueueSize <= 0 {
+		c.QueueSize = 1024
+	}
+
+	if c.Retries == 0 {
+		c.Retries = 3
+	} else if c.Retries < 0 {
+		c.Retries = 0
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Second
+	}
+
+	if c.BackoffMin <= 0 {
+		c.BackoffMin = time.Second
+	}
+
+	if c.BackoffMax < c.BackoffMin {
+		c.BackoffMax = 30 * time.Second
+		if c.BackoffMax < c.BackoffMin {
+			c.BackoffMax = c.BackoffMin
+		}
+	}
+
+	return nil
+}
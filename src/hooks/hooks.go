@@ -0,0 +1,257 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"logs"
+	"topics/types"
+)
+
+var (
+	log = logs.GetLogger()
+)
+
+// Event posted to hooks as JSON body
+type Event struct {
+	Type      string `json:"event"`
+	Timestamp string `json:"timestamp"`
+	ClientID  string `json:"client_id"`
+	Username  string `json:"username,omitempty"`
+	// Namespace topic namespace of the client project, empty if project isolation is off
+	Namespace string `json:"namespace,omitempty"`
+	// Address remote address, connected event only
+	Address string `json:"address,omitempty"`
+	// Topic filter of subscribe and unsubscribe events, topic name of publish event
+	Topic string `json:"topic,omitempty"`
+	// QoS granted QoS of subscribe event, QoS of published message
+	QoS     byte   `json:"qos"`
+	Retain  bool   `json:"retain,omitempty"`
+	Payload []byte `json:"payload,omitempty"`
+	// Reason of disconnect
+	Reason string `json:"reason,omitempty"`
+}
+
+// NewEvent allocate event of given type stamped with current time
+func NewEvent(t string, clientID string) *Event {
+	return &Event{
+		Type:      t,
+		Timestamp: time.Now().Format(time.RFC3339),
+		ClientID:  clientID,
+	}
+}
+
+// Sink accepts broker events and delivers them to hooks
+type Sink interface {
+	// Notify queue event for delivery, never blocks
+	// event must not be modified after call
+	Notify(*Event)
+	// Shutdown stop delivery, queued events are dropped
+	Shutdown() error
+}
+
+type impl struct {
+	hooks []*hook
+}
+
+type hook struct {
+	Config
+	events  map[string]bool
+	client  *http.Client
+	queue   chan *Event
+	quit    chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	dropped uint64
+}
+
+var _ Sink = (*impl)(nil)
+
+// New start delivery workers of hooks
+func New(configs []Config) (Sink, error) {
+	s := &impl{}
+
+	for _, c := range configs {
+		if err := c.validate(); err != nil {
+			return nil, err
+		}
+
+		h := &hook{
+			Config: c,
+			client: &http.Client{Timeout: c.Timeout},
+			queue:  make(chan *Event, c.QueueSize),
+			quit:   make(chan struct{}),
+		}
+
+		if len(c.Events) > 0 {
+			h.events = make(map[string]bool)
+			for _, e := range c.Events {
+				h.events[e] = true
+			}
+		}
+
+		h.ctx, h.cancel = context.WithCancel(context.Background())
+
+		s.hooks = append(s.hooks, h)
+	}
+
+	for _, h := range s.hooks {
+		h.wg.Add(1)
+		go h.run()
+	}
+
+	return s, nil
+}
+
+// Notify put event into queue of every hook accepting it
+func (s *impl) Notify(e *Event) {
+	for _, h := range s.hooks {
+		if !h.accept(e) {
+			continue
+		}
+
+		select {
+		case h.queue <- e:
+		default:
+			if atomic.AddUint64(&h.dropped, 1)%100 == 1 {
+				log.Warn("hook %s: queue is full, dropped %d events", h.Name, atomic.LoadUint64(&h.dropped))
+			}
+		}
+	}
+}
+
+// Shutdown stop delivery workers
+func (s *impl) Shutdown() error {
+	for _, h := range s.hooks {
+		close(h.quit)
+		h.cancel()
+	}
+
+	for _, h := range s.hooks {
+		h.wg.Wait()
+
+		if n := len(h.queue); n > 0 {
+			log.Warn("hook %s: %d undelivered events dropped on shutdown", h.Name, n)
+		}
+	}
+
+	return nil
+}
+
+func (h *hook) accept(e *Event) bool {
+	if h.events != nil && !h.events[e.Type] {
+		return false
+	}
+
+	if len(h.Topics) == 0 || len(e.Topic) == 0 {
+		return true
+	}
+
+	for _, f := range h.Topics {
+		if topicsTypes.TopicMatch(f, e.Topic) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// run deliver events one by one keeping order they were produced in
+func (h *hook) run() {
+	defer h.wg.Done()
+
+	for {
+		select {
+		case <-h.quit:
+			return
+		case e := <-h.queue:
+			h.deliver(e)
+		}
+	}
+}
+
+func (h *hook) deliver(e *Event) {
+	ev := *e
+	if !h.Payload {
+		ev.Payload = nil
+	}
+
+	body, err := json.Marshal(&ev)
+	if err != nil {
+		log.Error("hook %s: encode event %s, err:%s", h.Name, e.Type, err.Error())
+		return
+	}
+
+	delay := h.BackoffMin
+
+	for attempt := 0; ; attempt++ {
+		retry, err := h.post(body)
+		if err == nil {
+			return
+		}
+
+		if !retry || attempt >= h.Retries {
+			log.Error("hook %s: drop event %s, clientId:%s, err:%s", h.Name, e.Type, e.ClientID, err.Error())
+			return
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-h.quit:
+			return
+		}
+
+		if delay *= 2; delay > h.BackoffMax {
+			delay = h.BackoffMax
+		}
+	}
+}
+
+// post send body once, returns true if delivery might succeed on retry
+func (h *hook) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req = req.WithContext(h.ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if len(h.Secret) > 0 {
+		mac := hmac.New(sha256.New, []byte(h.Secret))
+		mac.Write(body) // nolint: errcheck
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+
+	io.Copy(ioutil.Discard, resp.Body) // nolint: errcheck
+	resp.Body.Close()                  // nolint: errcheck
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("unexpected status %s", resp.Status)
+
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
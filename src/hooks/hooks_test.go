@@ -0,0 +1,240 @@
+package hooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// request received by hook server
+type request struct {
+	at     time.Time
+	header http.Header
+	body   []byte
+	event  Event
+}
+
+// server answering with statuses in order, last one is repeated
+func server(t *testing.T, statuses ...int) (*httptest.Server, chan request) {
+	received := make(chan request, 16)
+
+	var lock sync.Mutex
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		req := request{at: time.Now(), header: r.Header, body: body}
+		if err := json.Unmarshal(body, &req.event); err != nil {
+			t.Errorf("decode event: %v", err)
+		}
+
+		lock.Lock()
+		status := statuses[0]
+		if len(statuses) > 1 {
+			statuses = statuses[1:]
+		}
+		lock.Unlock()
+
+		w.WriteHeader(status)
+		received <- req
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv, received
+}
+
+func newSink(t *testing.T, c Config) Sink {
+	s, err := New([]Config{c})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	t.Cleanup(func() {
+		s.Shutdown() // nolint: errcheck
+	})
+
+	return s
+}
+
+func next(t *testing.T, received chan request) request {
+	select {
+	case r := <-received:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatalf("event is not delivered")
+	}
+
+	return request{}
+}
+
+func none(t *testing.T, received chan request, wait time.Duration) {
+	select {
+	case r := <-received:
+		t.Errorf("unexpected delivery of %s %s", r.event.Type, r.event.Topic)
+	case <-time.After(wait):
+	}
+}
+
+func event(typ string, topic string) *Event {
+	e := NewEvent(typ, "c1")
+	e.Topic = topic
+	e.Payload = []byte("data")
+
+	return e
+}
+
+func TestFilters(t *testing.T) {
+	srv, received := server(t, http.StatusOK)
+
+	s := newSink(t, Config{
+		URL:    srv.URL,
+		Events: []string{EventConnected, EventPublished, EventSubscribed},
+		Topics: []string{"a/+", "b/#"},
+	})
+
+	tests := []struct {
+		e      *Event
+		accept bool
+	}{
+		{event(EventConnected, ""), true},
+		{event(EventPublished, "a/1"), true},
+		{event(EventPublished, "a/1/2"), false},
+		{event(EventSubscribed, "b/#"), true},
+		{event(EventPublished, "b/1/2"), true},
+		{event(EventPublished, "c"), false},
+		{event(EventDisconnected, ""), false},
+		{event(EventUnsubscribed, "a/1"), false},
+	}
+
+	for _, tt := range tests {
+		s.Notify(tt.e)
+
+		if !tt.accept {
+			none(t, received, 20*time.Millisecond)
+			continue
+		}
+
+		if r := next(t, received); r.event.Type != tt.e.Type || r.event.Topic != tt.e.Topic {
+			t.Errorf("expected %s %s, got %s %s", tt.e.Type, tt.e.Topic, r.event.Type, r.event.Topic)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	srv, received := server(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusOK)
+
+	s := newSink(t, Config{
+		URL:        srv.URL,
+		Retries:    3,
+		BackoffMin: 20 * time.Millisecond,
+		BackoffMax: 30 * time.Millisecond,
+	})
+
+	s.Notify(event(EventConnected, ""))
+
+	var at []time.Time
+	for i := 0; i < 4; i++ {
+		at = append(at, next(t, received).at)
+	}
+
+	// delay doubles and is capped by max
+	for i, min := range []time.Duration{20 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond} {
+		if d := at[i+1].Sub(at[i]); d < min {
+			t.Errorf("retry %d: expected delay at least %s, got %s", i+1, min, d)
+		}
+	}
+
+	none(t, received, 50*time.Millisecond)
+}
+
+func TestRetryLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		retries  int
+		attempts int
+	}{
+		{"server error", http.StatusBadGateway, 2, 3},
+		{"retries disabled", http.StatusBadGateway, -1, 1},
+		{"client error", http.StatusBadRequest, 2, 1},
+	}
+
+	for _, tt := range tests {
+		srv, received := server(t, tt.status)
+
+		s := newSink(t, Config{
+			URL:        srv.URL,
+			Retries:    tt.retries,
+			BackoffMin: time.Millisecond,
+		})
+
+		s.Notify(event(EventConnected, ""))
+
+		for i := 0; i < tt.attempts; i++ {
+			next(t, received)
+		}
+
+		none(t, received, 50*time.Millisecond)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	srv, received := server(t, http.StatusOK)
+
+	s := newSink(t, Config{
+		URL:     srv.URL,
+		Secret:  "secret",
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	})
+
+	s.Notify(event(EventPublished, "a"))
+
+	r := next(t, received)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(r.body) // nolint: errcheck
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if sig := r.header.Get(SignatureHeader); sig != expected {
+		t.Errorf("signature: expected %s, got %s", expected, sig)
+	}
+
+	if h := r.header.Get("Authorization"); h != "Bearer token" {
+		t.Errorf("custom header is not set: %q", h)
+	}
+
+	if ct := r.header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("content type: %q", ct)
+	}
+
+	// payload is sent only if enabled
+	if r.event.Payload != nil {
+		t.Errorf("payload must be omitted")
+	}
+}
+
+func TestNoSignature(t *testing.T) {
+	srv, received := server(t, http.StatusOK)
+
+	s := newSink(t, Config{URL: srv.URL, Payload: true})
+
+	s.Notify(event(EventPublished, "a"))
+
+	r := next(t, received)
+
+	if sig := r.header.Get(SignatureHeader); len(sig) != 0 {
+		t.Errorf("unexpected signature without secret: %s", sig)
+	}
+
+	if string(r.event.Payload) != "data" {
+		t.Errorf("payload: expected data, got %q", r.event.Payload)
+	}
+}
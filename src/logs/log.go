@@ -87,8 +87,12 @@ func newLogger() *Logger {
 	basedir := os.Getenv("APP_BASE_DIR")
 	logFile := filepath.Join(basedir, "conf", "log4g.json")
 	config := conf.LoadFile(logFile)
-	pattern := config.GetString("pattern")
-	param := config.GetJson()
+	//配置文件不存在时输出到控制台
+	pattern, param := "console", ""
+	if config != nil {
+		pattern = config.GetString("pattern")
+		param = config.GetJson()
+	}
 	if err := logger.setLogger(pattern, param); err != nil {
 		fmt.Println("set log failed. err:", err)
 	}
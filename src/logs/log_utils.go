@@ -35,6 +35,16 @@ func transLogLevel(level string) int {
 	return ret
 }
 
+// ParseLevel level of the name, one of DEBUG, INFO, WARN, ERROR, FATAL
+func ParseLevel(level string) (int, bool) {
+	switch level {
+	case "DEBUG", "INFO", "WARN", "ERROR", "FATAL":
+		return transLogLevel(level), true
+	}
+
+	return DEBUG, false
+}
+
 //获取当前的协程id。官方不提供go id，这里通过堆栈信息获取，仅DEBUG日志使用
 func getGID() string {
 	buf := make([]byte, 64)
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+
+	"common"
+	"github.com/VolantMQ/vlapi/mqttp"
+	"types"
+)
+
+// mqttConfig mqtt section of the config, protocol options advertised to clients
+// options not set keep defaults of common package
+type mqttConfig struct {
+	// Version protocols accepted: v3.1, v3.1.1, v5.0
+	Version []string `json:"version"`
+	// ConnectTimeout seconds to wait CONNECT after connection accepted
+	ConnectTimeout int `json:"connect_timeout"`
+	// SessionDups allow client to take over session of connected client with same id
+	SessionDups     bool `json:"session_dups"`
+	RetainAvailable bool `json:"retain_available"`
+	SubsOverlap     bool `json:"subs_overlap"`
+	SubsID          bool `json:"subs_id"`
+	SubsWildcard    bool `json:"subs_wildcard"`
+	ReceiveMax      int  `json:"receive_max"`
+	MaxPacketSize   int  `json:"max_packet_size"`
+	MaxTopicAlias   int  `json:"max_topic_alias"`
+	MaxQoS          int  `json:"max_qos"`
+	KeepAlive       struct {
+		// Period keep alive clients are told to use if Force is set, v5 clients get it as Server Keep Alive
+		Period int  `json:"period"`
+		Force  bool `json:"force"`
+	} `json:"keep_alive"`
+	Systree struct {
+		Enabled        bool `json:"enabled"`
+		UpdateInterval int  `json:"update_interval"`
+	} `json:"systree"`
+	Acceptor struct {
+		MaxIncoming int `json:"max_incoming"`
+		PreSpawn    int `json:"pre_spawn"`
+	} `json:"acceptor"`
+}
+
+func (c *mqttConfig) validate() error {
+	if len(c.Version) == 0 {
+		return fmt.Errorf("version: at least one protocol required")
+	}
+
+	for _, v := range c.Version {
+		switch v {
+		case "v3.1", "v3.1.1", "v5.0":
+		default:
+			return fmt.Errorf("version: unknown protocol %q", v)
+		}
+	}
+
+	switch {
+	case c.ConnectTimeout <= 0:
+		return fmt.Errorf("connect_timeout: must be positive")
+	case c.ReceiveMax < 1 || c.ReceiveMax > types.DefaultReceiveMax:
+		return fmt.Errorf("receive_max: must be within 1..%d", types.DefaultReceiveMax)
+	case c.MaxPacketSize < 1 || c.MaxPacketSize > types.DefaultMaxPacketSize:
+		return fmt.Errorf("max_packet_size: must be within 1..%d", types.DefaultMaxPacketSize)
+	case c.MaxTopicAlias < 0 || c.MaxTopicAlias > 65535:
+		return fmt.Errorf("max_topic_alias: must be within 0..65535")
+	case c.MaxQoS < 0 || c.MaxQoS > int(mqttp.QoS2):
+		return fmt.Errorf("max_qos: must be 0, 1 or 2")
+	case c.KeepAlive.Period < 0 || c.KeepAlive.Period > 65535:
+		return fmt.Errorf("keep_alive.period: must be within 0..65535")
+	case c.Systree.UpdateInterval < 0:
+		return fmt.Errorf("systree.update_interval: must not be negative")
+	case c.Acceptor.MaxIncoming <= 0:
+		return fmt.Errorf("acceptor.max_incoming: must be positive")
+	case c.Acceptor.PreSpawn < 0 || c.Acceptor.PreSpawn > c.Acceptor.MaxIncoming:
+		return fmt.Errorf("acceptor.pre_spawn: must be within 0..max_incoming")
+	}
+
+	return nil
+}
+
+// loadMQTTOptions apply mqtt section of the config to common options
+// options are read once on start, changing them requires restart
+func loadMQTTOptions() error {
+	c := mqttConfig{
+		// copy, decoding reuses backing array of the slice and rejected section must not change it
+		Version:         append([]string(nil), common.VERSION...),
+		ConnectTimeout:  common.ConnectTimeout,
+		SessionDups:     common.SessionDups,
+		RetainAvailable: common.RetainAvailable,
+		SubsOverlap:     common.SubsOverlap,
+		SubsID:          common.SubsID,
+		SubsWildcard:    common.SubsWildcard,
+		ReceiveMax:      common.ReceiveMax,
+		MaxPacketSize:   int(common.MaxPacketSize),
+		MaxTopicAlias:   int(common.MaxTopicAlias),
+		MaxQoS:          int(common.MaxQoS),
+	}
+	c.KeepAlive.Period = common.Period
+	c.KeepAlive.Force = common.Force
+	c.Systree.Enabled = common.Enabled
+	c.Systree.UpdateInterval = common.UpdateInterval
+	c.Acceptor.MaxIncoming = common.MaxIncoming
+	c.Acceptor.PreSpawn = common.PreSpawn
+
+	if _, err := config.GetObject("mqtt", &c); err != nil {
+		return err
+	}
+
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	common.VERSION = c.Version
+	common.ConnectTimeout = c.ConnectTimeout
+	common.SessionDups = c.SessionDups
+	common.RetainAvailable = c.RetainAvailable
+	common.SubsOverlap = c.SubsOverlap
+	common.SubsID = c.SubsID
+	common.SubsWildcard = c.SubsWildcard
+	common.ReceiveMax = c.ReceiveMax
+	common.MaxPacketSize = uint32(c.MaxPacketSize)
+	common.MaxTopicAlias = uint16(c.MaxTopicAlias)
+	common.MaxQoS = mqttp.QosType(c.MaxQoS)
+	common.Period = c.KeepAlive.Period
+	common.Force = c.KeepAlive.Force
+	common.Enabled = c.Systree.Enabled
+	common.UpdateInterval = c.Systree.UpdateInterval
+	common.MaxIncoming = c.Acceptor.MaxIncoming
+	common.PreSpawn = c.Acceptor.PreSpawn
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"common"
+	"github.com/VolantMQ/vlapi/mqttp"
+)
+
+// keepMQTTOptions restore options of common package once test done
+func keepMQTTOptions(t *testing.T) {
+	version, maxQoS, period, force := common.VERSION, common.MaxQoS, common.Period, common.Force
+	receiveMax, maxIncoming, preSpawn := common.ReceiveMax, common.MaxIncoming, common.PreSpawn
+
+	t.Cleanup(func() {
+		common.VERSION, common.MaxQoS, common.Period, common.Force = version, maxQoS, period, force
+		common.ReceiveMax, common.MaxIncoming, common.PreSpawn = receiveMax, maxIncoming, preSpawn
+	})
+}
+
+func TestLoadMQTTOptions(t *testing.T) {
+	keepMQTTOptions(t)
+
+	setTestConfig(t, `{"mqtt":{"version":["v3.1.1","v5.0"],"max_qos":1,"keep_alive":{"period":30,"force":true}}}`)
+
+	if err := loadMQTTOptions(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if !reflect.DeepEqual(common.VERSION, []string{"v3.1.1", "v5.0"}) || common.MaxQoS != mqttp.QoS1 {
+		t.Errorf("version %v, max qos %d", common.VERSION, common.MaxQoS)
+	}
+
+	if common.Period != 30 || !common.Force {
+		t.Errorf("keep alive %d, force %v, want 30 and forced", common.Period, common.Force)
+	}
+
+	// options absent from section keep their values
+	setTestConfig(t, `{"mqtt":{"max_qos":2}}`)
+
+	if err := loadMQTTOptions(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if common.MaxQoS != mqttp.QoS2 || common.Period != 30 || !common.Force || len(common.VERSION) != 2 {
+		t.Errorf("options not in section changed: period %d, force %v, version %v", common.Period, common.Force, common.VERSION)
+	}
+}
+
+func TestLoadMQTTOptionsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		mqtt string
+		err  string
+	}{
+		{"unknown version", `{"version":["v4"]}`, "version"},
+		{"version as string", `{"version":"v3.1.1"}`, ""},
+		{"no version", `{"version":[]}`, "version"},
+		{"max qos", `{"max_qos":3}`, "max_qos"},
+		{"negative max qos", `{"max_qos":-1}`, "max_qos"},
+		{"keep alive period", `{"keep_alive":{"period":70000,"force":true}}`, "keep_alive"},
+		{"receive max", `{"receive_max":0}`, "receive_max"},
+		{"pre spawn", `{"acceptor":{"max_incoming":2,"pre_spawn":3}}`, "pre_spawn"},
+	}
+
+	for _, tt := range tests {
+		keepMQTTOptions(t)
+		setTestConfig(t, `{"mqtt":`+tt.mqtt+`}`)
+
+		maxQoS, period, version := common.MaxQoS, common.Period, append([]string(nil), common.VERSION...)
+
+		err := loadMQTTOptions()
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got %v, want error about %q", tt.name, err, tt.err)
+		}
+
+		// rejected section is not applied
+		if common.MaxQoS != maxQoS || common.Period != period || !reflect.DeepEqual(common.VERSION, version) {
+			t.Errorf("%s: options changed by invalid section", tt.name)
+		}
+	}
+}
@@ -4,19 +4,31 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 
 	"auth"
+	"bridge"
+	"common"
 	"conf"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/VolantMQ/vlapi/plugin/persistence"
 	"github.com/VolantMQ/vlapi/plugin/persistence/mem"
+	"hooks"
 	"io/ioutil"
 	"logs"
+	"net"
 	"orm"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"persistence/file"
+	"persistence/sql"
 	"server"
+	"strings"
 	"syscall"
+	"time"
 	"transport"
+	"types"
 	"utils"
 )
 
@@ -37,10 +49,46 @@ type User struct {
 	Address string `orm:"size(512);null"`
 }
 
+// Acl topic access rule, rules are applied in order of Seq
+type Acl struct {
+	Id        int `orm:"auto"`
+	Seq       int
+	Action    string `orm:"size(8)"`
+	Username  string `orm:"size(128);null"`
+	ClientId  string `orm:"size(128);null"`
+	ProjectId string `orm:"size(64);null"`
+	Topic     string `orm:"size(256)"`
+	// Access comma separated list of read, write, subscribe
+	Access string `orm:"size(64)"`
+}
+
+// Ban entry of the ban list, see auth.Ban
+type Ban struct {
+	Id     int    `orm:"auto"`
+	Kind   string `orm:"size(16)"`
+	Value  string `orm:"size(256)"`
+	Reason string `orm:"size(512);null"`
+	// Expires unix time ban is lifted at, 0 for permanent ban
+	Expires int64
+	Created time.Time `orm:"type(datetime)"`
+}
+
+// TableUnique single ban of every kind and value
+func (b *Ban) TableUnique() [][]string {
+	return [][]string{{"Kind", "Value"}}
+}
 
 func initDB() error {
 	// register model
-	orm.RegisterModel(new(User))
+	orm.RegisterModel(new(User), new(Acl), new(Ban))
+
+	pc, err := loadPersistenceConfig()
+	if err != nil {
+		return err
+	}
+	if pc.Type == "sql" {
+		persistenceSQL.RegisterModels()
+	}
 
 	dsn := fmt.Sprintf("blue:blue@123@tcp(%s:%d)/blue?charset=utf8", config.GetString("db_host"),
 		config.GetIntWithDefault("db_port", 3306))
@@ -56,14 +104,13 @@ func initDB() error {
 	return nil
 }
 
-func getUsers() []User {
+func getUsers() ([]User, error) {
 	var users []User
 	// 获取 QueryBuilder 对象. 需要指定数据库驱动参数。
-	// 第二个返回值是错误对象，在这里略过
 	qb, err := orm.NewQueryBuilder("mysql")
 	if err != nil {
 		log.Error("build sql error:%s", err.Error())
-		return users
+		return users, err
 	}
 
 	// 构建查询对象
@@ -74,63 +121,602 @@ func getUsers() []User {
 	log.Debug(sql)
 	// 执行 SQL 语句
 	o := orm.NewOrm()
-	o.Raw(sql).QueryRows(&users)
+	_, err = o.Raw(sql).QueryRows(&users)
+
+	return users, err
+}
+
+// internalUserMap user in form accepted by internal auth provider
+func internalUserMap(user User) map[string]string {
+	userMap := make(map[string]string)
+	userMap["name"] = user.Name
+	userMap["password"] = user.Passwd
+	userMap["project_id"] = user.Id
+	return userMap
+}
+
+func getAcls() []Acl {
+	var acls []Acl
+	qb, err := orm.NewQueryBuilder("mysql")
+	if err != nil {
+		log.Error("build sql error:%s", err.Error())
+		return acls
+	}
+
+	qb = qb.Select("*").From("acl").OrderBy("seq", "id").Asc()
+
+	sql := qb.String()
+	log.Debug(sql)
+	o := orm.NewOrm()
+	o.Raw(sql).QueryRows(&acls)
+
+	return acls
+}
+
+// loadACL fill acl provider with rules from acl_file followed by rules from acl table
+func loadACL(setRules func(string, []auth.ACLRule) error) error {
+	cfg := &auth.ACLConfig{}
+
+	if file := config.GetString("acl_file"); len(file) > 0 {
+		var err error
+		if cfg, err = auth.LoadACLConfig(filepath.Join(basedir, "conf", file)); err != nil {
+			return err
+		}
+	}
+
+	if config.GetBoolWithDefault("acl_db", false) {
+		for _, a := range getAcls() {
+			cfg.Rules = append(cfg.Rules, auth.ACLRule{
+				Action:   a.Action,
+				Username: a.Username,
+				ClientID: a.ClientId,
+				Project:  a.ProjectId,
+				Topic:    a.Topic,
+				Access:   strings.Split(a.Access, ","),
+			})
+		}
+	}
+
+	// acl_default decides on access none of providers of the listener has decision on
+	if err := auth.SetACLDefault(config.GetString("acl_default")); err != nil {
+		log.Error("invalid acl_default %q", config.GetString("acl_default"))
+		return err
+	}
+
+	log.Debug("acl rules size:%d", len(cfg.Rules))
+
+	return setRules(cfg.Default, cfg.Rules)
+}
 
-	return users
+// scramConfig auth_scram section of the config
+type scramConfig struct {
+	// File json array of users with RFC 5803 credentials, relative to conf directory
+	File string `json:"file"`
+	// InternalUsers derive credentials of users loaded from database as well
+	InternalUsers bool `json:"internal_users"`
 }
 
-func registerAuth() *auth.Manager {
+// registerAuth register auth providers listeners may refer to by name
+func registerAuth() error {
 	if err := initDB(); err != nil {
-		log.Error("initDB fail:%s", err.Error())
-		return nil
+		return err
 	}
 	sAuth := auth.NewSimpleAuth()
-	userList := getUsers()
+	userList, err := getUsers()
+	if err != nil {
+		log.Error("load users err:%s", err.Error())
+	}
 	log.Debug("user size:%d", len(userList))
 	for _, user := range userList {
-		userMap := make(map[string] string)
-		userMap["name"] = user.Name
-		userMap["password"] = user.Passwd
-		userMap["project_id"] = user.Id
-		sAuth.AddUser(userMap)
+		sAuth.AddUser(internalUserMap(user))
+	}
+	internalUsers = userList
+	if err := auth.Register("internal", sAuth); err != nil {
+		return err
+	}
+
+	acl := auth.NewACL(sAuth.GetUser)
+	if err := loadACL(acl.SetRules); err != nil {
+		return fmt.Errorf("acl: %s", err.Error())
+	}
+	if err := auth.Register("acl", acl); err != nil {
+		return err
+	}
+	aclRules = acl.SetRules
+
+	// http鉴权: listeners having "http" in auth list delegate decisions to endpoints of auth_http section
+	httpConfig := auth.HTTPConfig{}
+	if ok, err := config.GetObject("auth_http", &httpConfig); err != nil {
+		return fmt.Errorf("auth_http: %s", err.Error())
+	} else if ok {
+		httpAuth, err := auth.NewHTTPAuth(httpConfig)
+		if err != nil {
+			return fmt.Errorf("auth_http: %s", err.Error())
+		}
+		if err = auth.Register("http", httpAuth); err != nil {
+			return err
+		}
+	}
+
+	// jwt鉴权: token is sent as password, key files are relative to conf directory
+	jwtConfig := auth.JWTConfig{}
+	if ok, err := config.GetObject("auth_jwt", &jwtConfig); err != nil {
+		return fmt.Errorf("auth_jwt: %s", err.Error())
+	} else if ok {
+		for _, f := range []*string{&jwtConfig.SecretFile, &jwtConfig.PublicKeyFile, &jwtConfig.JWKSFile} {
+			if len(*f) > 0 {
+				*f = filepath.Join(basedir, "conf", *f)
+			}
+		}
+		jwtAuth, err := auth.NewJWTAuth(jwtConfig)
+		if err != nil {
+			return fmt.Errorf("auth_jwt: %s", err.Error())
+		}
+		if err = auth.Register("jwt", jwtAuth); err != nil {
+			return err
+		}
+	}
+
+	// scram鉴权: MQTT 5 clients authenticate with AUTH packets exchange, method SCRAM-SHA-256
+	sc := scramConfig{}
+	if ok, err := config.GetObject("auth_scram", &sc); err != nil {
+		return fmt.Errorf("auth_scram: %s", err.Error())
+	} else if ok {
+		scramAuth := auth.NewSCRAMAuth()
+		scramUsers = scramAuth
+		if err = setSCRAMUsers(&sc, userList); err != nil {
+			return fmt.Errorf("auth_scram: %s", err.Error())
+		}
+		if err = auth.Register("scram", scramAuth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listenerConfig entry of the listeners array in nicemqtt.json
+type listenerConfig struct {
+	// Type one of tcp, ssl, ws, wss
+	Type string `json:"type"`
+	Host string `json:"host"`
+	Port string `json:"port"`
+	// Path websocket path, ws and wss only
+	Path string `json:"path"`
+	// Cert and Key file names relative to conf directory, ssl and wss only
+	Cert      string   `json:"cert"`
+	Key       string   `json:"key"`
+	Auth      []string `json:"auth"`
+	Anonymous bool     `json:"anonymous"`
+	// ClientCA CA bundle client certificates are verified against, enables mutual tls
+	// certificate is optional unless ClientCertRequired is set
+	ClientCA           string `json:"client_ca"`
+	ClientCertRequired bool   `json:"client_cert_required"`
+	// CRL revocation lists issued by CA of the bundle, PEM or DER
+	CRL string `json:"crl"`
+	// CertUsername and CertClientID field of the client certificate, cn or san,
+	// taking place of username and client id, client with certificate derived username needs no password
+	CertUsername string `json:"cert_username"`
+	CertClientID string `json:"cert_clientid"`
+	// RateLimit limits of clients connected to the listener, replaces global rate_limit
+	RateLimit *rateLimitConfig `json:"rate_limit"`
+	// OfflineQoS0 persist QoS0 messages for offline sessions of the listener, replaces global offline_qos0
+	OfflineQoS0 *bool `json:"offline_qos0"`
+}
+
+// offlineQueueConfig limits of messages kept for offline session
+type offlineQueueConfig struct {
+	// MaxMessages and MaxBytes per session, 0 is unlimited
+	MaxMessages int `json:"max_messages"`
+	MaxBytes    int `json:"max_bytes"`
+	// Overflow drop_oldest, drop_newest or drop_qos0
+	Overflow string `json:"overflow"`
+}
+
+// rateLimitConfig publish limits of a client, see types.RateLimit
+type rateLimitConfig struct {
+	// Messages and Bytes per second, 0 is unlimited
+	Messages float64 `json:"messages"`
+	Bytes    float64 `json:"bytes"`
+	// Burst seconds worth of messages client may send at once
+	Burst float64 `json:"burst"`
+	// Policy throttle or disconnect
+	Policy string `json:"policy"`
+	// Users limits by username, global section only
+	Users map[string]rateLimitConfig `json:"users"`
+}
+
+func (r *rateLimitConfig) limit() (types.RateLimit, error) {
+	switch r.Policy {
+	case "", types.RatePolicyThrottle, types.RatePolicyDisconnect:
+	default:
+		return types.RateLimit{}, fmt.Errorf("unknown rate limit policy %q", r.Policy)
+	}
+
+	return types.RateLimit{
+		Messages: r.Messages,
+		Bytes:    r.Bytes,
+		Burst:    r.Burst,
+		Policy:   r.Policy,
+	}, nil
+}
+
+func loadTLS(cert, key string) (*tls.Config, error) {
+	cerPath := filepath.Join(basedir, "conf", cert)
+	certPEMBlock, err := ioutil.ReadFile(cerPath)
+	if err != nil {
+		return nil, err
+	}
+	keyPath := filepath.Join(basedir, "conf", key)
+	keyPEMBlock, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	x509, err := tls.X509KeyPair(certPEMBlock, keyPEMBlock)
+	if err != nil {
+		return nil, err
+	}
+	c := &tls.Config{}
+	c.Certificates = append(c.Certificates, x509)
+	return c, nil
+}
+
+// loadClientCA enable verification of client certificates
+func loadClientCA(c *tls.Config, l *listenerConfig) error {
+	data, err := ioutil.ReadFile(filepath.Join(basedir, "conf", l.ClientCA))
+	if err != nil {
+		return err
+	}
+
+	cas, err := transport.ParseCertificates(data)
+	if err != nil {
+		return err
+	}
+
+	c.ClientCAs = x509.NewCertPool()
+	for _, ca := range cas {
+		c.ClientCAs.AddCert(ca)
+	}
+
+	c.ClientAuth = tls.VerifyClientCertIfGiven
+	if l.ClientCertRequired {
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if len(l.CRL) > 0 {
+		if data, err = ioutil.ReadFile(filepath.Join(basedir, "conf", l.CRL)); err != nil {
+			return err
+		}
+
+		crls, err := transport.ParseCRL(data, cas)
+		if err != nil {
+			return err
+		}
+
+		c.VerifyPeerCertificate = transport.VerifyCRL(crls)
+	}
+
+	return nil
+}
+
+// loadListenerConfigs read listeners array
+// if it is absent single listener is built from flat host/port/ssl_enable keys
+func loadListenerConfigs() ([]listenerConfig, error) {
+	var list []listenerConfig
+
+	found, err := config.GetObject("listeners", &list)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		l := listenerConfig{
+			Type: "tcp",
+			Host: config.GetString("host"),
+			Port: config.GetString("port"),
+		}
+		if config.GetBoolWithDefault("ssl_enable", false) {
+			l.Type = "ssl"
+			l.ClientCA = config.GetString("client_ca")
+			l.ClientCertRequired = config.GetBoolWithDefault("client_cert_required", false)
+			l.CRL = config.GetString("crl")
+			l.CertUsername = config.GetString("cert_username")
+			l.CertClientID = config.GetString("cert_clientid")
+		}
+		list = append(list, l)
+	}
+
+	for i := range list {
+		l := &list[i]
+		if len(l.Type) == 0 {
+			l.Type = "tcp"
+		}
+		if len(l.Host) == 0 {
+			l.Host = config.GetString("host")
+		}
+		if len(l.Cert) == 0 {
+			l.Cert = config.GetStringWithDefault("cert", "ssl.crt")
+		}
+		if len(l.Key) == 0 {
+			l.Key = config.GetStringWithDefault("key", "ssl.key")
+		}
+		if len(l.Auth) == 0 {
+			l.Auth = []string{"internal"}
+		}
+		if len(l.Port) == 0 {
+			return nil, fmt.Errorf("listener #%d: port is not set", i)
+		}
 	}
-	_ = auth.Register("internal", sAuth)
-	def, _ := auth.NewManager([]string{"internal"}, false)
-	return def
+
+	return list, nil
 }
 
-func loadMqtt(defaultAuth *auth.Manager) *transport.ConfigTCP {
+// loadListener build transport config accepted by server.ListenAndServe
+func loadListener(l *listenerConfig) (interface{}, error) {
+	authMngr, err := auth.NewManager(l.Auth, l.Anonymous)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = authMngr.SetCertIdentity(l.CertUsername, l.CertClientID); err != nil {
+		return nil, fmt.Errorf("listener %s: cert_username and cert_clientid must be cn or san", l.Port)
+	}
+
+	authMngr.SetGuard(banList, lockout)
 
 	tCfg := &transport.Config{
-		Host:        config.GetString("host"),
-		Port:        config.GetString("port"),
-		AuthManager: defaultAuth,
+		Host:        l.Host,
+		Port:        l.Port,
+		AuthManager: authMngr,
+		OfflineQoS0: l.OfflineQoS0,
 	}
 
-	tcpConfig := transport.NewConfigTCP(tCfg)
+	if l.RateLimit != nil {
+		limit, err := l.RateLimit.limit()
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %s", l.Port, err.Error())
+		}
+		tCfg.RateLimit = &limit
+	}
 
-	if config.GetBoolWithDefault("ssl_enable", false) {
-		cerPath := filepath.Join(basedir, "conf", "ssl.crt")
-		certPEMBlock, err := ioutil.ReadFile(cerPath)
+	var tlsConfig *tls.Config
+	switch l.Type {
+	case "ssl", "wss":
+		// certificate is loaded again once files change, new handshakes use the latest one
+		r, err := transport.NewCertReloader(filepath.Join(basedir, "conf", l.Cert), filepath.Join(basedir, "conf", l.Key))
 		if err != nil {
-			return nil
+			return nil, err
+		}
+		certReloaders = append(certReloaders, r)
+		tlsConfig = &tls.Config{GetCertificate: r.GetCertificate}
+		if len(l.ClientCA) > 0 {
+			if err = loadClientCA(tlsConfig, l); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch l.Type {
+	case "tcp", "ssl":
+		tcpConfig := transport.NewConfigTCP(tCfg)
+		tcpConfig.TLS = tlsConfig
+		return tcpConfig, nil
+	case "ws", "wss":
+		wsConfig := transport.NewConfigWS(tCfg)
+		if len(l.Path) > 0 {
+			wsConfig.Path = l.Path
 		}
-		keyPath := filepath.Join(basedir, "conf", "ssl.key")
-		keyPEMBlock, err := ioutil.ReadFile(keyPath)
+		wsConfig.TLS = tlsConfig
+		return wsConfig, nil
+	}
+
+	return nil, fmt.Errorf("unknown listener type %q", l.Type)
+}
+
+// bridgeConfig entry of the bridges array in nicemqtt.json
+type bridgeConfig struct {
+	Name string `json:"name"`
+	// Address host:port of remote broker
+	Address string `json:"address"`
+	// Version 4 for MQTT 3.1.1 or 5
+	Version      int    `json:"version"`
+	ClientID     string `json:"client_id"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	CleanSession bool   `json:"clean_session"`
+	// KeepAlive, ReconnectMin and ReconnectMax in seconds
+	KeepAlive    int `json:"keep_alive"`
+	ReconnectMin int `json:"reconnect_min"`
+	ReconnectMax int `json:"reconnect_max"`
+	// TLS connect over ssl, CA, Cert and Key file names relative to conf directory
+	TLS      bool           `json:"tls"`
+	CA       string         `json:"ca"`
+	Cert     string         `json:"cert"`
+	Key      string         `json:"key"`
+	Insecure bool           `json:"insecure"`
+	Origin   string         `json:"origin"`
+	Topics   []bridge.Topic `json:"topics"`
+}
+
+// loadBridgeTLS build client tls config of the bridge
+func loadBridgeTLS(b *bridgeConfig) (*tls.Config, error) {
+	c := &tls.Config{
+		InsecureSkipVerify: b.Insecure,
+	}
+
+	if host, _, err := net.SplitHostPort(b.Address); err == nil {
+		c.ServerName = host
+	}
+
+	if len(b.CA) > 0 {
+		caPEMBlock, err := ioutil.ReadFile(filepath.Join(basedir, "conf", b.CA))
 		if err != nil {
-			return nil
+			return nil, err
 		}
-		x509, err := tls.X509KeyPair(certPEMBlock, keyPEMBlock)
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(caPEMBlock) {
+			return nil, fmt.Errorf("no certificates found in %s", b.CA)
+		}
+	}
+
+	if len(b.Cert) > 0 {
+		cert, err := loadTLS(b.Cert, b.Key)
 		if err != nil {
-			return nil
+			return nil, err
+		}
+		c.Certificates = cert.Certificates
+	}
+
+	return c, nil
+}
+
+// loadBridges read bridges array, it is fine to have none
+func loadBridges() ([]bridge.Config, error) {
+	var list []bridgeConfig
+
+	if _, err := config.GetObject("bridges", &list); err != nil {
+		return nil, err
+	}
+
+	var bridges []bridge.Config
+
+	for i := range list {
+		b := &list[i]
+
+		c := bridge.Config{
+			Name:         b.Name,
+			Address:      b.Address,
+			Version:      mqttp.ProtocolVersion(b.Version),
+			ClientID:     b.ClientID,
+			Username:     b.Username,
+			Password:     b.Password,
+			CleanSession: b.CleanSession,
+			KeepAlive:    time.Duration(b.KeepAlive) * time.Second,
+			ReconnectMin: time.Duration(b.ReconnectMin) * time.Second,
+			ReconnectMax: time.Duration(b.ReconnectMax) * time.Second,
+			Origin:       b.Origin,
+			Topics:       b.Topics,
+		}
+
+		if b.TLS {
+			var err error
+			if c.TLS, err = loadBridgeTLS(b); err != nil {
+				return nil, fmt.Errorf("bridge %s: %s", b.Name, err.Error())
+			}
 		}
-		c := &tls.Config{}
-		c.Certificates = append(c.Certificates, x509)
-		tcpConfig.TLS = c
+
+		bridges = append(bridges, c)
+	}
+
+	return bridges, nil
+}
+
+// hookConfig entry of the hooks array in nicemqtt.json
+type hookConfig struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Events one or more of client.connected, client.disconnected, session.subscribed,
+	// session.unsubscribed and message.published, all by default
+	Events  []string          `json:"events"`
+	Topics  []string          `json:"topics"`
+	Payload bool              `json:"payload"`
+	Secret  string            `json:"secret"`
+	Headers map[string]string `json:"headers"`
+	// QueueSize events waiting for delivery
+	QueueSize int `json:"queue_size"`
+	Retries   int `json:"retries"`
+	// Timeout, BackoffMin and BackoffMax in seconds
+	Timeout    int `json:"timeout"`
+	BackoffMin int `json:"backoff_min"`
+	BackoffMax int `json:"backoff_max"`
+}
+
+// loadHooks read hooks array, it is fine to have none
+func loadHooks() ([]hooks.Config, error) {
+	var list []hookConfig
+
+	if _, err := config.GetObject("hooks", &list); err != nil {
+		return nil, err
+	}
+
+	var configs []hooks.Config
+
+	for _, h := range list {
+		configs = append(configs, hooks.Config{
+			Name:       h.Name,
+			URL:        h.URL,
+			Events:     h.Events,
+			Topics:     h.Topics,
+			Payload:    h.Payload,
+			Secret:     h.Secret,
+			Headers:    h.Headers,
+			QueueSize:  h.QueueSize,
+			Retries:    h.Retries,
+			Timeout:    time.Duration(h.Timeout) * time.Second,
+			BackoffMin: time.Duration(h.BackoffMin) * time.Second,
+			BackoffMax: time.Duration(h.BackoffMax) * time.Second,
+		})
+	}
+
+	return configs, nil
+}
+
+// persistenceConfig persistence section of the config
+type persistenceConfig struct {
+	// Type one of mem, file or sql
+	Type string `json:"type"`
+	// Path of the database file for file type, relative to APP_BASE_DIR
+	Path        string `json:"path"`
+	NoSync      bool   `json:"no_sync"`
+	CompactSize int64  `json:"compact_size"`
+	// BatchSize rows per statement for sql type, tables are kept in the users database
+	BatchSize int `json:"batch_size"`
+}
+
+func loadPersistenceConfig() (*persistenceConfig, error) {
+	pc := &persistenceConfig{}
+
+	if _, err := config.GetObject("persistence", pc); err != nil {
+		return nil, err
+	}
+
+	return pc, nil
+}
+
+// loadPersistence open persistence provider of sessions and retained messages
+// mem is used if persistence section is absent
+func loadPersistence() (persistence.IFace, error) {
+	pc, err := loadPersistenceConfig()
+	if err != nil {
+		return nil, err
 	}
 
-	return tcpConfig
+	switch pc.Type {
+	case "", "mem":
+		return persistenceMem.Load(nil, nil)
+	case "file":
+		path := pc.Path
+		if len(path) == 0 {
+			path = filepath.Join("data", "nicemqtt.db")
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(basedir, path)
+		}
+
+		log.Info("file persistence: %s", path)
+
+		return persistenceFile.Load(&persistenceFile.Config{
+			Path:        path,
+			NoSync:      pc.NoSync,
+			CompactSize: pc.CompactSize,
+		}, nil)
+	case "sql":
+		return persistenceSQL.Load(&persistenceSQL.Config{
+			BatchSize: pc.BatchSize,
+		}, nil)
+	}
 
+	return nil, fmt.Errorf("unknown persistence type %q", pc.Type)
 }
 
 func main() {
@@ -155,16 +741,65 @@ func main() {
 		log.Error(errStr)
 		os.Exit(1)
 	}
+	initialConfig = config
 
 	// 注册鉴权
-	auth := registerAuth()
+	if err := registerAuth(); err != nil {
+		log.Error("register auth fail:%s", err.Error())
+		os.Exit(1)
+	}
+
+	listeners, err := loadListenerConfigs()
+	if err != nil {
+		log.Error("load listeners fail:%s", err.Error())
+		os.Exit(1)
+	}
+
+	// 防暴力破解: lockout after failed logins and ban list shared by all listeners
+	if err := loadGuard(); err != nil {
+		log.Error("load lockout and bans fail:%s", err.Error())
+		os.Exit(1)
+	}
+
+	// 协议选项: protocol options advertised to clients
+	if err := loadMQTTOptions(); err != nil {
+		log.Error("load mqtt options fail:%s", err.Error())
+		os.Exit(1)
+	}
+
+	// 项目隔离: topics of every client are placed into namespace of its project
+	common.ProjectIsolation = config.GetBoolWithDefault("project_isolation", false)
 
-	tcpConfig := loadMqtt(auth)
+	applyLogLevel()
+	applyLimits()
 
-	persist, _ := persistenceMem.Load(nil, nil)
+	// 共享订阅: $share/{ShareName}/{filter}
+	common.SubsShared = config.GetBoolWithDefault("shared_subscriptions", common.SubsShared)
+	common.SharedStrategy = config.GetStringWithDefault("shared_strategy", common.SharedStrategy)
+
+	bridges, err := loadBridges()
+	if err != nil {
+		log.Error("load bridges fail:%s", err.Error())
+		os.Exit(1)
+	}
+
+	hookConfigs, err := loadHooks()
+	if err != nil {
+		log.Error("load hooks fail:%s", err.Error())
+		os.Exit(1)
+	}
+
+	persist, err := loadPersistence()
+	if err != nil {
+		log.Error("load persistence fail:%s", err.Error())
+		os.Exit(1)
+	}
+	defer persist.Shutdown() // nolint: errcheck
 
 	serverConfig := server.Config{
 		Persistence: persist,
+		Bridges:     bridges,
+		Hooks:       hookConfigs,
 		TransportStatus: func(id string, status string) {
 			log.Info("listener id: %s status: %s", id, status)
 		},
@@ -181,19 +816,62 @@ func main() {
 	log.Info("MQTT server created")
 
 	// http server start
-	host := config.GetString("host")
-	go server.StartHTTPServer(host, "8080")
+	httpAuth, err := auth.NewManager(config.GetStringSliceWithDefault("http_auth", []string{"internal", "acl"}), false)
+	if err != nil {
+		log.Error("http auth err:%s", err.Error())
+		return
+	}
+	httpAuth.SetGuard(banList, lockout)
+
+	go server.StartHTTPServer(server.HTTPConfig{
+		Host:  config.GetStringWithDefault("http_host", config.GetString("host")),
+		Port:  config.GetStringWithDefault("http_port", "8080"),
+		Auth:  httpAuth,
+		Users: &dbUsers{},
+		Bans:  banList,
+	}, srv)
 
 	log.Info("MQTT starting listeners")
-	if err = srv.ListenAndServe(tcpConfig); err != nil {
-		log.Error("listen and serve err:%s", err.Error())
-		return
+	for i := range listeners {
+		l := &listeners[i]
+
+		var lCfg interface{}
+		if lCfg, err = loadListener(l); err != nil {
+			log.Error("listener %s:%s config err:%s", l.Type, l.Port, err.Error())
+			return
+		}
+
+		if err = srv.ListenAndServe(lCfg); err != nil {
+			log.Error("listen and serve %s:%s err:%s", l.Type, l.Port, err.Error())
+			return
+		}
 	}
 
+	// 证书热更新: certificates of tls listeners are checked every cert_check_interval seconds
+	quit := make(chan struct{})
+	if interval := config.GetIntWithDefault("cert_check_interval", 60); interval > 0 {
+		for _, r := range certReloaders {
+			go r.Watch(time.Duration(interval)*time.Second, quit)
+		}
+	}
+
+	// 用户同步: users changed in database directly are picked up every user_sync_interval seconds
+	if interval := config.GetIntWithDefault("user_sync_interval", 60); interval > 0 {
+		go syncUsers(time.Duration(interval)*time.Second, quit)
+	}
+
+	// SIGHUP: reload config and certificates without dropping connections
 	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-	sig := <-ch
-	log.Info("service received signal: %s", sig.String())
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range ch {
+		if sig == syscall.SIGHUP {
+			reload(srv)
+			continue
+		}
+		log.Info("service received signal: %s", sig.String())
+		break
+	}
+	close(quit)
 
 	if err = srv.Shutdown(); err != nil {
 		log.Error("shutdown server err:%s", err.Error())
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"auth"
+	"conf"
+	"transport"
+)
+
+func TestLoadListenerConfigs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []listenerConfig
+	}{
+		{
+			"legacy tcp",
+			`{"host":"127.0.0.1","port":"1883"}`,
+			[]listenerConfig{{Type: "tcp", Host: "127.0.0.1", Port: "1883", Cert: "ssl.crt", Key: "ssl.key", Auth: []string{"internal"}}},
+		},
+		{
+			"legacy ssl",
+			`{"host":"h","port":"8883","cert":"a.crt","key":"a.key","ssl_enable":true,"client_ca":"ca.crt","client_cert_required":true,"crl":"ca.crl","cert_username":"cn"}`,
+			[]listenerConfig{{Type: "ssl", Host: "h", Port: "8883", Cert: "a.crt", Key: "a.key", Auth: []string{"internal"},
+				ClientCA: "ca.crt", ClientCertRequired: true, CRL: "ca.crl", CertUsername: "cn"}},
+		},
+		{
+			"listeners replace legacy keys",
+			`{"host":"h","port":"1883","listeners":[
+				{"port":"1884","auth":["internal","acl"]},
+				{"type":"wss","host":"0.0.0.0","port":"8084","path":"/mqtt","cert":"w.crt","key":"w.key","auth":["jwt"],"anonymous":true}]}`,
+			[]listenerConfig{
+				{Type: "tcp", Host: "h", Port: "1884", Cert: "ssl.crt", Key: "ssl.key", Auth: []string{"internal", "acl"}},
+				{Type: "wss", Host: "0.0.0.0", Port: "8084", Path: "/mqtt", Cert: "w.crt", Key: "w.key", Auth: []string{"jwt"}, Anonymous: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		setTestConfig(t, tt.config)
+
+		list, err := loadListenerConfigs()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(list, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, list, tt.want)
+		}
+	}
+}
+
+func TestLoadListenerConfigsLimits(t *testing.T) {
+	setTestConfig(t, `{"listeners":[{"port":"1883","rate_limit":{"messages":5,"policy":"disconnect"},"offline_qos0":false}]}`)
+
+	list, err := loadListenerConfigs()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	l := list[0]
+	if l.RateLimit == nil || l.RateLimit.Messages != 5 || l.RateLimit.Policy != "disconnect" ||
+		l.OfflineQoS0 == nil || *l.OfflineQoS0 {
+		t.Errorf("unexpected listener %+v", l)
+	}
+}
+
+func TestLoadListenerConfigsInvalid(t *testing.T) {
+	for _, c := range []string{
+		`{"host":"h"}`,
+		`{"port":"1883","listeners":[{"type":"tcp"}]}`,
+		`{"listeners":{"port":"1883"}}`,
+	} {
+		setTestConfig(t, c)
+
+		if list, err := loadListenerConfigs(); err == nil {
+			t.Errorf("config %s: got %+v, want error", c, list)
+		}
+	}
+}
+
+// TestShippedConfig config shipped in conf keeps plain tcp listener with internal users
+func TestShippedConfig(t *testing.T) {
+	prev := config
+	t.Cleanup(func() {
+		config = prev
+	})
+
+	config = conf.LoadFile(filepath.Join("..", "conf", server_config))
+	if config == nil {
+		t.Fatalf("can not load shipped %s", server_config)
+	}
+
+	list, err := loadListenerConfigs()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if len(list) != 1 || list[0].Type != "tcp" || list[0].Port != "1883" || !reflect.DeepEqual(list[0].Auth, []string{"internal"}) {
+		t.Errorf("unexpected listeners %+v", list)
+	}
+
+	pc, err := loadPersistenceConfig()
+	if err != nil || (pc.Type != "" && pc.Type != "mem") {
+		t.Errorf("persistence %+v, err:%v, want mem", pc, err)
+	}
+
+	for _, k := range []string{"rate_limit", "offline_queue", "acl_file", "acl_default"} {
+		if config.Get(k) != nil {
+			t.Errorf("%s is set", k)
+		}
+	}
+
+	if lc, err := loadLockout(); err != nil || lc.Threshold >= 0 {
+		t.Errorf("lockout %+v, err:%v, want disabled", lc, err)
+	}
+}
+
+// TestLoadListenerAuth every listener gets manager of its own providers
+func TestLoadListenerAuth(t *testing.T) {
+	auth.Register("internal", auth.NewSimpleAuth()) // nolint: errcheck
+
+	l, err := loadListener(&listenerConfig{Type: "tcp", Port: "1883", Auth: []string{"internal"}})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if tcp, ok := l.(*transport.ConfigTCP); !ok || tcp.Scheme != "tcp" || tcp.TLS != nil {
+		t.Errorf("unexpected listener config %+v", l)
+	}
+
+	if _, err := loadListener(&listenerConfig{Type: "tcp", Port: "1883", Auth: []string{"no-such-provider"}}); err == nil {
+		t.Errorf("listener with unknown auth provider accepted")
+	}
+
+	if _, err := loadListener(&listenerConfig{Type: "tcp", Port: "1883", Auth: []string{"internal"}, CertUsername: "email"}); err == nil {
+		t.Errorf("listener with invalid cert_username accepted")
+	}
+}
@@ -0,0 +1,311 @@
+package persistenceFile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+)
+
+func open(t *testing.T, cfg *Config) (*impl, persistence.Sessions) {
+	p, err := Load(cfg, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	s, err := p.Sessions()
+	if err != nil {
+		t.Fatalf("sessions: %v", err)
+	}
+
+	return p.(*impl), s
+}
+
+// crash close the log without compaction as if process died
+func crash(p *impl) {
+	p.db.lock.Lock()
+	p.db.file.Close() // nolint: errcheck
+	p.db.file = nil
+	p.db.lock.Unlock()
+}
+
+func testConfig(t *testing.T) *Config {
+	return &Config{Path: filepath.Join(t.TempDir(), "db", "nicemqtt.log"), NoSync: true}
+}
+
+func packet(data string) *persistence.PersistedPacket {
+	return &persistence.PersistedPacket{Data: []byte(data)}
+}
+
+// queue payloads of the session queue in order
+func queue(t *testing.T, s persistence.Sessions, id string) []string {
+	var list []string
+
+	err := s.PacketsForEachQoS12([]byte(id), nil, func(_ interface{}, pkt *persistence.PersistedPacket) (bool, error) {
+		list = append(list, string(pkt.Data))
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("packets for each: %v", err)
+	}
+
+	return list
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func populate(t *testing.T, s persistence.Sessions) {
+	if err := s.Create([]byte("c1"), &persistence.SessionBase{Timestamp: "t1", Version: 5}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	state := &persistence.SessionState{
+		Subscriptions: []byte("subs"),
+		Expire:        &persistence.SessionDelays{ExpireIn: "10"},
+		SessionBase:   persistence.SessionBase{Timestamp: "t1", Version: 5},
+	}
+
+	if err := s.StateStore([]byte("c1"), state); err != nil {
+		t.Fatalf("state store: %v", err)
+	}
+
+	for _, d := range []string{"a", "b", "c"} {
+		if err := s.PacketStoreQoS12([]byte("c1"), packet(d)); err != nil {
+			t.Fatalf("packet store: %v", err)
+		}
+	}
+}
+
+func checkState(t *testing.T, s persistence.Sessions, packets []string) {
+	if !s.Exists([]byte("c1")) {
+		t.Fatalf("session is not restored")
+	}
+
+	var restored *persistence.SessionState
+	s.LoadForEach(loaderFunc(func(id []byte, state *persistence.SessionState) { // nolint: errcheck
+		if string(id) == "c1" {
+			restored = state
+		}
+	}), nil)
+
+	if restored == nil || string(restored.Subscriptions) != "subs" || restored.Version != 5 ||
+		restored.Expire == nil || restored.Expire.ExpireIn != "10" {
+		t.Errorf("unexpected restored state %+v", restored)
+	}
+
+	if q := queue(t, s, "c1"); !equal(q, packets) {
+		t.Errorf("restored packets: expected %v, got %v", packets, q)
+	}
+}
+
+type loaderFunc func([]byte, *persistence.SessionState)
+
+func (f loaderFunc) LoadSession(_ interface{}, id []byte, state *persistence.SessionState) error {
+	f(id, state)
+	return nil
+}
+
+func TestReplay(t *testing.T) {
+	cfg := testConfig(t)
+
+	p, s := open(t, cfg)
+	populate(t, s)
+	crash(p)
+
+	p, s = open(t, cfg)
+	checkState(t, s, []string{"a", "b", "c"})
+
+	// records appended after replay survive next restart
+	if err := s.PacketStoreQoS12([]byte("c1"), packet("d")); err != nil {
+		t.Fatalf("packet store: %v", err)
+	}
+	crash(p)
+
+	_, s = open(t, cfg)
+	checkState(t, s, []string{"a", "b", "c", "d"})
+}
+
+func TestBrokenTail(t *testing.T) {
+	cfg := testConfig(t)
+
+	p, s := open(t, cfg)
+	populate(t, s)
+	size := p.db.size
+	if err := s.PacketStoreQoS12([]byte("c1"), packet("d")); err != nil {
+		t.Fatalf("packet store: %v", err)
+	}
+	crash(p)
+
+	// record interrupted in the middle of write
+	if err := os.Truncate(cfg.Path, size+headerSize+3); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+
+	p, s = open(t, cfg)
+	checkState(t, s, []string{"a", "b", "c"})
+
+	if st, err := os.Stat(cfg.Path); err != nil || st.Size() != size {
+		t.Errorf("broken tail is not truncated: %v", st.Size())
+	}
+
+	if err := s.PacketStoreQoS12([]byte("c1"), packet("e")); err != nil {
+		t.Fatalf("packet store: %v", err)
+	}
+	crash(p)
+
+	_, s = open(t, cfg)
+	checkState(t, s, []string{"a", "b", "c", "e"})
+}
+
+func TestCRCMismatch(t *testing.T) {
+	cfg := testConfig(t)
+
+	p, s := open(t, cfg)
+	populate(t, s)
+	size := p.db.size
+	if err := s.PacketStoreQoS12([]byte("c1"), packet("d")); err != nil {
+		t.Fatalf("packet store: %v", err)
+	}
+	crash(p)
+
+	f, err := os.OpenFile(cfg.Path, os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	// flip byte of the last record payload
+	b := make([]byte, 1)
+	f.ReadAt(b, size+headerSize+2) // nolint: errcheck
+	b[0] ^= 0xFF
+	f.WriteAt(b, size+headerSize+2) // nolint: errcheck
+	f.Close()                       // nolint: errcheck
+
+	_, s = open(t, cfg)
+	checkState(t, s, []string{"a", "b", "c"})
+
+	if st, err := os.Stat(cfg.Path); err != nil || st.Size() != size {
+		t.Errorf("corrupted record is not truncated: %v", st.Size())
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.CompactSize = 4096
+
+	p, s := open(t, cfg)
+	populate(t, s)
+
+	// log grows with every rewrite of the queue while state stays the same
+	for i := 0; i < 200; i++ {
+		if err := s.PacketStoreQoS12([]byte("c1"), packet("x")); err != nil {
+			t.Fatalf("packet store: %v", err)
+		}
+
+		s.PacketsForEachQoS12([]byte("c1"), nil, func(_ interface{}, pkt *persistence.PersistedPacket) (bool, error) { // nolint: errcheck
+			return string(pkt.Data) == "x", nil
+		})
+	}
+
+	if p.db.size >= 2*cfg.CompactSize {
+		t.Errorf("log is not compacted, size:%d", p.db.size)
+	}
+	crash(p)
+
+	p, s = open(t, cfg)
+	checkState(t, s, []string{"a", "b", "c"})
+
+	if err := p.Shutdown(); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	if _, err := os.Stat(cfg.Path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("snapshot temporary file left")
+	}
+
+	_, s = open(t, cfg)
+	checkState(t, s, []string{"a", "b", "c"})
+}
+
+func TestPacketsForEachReentrant(t *testing.T) {
+	cfg := testConfig(t)
+
+	_, s := open(t, cfg)
+	populate(t, s)
+
+	// loader calls back into storage and removes every packet it seen
+	err := s.PacketsForEachQoS12([]byte("c1"), nil, func(_ interface{}, pkt *persistence.PersistedPacket) (bool, error) {
+		if string(pkt.Data) == "b" {
+			if err := s.PacketStoreQoS12([]byte("c1"), packet("d")); err != nil {
+				t.Errorf("packet store: %v", err)
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("packets for each: %v", err)
+	}
+
+	if q := queue(t, s, "c1"); !equal(q, []string{"d"}) {
+		t.Errorf("packet stored by loader must be kept: %v", q)
+	}
+}
+
+func TestPacketsDrop(t *testing.T) {
+	cfg := testConfig(t)
+
+	p, s := open(t, cfg)
+	populate(t, s)
+
+	// packets left are big, so rewrite of the queue would be noticed
+	for _, d := range []string{"d", "e"} {
+		if err := s.PacketStoreQoS12([]byte("c1"), packet(d+strings.Repeat(".", 1024))); err != nil {
+			t.Fatalf("packet store: %v", err)
+		}
+	}
+
+	size := p.db.size
+
+	if err := s.PacketsDropQoS12([]byte("c1"), 2); err != nil {
+		t.Fatalf("drop: %v", err)
+	}
+
+	// record keeps count only, packets left are not rewritten
+	if grown := p.db.size - size; grown <= 0 || grown > 64 {
+		t.Errorf("drop record of %d bytes", grown)
+	}
+
+	crash(p)
+
+	p, s = open(t, cfg)
+
+	if q := queue(t, s, "c1"); len(q) != 3 || q[0] != "c" {
+		t.Errorf("restored %d packets, want 3 starting with c", len(q))
+	}
+
+	// dropping more than queue holds empties it
+	if err := s.PacketsDropQoS12([]byte("c1"), 10); err != nil {
+		t.Fatalf("drop: %v", err)
+	}
+	crash(p)
+
+	_, s = open(t, cfg)
+	checkState(t, s, nil)
+
+	if err := s.PacketsDropQoS0([]byte("c2"), 1); err != persistence.ErrNotFound {
+		t.Errorf("drop of unknown session: got %v, want %v", err, persistence.ErrNotFound)
+	}
+}
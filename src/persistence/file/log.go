@@ -0,0 +1,185 @@
+package persistenceFile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+)
+
+// record operations
+// every change of the state is appended to the log as single record
+const (
+	opCreate byte = iota + 1
+	opDelete
+	opState
+	opStateDelete
+	opSubscriptions
+	opExpiry
+	opPacketsAppend
+	opPacketsSet
+	opRetained
+	opSystem
+	// opPacketsDrop remove Count oldest packets of the queue
+	opPacketsDrop
+)
+
+// packet queues of the session
+const (
+	queueQoS0 byte = iota
+	queueQoS12
+	queueUnAck
+	queuesCount
+)
+
+// record header: 4 bytes of payload length followed by 4 bytes of payload crc32
+const headerSize = 8
+
+// maxRecordSize sanity limit of the record, bigger length is treated as broken tail
+const maxRecordSize = 256 << 20
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type record struct {
+	Op      byte                           `json:"o"`
+	ID      string                         `json:"i,omitempty"`
+	Queue   byte                           `json:"q,omitempty"`
+	Base    *persistence.SessionBase       `json:"b,omitempty"`
+	Data    []byte                         `json:"d,omitempty"`
+	Expire  *persistence.SessionDelays     `json:"e,omitempty"`
+	Packets []*persistence.PersistedPacket `json:"p,omitempty"`
+	Queues  *persistence.PersistedPackets  `json:"a,omitempty"`
+	System  *persistence.SystemState       `json:"s,omitempty"`
+	Count   int                            `json:"n,omitempty"`
+}
+
+func encodeRecord(buf []byte, r *record) ([]byte, error) {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return buf, err
+	}
+
+	var hdr [headerSize]byte
+	binary.BigEndian.PutUint32(hdr[0:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(hdr[4:], crc32.Checksum(payload, crcTable))
+
+	buf = append(buf, hdr[:]...)
+	return append(buf, payload...), nil
+}
+
+// replayLog read records of the log and pass them to apply
+// returns offset of the last complete record, anything after it is partially written tail
+// left by crash and must be truncated before appending
+func replayLog(f *os.File, apply func(*record)) (int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	rd := bufio.NewReaderSize(f, 64*1024)
+
+	var offset int64
+	var hdr [headerSize]byte
+
+	for {
+		if _, err := io.ReadFull(rd, hdr[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return offset, nil
+			}
+			return offset, err
+		}
+
+		size := binary.BigEndian.Uint32(hdr[0:])
+		if size > maxRecordSize {
+			return offset, nil
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(rd, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return offset, nil
+			}
+			return offset, err
+		}
+
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(hdr[4:]) {
+			return offset, nil
+		}
+
+		r := &record{}
+		if err := json.Unmarshal(payload, r); err != nil {
+			return offset, nil
+		}
+
+		apply(r)
+
+		offset += int64(headerSize + size)
+	}
+}
+
+// writeSnapshot write records into new file and atomically replace log with it
+func writeSnapshot(path string, records []*record, noSync bool) (int64, error) {
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+
+	wr := bufio.NewWriterSize(f, 64*1024)
+
+	var size int64
+	var buf []byte
+
+	for _, r := range records {
+		if buf, err = encodeRecord(buf[:0], r); err != nil {
+			break
+		}
+
+		if _, err = wr.Write(buf); err != nil {
+			break
+		}
+
+		size += int64(len(buf))
+	}
+
+	if err == nil {
+		err = wr.Flush()
+	}
+
+	if err == nil && !noSync {
+		err = f.Sync()
+	}
+
+	if e := f.Close(); err == nil {
+		err = e
+	}
+
+	if err != nil {
+		os.Remove(tmp) // nolint: errcheck
+		return 0, err
+	}
+
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp) // nolint: errcheck
+		return 0, err
+	}
+
+	if !noSync {
+		syncDir(filepath.Dir(path))
+	}
+
+	return size, nil
+}
+
+// syncDir make rename of the file durable
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()  // nolint: errcheck
+		d.Close() // nolint: errcheck
+	}
+}
@@ -0,0 +1,319 @@
+package persistenceFile
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/VolantMQ/vlapi/plugin"
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+	"logs"
+)
+
+// defaultCompactSize size of the log compaction is considered at
+const defaultCompactSize = 16 << 20
+
+// Config of the file persistence
+type Config struct {
+	// Path of the database file, created if does not exist
+	Path string
+	// NoSync skip fsync after every write
+	// writes are faster but changes made shortly before power loss might be lost
+	NoSync bool
+	// CompactSize size of the log in bytes compaction is considered at
+	// log is compacted once it is grown twice since last compaction
+	CompactSize int64
+}
+
+var (
+	log = logs.GetLogger()
+)
+
+// db state of the storage
+// state is kept in memory and every change is appended to the log before applied,
+// on open the log is replayed to restore the state
+type db struct {
+	lock     sync.Mutex
+	cfg      Config
+	file     *os.File
+	buf      []byte
+	size     int64
+	liveSize int64
+	entries  map[string]*session
+	retained []*persistence.PersistedPacket
+	system   persistence.SystemState
+}
+
+type impl struct {
+	db  db
+	r   retained
+	s   sessions
+	sys system
+}
+
+var _ persistence.IFace = (*impl)(nil)
+
+// Load open file persistence
+// c must be of *Config type
+func Load(c interface{}, params *vlplugin.SysParams) (persistence.IFace, error) {
+	cfg, ok := c.(*Config)
+	if !ok || cfg == nil || len(cfg.Path) == 0 {
+		return nil, persistence.ErrInvalidConfig
+	}
+
+	pl := &impl{}
+
+	pl.db.cfg = *cfg
+	pl.db.entries = make(map[string]*session)
+
+	if pl.db.cfg.CompactSize <= 0 {
+		pl.db.cfg.CompactSize = defaultCompactSize
+	}
+
+	if err := pl.db.open(); err != nil {
+		return nil, err
+	}
+
+	pl.r = retained{
+		db: &pl.db,
+	}
+
+	pl.s = sessions{
+		db: &pl.db,
+	}
+
+	pl.sys = system{
+		db: &pl.db,
+	}
+
+	return pl, nil
+}
+
+func (p *impl) System() (persistence.System, error) {
+	if !p.db.isOpen() {
+		return nil, persistence.ErrNotOpen
+	}
+
+	return &p.sys, nil
+}
+
+func (p *impl) Sessions() (persistence.Sessions, error) {
+	if !p.db.isOpen() {
+		return nil, persistence.ErrNotOpen
+	}
+
+	return &p.s, nil
+}
+
+func (p *impl) Retained() (persistence.Retained, error) {
+	if !p.db.isOpen() {
+		return nil, persistence.ErrNotOpen
+	}
+
+	return &p.r, nil
+}
+
+// Shutdown compact and close the log
+func (p *impl) Shutdown() error {
+	return p.db.close()
+}
+
+func (d *db) open() error {
+	if err := os.MkdirAll(filepath.Dir(d.cfg.Path), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(d.cfg.Path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	offset, err := replayLog(f, d.apply)
+	if err != nil {
+		f.Close() // nolint: errcheck
+		return err
+	}
+
+	var fSize int64
+	if st, e := f.Stat(); e == nil {
+		fSize = st.Size()
+	}
+
+	// drop the tail left by interrupted write
+	if fSize > offset {
+		log.Warn("file persistence, truncating broken tail, path:%s, offset:%d, size:%d", d.cfg.Path, offset, fSize)
+		if err = f.Truncate(offset); err != nil {
+			f.Close() // nolint: errcheck
+			return err
+		}
+	}
+
+	d.file = f
+	d.size = offset
+	d.liveSize = offset
+
+	if len(d.system.CreatedAt) == 0 {
+		return d.write(&record{
+			Op: opSystem,
+			System: &persistence.SystemState{
+				Version:   "1",
+				CreatedAt: time.Now().Format(time.RFC3339),
+			},
+		})
+	}
+
+	return nil
+}
+
+func (d *db) isOpen() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.file != nil
+}
+
+func (d *db) close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.file == nil {
+		return persistence.ErrNotOpen
+	}
+
+	if d.size > d.liveSize {
+		if err := d.compact(); err != nil {
+			log.Error("file persistence compact, path:%s, err:%s", d.cfg.Path, err.Error())
+		}
+	}
+
+	err := d.file.Close()
+	d.file = nil
+
+	return err
+}
+
+// write append record to the log and apply it to the state
+// must be called with lock held
+func (d *db) write(r *record) error {
+	if d.file == nil {
+		return persistence.ErrNotOpen
+	}
+
+	var err error
+	if d.buf, err = encodeRecord(d.buf[:0], r); err != nil {
+		return err
+	}
+
+	if _, err = d.file.Write(d.buf); err == nil && !d.cfg.NoSync {
+		err = d.file.Sync()
+	}
+
+	if err != nil {
+		// record might be partially written, cut it so log stays consistent
+		if e := d.file.Truncate(d.size); e != nil {
+			log.Error("file persistence truncate, path:%s, err:%s", d.cfg.Path, e.Error())
+		}
+		return err
+	}
+
+	d.size += int64(len(d.buf))
+
+	d.apply(r)
+
+	if d.size >= d.cfg.CompactSize && d.size >= 2*d.liveSize {
+		if err = d.compact(); err != nil {
+			log.Error("file persistence compact, path:%s, err:%s", d.cfg.Path, err.Error())
+			// retry once log doubles again
+			d.liveSize = d.size
+		}
+	}
+
+	return nil
+}
+
+// compact replace log with snapshot of the current state
+// must be called with lock held
+func (d *db) compact() error {
+	size, err := writeSnapshot(d.cfg.Path, d.snapshot(), d.cfg.NoSync)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(d.cfg.Path, os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	d.file.Close() // nolint: errcheck
+	d.file = f
+	d.size = size
+	d.liveSize = size
+
+	return nil
+}
+
+// snapshot records restoring current state
+func (d *db) snapshot() []*record {
+	sys := d.system
+	records := []*record{{Op: opSystem, System: &sys}}
+
+	if len(d.retained) > 0 {
+		records = append(records, &record{Op: opRetained, Packets: d.retained})
+	}
+
+	for id, ses := range d.entries {
+		base := ses.state.SessionBase
+		records = append(records, &record{Op: opCreate, ID: id, Base: &base})
+
+		if ses.hasState {
+			records = append(records, &record{
+				Op:     opState,
+				ID:     id,
+				Base:   &base,
+				Data:   ses.state.Subscriptions,
+				Expire: ses.state.Expire,
+			})
+		}
+
+		for q := byte(0); q < queuesCount; q++ {
+			if len(ses.packets[q]) > 0 {
+				records = append(records, &record{Op: opPacketsSet, ID: id, Queue: q, Packets: ses.packets[q]})
+			}
+		}
+	}
+
+	return records
+}
+
+// apply record to the state
+func (d *db) apply(r *record) {
+	switch r.Op {
+	case opSystem:
+		if r.System != nil {
+			d.system = *r.System
+		}
+	case opRetained:
+		d.retained = r.Packets
+	case opCreate:
+		ses := &session{}
+		if r.Base != nil {
+			ses.state.SessionBase = *r.Base
+		}
+		d.entries[r.ID] = ses
+	case opDelete:
+		delete(d.entries, r.ID)
+	default:
+		ses := d.entries[r.ID]
+		if ses == nil {
+			if r.Op != opSubscriptions {
+				return
+			}
+
+			ses = &session{}
+			d.entries[r.ID] = ses
+		}
+
+		ses.apply(r)
+	}
+}
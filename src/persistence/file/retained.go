@@ -0,0 +1,30 @@
+package persistenceFile
+
+import (
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+)
+
+type retained struct {
+	db *db
+}
+
+func (r *retained) Load() ([]*persistence.PersistedPacket, error) {
+	r.db.lock.Lock()
+	defer r.db.lock.Unlock()
+
+	return r.db.retained, nil
+}
+
+func (r *retained) Store(data []*persistence.PersistedPacket) error {
+	r.db.lock.Lock()
+	defer r.db.lock.Unlock()
+
+	return r.db.write(&record{Op: opRetained, Packets: data})
+}
+
+func (r *retained) Wipe() error {
+	r.db.lock.Lock()
+	defer r.db.lock.Unlock()
+
+	return r.db.write(&record{Op: opRetained})
+}
@@ -0,0 +1,375 @@
+package persistenceFile
+
+import (
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+)
+
+type sessions struct {
+	db *db
+}
+
+type session struct {
+	state    persistence.SessionState
+	hasState bool
+	packets  [queuesCount][]*persistence.PersistedPacket
+}
+
+var _ persistence.Sessions = (*sessions)(nil)
+
+func (s *session) apply(r *record) {
+	switch r.Op {
+	case opState:
+		s.state.Subscriptions = r.Data
+		s.state.Expire = r.Expire
+		if r.Base != nil {
+			s.state.SessionBase = *r.Base
+		}
+		s.hasState = true
+	case opStateDelete:
+		s.state.Subscriptions = nil
+		s.state.Expire = nil
+		s.hasState = false
+	case opSubscriptions:
+		s.state.Subscriptions = r.Data
+		s.hasState = true
+	case opExpiry:
+		s.state.Expire = r.Expire
+		s.hasState = true
+	case opPacketsAppend:
+		if r.Queues != nil {
+			s.packets[queueQoS0] = append(s.packets[queueQoS0], r.Queues.QoS0...)
+			s.packets[queueQoS12] = append(s.packets[queueQoS12], r.Queues.QoS12...)
+			s.packets[queueUnAck] = append(s.packets[queueUnAck], r.Queues.UnAck...)
+		}
+	case opPacketsSet:
+		if r.Queue < queuesCount {
+			s.packets[r.Queue] = r.Packets
+		}
+	case opPacketsDrop:
+		if r.Queue < queuesCount {
+			if r.Count >= len(s.packets[r.Queue]) {
+				s.packets[r.Queue] = nil
+			} else {
+				s.packets[r.Queue] = s.packets[r.Queue][r.Count:]
+			}
+		}
+	}
+}
+
+func (s *sessions) Exists(id []byte) bool {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	_, ok := s.db.entries[string(id)]
+	return ok
+}
+
+func (s *sessions) Count() uint64 {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	return uint64(len(s.db.entries))
+}
+
+func (s *sessions) SubscriptionsStore(id []byte, data []byte) error {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	return s.db.write(&record{Op: opSubscriptions, ID: string(id), Data: data})
+}
+
+func (s *sessions) SubscriptionsDelete(id []byte) error {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	if ses, ok := s.db.entries[string(id)]; !ok || len(ses.state.Subscriptions) == 0 {
+		return nil
+	}
+
+	return s.db.write(&record{Op: opSubscriptions, ID: string(id)})
+}
+
+func (s *sessions) packetsForEach(id []byte, q byte, ctx interface{}, load persistence.PacketLoader) error {
+	// loader might block or call back into storage, so it walks over copy of the queue
+	s.db.lock.Lock()
+	var packets []*persistence.PersistedPacket
+	if ses, ok := s.db.entries[string(id)]; ok {
+		packets = append(packets, ses.packets[q]...)
+	}
+	s.db.lock.Unlock()
+
+	removed := make(map[*persistence.PersistedPacket]bool)
+
+	// packets are loaded in order they were stored
+	for _, pkt := range packets {
+		rm, err := load(ctx, pkt)
+		if rm {
+			removed[pkt] = true
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	if len(removed) == 0 {
+		return nil
+	}
+
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	ses, ok := s.db.entries[string(id)]
+	if !ok {
+		return nil
+	}
+
+	// queue might be changed while loader was running, packets stored meanwhile are kept
+	left := make([]*persistence.PersistedPacket, 0, len(ses.packets[q]))
+	for _, pkt := range ses.packets[q] {
+		if !removed[pkt] {
+			left = append(left, pkt)
+		}
+	}
+
+	if len(left) == len(ses.packets[q]) {
+		return nil
+	}
+
+	return s.db.write(&record{Op: opPacketsSet, ID: string(id), Queue: q, Packets: left})
+}
+
+func (s *sessions) PacketsForEachQoS0(id []byte, ctx interface{}, load persistence.PacketLoader) error {
+	return s.packetsForEach(id, queueQoS0, ctx, load)
+}
+
+func (s *sessions) PacketsForEachQoS12(id []byte, ctx interface{}, load persistence.PacketLoader) error {
+	return s.packetsForEach(id, queueQoS12, ctx, load)
+}
+
+func (s *sessions) PacketsForEachUnAck(id []byte, ctx interface{}, load persistence.PacketLoader) error {
+	return s.packetsForEach(id, queueUnAck, ctx, load)
+}
+
+func (s *sessions) packetCount(id []byte, q byte) (uint64, error) {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	if ses, ok := s.db.entries[string(id)]; ok {
+		return uint64(len(ses.packets[q])), nil
+	}
+
+	return 0, persistence.ErrNotFound
+}
+
+func (s *sessions) PacketCountQoS0(id []byte) (uint64, error) {
+	return s.packetCount(id, queueQoS0)
+}
+
+func (s *sessions) PacketCountQoS12(id []byte) (uint64, error) {
+	return s.packetCount(id, queueQoS12)
+}
+
+func (s *sessions) PacketCountUnAck(id []byte) (uint64, error) {
+	return s.packetCount(id, queueUnAck)
+}
+
+func (s *sessions) PacketsStore(id []byte, packets persistence.PersistedPackets) error {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	if _, ok := s.db.entries[string(id)]; !ok {
+		return persistence.ErrNotFound
+	}
+
+	if len(packets.QoS0)+len(packets.QoS12)+len(packets.UnAck) == 0 {
+		return nil
+	}
+
+	return s.db.write(&record{Op: opPacketsAppend, ID: string(id), Queues: &packets})
+}
+
+func (s *sessions) PacketsDelete(id []byte) error {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	ses, ok := s.db.entries[string(id)]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+
+	for q := byte(0); q < queuesCount; q++ {
+		if len(ses.packets[q]) > 0 {
+			if err := s.db.write(&record{Op: opPacketsSet, ID: string(id), Queue: q}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// packetsDrop remove count oldest packets of the queue, record does not carry packets left
+func (s *sessions) packetsDrop(id []byte, q byte, count int) error {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	ses, ok := s.db.entries[string(id)]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+
+	if count <= 0 || len(ses.packets[q]) == 0 {
+		return nil
+	}
+
+	return s.db.write(&record{Op: opPacketsDrop, ID: string(id), Queue: q, Count: count})
+}
+
+func (s *sessions) PacketsDropQoS0(id []byte, count int) error {
+	return s.packetsDrop(id, queueQoS0, count)
+}
+
+func (s *sessions) PacketsDropQoS12(id []byte, count int) error {
+	return s.packetsDrop(id, queueQoS12, count)
+}
+
+func (s *sessions) packetStore(id []byte, q byte, pkt *persistence.PersistedPacket) error {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	if _, ok := s.db.entries[string(id)]; !ok {
+		return persistence.ErrNotFound
+	}
+
+	packets := &persistence.PersistedPackets{}
+
+	switch q {
+	case queueQoS0:
+		packets.QoS0 = []*persistence.PersistedPacket{pkt}
+	case queueQoS12:
+		packets.QoS12 = []*persistence.PersistedPacket{pkt}
+	default:
+		packets.UnAck = []*persistence.PersistedPacket{pkt}
+	}
+
+	return s.db.write(&record{Op: opPacketsAppend, ID: string(id), Queues: packets})
+}
+
+func (s *sessions) PacketStoreQoS0(id []byte, pkt *persistence.PersistedPacket) error {
+	return s.packetStore(id, queueQoS0, pkt)
+}
+
+func (s *sessions) PacketStoreQoS12(id []byte, pkt *persistence.PersistedPacket) error {
+	return s.packetStore(id, queueQoS12, pkt)
+}
+
+func (s *sessions) PacketStoreUnAck(id []byte, pkt *persistence.PersistedPacket) error {
+	return s.packetStore(id, queueUnAck, pkt)
+}
+
+func (s *sessions) LoadForEach(loader persistence.SessionLoader, context interface{}) error {
+	s.db.lock.Lock()
+
+	// loader calls back into storage, so walk over copy of states
+	ids := make([]string, 0, len(s.db.entries))
+	states := make([]persistence.SessionState, 0, len(s.db.entries))
+
+	for id, ses := range s.db.entries {
+		ids = append(ids, id)
+		states = append(states, ses.state)
+	}
+
+	s.db.lock.Unlock()
+
+	for i := range ids {
+		if err := loader.LoadSession(context, []byte(ids[i]), &states[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *sessions) Create(id []byte, state *persistence.SessionBase) error {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	if _, ok := s.db.entries[string(id)]; ok {
+		return persistence.ErrAlreadyExists
+	}
+
+	return s.db.write(&record{Op: opCreate, ID: string(id), Base: state})
+}
+
+func (s *sessions) StateStore(id []byte, state *persistence.SessionState) error {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	ses, ok := s.db.entries[string(id)]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+
+	subs := state.Subscriptions
+	if len(subs) == 0 {
+		subs = ses.state.Subscriptions
+	}
+
+	return s.db.write(&record{
+		Op:     opState,
+		ID:     string(id),
+		Base:   &state.SessionBase,
+		Data:   subs,
+		Expire: state.Expire,
+	})
+}
+
+func (s *sessions) ExpiryStore(id []byte, exp *persistence.SessionDelays) error {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	if _, ok := s.db.entries[string(id)]; !ok {
+		return persistence.ErrNotFound
+	}
+
+	return s.db.write(&record{Op: opExpiry, ID: string(id), Expire: exp})
+}
+
+func (s *sessions) ExpiryDelete(id []byte) error {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	ses, ok := s.db.entries[string(id)]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+
+	if ses.state.Expire == nil {
+		return nil
+	}
+
+	return s.db.write(&record{Op: opExpiry, ID: string(id)})
+}
+
+func (s *sessions) StateDelete(id []byte) error {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	if _, ok := s.db.entries[string(id)]; !ok {
+		return persistence.ErrNotFound
+	}
+
+	return s.db.write(&record{Op: opStateDelete, ID: string(id)})
+}
+
+func (s *sessions) Delete(id []byte) error {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	if _, ok := s.db.entries[string(id)]; !ok {
+		return persistence.ErrNotFound
+	}
+
+	return s.db.write(&record{Op: opDelete, ID: string(id)})
+}
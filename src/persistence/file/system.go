@@ -0,0 +1,25 @@
+package persistenceFile
+
+import (
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+)
+
+type system struct {
+	db *db
+}
+
+func (s *system) GetInfo() (*persistence.SystemState, error) {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	state := s.db.system
+
+	return &state, nil
+}
+
+func (s *system) SetInfo(state *persistence.SystemState) error {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+
+	return s.db.write(&record{Op: opSystem, System: state})
+}
@@ -0,0 +1,144 @@
+package persistenceSQL
+
+import (
+	"encoding/base64"
+
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+	"orm"
+)
+
+// packet queues of the session
+const (
+	queueQoS0 = iota
+	queueQoS12
+	queueUnAck
+)
+
+// MqttSession persisted session state
+// binary fields are kept base64 encoded
+type MqttSession struct {
+	Id            string `orm:"size(255);pk"`
+	Version       int
+	CreatedAt     string `orm:"size(32)"`
+	Subscriptions string `orm:"type(text);null"`
+	HasExpiry     bool
+	ExpireSince   string `orm:"size(32);null"`
+	ExpireIn      string `orm:"size(16);null"`
+	Will          string `orm:"type(text);null"`
+}
+
+// MqttPacket queued packet of the session, packets of the queue are ordered by Id
+type MqttPacket struct {
+	Id        int64  `orm:"auto"`
+	SessionId string `orm:"size(255)"`
+	Queue     int
+	ExpireAt  string `orm:"size(32);null"`
+	Data      string `orm:"type(text)"`
+}
+
+// MqttRetained retained message
+type MqttRetained struct {
+	Id       int64  `orm:"auto"`
+	ExpireAt string `orm:"size(32);null"`
+	Data     string `orm:"type(text)"`
+}
+
+// MqttSystem persistence state of the system, single row
+type MqttSystem struct {
+	Id        int    `orm:"pk"`
+	Version   string `orm:"size(32)"`
+	CreatedAt string `orm:"size(32)"`
+}
+
+// TableIndex packets are always selected by session and queue
+func (p *MqttPacket) TableIndex() [][]string {
+	return [][]string{
+		{"SessionId", "Queue"},
+	}
+}
+
+// RegisterModels register tables of the provider
+// must be called before orm is bootstrapped, e.g. before first RunSyncdb or NewOrm
+func RegisterModels() {
+	orm.RegisterModel(new(MqttSession), new(MqttPacket), new(MqttRetained), new(MqttSystem))
+}
+
+func encodeBytes(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func decodeBytes(s string) ([]byte, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	return base64.StdEncoding.DecodeString(s)
+}
+
+func (m *MqttSession) state() *persistence.SessionState {
+	state := &persistence.SessionState{
+		SessionBase: persistence.SessionBase{
+			Timestamp: m.CreatedAt,
+			Version:   byte(m.Version),
+		},
+	}
+
+	var err error
+
+	if state.Subscriptions, err = decodeBytes(m.Subscriptions); err != nil {
+		state.Errors = append(state.Errors, err)
+	}
+
+	if m.HasExpiry {
+		state.Expire = &persistence.SessionDelays{
+			Since:    m.ExpireSince,
+			ExpireIn: m.ExpireIn,
+		}
+
+		if state.Expire.Will, err = decodeBytes(m.Will); err != nil {
+			state.Errors = append(state.Errors, err)
+		}
+	}
+
+	return state
+}
+
+func (m *MqttSession) setExpiry(exp *persistence.SessionDelays) {
+	if exp == nil {
+		m.HasExpiry = false
+		m.ExpireSince = ""
+		m.ExpireIn = ""
+		m.Will = ""
+		return
+	}
+
+	m.HasExpiry = true
+	m.ExpireSince = exp.Since
+	m.ExpireIn = exp.ExpireIn
+	m.Will = encodeBytes(exp.Will)
+}
+
+func newPacket(id string, queue int, pkt *persistence.PersistedPacket) MqttPacket {
+	return MqttPacket{
+		SessionId: id,
+		Queue:     queue,
+		ExpireAt:  pkt.ExpireAt,
+		Data:      encodeBytes(pkt.Data),
+	}
+}
+
+func (p *MqttPacket) persisted() (*persistence.PersistedPacket, error) {
+	data, err := decodeBytes(p.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &persistence.PersistedPacket{
+		ExpireAt: p.ExpireAt,
+		Data:     data,
+	}, nil
+}
@@ -0,0 +1,226 @@
+package persistenceSQL
+
+import (
+	"strings"
+	"time"
+
+	"github.com/VolantMQ/vlapi/plugin"
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+	"logs"
+	"orm"
+)
+
+// defaultBatchSize rows per insert statement and per read of the streaming loads
+const defaultBatchSize = 256
+
+// Config of the sql persistence
+type Config struct {
+	// Alias of the database registered by orm.RegisterDataBase, default if empty
+	Alias string
+	// BatchSize rows per insert statement and read batch
+	BatchSize int
+}
+
+var (
+	log = logs.GetLogger()
+)
+
+type dbStatus struct {
+	done chan struct{}
+}
+
+type impl struct {
+	status dbStatus
+	cfg    Config
+	r      retained
+	s      sessions
+	sys    system
+}
+
+var _ persistence.IFace = (*impl)(nil)
+
+// Load open sql persistence
+// models must be registered by RegisterModels, missing tables are created
+func Load(c interface{}, params *vlplugin.SysParams) (persistence.IFace, error) {
+	cfg, ok := c.(*Config)
+	if !ok || cfg == nil {
+		return nil, persistence.ErrInvalidConfig
+	}
+
+	pl := &impl{
+		cfg: *cfg,
+	}
+
+	if len(pl.cfg.Alias) == 0 {
+		pl.cfg.Alias = "default"
+	}
+
+	if pl.cfg.BatchSize <= 0 {
+		pl.cfg.BatchSize = defaultBatchSize
+	}
+
+	if err := orm.RunSyncdb(pl.cfg.Alias, false, false); err != nil {
+		return nil, err
+	}
+
+	pl.status.done = make(chan struct{})
+
+	pl.r = retained{
+		status: &pl.status,
+		cfg:    &pl.cfg,
+	}
+
+	pl.s = sessions{
+		status: &pl.status,
+		cfg:    &pl.cfg,
+	}
+
+	pl.sys = system{
+		status: &pl.status,
+		cfg:    &pl.cfg,
+	}
+
+	if err := pl.sys.init(); err != nil {
+		return nil, err
+	}
+
+	return pl, nil
+}
+
+func (p *impl) System() (persistence.System, error) {
+	if err := p.status.open(); err != nil {
+		return nil, err
+	}
+
+	return &p.sys, nil
+}
+
+func (p *impl) Sessions() (persistence.Sessions, error) {
+	if err := p.status.open(); err != nil {
+		return nil, err
+	}
+
+	return &p.s, nil
+}
+
+func (p *impl) Retained() (persistence.Retained, error) {
+	if err := p.status.open(); err != nil {
+		return nil, err
+	}
+
+	return &p.r, nil
+}
+
+func (p *impl) Shutdown() error {
+	select {
+	case <-p.status.done:
+		return persistence.ErrNotOpen
+	default:
+		close(p.status.done)
+	}
+
+	return nil
+}
+
+// open error if provider has been shut down
+func (s *dbStatus) open() error {
+	select {
+	case <-s.done:
+		return persistence.ErrNotOpen
+	default:
+	}
+
+	return nil
+}
+
+// newOrm ormer of the database unless provider has been shut down
+func newOrm(status *dbStatus, cfg *Config) (orm.Ormer, error) {
+	if err := status.open(); err != nil {
+		return nil, err
+	}
+
+	o := orm.NewOrm()
+	if err := o.Using(cfg.Alias); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// inTx run f within transaction
+func inTx(status *dbStatus, cfg *Config, f func(o orm.Ormer) error) error {
+	o, err := newOrm(status, cfg)
+	if err != nil {
+		return err
+	}
+
+	if err = o.Begin(); err != nil {
+		return err
+	}
+
+	if err = f(o); err != nil {
+		if e := o.Rollback(); e != nil {
+			log.Error("sql persistence rollback, err:%s", e.Error())
+		}
+		return err
+	}
+
+	return o.Commit()
+}
+
+// isDuplicate true if err reports violation of primary key or unique constraint
+// drivers do not share error type, so known messages of mysql, postgres and sqlite are matched
+func isDuplicate(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	msg := strings.ToLower(err.Error())
+
+	return strings.Contains(msg, "duplicate entry") ||
+		strings.Contains(msg, "duplicate key") ||
+		strings.Contains(msg, "unique constraint")
+}
+
+type system struct {
+	status *dbStatus
+	cfg    *Config
+}
+
+// init write system row on first start
+func (s *system) init() error {
+	o, err := newOrm(s.status, s.cfg)
+	if err != nil {
+		return err
+	}
+
+	st := &MqttSystem{
+		Id:        1,
+		Version:   "1",
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+
+	_, _, err = o.ReadOrCreate(st, "Id")
+
+	return err
+}
+
+func (s *system) GetInfo() (*persistence.SystemState, error) {
+	o, err := newOrm(s.status, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &MqttSystem{Id: 1}
+	if err = o.Read(st); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, persistence.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &persistence.SystemState{
+		Version:   st.Version,
+		CreatedAt: st.CreatedAt,
+	}, nil
+}
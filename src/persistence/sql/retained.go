@@ -0,0 +1,82 @@
+package persistenceSQL
+
+import (
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+	"orm"
+)
+
+type retained struct {
+	status *dbStatus
+	cfg    *Config
+}
+
+func (r *retained) Load() ([]*persistence.PersistedPacket, error) {
+	o, err := newOrm(r.status, r.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*persistence.PersistedPacket
+	var last int64
+
+	for {
+		var rows []MqttRetained
+		if _, err = o.QueryTable(new(MqttRetained)).Filter("id__gt", last).OrderBy("id").Limit(r.cfg.BatchSize).All(&rows); err != nil {
+			return nil, err
+		}
+
+		for i := range rows {
+			data, e := decodeBytes(rows[i].Data)
+			if e != nil {
+				log.Error("sql persistence decode retained, id:%d, err:%s", rows[i].Id, e.Error())
+				continue
+			}
+
+			res = append(res, &persistence.PersistedPacket{
+				ExpireAt: rows[i].ExpireAt,
+				Data:     data,
+			})
+		}
+
+		if len(rows) < r.cfg.BatchSize {
+			break
+		}
+
+		last = rows[len(rows)-1].Id
+	}
+
+	return res, nil
+}
+
+func (r *retained) Store(data []*persistence.PersistedPacket) error {
+	return inTx(r.status, r.cfg, func(o orm.Ormer) error {
+		if _, err := o.QueryTable(new(MqttRetained)).Filter("id__gte", 0).Delete(); err != nil {
+			return err
+		}
+
+		if len(data) == 0 {
+			return nil
+		}
+
+		rows := make([]MqttRetained, 0, len(data))
+		for _, pkt := range data {
+			rows = append(rows, MqttRetained{
+				ExpireAt: pkt.ExpireAt,
+				Data:     encodeBytes(pkt.Data),
+			})
+		}
+
+		_, err := o.InsertMulti(r.cfg.BatchSize, rows)
+		return err
+	})
+}
+
+func (r *retained) Wipe() error {
+	o, err := newOrm(r.status, r.cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = o.QueryTable(new(MqttRetained)).Filter("id__gte", 0).Delete()
+	return err
+}
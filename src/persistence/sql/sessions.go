@@ -0,0 +1,444 @@
+package persistenceSQL
+
+import (
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+	"orm"
+)
+
+type sessions struct {
+	status *dbStatus
+	cfg    *Config
+}
+
+var _ persistence.Sessions = (*sessions)(nil)
+
+func readSession(o orm.Ormer, id []byte) (*MqttSession, error) {
+	ses := &MqttSession{Id: string(id)}
+
+	if err := o.Read(ses); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, persistence.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return ses, nil
+}
+
+// update read session and store columns changed by f
+func (s *sessions) update(id []byte, f func(*MqttSession) []string) error {
+	o, err := newOrm(s.status, s.cfg)
+	if err != nil {
+		return err
+	}
+
+	ses, err := readSession(o, id)
+	if err != nil {
+		return err
+	}
+
+	if cols := f(ses); len(cols) > 0 {
+		_, err = o.Update(ses, cols...)
+	}
+
+	return err
+}
+
+func (s *sessions) Exists(id []byte) bool {
+	o, err := newOrm(s.status, s.cfg)
+	if err != nil {
+		return false
+	}
+
+	return o.QueryTable(new(MqttSession)).Filter("id", string(id)).Exist()
+}
+
+func (s *sessions) Count() uint64 {
+	o, err := newOrm(s.status, s.cfg)
+	if err != nil {
+		return 0
+	}
+
+	cnt, err := o.QueryTable(new(MqttSession)).Count()
+	if err != nil {
+		log.Error("sql persistence count sessions, err:%s", err.Error())
+		return 0
+	}
+
+	return uint64(cnt)
+}
+
+func (s *sessions) SubscriptionsStore(id []byte, data []byte) error {
+	o, err := newOrm(s.status, s.cfg)
+	if err != nil {
+		return err
+	}
+
+	ses, err := readSession(o, id)
+	if err == persistence.ErrNotFound {
+		_, err = o.Insert(&MqttSession{
+			Id:            string(id),
+			Subscriptions: encodeBytes(data),
+		})
+
+		// session created concurrently, update it
+		if !isDuplicate(err) {
+			return err
+		}
+
+		ses, err = readSession(o, id)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	ses.Subscriptions = encodeBytes(data)
+	_, err = o.Update(ses, "Subscriptions")
+
+	return err
+}
+
+func (s *sessions) SubscriptionsDelete(id []byte) error {
+	err := s.update(id, func(ses *MqttSession) []string {
+		if len(ses.Subscriptions) == 0 {
+			return nil
+		}
+
+		ses.Subscriptions = ""
+		return []string{"Subscriptions"}
+	})
+
+	if err == persistence.ErrNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// packetsForEach walk packets of the queue in order they were stored
+// packets are read in batches, loaded ones deleted once walk done
+func (s *sessions) packetsForEach(id []byte, queue int, ctx interface{}, load persistence.PacketLoader) error {
+	o, err := newOrm(s.status, s.cfg)
+	if err != nil {
+		return err
+	}
+
+	var remove []int64
+	var last int64
+
+	stop := false
+
+	for !stop {
+		var rows []MqttPacket
+		_, err = o.QueryTable(new(MqttPacket)).
+			Filter("session_id", string(id)).
+			Filter("queue", queue).
+			Filter("id__gt", last).
+			OrderBy("id").
+			Limit(s.cfg.BatchSize).
+			All(&rows)
+		if err != nil {
+			return err
+		}
+
+		for i := range rows {
+			pkt, e := rows[i].persisted()
+			if e != nil {
+				log.Error("sql persistence decode packet, clientId:%s, err:%s", string(id), e.Error())
+				remove = append(remove, rows[i].Id)
+				continue
+			}
+
+			rm, e := load(ctx, pkt)
+			if rm {
+				remove = append(remove, rows[i].Id)
+			}
+
+			if e != nil {
+				stop = true
+				break
+			}
+		}
+
+		if len(rows) < s.cfg.BatchSize {
+			break
+		}
+
+		last = rows[len(rows)-1].Id
+	}
+
+	for len(remove) > 0 {
+		n := len(remove)
+		if n > s.cfg.BatchSize {
+			n = s.cfg.BatchSize
+		}
+
+		if _, err = o.QueryTable(new(MqttPacket)).Filter("id__in", remove[:n]).Delete(); err != nil {
+			return err
+		}
+
+		remove = remove[n:]
+	}
+
+	return nil
+}
+
+func (s *sessions) PacketsForEachQoS0(id []byte, ctx interface{}, load persistence.PacketLoader) error {
+	return s.packetsForEach(id, queueQoS0, ctx, load)
+}
+
+func (s *sessions) PacketsForEachQoS12(id []byte, ctx interface{}, load persistence.PacketLoader) error {
+	return s.packetsForEach(id, queueQoS12, ctx, load)
+}
+
+func (s *sessions) PacketsForEachUnAck(id []byte, ctx interface{}, load persistence.PacketLoader) error {
+	return s.packetsForEach(id, queueUnAck, ctx, load)
+}
+
+func (s *sessions) packetCount(id []byte, queue int) (uint64, error) {
+	o, err := newOrm(s.status, s.cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	if !o.QueryTable(new(MqttSession)).Filter("id", string(id)).Exist() {
+		return 0, persistence.ErrNotFound
+	}
+
+	cnt, err := o.QueryTable(new(MqttPacket)).Filter("session_id", string(id)).Filter("queue", queue).Count()
+
+	return uint64(cnt), err
+}
+
+func (s *sessions) PacketCountQoS0(id []byte) (uint64, error) {
+	return s.packetCount(id, queueQoS0)
+}
+
+func (s *sessions) PacketCountQoS12(id []byte) (uint64, error) {
+	return s.packetCount(id, queueQoS12)
+}
+
+func (s *sessions) PacketCountUnAck(id []byte) (uint64, error) {
+	return s.packetCount(id, queueUnAck)
+}
+
+func (s *sessions) PacketsStore(id []byte, packets persistence.PersistedPackets) error {
+	rows := make([]MqttPacket, 0, len(packets.QoS0)+len(packets.QoS12)+len(packets.UnAck))
+
+	for _, pkt := range packets.QoS0 {
+		rows = append(rows, newPacket(string(id), queueQoS0, pkt))
+	}
+
+	for _, pkt := range packets.QoS12 {
+		rows = append(rows, newPacket(string(id), queueQoS12, pkt))
+	}
+
+	for _, pkt := range packets.UnAck {
+		rows = append(rows, newPacket(string(id), queueUnAck, pkt))
+	}
+
+	return inTx(s.status, s.cfg, func(o orm.Ormer) error {
+		if !o.QueryTable(new(MqttSession)).Filter("id", string(id)).Exist() {
+			return persistence.ErrNotFound
+		}
+
+		if len(rows) == 0 {
+			return nil
+		}
+
+		_, err := o.InsertMulti(s.cfg.BatchSize, rows)
+		return err
+	})
+}
+
+func (s *sessions) PacketsDelete(id []byte) error {
+	o, err := newOrm(s.status, s.cfg)
+	if err != nil {
+		return err
+	}
+
+	if !o.QueryTable(new(MqttSession)).Filter("id", string(id)).Exist() {
+		return persistence.ErrNotFound
+	}
+
+	_, err = o.QueryTable(new(MqttPacket)).Filter("session_id", string(id)).Delete()
+
+	return err
+}
+
+// packetsDrop delete count packets of the queue with lowest ids
+func (s *sessions) packetsDrop(id []byte, queue int, count int) error {
+	return inTx(s.status, s.cfg, func(o orm.Ormer) error {
+		if !o.QueryTable(new(MqttSession)).Filter("id", string(id)).Exist() {
+			return persistence.ErrNotFound
+		}
+
+		if count <= 0 {
+			return nil
+		}
+
+		var ids orm.ParamsList
+		_, err := o.QueryTable(new(MqttPacket)).
+			Filter("session_id", string(id)).
+			Filter("queue", queue).
+			OrderBy("id").
+			Limit(count).
+			ValuesFlat(&ids, "id")
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		_, err = o.QueryTable(new(MqttPacket)).Filter("id__in", ids).Delete()
+		return err
+	})
+}
+
+func (s *sessions) PacketsDropQoS0(id []byte, count int) error {
+	return s.packetsDrop(id, queueQoS0, count)
+}
+
+func (s *sessions) PacketsDropQoS12(id []byte, count int) error {
+	return s.packetsDrop(id, queueQoS12, count)
+}
+
+func (s *sessions) packetStore(id []byte, queue int, pkt *persistence.PersistedPacket) error {
+	o, err := newOrm(s.status, s.cfg)
+	if err != nil {
+		return err
+	}
+
+	if !o.QueryTable(new(MqttSession)).Filter("id", string(id)).Exist() {
+		return persistence.ErrNotFound
+	}
+
+	row := newPacket(string(id), queue, pkt)
+	_, err = o.Insert(&row)
+
+	return err
+}
+
+func (s *sessions) PacketStoreQoS0(id []byte, pkt *persistence.PersistedPacket) error {
+	return s.packetStore(id, queueQoS0, pkt)
+}
+
+func (s *sessions) PacketStoreQoS12(id []byte, pkt *persistence.PersistedPacket) error {
+	return s.packetStore(id, queueQoS12, pkt)
+}
+
+func (s *sessions) PacketStoreUnAck(id []byte, pkt *persistence.PersistedPacket) error {
+	return s.packetStore(id, queueUnAck, pkt)
+}
+
+// LoadForEach stream sessions in batches ordered by id
+// loader is free to modify storage as session is not touched after it is loaded
+func (s *sessions) LoadForEach(loader persistence.SessionLoader, context interface{}) error {
+	o, err := newOrm(s.status, s.cfg)
+	if err != nil {
+		return err
+	}
+
+	last := ""
+
+	for {
+		var rows []MqttSession
+		if _, err = o.QueryTable(new(MqttSession)).Filter("id__gt", last).OrderBy("id").Limit(s.cfg.BatchSize).All(&rows); err != nil {
+			return err
+		}
+
+		for i := range rows {
+			if err = loader.LoadSession(context, []byte(rows[i].Id), rows[i].state()); err != nil {
+				return err
+			}
+		}
+
+		if len(rows) < s.cfg.BatchSize {
+			return nil
+		}
+
+		last = rows[len(rows)-1].Id
+	}
+}
+
+func (s *sessions) Create(id []byte, state *persistence.SessionBase) error {
+	o, err := newOrm(s.status, s.cfg)
+	if err != nil {
+		return err
+	}
+
+	ses := &MqttSession{
+		Id: string(id),
+	}
+
+	if state != nil {
+		ses.CreatedAt = state.Timestamp
+		ses.Version = int(state.Version)
+	}
+
+	// primary key rejects concurrent create of the same session
+	if _, err = o.Insert(ses); isDuplicate(err) {
+		return persistence.ErrAlreadyExists
+	}
+
+	return err
+}
+
+func (s *sessions) StateStore(id []byte, state *persistence.SessionState) error {
+	return s.update(id, func(ses *MqttSession) []string {
+		ses.CreatedAt = state.Timestamp
+		ses.Version = int(state.Version)
+
+		// keep persisted subscriptions if state has none
+		if len(state.Subscriptions) > 0 {
+			ses.Subscriptions = encodeBytes(state.Subscriptions)
+		}
+
+		ses.setExpiry(state.Expire)
+
+		return []string{"CreatedAt", "Version", "Subscriptions", "HasExpiry", "ExpireSince", "ExpireIn", "Will"}
+	})
+}
+
+func (s *sessions) ExpiryStore(id []byte, exp *persistence.SessionDelays) error {
+	return s.update(id, func(ses *MqttSession) []string {
+		ses.setExpiry(exp)
+
+		return []string{"HasExpiry", "ExpireSince", "ExpireIn", "Will"}
+	})
+}
+
+func (s *sessions) ExpiryDelete(id []byte) error {
+	return s.update(id, func(ses *MqttSession) []string {
+		if !ses.HasExpiry {
+			return nil
+		}
+
+		ses.setExpiry(nil)
+
+		return []string{"HasExpiry", "ExpireSince", "ExpireIn", "Will"}
+	})
+}
+
+func (s *sessions) StateDelete(id []byte) error {
+	return s.update(id, func(ses *MqttSession) []string {
+		ses.Subscriptions = ""
+		ses.setExpiry(nil)
+
+		return []string{"Subscriptions", "HasExpiry", "ExpireSince", "ExpireIn", "Will"}
+	})
+}
+
+func (s *sessions) Delete(id []byte) error {
+	return inTx(s.status, s.cfg, func(o orm.Ormer) error {
+		if _, err := o.QueryTable(new(MqttPacket)).Filter("session_id", string(id)).Delete(); err != nil {
+			return err
+		}
+
+		num, err := o.QueryTable(new(MqttSession)).Filter("id", string(id)).Delete()
+		if err == nil && num == 0 {
+			err = persistence.ErrNotFound
+		}
+
+		return err
+	})
+}
@@ -0,0 +1,148 @@
+package persistenceSQL
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+)
+
+// closed provider as Load would build it, shut down before any database access
+func closed(t *testing.T) *impl {
+	p := &impl{cfg: Config{Alias: "default", BatchSize: defaultBatchSize}}
+	p.status.done = make(chan struct{})
+	p.r = retained{status: &p.status, cfg: &p.cfg}
+	p.s = sessions{status: &p.status, cfg: &p.cfg}
+	p.sys = system{status: &p.status, cfg: &p.cfg}
+
+	if err := p.Shutdown(); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	return p
+}
+
+func TestShutdown(t *testing.T) {
+	p := closed(t)
+
+	if err := p.Shutdown(); err != persistence.ErrNotOpen {
+		t.Errorf("second shutdown: expected %v, got %v", persistence.ErrNotOpen, err)
+	}
+
+	if _, err := p.Sessions(); err != persistence.ErrNotOpen {
+		t.Errorf("sessions: expected %v, got %v", persistence.ErrNotOpen, err)
+	}
+
+	if _, err := p.Retained(); err != persistence.ErrNotOpen {
+		t.Errorf("retained: expected %v, got %v", persistence.ErrNotOpen, err)
+	}
+
+	if _, err := p.System(); err != persistence.ErrNotOpen {
+		t.Errorf("system: expected %v, got %v", persistence.ErrNotOpen, err)
+	}
+}
+
+func TestSessionsAfterShutdown(t *testing.T) {
+	p := closed(t)
+	s := &p.s
+	id := []byte("c1")
+	loader := func(interface{}, *persistence.PersistedPacket) (bool, error) { return false, nil }
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"create", s.Create(id, &persistence.SessionBase{})},
+		{"state store", s.StateStore(id, &persistence.SessionState{})},
+		{"subscriptions store", s.SubscriptionsStore(id, []byte("subs"))},
+		{"expiry store", s.ExpiryStore(id, &persistence.SessionDelays{})},
+		{"packet store", s.PacketStoreQoS12(id, &persistence.PersistedPacket{})},
+		{"packets for each", s.PacketsForEachQoS12(id, nil, loader)},
+		{"packets drop", s.PacketsDropQoS12(id, 1)},
+		{"load for each", s.LoadForEach(nil, nil)},
+		{"delete", s.Delete(id)},
+		{"retained store", p.r.Store(nil)},
+		{"retained wipe", p.r.Wipe()},
+	}
+
+	for _, tt := range tests {
+		if tt.err != persistence.ErrNotOpen {
+			t.Errorf("%s: expected %v, got %v", tt.name, persistence.ErrNotOpen, tt.err)
+		}
+	}
+
+	if s.Exists(id) {
+		t.Errorf("session must not exist after shutdown")
+	}
+
+	if n := s.Count(); n != 0 {
+		t.Errorf("count: expected 0, got %d", n)
+	}
+}
+
+func TestIsDuplicate(t *testing.T) {
+	tests := []struct {
+		err error
+		dup bool
+	}{
+		{nil, false},
+		{errors.New("Error 1062: Duplicate entry 'c1' for key 'PRIMARY'"), true},
+		{errors.New(`pq: duplicate key value violates unique constraint "mqtt_session_pkey"`), true},
+		{errors.New("UNIQUE constraint failed: mqtt_session.id"), true},
+		{errors.New("Error 1146: Table 'mqtt_session' doesn't exist"), false},
+	}
+
+	for _, tt := range tests {
+		if dup := isDuplicate(tt.err); dup != tt.dup {
+			t.Errorf("%v: expected %v, got %v", tt.err, tt.dup, dup)
+		}
+	}
+}
+
+func TestSessionModel(t *testing.T) {
+	m := &MqttSession{
+		Id:            "c1",
+		CreatedAt:     "t1",
+		Version:       5,
+		Subscriptions: encodeBytes([]byte("subs")),
+	}
+
+	m.setExpiry(&persistence.SessionDelays{Since: "s", ExpireIn: "10", Will: []byte("will")})
+
+	state := m.state()
+	if len(state.Errors) != 0 || string(state.Subscriptions) != "subs" || state.Version != 5 || state.Timestamp != "t1" {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	if state.Expire == nil || state.Expire.Since != "s" || state.Expire.ExpireIn != "10" || string(state.Expire.Will) != "will" {
+		t.Errorf("unexpected expiry %+v", state.Expire)
+	}
+
+	m.setExpiry(nil)
+	if state = m.state(); state.Expire != nil || len(m.Will) != 0 {
+		t.Errorf("expiry is not cleared %+v", state.Expire)
+	}
+
+	m.Subscriptions = "!"
+	if state = m.state(); len(state.Errors) != 1 {
+		t.Errorf("broken subscriptions must be reported")
+	}
+}
+
+func TestPacketModel(t *testing.T) {
+	m := newPacket("c1", 1, &persistence.PersistedPacket{ExpireAt: "e", Data: []byte{0x30, 0x00}})
+
+	pkt, err := m.persisted()
+	if err != nil {
+		t.Fatalf("persisted: %v", err)
+	}
+
+	if pkt.ExpireAt != "e" || string(pkt.Data) != string([]byte{0x30, 0x00}) {
+		t.Errorf("unexpected packet %+v", pkt)
+	}
+
+	m.Data = "!"
+	if _, err = m.persisted(); err == nil {
+		t.Errorf("broken packet must be reported")
+	}
+}
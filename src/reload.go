@@ -0,0 +1,318 @@
+package main
+
+import (
+	"auth"
+	"clients"
+	"common"
+	"conf"
+	"fmt"
+	"logs"
+	"path/filepath"
+	"reflect"
+	"server"
+	"sort"
+	"sync"
+	"transport"
+	"types"
+)
+
+// scramStore users of the scram auth provider
+type scramStore interface {
+	AddUser(name, password, projectID string) error
+	SetCredential(name string, c *auth.SCRAMCredential, projectID string)
+	DelUser(name string)
+}
+
+var (
+	// initialConfig config server has been started with, changes of keys not applied on reload are reported against it
+	initialConfig *conf.Config
+
+	// providers refreshed on reload
+	aclRules func(string, []auth.ACLRule) error
+	// scramUsers nil if auth_scram section was absent on start
+	scramUsers scramStore
+	scramNames map[string]bool
+	// internalUsers users loaded from database last time
+	internalUsers []User
+	// usersLock serializes reload of users by signal, timer and http API, config is replaced under it
+	usersLock sync.Mutex
+
+	// certReloaders certificates of tls listeners
+	certReloaders []*transport.CertReloader
+)
+
+// reloadableKeys config keys applied on reload, change of any other key requires restart
+var reloadableKeys = map[string]bool{
+	"log_level":       true,
+	"acl_file":        true,
+	"acl_db":          true,
+	"acl_default":     true,
+	"ack_timeout":     true,
+	"ack_max_timeout": true,
+	"ack_backoff":     true,
+	"ack_retries":     true,
+	"bridges":         true,
+	"rate_limit":      true,
+	"offline_qos0":    true,
+	"offline_queue":   true,
+	"lockout":         true,
+}
+
+// applyLogLevel log_level of the config, level of log4g.json is kept if it is not set
+func applyLogLevel() {
+	name := config.GetString("log_level")
+	if len(name) == 0 {
+		return
+	}
+
+	if level, ok := logs.ParseLevel(name); ok {
+		log.SetLevel(level)
+	} else {
+		log.Error("unknown log_level %q", name)
+	}
+}
+
+// applyLimits options taking effect on new connections
+// limits are published as single snapshot, connections never see half applied reload
+func applyLimits() {
+	l := *common.CurrentLimits()
+
+	// 重传: QoS1/2 messages not acknowledged within ack_timeout seconds are resent
+	l.AckTimeout = config.GetIntWithDefault("ack_timeout", l.AckTimeout)
+	l.AckMaxTimeout = config.GetIntWithDefault("ack_max_timeout", l.AckMaxTimeout)
+	l.AckBackoff = config.GetFloatWithDefault("ack_backoff", l.AckBackoff)
+	l.AckRetries = config.GetIntWithDefault("ack_retries", l.AckRetries)
+
+	// 限流: publish limits of every client and of particular users, listener may have own ones
+	if err := applyRateLimit(&l); err != nil {
+		log.Error("rate_limit is invalid, running limits are kept:%s", err.Error())
+	}
+
+	// 离线队列: messages persisted for offline durable sessions
+	l.OfflineQoS0 = config.GetBoolWithDefault("offline_qos0", l.OfflineQoS0)
+	if err := applyOfflineQueue(&l); err != nil {
+		log.Error("offline_queue is invalid, running limits are kept:%s", err.Error())
+	}
+
+	common.SetLimits(&l)
+}
+
+func applyOfflineQueue(l *common.Limits) error {
+	oc := offlineQueueConfig{
+		Overflow: clients.OverflowDropOldest,
+	}
+	if _, err := config.GetObject("offline_queue", &oc); err != nil {
+		return err
+	}
+
+	switch oc.Overflow {
+	case clients.OverflowDropOldest, clients.OverflowDropNewest, clients.OverflowDropQoS0:
+	default:
+		return fmt.Errorf("unknown overflow policy %q", oc.Overflow)
+	}
+
+	l.OfflineQueueMax = oc.MaxMessages
+	l.OfflineQueueBytes = oc.MaxBytes
+	l.OfflineOverflow = oc.Overflow
+
+	return nil
+}
+
+func applyRateLimit(l *common.Limits) error {
+	rc := rateLimitConfig{}
+	if _, err := config.GetObject("rate_limit", &rc); err != nil {
+		return err
+	}
+
+	global, err := rc.limit()
+	if err != nil {
+		return err
+	}
+
+	// map of published snapshot is never modified, so new one is built
+	users := make(map[string]types.RateLimit)
+	for name, u := range rc.Users {
+		if users[name], err = u.limit(); err != nil {
+			return fmt.Errorf("user %s: %s", name, err.Error())
+		}
+	}
+
+	l.RateLimit = global
+	l.UserRateLimits = users
+
+	return nil
+}
+
+// setSCRAMUsers put internal users and users of the credentials file into scram provider
+// users put by previous call and absent now are removed
+func setSCRAMUsers(sc *scramConfig, users []User) error {
+	var fileUsers []auth.SCRAMUser
+	var creds []*auth.SCRAMCredential
+
+	if len(sc.File) > 0 {
+		var err error
+		if fileUsers, err = auth.LoadSCRAMUsers(filepath.Join(basedir, "conf", sc.File)); err != nil {
+			return err
+		}
+		for _, u := range fileUsers {
+			cred, err := auth.ParseSCRAMCredential(u.Credential)
+			if err != nil {
+				return fmt.Errorf("user %s: %s", u.Name, err.Error())
+			}
+			creds = append(creds, cred)
+		}
+	}
+
+	names := make(map[string]bool)
+
+	if sc.InternalUsers {
+		for _, user := range users {
+			if err := scramUsers.AddUser(user.Name, user.Passwd, user.Id); err != nil {
+				return err
+			}
+			names[user.Name] = true
+		}
+	}
+
+	for i, u := range fileUsers {
+		scramUsers.SetCredential(u.Name, creds[i], u.ProjectID)
+		names[u.Name] = true
+	}
+
+	for name := range scramNames {
+		if !names[name] {
+			scramUsers.DelUser(name)
+		}
+	}
+
+	scramNames = names
+
+	return nil
+}
+
+// reloadUsers load users from database again, users removed from database are dropped
+// connected clients of removed users stay connected
+func reloadUsers() error {
+	usersLock.Lock()
+	defer usersLock.Unlock()
+
+	users, err := getUsers()
+	if err != nil {
+		return err
+	}
+
+	sAuth := auth.GetAuth()
+
+	present := make(map[string]bool)
+	for _, user := range users {
+		present[user.Name] = true
+	}
+
+	for _, user := range internalUsers {
+		if !present[user.Name] {
+			sAuth.DelUser(user.Name)
+		}
+	}
+
+	for _, user := range users {
+		sAuth.AddUser(internalUserMap(user))
+	}
+
+	internalUsers = users
+
+	log.Debug("user size:%d", len(users))
+
+	if scramUsers != nil {
+		sc := scramConfig{}
+		if _, err = config.GetObject("auth_scram", &sc); err != nil {
+			return fmt.Errorf("auth_scram: %s", err.Error())
+		}
+		if err = setSCRAMUsers(&sc, users); err != nil {
+			return fmt.Errorf("auth_scram: %s", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// reload read config again and apply settings which do not require restart
+// existing connections are kept, limits take effect on new connections
+func reload(srv server.Server) {
+	log.Info("reloading %s", server_config)
+
+	c := conf.LoadFile(filepath.Join(basedir, "conf", server_config))
+	if c == nil {
+		log.Error("reload: can not load %s, running config is kept", server_config)
+		return
+	}
+
+	// users sync running by timer and http API reads config
+	usersLock.Lock()
+	config = c
+	usersLock.Unlock()
+
+	applyLogLevel()
+	applyLimits()
+
+	if err := reloadUsers(); err != nil {
+		log.Error("reload users fail:%s", err.Error())
+	}
+
+	if err := loadACL(aclRules); err != nil {
+		log.Error("reload acl fail:%s", err.Error())
+	}
+
+	if lc, err := loadLockout(); err != nil {
+		log.Error("reload lockout fail:%s", err.Error())
+	} else {
+		lockout.SetConfig(lc)
+	}
+
+	if bridges, err := loadBridges(); err != nil {
+		log.Error("reload bridges fail:%s", err.Error())
+	} else if err = srv.ReloadBridges(bridges); err != nil {
+		log.Error("reload bridges fail:%s", err.Error())
+	}
+
+	for _, r := range certReloaders {
+		if _, err := r.Reload(); err != nil {
+			log.Error("reload certificate fail:%s", err.Error())
+		}
+	}
+
+	for _, k := range restartKeys(initialConfig, c) {
+		log.Warn("reload: %s has changed, restart is required to apply it", k)
+	}
+
+	log.Info("%s reloaded", server_config)
+}
+
+// restartKeys keys changed since start which are not applied on reload
+func restartKeys(prev, next *conf.Config) []string {
+	keys := make(map[string]bool)
+	for _, k := range prev.Keys() {
+		keys[k] = true
+	}
+	for _, k := range next.Keys() {
+		keys[k] = true
+	}
+
+	var changed []string
+
+	for k := range keys {
+		if reloadableKeys[k] {
+			continue
+		}
+		// users of the scram provider are reloaded, provider itself is created on start
+		if k == "auth_scram" && scramUsers != nil && next.Get(k) != nil {
+			continue
+		}
+		if !reflect.DeepEqual(prev.Get(k), next.Get(k)) {
+			changed = append(changed, k)
+		}
+	}
+
+	sort.Strings(changed)
+
+	return changed
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"auth"
+	"common"
+	"conf"
+)
+
+// fakeScram scram users store
+type fakeScram struct{}
+
+func (*fakeScram) AddUser(name, password, projectID string) error { return nil }
+
+func (*fakeScram) SetCredential(name string, c *auth.SCRAMCredential, projectID string) {}
+
+func (*fakeScram) DelUser(name string) {}
+
+// loadTestConfig config parsed from given json
+func loadTestConfig(t *testing.T, data string) *conf.Config {
+	file := filepath.Join(t.TempDir(), "nicemqtt.json")
+	if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	c := conf.LoadFile(file)
+	if c == nil {
+		t.Fatalf("invalid config %s", data)
+	}
+
+	return c
+}
+
+// setTestConfig replace running config for the test
+func setTestConfig(t *testing.T, data string) {
+	prev := config
+	t.Cleanup(func() {
+		config = prev
+	})
+
+	config = loadTestConfig(t, data)
+}
+
+func TestRestartKeys(t *testing.T) {
+	prev := loadTestConfig(t, `{"port":"1883","log_level":"info","ack_timeout":20,"rate_limit":{"messages":10},"auth_scram":{"file":"a"},"removed":1}`)
+
+	tests := []struct {
+		name  string
+		next  string
+		scram bool
+		keys  []string
+	}{
+		{"unchanged", `{"port":"1883","log_level":"info","ack_timeout":20,"rate_limit":{"messages":10},"auth_scram":{"file":"a"},"removed":1}`, false, nil},
+		{"reloadable keys changed", `{"port":"1883","log_level":"debug","ack_timeout":5,"rate_limit":{"messages":1},"auth_scram":{"file":"a"},"removed":1}`, false, nil},
+		{"restart keys changed", `{"port":"1884","log_level":"info","ack_timeout":20,"rate_limit":{"messages":10},"auth_scram":{"file":"b"},"added":true}`, false, []string{"added", "auth_scram", "port", "removed"}},
+		{"scram users reloaded", `{"port":"1883","auth_scram":{"file":"b"},"removed":1}`, true, nil},
+		{"scram provider removed", `{"port":"1883","removed":1}`, true, []string{"auth_scram"}},
+	}
+
+	prevScram := scramUsers
+	t.Cleanup(func() {
+		scramUsers = prevScram
+	})
+
+	for _, tt := range tests {
+		scramUsers = nil
+		if tt.scram {
+			scramUsers = &fakeScram{}
+		}
+
+		if keys := restartKeys(prev, loadTestConfig(t, tt.next)); !reflect.DeepEqual(keys, tt.keys) {
+			t.Errorf("%s: got %v, want %v", tt.name, keys, tt.keys)
+		}
+	}
+}
+
+func TestApplyLimits(t *testing.T) {
+	prev := common.CurrentLimits()
+	t.Cleanup(func() {
+		common.SetLimits(prev)
+	})
+
+	setTestConfig(t, `{"ack_timeout":5,"ack_retries":2,"offline_qos0":false,
+		"rate_limit":{"messages":10,"users":{"u1":{"messages":100}}},
+		"offline_queue":{"max_messages":50,"overflow":"drop_newest"}}`)
+
+	applyLimits()
+
+	l := common.CurrentLimits()
+	if l == prev {
+		t.Fatalf("limits are modified in place")
+	}
+
+	if l.AckTimeout != 5 || l.AckRetries != 2 || l.AckMaxTimeout != prev.AckMaxTimeout || l.OfflineQoS0 ||
+		l.RateLimit.Messages != 10 || l.UserRateLimits["u1"].Messages != 100 ||
+		l.OfflineQueueMax != 50 || l.OfflineOverflow != "drop_newest" {
+		t.Errorf("unexpected limits %+v", l)
+	}
+
+	// invalid sections keep running limits of these sections only
+	setTestConfig(t, `{"ack_timeout":7,"rate_limit":{"policy":"block"},"offline_queue":{"overflow":"drop_all"}}`)
+
+	applyLimits()
+
+	next := common.CurrentLimits()
+	if next.AckTimeout != 7 || next.RateLimit.Messages != 10 || next.OfflineQueueMax != 50 {
+		t.Errorf("unexpected limits %+v", next)
+	}
+
+	// snapshot published before is never changed
+	if l.AckTimeout != 5 {
+		t.Errorf("published snapshot changed %+v", l)
+	}
+}
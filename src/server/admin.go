@@ -0,0 +1,156 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"auth"
+	"clients"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// sessionsAdmin operations of sessions manager used by management API
+type sessionsAdmin interface {
+	Clients(offset, limit int) ([]clients.ClientInfo, int)
+	Session(id string) (*clients.SessionInfo, error)
+	Disconnect(id string) error
+	DeleteSession(id string) error
+	// DisconnectUser stop sessions authenticated as username, returns count of stopped sessions
+	DisconnectUser(username string) int
+	// DisconnectBanned stop sessions matching ban list, returns count of stopped sessions
+	DisconnectBanned(bans *auth.BanList) int
+}
+
+var _ sessionsAdmin = (*clients.Manager)(nil)
+
+// adminAPI http handlers to manage clients and sessions of the running server
+type adminAPI struct {
+	sessions sessionsAdmin
+}
+
+type clientsPage struct {
+	Total  int                  `json:"total"`
+	Offset int                  `json:"offset"`
+	Limit  int                  `json:"limit"`
+	Items  []clients.ClientInfo `json:"items"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error("write response err:%s", err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, &errorResponse{Error: err.Error()})
+}
+
+// sessionError map error of the sessions manager to http status
+func sessionError(w http.ResponseWriter, err error) {
+	switch err {
+	case clients.ErrSessionNotFound:
+		writeError(w, http.StatusNotFound, err)
+	case clients.ErrSessionActive:
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// pageParams read offset and limit query parameters
+func pageParams(req *http.Request) (int, int, bool) {
+	offset := 0
+	limit := defaultPageLimit
+
+	var err error
+
+	q := req.URL.Query()
+	if v := q.Get("offset"); len(v) > 0 {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, false
+		}
+	}
+
+	if v := q.Get("limit"); len(v) > 0 {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			return 0, 0, false
+		}
+	}
+
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	return offset, limit, true
+}
+
+// ListClients GET /v1/clients?offset=&limit=
+func (a *adminAPI) ListClients(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	offset, limit, ok := pageParams(req)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	items, total := a.sessions.Clients(offset, limit)
+	if items == nil {
+		items = []clients.ClientInfo{}
+	}
+
+	writeJSON(w, http.StatusOK, &clientsPage{
+		Total:  total,
+		Offset: offset,
+		Limit:  limit,
+		Items:  items,
+	})
+}
+
+// GetSession GET /v1/sessions/:id
+func (a *adminAPI) GetSession(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	info, err := a.sessions.Session(ps.ByName("id"))
+	if err != nil {
+		sessionError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
+
+// DisconnectClient DELETE /v1/clients/:id
+func (a *adminAPI) DisconnectClient(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+	log.Info("Client disconnect start, id:%s.", id)
+
+	if err := a.sessions.Disconnect(id); err != nil {
+		sessionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteSession DELETE /v1/sessions/:id
+func (a *adminAPI) DeleteSession(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+	log.Info("Session delete start, id:%s.", id)
+
+	if err := a.sessions.DeleteSession(id); err != nil {
+		sessionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+
+	"auth"
+	"clients"
+)
+
+// sessions fake sessions manager with connected clients ordered by id
+type sessions struct {
+	clients      []clients.ClientInfo
+	disconnected []string
+	deleted      []string
+	// stopped clients disconnected by user or ban
+	stopped []string
+}
+
+func (s *sessions) Clients(offset, limit int) ([]clients.ClientInfo, int) {
+	if offset >= len(s.clients) {
+		return nil, len(s.clients)
+	}
+
+	end := offset + limit
+	if end > len(s.clients) {
+		end = len(s.clients)
+	}
+
+	return s.clients[offset:end], len(s.clients)
+}
+
+func (s *sessions) Session(id string) (*clients.SessionInfo, error) {
+	for i := range s.clients {
+		if s.clients[i].ID == id {
+			return &clients.SessionInfo{ID: id, Online: true, Client: &s.clients[i], Subscriptions: []clients.SubscriptionInfo{}}, nil
+		}
+	}
+
+	return nil, clients.ErrSessionNotFound
+}
+
+func (s *sessions) Disconnect(id string) error {
+	if _, err := s.Session(id); err != nil {
+		return err
+	}
+
+	s.disconnected = append(s.disconnected, id)
+	return nil
+}
+
+func (s *sessions) DeleteSession(id string) error {
+	if _, err := s.Session(id); err == nil {
+		return clients.ErrSessionActive
+	}
+
+	if id != "offline" {
+		return clients.ErrSessionNotFound
+	}
+
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+func (s *sessions) DisconnectUser(username string) int {
+	return s.disconnect(func(c clients.ClientInfo) bool {
+		return c.Username == username
+	})
+}
+
+func (s *sessions) DisconnectBanned(bans *auth.BanList) int {
+	return s.disconnect(func(c clients.ClientInfo) bool {
+		host, _, _ := net.SplitHostPort(c.Address)
+		return bans.Banned(c.ID, c.Username, host) != nil
+	})
+}
+
+// disconnect drop matching clients from the list as real sessions are gone once stopped
+func (s *sessions) disconnect(match func(clients.ClientInfo) bool) int {
+	var active []clients.ClientInfo
+
+	for _, c := range s.clients {
+		if match(c) {
+			s.stopped = append(s.stopped, c.ID)
+		} else {
+			active = append(active, c)
+		}
+	}
+
+	n := len(s.clients) - len(active)
+	s.clients = active
+
+	return n
+}
+
+func newTestSessions() *sessions {
+	return &sessions{
+		clients: []clients.ClientInfo{
+			{ID: "c1", Address: "10.0.0.1:1000", Username: "u1", Protocol: "v5.0", KeepAlive: 60},
+			{ID: "c2", Address: "10.0.0.2:1000", Username: "u2", Protocol: "v3.1.1"},
+			{ID: "c3", Address: "10.0.0.3:1000", Username: "u3", Protocol: "v3.1.1"},
+		},
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	s := newTestSessions()
+	router := newRouter(HTTPConfig{Auth: newTestAuth(t)}, nil, s)
+
+	routes := []struct {
+		method string
+		url    string
+	}{
+		{http.MethodGet, "/v1/clients"},
+		{http.MethodDelete, "/v1/clients/c1"},
+		{http.MethodGet, "/v1/sessions/c1"},
+		{http.MethodDelete, "/v1/sessions/offline"},
+	}
+
+	for _, r := range routes {
+		if w := request(router, r.method, r.url, "", false); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without credentials: got %d, want %d", r.method, r.url, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	if len(s.disconnected) != 0 || len(s.deleted) != 0 {
+		t.Errorf("unauthorized request changed sessions, disconnected:%v, deleted:%v", s.disconnected, s.deleted)
+	}
+
+	// admin API is not served at all if callers can not be authenticated
+	router = newRouter(HTTPConfig{}, nil, s)
+	if w := request(router, http.MethodGet, "/v1/clients", "", true); w.Code != http.StatusNotFound {
+		t.Errorf("clients without auth configured: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestAdminListClients(t *testing.T) {
+	router := newRouter(HTTPConfig{Auth: newTestAuth(t)}, nil, newTestSessions())
+
+	tests := []struct {
+		query  string
+		code   int
+		offset int
+		limit  int
+		ids    []string
+	}{
+		{"", http.StatusOK, 0, defaultPageLimit, []string{"c1", "c2", "c3"}},
+		{"?offset=1&limit=1", http.StatusOK, 1, 1, []string{"c2"}},
+		{"?offset=5", http.StatusOK, 5, defaultPageLimit, []string{}},
+		{"?limit=5000", http.StatusOK, 0, maxPageLimit, []string{"c1", "c2", "c3"}},
+		{"?offset=-1", http.StatusBadRequest, 0, 0, nil},
+		{"?limit=0", http.StatusBadRequest, 0, 0, nil},
+		{"?limit=x", http.StatusBadRequest, 0, 0, nil},
+	}
+
+	for _, tt := range tests {
+		w := request(router, http.MethodGet, "/v1/clients"+tt.query, "", true)
+		if w.Code != tt.code {
+			t.Errorf("%q: got %d, want %d", tt.query, w.Code, tt.code)
+			continue
+		}
+
+		if tt.code != http.StatusOK {
+			continue
+		}
+
+		page := &clientsPage{}
+		if err := json.Unmarshal(w.Body.Bytes(), page); err != nil {
+			t.Fatalf("%q: decode: %v", tt.query, err)
+		}
+
+		if page.Total != 3 || page.Offset != tt.offset || page.Limit != tt.limit || len(page.Items) != len(tt.ids) {
+			t.Errorf("%q: unexpected page %+v", tt.query, page)
+			continue
+		}
+
+		for i, id := range tt.ids {
+			if page.Items[i].ID != id {
+				t.Errorf("%q: item %d is %s, want %s", tt.query, i, page.Items[i].ID, id)
+			}
+		}
+	}
+}
+
+func TestAdminClientsJSON(t *testing.T) {
+	router := newRouter(HTTPConfig{Auth: newTestAuth(t)}, nil, newTestSessions())
+
+	w := request(router, http.MethodGet, "/v1/clients?limit=1", "", true)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("content type %q", ct)
+	}
+
+	var page map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	for _, key := range []string{"total", "offset", "limit", "items"} {
+		if _, ok := page[key]; !ok {
+			t.Errorf("page has no %q", key)
+		}
+	}
+
+	item := page["items"].([]interface{})[0].(map[string]interface{})
+	for _, key := range []string{"id", "address", "username", "protocol", "keep_alive", "connected_at", "rate"} {
+		if _, ok := item[key]; !ok {
+			t.Errorf("client has no %q", key)
+		}
+	}
+
+	if item["address"] != "10.0.0.1:1000" || item["protocol"] != "v5.0" || item["keep_alive"] != float64(60) {
+		t.Errorf("unexpected client %v", item)
+	}
+}
+
+func TestAdminSessions(t *testing.T) {
+	s := newTestSessions()
+	router := newRouter(HTTPConfig{Auth: newTestAuth(t)}, nil, s)
+
+	tests := []struct {
+		method string
+		url    string
+		code   int
+	}{
+		{http.MethodGet, "/v1/sessions/c1", http.StatusOK},
+		{http.MethodGet, "/v1/sessions/unknown", http.StatusNotFound},
+		{http.MethodDelete, "/v1/clients/c2", http.StatusOK},
+		{http.MethodDelete, "/v1/clients/unknown", http.StatusNotFound},
+		{http.MethodDelete, "/v1/sessions/c1", http.StatusConflict},
+		{http.MethodDelete, "/v1/sessions/unknown", http.StatusNotFound},
+		{http.MethodDelete, "/v1/sessions/offline", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		w := request(router, tt.method, tt.url, "", true)
+		if w.Code != tt.code {
+			t.Errorf("%s %s: got %d, want %d", tt.method, tt.url, w.Code, tt.code)
+		}
+
+		if tt.code == http.StatusNotFound && tt.method == http.MethodGet {
+			e := &errorResponse{}
+			if err := json.Unmarshal(w.Body.Bytes(), e); err != nil || e.Error != clients.ErrSessionNotFound.Error() {
+				t.Errorf("%s %s: unexpected error body %s", tt.method, tt.url, w.Body.String())
+			}
+		}
+	}
+
+	if len(s.disconnected) != 1 || s.disconnected[0] != "c2" {
+		t.Errorf("disconnected %v, want [c2]", s.disconnected)
+	}
+
+	if len(s.deleted) != 1 || s.deleted[0] != "offline" {
+		t.Errorf("deleted %v, want [offline]", s.deleted)
+	}
+
+	w := request(router, http.MethodGet, "/v1/sessions/c1", "", true)
+
+	info := &clients.SessionInfo{}
+	if err := json.Unmarshal(w.Body.Bytes(), info); err != nil {
+		t.Fatalf("decode session: %v", err)
+	}
+
+	if info.ID != "c1" || !info.Online || info.Client == nil || info.Client.Username != "u1" {
+		t.Errorf("unexpected session %+v", info)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"auth"
+	"github.com/julienschmidt/httprouter"
+)
+
+// bansAPI http handlers of the ban list
+type bansAPI struct {
+	bans *auth.BanList
+	// sessions nil if MQTT server is not provided, sessions matching new bans are not stopped then
+	sessions sessionsAdmin
+}
+
+type banRequest struct {
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+	// Duration seconds ban is in effect for, 0 for permanent ban
+	Duration int `json:"duration"`
+}
+
+func banError(w http.ResponseWriter, err error) {
+	switch err {
+	case auth.ErrNotFound:
+		writeError(w, http.StatusNotFound, err)
+	case auth.ErrBanInvalid:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		log.Error("ban list err:%s", err.Error())
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// ListBans GET /v1/bans
+func (a *bansAPI) ListBans(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	list := a.bans.List()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Kind != list[j].Kind {
+			return list[i].Kind < list[j].Kind
+		}
+		return list[i].Value < list[j].Value
+	})
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// AddBan POST /v1/bans
+// active sessions matching ban are disconnected
+func (a *bansAPI) AddBan(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	r := &banRequest{}
+	if err := readJSON(req, r); err != nil || r.Duration < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ban := auth.Ban{
+		Kind:   r.Kind,
+		Value:  r.Value,
+		Reason: r.Reason,
+	}
+
+	if r.Duration > 0 {
+		ban.Expires = time.Now().Add(time.Duration(r.Duration) * time.Second)
+	}
+
+	if err := a.bans.Add(ban); err != nil {
+		banError(w, err)
+		return
+	}
+
+	log.Info("Ban added, %s:%s, reason:%s.", r.Kind, r.Value, r.Reason)
+
+	if a.sessions != nil {
+		if n := a.sessions.DisconnectBanned(a.bans); n > 0 {
+			log.Info("Ban added, disconnected sessions:%d.", n)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// RemoveBan DELETE /v1/bans/:kind/*value
+// value is the rest of the path to keep CIDR intact, e.g. /v1/bans/ip/10.0.0.0/8
+func (a *bansAPI) RemoveBan(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	kind := ps.ByName("kind")
+	value := strings.TrimPrefix(ps.ByName("value"), "/")
+
+	if err := a.bans.Remove(kind, value); err != nil {
+		banError(w, err)
+		return
+	}
+
+	log.Info("Ban removed, %s:%s.", kind, value)
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"auth"
+)
+
+func newTestBans(t *testing.T) *auth.BanList {
+	bans, err := auth.NewBanList(nil)
+	if err != nil {
+		t.Fatalf("ban list: %v", err)
+	}
+
+	return bans
+}
+
+func TestBansAuth(t *testing.T) {
+	bans := newTestBans(t)
+	s := newTestSessions()
+	router := newRouter(HTTPConfig{Auth: newTestAuth(t), Bans: bans}, nil, s)
+
+	w := request(router, http.MethodPost, "/v1/bans", `{"kind":"ip","value":"0.0.0.0/0"}`, false)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("add ban without credentials: got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	if len(bans.List()) != 0 || len(s.stopped) != 0 {
+		t.Errorf("unauthorized request banned, list:%v, disconnected:%v", bans.List(), s.stopped)
+	}
+
+	bans.Add(auth.Ban{Kind: auth.BanClientID, Value: "c1"}) // nolint: errcheck
+
+	if w = request(router, http.MethodDelete, "/v1/bans/clientid/c1", "", false); w.Code != http.StatusUnauthorized {
+		t.Errorf("remove ban without credentials: got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	if w = request(router, http.MethodGet, "/v1/bans", "", false); w.Code != http.StatusUnauthorized {
+		t.Errorf("list bans without credentials: got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	if len(bans.List()) != 1 {
+		t.Errorf("unauthorized request lifted ban")
+	}
+
+	router = newRouter(HTTPConfig{Bans: bans}, nil, s)
+	if w = request(router, http.MethodGet, "/v1/bans", "", true); w.Code != http.StatusNotFound {
+		t.Errorf("bans without auth configured: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestBans(t *testing.T) {
+	bans := newTestBans(t)
+	s := newTestSessions()
+	router := newRouter(HTTPConfig{Auth: newTestAuth(t), Bans: bans}, nil, s)
+
+	tests := []struct {
+		method string
+		url    string
+		body   string
+		code   int
+	}{
+		{http.MethodPost, "/v1/bans", `{"kind":"ip","value":"10.0.0.2/31","reason":"abuse"}`, http.StatusOK},
+		{http.MethodPost, "/v1/bans", `{"kind":"username","value":"u9","duration":60}`, http.StatusOK},
+		{http.MethodPost, "/v1/bans", `{"kind":"ip","value":"10.0.0"}`, http.StatusBadRequest},
+		{http.MethodPost, "/v1/bans", `{"kind":"host","value":"x"}`, http.StatusBadRequest},
+		{http.MethodPost, "/v1/bans", `{"kind":"username","value":"u8","duration":-1}`, http.StatusBadRequest},
+		{http.MethodPost, "/v1/bans", `{`, http.StatusBadRequest},
+		{http.MethodDelete, "/v1/bans/username/u9", "", http.StatusOK},
+		{http.MethodDelete, "/v1/bans/username/u9", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		if w := request(router, tt.method, tt.url, tt.body, true); w.Code != tt.code {
+			t.Errorf("%s %s %s: got %d, want %d", tt.method, tt.url, tt.body, w.Code, tt.code)
+		}
+	}
+
+	// 10.0.0.2/31 covers c2 and c3
+	if len(s.stopped) != 2 || s.stopped[0] != "c2" || s.stopped[1] != "c3" {
+		t.Errorf("disconnected %v, want [c2 c3]", s.stopped)
+	}
+
+	w := request(router, http.MethodGet, "/v1/bans", "", true)
+
+	var list []auth.Ban
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if len(list) != 1 || list[0].Kind != auth.BanIP || list[0].Value != "10.0.0.2/31" || list[0].Reason != "abuse" {
+		t.Errorf("unexpected bans %+v", list)
+	}
+
+	// CIDR is kept intact by catch-all value
+	if w = request(router, http.MethodDelete, "/v1/bans/ip/10.0.0.2/31", "", true); w.Code != http.StatusOK {
+		t.Errorf("remove CIDR ban: got %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if len(bans.List()) != 0 {
+		t.Errorf("bans left %v", bans.List())
+	}
+}
@@ -10,7 +10,7 @@ import (
 
 type User struct {
 	Name      string `json:"name"`
-	Password  string `json:"password"`
+	Password  string `json:"password,omitempty"`
 	ProjectId string `json:"project_id"`
 }
 
@@ -65,8 +65,67 @@ func Health(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func StartHTTPServer(host, port string) {
+// basicAuth authenticate caller using basic auth credentials
+func basicAuth(m *auth.Manager, req *http.Request) (string, bool) {
+	username, password, _ := req.BasicAuth()
+
+	return username, m.Password("", username, password) == auth.StatusAllow
+}
+
+// withAuth handler available to callers authenticated by manager only
+func withAuth(m *auth.Manager, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		if _, ok := basicAuth(m, req); !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="mqtt"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		h(w, req, ps)
+	}
+}
+
+// HTTPConfig configuration of the management API
+type HTTPConfig struct {
+	Host string
+	Port string
+	// Auth authenticates and authorizes callers of publish, admin, ban and users API
+	// these API are disabled if not set
+	Auth *auth.Manager
+	// Users persistent storage of users, users API changes memory of internal auth provider only if not set
+	Users UserStore
+	// Bans ban list managed over API, ban API is disabled if either it or Auth is not set
+	Bans *auth.BanList
+}
+
+// StartHTTPServer serve management API
+// admin and publish API are available only if MQTT server provided
+func StartHTTPServer(config HTTPConfig, srv Server) {
+	host, port := config.Host, config.Port
+
 	log.Info("Start HTTP Server.")
+
+	s, _ := srv.(*server)
+
+	var sessions sessionsAdmin
+	if s != nil {
+		sessions = s.sessionsMgr
+	}
+
+	server := &http.Server{Addr: host + ":" + port, Handler: newRouter(config, s, sessions)}
+
+	log.Info("Starting http server on port %v", port)
+
+	err := server.ListenAndServe()
+	if err != nil {
+		log.Fatal("ListenAndServe: ", err)
+	}
+	log.Info("Stop http server on port %v", port)
+}
+
+// newRouter routes of management API
+// sessions nil if MQTT server is not provided
+func newRouter(config HTTPConfig, s *server, sessions sessionsAdmin) *httprouter.Router {
 	router := httprouter.New()
 
 	// Set router options.
@@ -79,16 +138,53 @@ func StartHTTPServer(host, port string) {
 	// Route for http
 	router.GET("/v1/heart", Health)
 
-	router.POST("/v1/users", AddUser)
-	router.DELETE("/v1/users/:username", DelUser)
+	// users API changes credentials MQTT clients authenticate with, so callers must authenticate
+	if config.Auth != nil {
+		if config.Users != nil {
+			users := &usersAPI{users: config.Users, sessions: sessions}
 
-	server := &http.Server{Addr: host + ":" + port, Handler: router}
+			router.GET("/v1/users", withAuth(config.Auth, users.ListUsers))
+			router.POST("/v1/users", withAuth(config.Auth, users.AddUser))
+			router.POST("/v1/users/sync", withAuth(config.Auth, users.SyncUsers))
+			router.PUT("/v1/users/:username", withAuth(config.Auth, users.SetPassword))
+			router.DELETE("/v1/users/:username", withAuth(config.Auth, users.DelUser))
+		} else {
+			router.POST("/v1/users", withAuth(config.Auth, AddUser))
+			router.DELETE("/v1/users/:username", withAuth(config.Auth, DelUser))
+		}
+	}
 
-	log.Info("Starting http server on port %v", port)
+	// ban list might lock out every client, so callers must authenticate
+	if config.Bans != nil && config.Auth != nil {
+		bans := &bansAPI{bans: config.Bans, sessions: sessions}
 
-	err := server.ListenAndServe()
-	if err != nil {
-		log.Fatal("ListenAndServe: ", err)
+		router.GET("/v1/bans", withAuth(config.Auth, bans.ListBans))
+		router.POST("/v1/bans", withAuth(config.Auth, bans.AddBan))
+		router.DELETE("/v1/bans/:kind/*value", withAuth(config.Auth, bans.RemoveBan))
 	}
-	log.Info("Stop http server on port %v", port)
+
+	// clients and sessions API disclose addresses of clients and stop them, so callers must authenticate
+	if sessions != nil && config.Auth != nil {
+		admin := &adminAPI{sessions: sessions}
+
+		router.GET("/v1/clients", withAuth(config.Auth, admin.ListClients))
+		router.DELETE("/v1/clients/:id", withAuth(config.Auth, admin.DisconnectClient))
+		router.GET("/v1/sessions/:id", withAuth(config.Auth, admin.GetSession))
+		router.DELETE("/v1/sessions/:id", withAuth(config.Auth, admin.DeleteSession))
+	}
+
+	if s != nil {
+		metrics := &metricsAPI{srv: s}
+
+		router.GET("/metrics", metrics.Metrics)
+
+		if config.Auth != nil {
+			pub := &publishAPI{srv: s, auth: config.Auth}
+
+			router.POST("/v1/publish", pub.Publish)
+			router.POST("/v1/publish/batch", pub.PublishBatch)
+		}
+	}
+
+	return router
 }
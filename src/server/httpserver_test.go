@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	testAdmin    = "admin"
+	testPassword = "secret"
+)
+
+// adminAuth auth provider accepting single admin user
+type adminAuth struct{}
+
+func (adminAuth) Password(clientID, user, password string) error {
+	if user == testAdmin && password == testPassword {
+		return auth.StatusAllow
+	}
+
+	return auth.StatusDeny
+}
+
+func (adminAuth) ACL(clientID, user, topic string, access auth.AccessType) error {
+	return auth.StatusAllow
+}
+
+func (adminAuth) GetUser(user string) *auth.User { return nil }
+
+func (adminAuth) Shutdown() error { return nil }
+
+func init() {
+	auth.Register("test-admin", adminAuth{}) // nolint: errcheck
+}
+
+func newTestAuth(t *testing.T) *auth.Manager {
+	m, err := auth.NewManager([]string{"test-admin"}, false)
+	if err != nil {
+		t.Fatalf("auth manager: %v", err)
+	}
+
+	return m
+}
+
+// request serve request by router, credentials of admin are set if authorized
+func request(router *httprouter.Router, method, url, body string, authorized bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+	if authorized {
+		req.SetBasicAuth(testAdmin, testPassword)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestHeartNoAuth(t *testing.T) {
+	router := newRouter(HTTPConfig{}, nil, nil)
+
+	if w := request(router, http.MethodGet, "/v1/heart", "", false); w.Code != http.StatusOK {
+		t.Errorf("heart: got %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"systree"
+)
+
+// metricsAPI exports systree counters and server internals in prometheus text format
+type metricsAPI struct {
+	srv *server
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func gaugeFamily(name, help string, value int) systree.Family {
+	return systree.Family{
+		Name:    name,
+		Help:    help,
+		Type:    systree.FamilyGauge,
+		Samples: []systree.Sample{{Value: float64(value)}},
+	}
+}
+
+// families of the server which are not tracked by systree
+func (m *metricsAPI) families() []systree.Family {
+	var families []systree.Family
+
+	if ses, err := m.srv.Persistence.Sessions(); err == nil {
+		families = append(families, gaugeFamily("mqtt_sessions_persisted", "Sessions kept by persistence", int(ses.Count())))
+	}
+
+	pool := m.srv.acceptPool.Stats()
+
+	families = append(families,
+		gaugeFamily("mqtt_accept_pool_size", "Max workers of the accept pool", pool.Size),
+		gaugeFamily("mqtt_accept_pool_workers", "Spawned workers of the accept pool", pool.Workers),
+		gaugeFamily("mqtt_accept_pool_busy", "Accept pool workers running task", pool.Busy),
+		gaugeFamily("mqtt_accept_pool_queued", "Tasks waiting for free accept pool worker", pool.Queued))
+
+	depth := systree.Family{Name: "mqtt_topics_queue_length", Help: "Requests waiting for topics provider", Type: systree.FamilyGauge}
+	capacity := systree.Family{Name: "mqtt_topics_queue_capacity", Help: "Capacity of topics provider queue", Type: systree.FamilyGauge}
+
+	for _, q := range m.srv.topicsMgr.Queues() {
+		labels := []systree.Label{{Name: "queue", Value: q.Name}}
+		depth.Samples = append(depth.Samples, systree.Sample{Labels: labels, Value: float64(q.Len)})
+		capacity.Samples = append(capacity.Samples, systree.Sample{Labels: labels, Value: float64(q.Cap)})
+	}
+
+	return append(families, depth, capacity)
+}
+
+// Metrics GET /metrics
+func (m *metricsAPI) Metrics(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	families := append(m.srv.sysTree.Families(), m.families()...)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	wr := bufio.NewWriter(w)
+
+	for _, f := range families {
+		if len(f.Samples) == 0 {
+			continue
+		}
+
+		wr.WriteString("# HELP " + f.Name + " " + f.Help + "\n")
+		wr.WriteString("# TYPE " + f.Name + " " + string(f.Type) + "\n")
+
+		for _, s := range f.Samples {
+			wr.WriteString(f.Name)
+
+			if len(s.Labels) > 0 {
+				wr.WriteByte('{')
+				for i, l := range s.Labels {
+					if i > 0 {
+						wr.WriteByte(',')
+					}
+					wr.WriteString(l.Name + `="` + labelEscaper.Replace(l.Value) + `"`)
+				}
+				wr.WriteByte('}')
+			}
+
+			wr.WriteString(" " + strconv.FormatFloat(s.Value, 'g', -1, 64) + "\n")
+		}
+	}
+
+	if err := wr.Flush(); err != nil {
+		log.Error("write metrics err:%s", err.Error())
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/VolantMQ/vlapi/plugin/persistence"
+	persistenceMem "github.com/VolantMQ/vlapi/plugin/persistence/mem"
+	"systree"
+	topicsTypes "topics/types"
+	"types"
+)
+
+// tree fake systree exporting fixed families
+type tree struct {
+	systree.Provider
+	families []systree.Family
+}
+
+func (t *tree) Families() []systree.Family {
+	return t.families
+}
+
+// topicsProvider fake topics provider with fixed queues
+type topicsProvider struct {
+	topicsTypes.Provider
+	queues []topicsTypes.QueueStat
+}
+
+func (t *topicsProvider) Queues() []topicsTypes.QueueStat {
+	return t.queues
+}
+
+// pool fake accept pool with fixed stats
+type pool struct {
+	stats types.PoolStats
+}
+
+func (p *pool) Schedule(task func()) error                               { return nil }
+func (p *pool) ScheduleTimeout(timeout time.Duration, task func()) error { return nil }
+func (p *pool) Close() error                                             { return nil }
+func (p *pool) Stats() types.PoolStats                                   { return p.stats }
+
+func TestMetrics(t *testing.T) {
+	p, _ := persistenceMem.Load(nil, nil)
+	ses, _ := p.Sessions()
+	ses.Create([]byte("c1"), &persistence.SessionBase{Version: byte(mqttp.ProtocolV311)}) // nolint: errcheck
+
+	srv := &server{
+		Config: Config{Persistence: p},
+		sysTree: &tree{families: []systree.Family{
+			{Name: "mqtt_packets_received_total", Help: "Packets received", Type: systree.FamilyCounter, Samples: []systree.Sample{
+				{Labels: []systree.Label{{Name: "type", Value: "connect"}}, Value: 3},
+				{Labels: []systree.Label{{Name: "type", Value: "publish"}}, Value: 1.5e+07},
+			}},
+			{Name: "mqtt_listener_connections", Help: "Open connections of the listener", Type: systree.FamilyGauge, Samples: []systree.Sample{
+				{Labels: []systree.Label{{Name: "listener", Value: "tcp:1883"}}, Value: 2},
+				{Labels: []systree.Label{{Name: "listener", Value: `a\b"c` + "\nd"}, {Name: "scheme", Value: "ws"}}, Value: 1},
+			}},
+			{Name: "mqtt_empty", Help: "Family without samples", Type: systree.FamilyGauge},
+		}},
+		topicsMgr:  &topicsProvider{queues: []topicsTypes.QueueStat{{Name: "subscribe", Len: 4, Cap: 1024}}},
+		acceptPool: &pool{stats: types.PoolStats{Size: 8, Workers: 2, Busy: 1}},
+	}
+
+	rec := httptest.NewRecorder()
+	(&metricsAPI{srv: srv}).Metrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil), nil)
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type %q", ct)
+	}
+
+	want := []string{
+		"# HELP mqtt_packets_received_total Packets received",
+		"# TYPE mqtt_packets_received_total counter",
+		`mqtt_packets_received_total{type="connect"} 3`,
+		`mqtt_packets_received_total{type="publish"} 1.5e+07`,
+		"# HELP mqtt_listener_connections Open connections of the listener",
+		"# TYPE mqtt_listener_connections gauge",
+		`mqtt_listener_connections{listener="tcp:1883"} 2`,
+		`mqtt_listener_connections{listener="a\\b\"c\nd",scheme="ws"} 1`,
+		"# HELP mqtt_sessions_persisted Sessions kept by persistence",
+		"# TYPE mqtt_sessions_persisted gauge",
+		"mqtt_sessions_persisted 1",
+		"mqtt_accept_pool_size 8",
+		"mqtt_accept_pool_workers 2",
+		"mqtt_accept_pool_busy 1",
+		"mqtt_accept_pool_queued 0",
+		`mqtt_topics_queue_length{queue="subscribe"} 4`,
+		`mqtt_topics_queue_capacity{queue="subscribe"} 1024`,
+	}
+
+	lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+
+	// expected lines appear in given order
+	next := 0
+	for _, l := range lines {
+		if next < len(want) && l == want[next] {
+			next++
+		}
+	}
+
+	if next != len(want) {
+		t.Errorf("line %q not found in order, got:\n%s", want[next], rec.Body.String())
+	}
+
+	for _, l := range lines {
+		if strings.Contains(l, "mqtt_empty") {
+			t.Errorf("family without samples exported: %q", l)
+		}
+	}
+
+	// every family is described once and each sample belongs to described family
+	described := map[string]int{}
+	for _, l := range lines {
+		if strings.HasPrefix(l, "# TYPE ") {
+			described[strings.Fields(l)[2]]++
+			continue
+		}
+
+		if strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		name := strings.FieldsFunc(l, func(r rune) bool { return r == '{' || r == ' ' })[0]
+		if described[name] != 1 {
+			t.Errorf("sample %q of family described %d times", l, described[name])
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"auth"
+	"common"
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/julienschmidt/httprouter"
+	"types"
+)
+
+// maxPublishBody limit of the publish request body
+const maxPublishBody = 16 << 20
+
+var (
+	errPublishTopic    = errors.New("publish: invalid topic")
+	errPublishEncoding = errors.New("publish: unknown payload encoding")
+	errPublishQoS      = errors.New("publish: invalid qos")
+	errNotAuthorized   = errors.New("publish: not authorized")
+)
+
+type userProperty struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type publishProperties struct {
+	UserProperties  []userProperty `json:"user_properties,omitempty"`
+	MessageExpiry   *uint32        `json:"message_expiry,omitempty"`
+	ContentType     string         `json:"content_type,omitempty"`
+	ResponseTopic   string         `json:"response_topic,omitempty"`
+	CorrelationData string         `json:"correlation_data,omitempty"`
+	PayloadFormat   *byte          `json:"payload_format,omitempty"`
+}
+
+// publishRequest message to be published
+// payload is taken as is unless encoding is base64
+type publishRequest struct {
+	Topic      string             `json:"topic"`
+	Payload    string             `json:"payload"`
+	Encoding   string             `json:"encoding,omitempty"`
+	QoS        byte               `json:"qos"`
+	Retain     bool               `json:"retain"`
+	Properties *publishProperties `json:"properties,omitempty"`
+}
+
+type publishResult struct {
+	Topic string `json:"topic"`
+	Code  int    `json:"code"`
+	Error string `json:"error,omitempty"`
+}
+
+// publishAPI http handlers to publish messages as if they were sent by MQTT client
+type publishAPI struct {
+	srv  *server
+	auth *auth.Manager
+}
+
+// toPacket build PUBLISH packet from request
+// packet is always of v5.0 and downgraded for subscribers of older versions
+func (r *publishRequest) toPacket() (*mqttp.Publish, error) {
+	var payload []byte
+
+	switch r.Encoding {
+	case "", "plain":
+		payload = []byte(r.Payload)
+	case "base64":
+		var err error
+		if payload, err = base64.StdEncoding.DecodeString(r.Payload); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errPublishEncoding
+	}
+
+	qos := mqttp.QosType(r.QoS)
+	if !qos.IsValid() || qos > common.MaxQoS {
+		return nil, errPublishQoS
+	}
+
+	pkt := mqttp.NewPublish(mqttp.ProtocolV50)
+	if err := pkt.Set(r.Topic, payload, qos, r.Retain, false); err != nil || len(r.Topic) == 0 {
+		return nil, errPublishTopic
+	}
+
+	if pr := r.Properties; pr != nil {
+		if len(pr.UserProperties) > 0 {
+			pairs := make([]mqttp.StringPair, 0, len(pr.UserProperties))
+			for _, up := range pr.UserProperties {
+				pairs = append(pairs, mqttp.StringPair{K: up.Key, V: up.Value})
+			}
+
+			if err := pkt.PropertySet(mqttp.PropertyUserProperty, pairs); err != nil {
+				return nil, err
+			}
+		}
+
+		if pr.MessageExpiry != nil {
+			if err := pkt.PropertySet(mqttp.PropertyPublicationExpiry, *pr.MessageExpiry); err != nil {
+				return nil, err
+			}
+
+			// [MQTT-3.3.2.3.3]
+			pkt.SetExpireAt(time.Now().Add(time.Duration(*pr.MessageExpiry) * time.Second))
+		}
+
+		if len(pr.ContentType) > 0 {
+			if err := pkt.PropertySet(mqttp.PropertyContentType, pr.ContentType); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(pr.ResponseTopic) > 0 {
+			if err := pkt.PropertySet(mqttp.PropertyResponseTopic, pr.ResponseTopic); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(pr.CorrelationData) > 0 {
+			if err := pkt.PropertySet(mqttp.PropertyCorrelationData, []byte(pr.CorrelationData)); err != nil {
+				return nil, err
+			}
+		}
+
+		if pr.PayloadFormat != nil {
+			if err := pkt.PropertySet(mqttp.PropertyPayloadFormat, *pr.PayloadFormat); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return pkt, nil
+}
+
+// authenticate caller using basic auth credentials
+func (a *publishAPI) authenticate(req *http.Request) (string, bool) {
+	return basicAuth(a.auth, req)
+}
+
+// publish single request on behalf of the user
+// goes same way as PUBLISH of the MQTT client: ACL check, project namespace, retain and topics provider
+func (a *publishAPI) publish(username string, r *publishRequest) (int, error) {
+	pkt, err := r.toPacket()
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if a.auth.ACL("", username, pkt.Topic(), auth.AccessWrite) != auth.StatusAllow {
+		return http.StatusForbidden, errNotAuthorized
+	}
+
+	if common.ProjectIsolation {
+		var ns string
+		if user := a.auth.FetchUser(username); user != nil {
+			ns = user.ProjectId
+		}
+
+		// users out of any project must not publish into project namespaces
+		if types.EscapesNamespace(ns, pkt.Topic()) {
+			return http.StatusForbidden, errNotAuthorized
+		}
+
+		if err = pkt.SetTopic(types.NamespaceTopic(ns, pkt.Topic())); err != nil {
+			return http.StatusBadRequest, errPublishTopic
+		}
+	}
+
+	// [MQTT-3.3.1.3]
+	if pkt.Retain() {
+		if !common.RetainAvailable {
+			return http.StatusBadRequest, mqttp.CodeRetainNotSupported
+		}
+
+		if err = a.srv.topicsMgr.Retain(pkt); err != nil {
+			log.Error("http publish retain, topic:%s, err:%s", pkt.Topic(), err.Error())
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	if err = a.srv.topicsMgr.Publish(pkt); err != nil {
+		log.Error("http publish, topic:%s, err:%s", pkt.Topic(), err.Error())
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+func readBody(w http.ResponseWriter, req *http.Request, v interface{}) error {
+	defer req.Body.Close() // nolint: errcheck
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxPublishBody))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// Publish POST /v1/publish
+func (a *publishAPI) Publish(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	username, ok := a.authenticate(req)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="mqtt"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	r := &publishRequest{}
+	if err := readBody(w, req, r); err != nil {
+		log.Error("Invalid body. err:%s", err.Error())
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if code, err := a.publish(username, r); err != nil {
+		writeError(w, code, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// PublishBatch POST /v1/publish/batch
+// each message is published independently and result reported per message in request order
+func (a *publishAPI) PublishBatch(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	username, ok := a.authenticate(req)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="mqtt"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var list []publishRequest
+	if err := readBody(w, req, &list); err != nil {
+		log.Error("Invalid body. err:%s", err.Error())
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	results := make([]publishResult, 0, len(list))
+
+	for i := range list {
+		res := publishResult{
+			Topic: list[i].Topic,
+		}
+
+		code, err := a.publish(username, &list[i])
+		res.Code = code
+		if err != nil {
+			res.Error = err.Error()
+		}
+
+		results = append(results, res)
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
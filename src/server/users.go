@@ -0,0 +1,180 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+var (
+	// ErrUserNotFound user with given name does not exist
+	ErrUserNotFound = errors.New("users: user not found")
+	// ErrUserExists user with given name already exists
+	ErrUserExists = errors.New("users: user already exists")
+	// ErrProjectTaken user store keeps single user per project and project has one already
+	ErrProjectTaken = errors.New("users: project already has a user")
+	// ErrUserInvalid name, password or project id is not set
+	ErrUserInvalid = errors.New("users: name, password and project_id are required")
+)
+
+// UserStore persistent storage of users managed over http API
+type UserStore interface {
+	// ListUsers users without passwords
+	ListUsers() ([]User, error)
+	AddUser(u *User) error
+	SetPassword(name, password string) error
+	DelUser(name string) error
+	// Sync load users of auth providers from storage
+	Sync() error
+}
+
+// usersAPI http handlers of users kept in UserStore
+type usersAPI struct {
+	users UserStore
+	// sessions nil if MQTT server is not provided, sessions of deleted users are not stopped then
+	sessions sessionsAdmin
+}
+
+type passwordRequest struct {
+	Password string `json:"password"`
+}
+
+// userError map error of the user store to http status
+func userError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrUserNotFound:
+		writeError(w, http.StatusNotFound, err)
+	case ErrUserExists, ErrProjectTaken:
+		writeError(w, http.StatusConflict, err)
+	case ErrUserInvalid:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		log.Error("users store err:%s", err.Error())
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// sync refresh auth providers after store has been changed
+func (a *usersAPI) sync() {
+	if err := a.users.Sync(); err != nil {
+		log.Error("users sync err:%s", err.Error())
+	}
+}
+
+// ListUsers GET /v1/users
+func (a *usersAPI) ListUsers(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	users, err := a.users.ListUsers()
+	if err != nil {
+		userError(w, err)
+		return
+	}
+
+	if users == nil {
+		users = []User{}
+	}
+
+	writeJSON(w, http.StatusOK, users)
+}
+
+// AddUser POST /v1/users
+func (a *usersAPI) AddUser(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	log.Info("User add start.")
+
+	user := &User{}
+	if err := readJSON(req, user); err != nil {
+		log.Error("Invalid body. err:%s", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if len(user.Name) == 0 || len(user.Password) == 0 || len(user.ProjectId) == 0 {
+		userError(w, ErrUserInvalid)
+		return
+	}
+
+	if err := a.users.AddUser(user); err != nil {
+		userError(w, err)
+		return
+	}
+
+	a.sync()
+
+	w.WriteHeader(http.StatusOK)
+	log.Info("User add success, name:%s.", user.Name)
+}
+
+// SetPassword PUT /v1/users/:username
+func (a *usersAPI) SetPassword(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	name := ps.ByName("username")
+	log.Info("User password change start, name:%s.", name)
+
+	r := &passwordRequest{}
+	if err := readJSON(req, r); err != nil {
+		log.Error("Invalid body. err:%s", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if len(r.Password) == 0 {
+		userError(w, ErrUserInvalid)
+		return
+	}
+
+	if err := a.users.SetPassword(name, r.Password); err != nil {
+		userError(w, err)
+		return
+	}
+
+	a.sync()
+
+	w.WriteHeader(http.StatusOK)
+	log.Info("User password change success, name:%s.", name)
+}
+
+// DelUser DELETE /v1/users/:username
+// live sessions of the user are disconnected
+func (a *usersAPI) DelUser(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	name := ps.ByName("username")
+	log.Info("User del start, name:%s.", name)
+
+	if err := a.users.DelUser(name); err != nil {
+		userError(w, err)
+		return
+	}
+
+	a.sync()
+
+	if a.sessions != nil {
+		if n := a.sessions.DisconnectUser(name); n > 0 {
+			log.Info("User del, name:%s, disconnected sessions:%d.", name, n)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	log.Info("User del success.")
+}
+
+// SyncUsers POST /v1/users/sync
+// notification users have been changed in storage directly
+func (a *usersAPI) SyncUsers(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	if err := a.users.Sync(); err != nil {
+		userError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func readJSON(req *http.Request, v interface{}) error {
+	defer req.Body.Close() // nolint: errcheck
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
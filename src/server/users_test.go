@@ -0,0 +1,200 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"testing"
+)
+
+// users fake user store keeping single user per project
+type users struct {
+	users map[string]User
+	syncs int
+}
+
+func newTestUsers() *users {
+	return &users{
+		users: map[string]User{
+			"u1": {Name: "u1", Password: "p", ProjectId: "p1"},
+			"u2": {Name: "u2", Password: "p", ProjectId: "p2"},
+		},
+	}
+}
+
+func (s *users) ListUsers() ([]User, error) {
+	var list []User
+	for _, u := range s.users {
+		list = append(list, User{Name: u.Name, ProjectId: u.ProjectId})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list, nil
+}
+
+func (s *users) AddUser(u *User) error {
+	if _, ok := s.users[u.Name]; ok {
+		return ErrUserExists
+	}
+
+	for _, v := range s.users {
+		if v.ProjectId == u.ProjectId {
+			return ErrProjectTaken
+		}
+	}
+
+	s.users[u.Name] = *u
+	return nil
+}
+
+func (s *users) SetPassword(name, password string) error {
+	u, ok := s.users[name]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	u.Password = password
+	s.users[name] = u
+	return nil
+}
+
+func (s *users) DelUser(name string) error {
+	if _, ok := s.users[name]; !ok {
+		return ErrUserNotFound
+	}
+
+	delete(s.users, name)
+	return nil
+}
+
+func (s *users) Sync() error {
+	s.syncs++
+	return nil
+}
+
+func TestUsersAuth(t *testing.T) {
+	store := newTestUsers()
+	s := newTestSessions()
+	router := newRouter(HTTPConfig{Auth: newTestAuth(t), Users: store}, nil, s)
+
+	routes := []struct {
+		method string
+		url    string
+		body   string
+	}{
+		{http.MethodGet, "/v1/users", ""},
+		{http.MethodPost, "/v1/users", `{"name":"u3","password":"p","project_id":"p3"}`},
+		{http.MethodPost, "/v1/users/sync", ""},
+		{http.MethodPut, "/v1/users/u1", `{"password":"x"}`},
+		{http.MethodDelete, "/v1/users/u1", ""},
+	}
+
+	for _, r := range routes {
+		if w := request(router, r.method, r.url, r.body, false); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without credentials: got %d, want %d", r.method, r.url, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	if len(store.users) != 2 || store.users["u1"].Password != "p" || store.syncs != 0 || len(s.stopped) != 0 {
+		t.Errorf("unauthorized request changed state, users:%v, syncs:%d, stopped:%v", store.users, store.syncs, s.stopped)
+	}
+
+	// without Auth neither store backed nor legacy routes are served
+	for _, config := range []HTTPConfig{{Users: store}, {}} {
+		router = newRouter(config, nil, s)
+
+		for _, r := range routes {
+			if w := request(router, r.method, r.url, r.body, true); w.Code != http.StatusNotFound && w.Code != http.StatusMethodNotAllowed {
+				t.Errorf("%s %s without auth configured: got %d, want not found", r.method, r.url, w.Code)
+			}
+		}
+	}
+}
+
+func TestUsers(t *testing.T) {
+	store := newTestUsers()
+	router := newRouter(HTTPConfig{Auth: newTestAuth(t), Users: store}, nil, newTestSessions())
+
+	tests := []struct {
+		method string
+		url    string
+		body   string
+		code   int
+	}{
+		{http.MethodPost, "/v1/users", `{"name":"u3","password":"p3","project_id":"p3"}`, http.StatusOK},
+		{http.MethodPost, "/v1/users", `{"name":"u3","password":"p","project_id":"p4"}`, http.StatusConflict},
+		{http.MethodPost, "/v1/users", `{"name":"u4","password":"p","project_id":"p1"}`, http.StatusConflict},
+		{http.MethodPost, "/v1/users", `{"name":"u4","project_id":"p4"}`, http.StatusBadRequest},
+		{http.MethodPost, "/v1/users", `{`, http.StatusBadRequest},
+		{http.MethodPut, "/v1/users/u1", `{"password":"x"}`, http.StatusOK},
+		{http.MethodPut, "/v1/users/u1", `{"password":""}`, http.StatusBadRequest},
+		{http.MethodPut, "/v1/users/u9", `{"password":"x"}`, http.StatusNotFound},
+		{http.MethodPost, "/v1/users/sync", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		if w := request(router, tt.method, tt.url, tt.body, true); w.Code != tt.code {
+			t.Errorf("%s %s %s: got %d, want %d", tt.method, tt.url, tt.body, w.Code, tt.code)
+		}
+	}
+
+	if u, ok := store.users["u3"]; !ok || u.Password != "p3" || u.ProjectId != "p3" {
+		t.Errorf("user not written to store, got %+v", u)
+	}
+
+	if store.users["u1"].Password != "x" {
+		t.Errorf("password not changed in store")
+	}
+
+	// auth providers are refreshed after every change and on request
+	if store.syncs != 3 {
+		t.Errorf("syncs %d, want 3", store.syncs)
+	}
+
+	w := request(router, http.MethodGet, "/v1/users", "", true)
+
+	var list []User
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if len(list) != 3 || list[0].Name != "u1" || list[0].ProjectId != "p1" || list[0].Password != "" {
+		t.Errorf("unexpected users %+v", list)
+	}
+}
+
+func TestUsersDelete(t *testing.T) {
+	store := newTestUsers()
+	s := newTestSessions()
+	router := newRouter(HTTPConfig{Auth: newTestAuth(t), Users: store}, nil, s)
+
+	if w := request(router, http.MethodDelete, "/v1/users/u2", "", true); w.Code != http.StatusOK {
+		t.Fatalf("delete: got %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if _, ok := store.users["u2"]; ok {
+		t.Errorf("user not deleted from store")
+	}
+
+	// sessions of deleted user are stopped, others are kept
+	if len(s.stopped) != 1 || s.stopped[0] != "c2" {
+		t.Errorf("stopped %v, want [c2]", s.stopped)
+	}
+
+	if w := request(router, http.MethodDelete, "/v1/users/u2", "", true); w.Code != http.StatusNotFound {
+		t.Errorf("delete unknown: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	if len(s.stopped) != 1 {
+		t.Errorf("failed delete stopped sessions %v", s.stopped)
+	}
+
+	// without MQTT server user is deleted only
+	router = newRouter(HTTPConfig{Auth: newTestAuth(t), Users: store}, nil, nil)
+	if w := request(router, http.MethodDelete, "/v1/users/u1", "", true); w.Code != http.StatusOK {
+		t.Errorf("delete without sessions: got %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -1,9 +1,11 @@
 package server
 
 import (
+	"bridge"
 	"common"
 	"errors"
 	"logs"
+	"reflect"
 	"regexp"
 	"sync"
 	"time"
@@ -14,6 +16,7 @@ import (
 	"github.com/VolantMQ/vlapi/plugin/persistence"
 	"github.com/VolantMQ/vlapi/subscriber"
 	"github.com/troian/easygo/netpoll"
+	"hooks"
 	"systree"
 	"topics"
 	"topics/types"
@@ -53,6 +56,12 @@ type Config struct {
 
 	// NodeName
 	NodeName string
+
+	// Bridges connections to remote brokers started along with server
+	Bridges []bridge.Config
+
+	// Hooks http endpoints client and message events are posted to
+	Hooks []hooks.Config
 }
 
 // Server server API
@@ -63,6 +72,11 @@ type Server interface {
 	// Transport status reported over TransportStatus callback in server configuration
 	ListenAndServe(interface{}) error
 
+	// ReloadBridges restart bridges which configuration has changed, start new and stop removed ones
+	// bridges are matched by name, unchanged bridges keep their connections,
+	// bridges connecting over tls are always restarted to pick up rotated certificates
+	ReloadBridges([]bridge.Config) error
+
 	// Shutdown terminates the server by shutting down all the client connections and closing
 	// configured listeners. It does full clean up of the resources and
 	Shutdown() error
@@ -80,7 +94,11 @@ type server struct {
 	onClose     sync.Once
 	ePoll       netpoll.EventPoll
 	acceptPool  types.Pool
-	transports  struct {
+	bridges     []bridge.Bridge
+	// bridgeConfigs configuration of running bridges, same order as bridges
+	bridgeConfigs []bridge.Config
+	hooks         hooks.Sink
+	transports    struct {
 		list map[string]transport.Provider
 		wg   sync.WaitGroup
 	}
@@ -126,8 +144,10 @@ func NewServer(config Config) (Server, error) {
 	topicsConfig := topicsTypes.NewMemConfig()
 
 	topicsConfig.Stat = s.sysTree.Topics()
+	topicsConfig.Retained = s.sysTree.Retained()
 	topicsConfig.Persist = persisRetained
 	topicsConfig.OverlappingSubscriptions = common.SubsOverlap
+	topicsConfig.SharedStrategy = common.SharedStrategy
 
 	if s.topicsMgr, err = topics.New(topicsConfig); err != nil {
 		return nil, err
@@ -163,10 +183,45 @@ func NewServer(config Config) (Server, error) {
 		NodeName:         s.NodeName,
 	}
 
+	if len(config.Hooks) > 0 {
+		if s.hooks, err = hooks.New(config.Hooks); err != nil {
+			return nil, err
+		}
+
+		mConfig.Hooks = s.hooks
+	}
+
 	if s.sessionsMgr, err = clients.NewManager(mConfig); err != nil {
 		return nil, err
 	}
 
+	if len(config.Bridges) > 0 {
+		var persistSessions persistence.Sessions
+		if persistSessions, err = s.Persistence.Sessions(); err != nil {
+			return nil, err
+		}
+
+		for _, c := range config.Bridges {
+			var b bridge.Bridge
+			if b, err = bridge.New(c, s.topicsMgr, persistSessions); err != nil {
+				log.Error("bridge %s, err:%s", c.Name, err.Error())
+
+				for _, started := range s.bridges {
+					started.Shutdown() // nolint: errcheck
+				}
+
+				if s.hooks != nil {
+					s.hooks.Shutdown() // nolint: errcheck
+				}
+
+				return nil, err
+			}
+
+			s.bridges = append(s.bridges, b)
+			s.bridgeConfigs = append(s.bridgeConfigs, c)
+		}
+	}
+
 	return s, nil
 }
 
@@ -191,9 +246,8 @@ func (s *server) ListenAndServe(config interface{}) error {
 	switch c := config.(type) {
 	case *transport.ConfigTCP:
 		l, err = transport.NewTCP(c, &internalConfig)
-	// todo (troian) proper websocket implementation
-	// case *transport.ConfigWS:
-	// 	l, err = transport.NewWS(c, &internalConfig)
+	case *transport.ConfigWS:
+		l, err = transport.NewWS(c, &internalConfig)
 	default:
 		return errors.New("invalid listener type")
 	}
@@ -245,6 +299,77 @@ func (s *server) ListenAndServe(config interface{}) error {
 	return nil
 }
 
+// ReloadBridges implements Server interface
+func (s *server) ReloadBridges(configs []bridge.Config) error {
+	defer s.lock.Unlock()
+	s.lock.Lock()
+
+	select {
+	case <-s.quit:
+		return errors.New("server is shutting down")
+	default:
+	}
+
+	running := make(map[string]int)
+	for i, c := range s.bridgeConfigs {
+		running[c.Name] = i
+	}
+
+	var bridges []bridge.Bridge
+	var started []bridge.Config
+	var persistSessions persistence.Sessions
+	var err error
+
+	for _, c := range configs {
+		if i, ok := running[c.Name]; ok {
+			delete(running, c.Name)
+
+			if c.TLS == nil && reflect.DeepEqual(c, s.bridgeConfigs[i]) {
+				bridges = append(bridges, s.bridges[i])
+				started = append(started, c)
+				continue
+			}
+
+			log.Info("bridge %s: configuration changed, restarting", c.Name)
+			s.bridges[i].Shutdown() // nolint: errcheck
+		}
+
+		if persistSessions == nil {
+			if persistSessions, err = s.Persistence.Sessions(); err != nil {
+				break
+			}
+		}
+
+		var b bridge.Bridge
+		if b, err = bridge.New(c, s.topicsMgr, persistSessions); err != nil {
+			log.Error("bridge %s, err:%s", c.Name, err.Error())
+			break
+		}
+
+		bridges = append(bridges, b)
+		started = append(started, c)
+	}
+
+	// on error bridges failed to start are kept stopped, ones not reached yet keep running
+	if err != nil {
+		for name, i := range running {
+			log.Debug("bridge %s: kept running", name)
+			bridges = append(bridges, s.bridges[i])
+			started = append(started, s.bridgeConfigs[i])
+		}
+	} else {
+		for name, i := range running {
+			log.Info("bridge %s: removed", name)
+			s.bridges[i].Shutdown() // nolint: errcheck
+		}
+	}
+
+	s.bridges = bridges
+	s.bridgeConfigs = started
+
+	return err
+}
+
 // Shutdown server
 func (s *server) Shutdown() error {
 	// By closing the quit channel, we are telling the server to stop accepting new
@@ -270,6 +395,10 @@ func (s *server) Shutdown() error {
 			delete(s.transports.list, port)
 		}
 
+		for _, b := range s.bridges {
+			b.Shutdown() // nolint: errcheck
+		}
+
 		s.sessionsMgr.Stop() // nolint: errcheck, gas
 
 		// shutdown systree updater
@@ -282,6 +411,10 @@ func (s *server) Shutdown() error {
 			log.Error("stop session manager, err:%s", err.Error())
 		}
 
+		if s.hooks != nil {
+			s.hooks.Shutdown() // nolint: errcheck
+		}
+
 		if err := s.topicsMgr.Shutdown(); err != nil {
 			log.Error("stop topics manager manager, err:%s", err.Error())
 		}
@@ -297,18 +430,22 @@ func (s *server) systreeUpdater() {
 		s.systree.wg.Done()
 	}()
 
-	select {
-	case <-s.systree.timer.C:
-		for _, val := range s.systree.publishes {
-			p := val.Publish()
-			pkt := mqttp.NewPublish(mqttp.ProtocolV311)
-
-			pkt.SetPayload(p.Payload())
-			pkt.SetTopic(p.Topic())  // nolint: errcheck
-			pkt.SetQoS(p.QoS())      // nolint: errcheck
-			s.topicsMgr.Publish(pkt) // nolint: errcheck
+	for {
+		select {
+		case <-s.systree.timer.C:
+			s.sysTree.Update()
+
+			for _, val := range s.systree.publishes {
+				p := val.Publish()
+				pkt := mqttp.NewPublish(mqttp.ProtocolV311)
+
+				pkt.SetPayload(p.Payload())
+				pkt.SetTopic(p.Topic())  // nolint: errcheck
+				pkt.SetQoS(p.QoS())      // nolint: errcheck
+				s.topicsMgr.Publish(pkt) // nolint: errcheck
+			}
+		case <-s.quit:
+			return
 		}
-	case <-s.quit:
-		return
 	}
 }
@@ -4,9 +4,11 @@ import (
 	"sync"
 	"unsafe"
 
+	"auth"
 	"github.com/VolantMQ/vlapi/mqttp"
 	"github.com/VolantMQ/vlapi/subscriber"
 	"topics/types"
+	"types"
 )
 
 // Config subscriber config options
@@ -15,6 +17,14 @@ type Config struct {
 	OfflinePublish vlsubscriber.Publisher
 	Topics         topicsTypes.SubscriberInterface
 	Version        mqttp.ProtocolVersion
+	// Permissions if set messages subscriber does not have read access to are dropped
+	Permissions auth.Permissions
+	Username    string
+	// Namespace topic namespace of the client project
+	// subscriber expects filters already placed into namespace and strips it from delivered messages
+	Namespace string
+	// MaxQoS maximum QoS subscriptions are granted with
+	MaxQoS mqttp.QosType
 }
 
 // Type subscriber object
@@ -25,6 +35,7 @@ type Type struct {
 	access        sync.WaitGroup
 	subSignal     chan topicsTypes.SubscribeResp
 	unSubSignal   chan topicsTypes.UnSubscribeResp
+	online        bool
 	Config
 }
 
@@ -80,8 +91,26 @@ func (s *Type) Subscriptions() vlsubscriber.Subscriptions {
 	return s.subscriptions
 }
 
+// SubscriptionsCopy snapshot of active subscriptions safe to be used concurrently with subscribe
+func (s *Type) SubscriptionsCopy() vlsubscriber.Subscriptions {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	subs := make(vlsubscriber.Subscriptions, len(s.subscriptions))
+	for topic, params := range s.subscriptions {
+		p := *params
+		subs[topic] = &p
+	}
+
+	return subs
+}
+
 // Subscribe to given topic
 func (s *Type) Subscribe(topic string, params *vlsubscriber.SubscriptionParams) ([]*mqttp.Publish, error) {
+	// [MQTT-3.2.2.3.3] subscription is granted with maximum QoS server supports
+	if params.Ops.QoS() > s.MaxQoS {
+		params.Ops = mqttp.SubscriptionOptions(params.Ops.Raw()&^byte(mqttp.QoS1|mqttp.QoS2) | byte(s.MaxQoS))
+	}
 
 	s.Topics.Subscribe(topicsTypes.SubscribeReq{
 		Filter: topic,
@@ -98,7 +127,9 @@ func (s *Type) Subscribe(topic string, params *vlsubscriber.SubscriptionParams)
 
 	params.Granted = resp.Granted
 
+	s.lock.Lock()
 	s.subscriptions[topic] = params
+	s.lock.Unlock()
 
 	return resp.Retained, nil
 }
@@ -113,20 +144,68 @@ func (s *Type) UnSubscribe(topic string) error {
 
 	resp := <-s.unSubSignal
 
+	s.lock.Lock()
 	delete(s.subscriptions, topic)
+	s.lock.Unlock()
 
 	return resp.Err
 }
 
+// SetPermissions replace permissions used to check read access
+// invoked when persisted subscriber is picked up by new connection
+func (s *Type) SetPermissions(p auth.Permissions, username string) {
+	s.lock.Lock()
+	s.Permissions = p
+	s.Username = username
+	s.lock.Unlock()
+}
+
+// SetNamespace replace topic namespace stripped from delivered messages
+func (s *Type) SetNamespace(ns string) {
+	s.lock.Lock()
+	s.Namespace = ns
+	s.lock.Unlock()
+}
+
+// clientTopic topic as seen by client, false if topic out of subscriber namespace
+func (s *Type) clientTopic(topic string) (string, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return types.StripNamespace(s.Namespace, topic)
+}
+
+func (s *Type) readAllowed(topic string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.Permissions == nil {
+		return true
+	}
+
+	return s.Permissions.ACL(s.ID, s.Username, topic, auth.AccessRead) == auth.StatusAllow
+}
+
 // Publish message accordingly to subscriber state
 // online: forward message to session
 // offline: persist message
 func (s *Type) Publish(p *mqttp.Publish, grantedQoS mqttp.QosType, ops mqttp.SubscriptionOptions, ids []uint32) error {
+	topic, ok := s.clientTopic(p.Topic())
+	if !ok || !s.readAllowed(topic) {
+		return nil
+	}
+
 	pkt, err := p.Clone(s.Version)
 	if err != nil {
 		return err
 	}
 
+	if topic != pkt.Topic() {
+		if err = pkt.SetTopic(topic); err != nil {
+			return err
+		}
+	}
+
 	if len(ids) > 0 {
 		if err = pkt.PropertySet(mqttp.PropertySubscriptionIdentifier, ids); err != nil {
 			return err
@@ -171,13 +250,26 @@ func (s *Type) Publish(p *mqttp.Publish, grantedQoS mqttp.QosType, ops mqttp.Sub
 func (s *Type) Online(c vlsubscriber.Publisher) {
 	s.lock.Lock()
 	s.publisher = c
+	s.online = true
 	s.lock.Unlock()
 }
 
+// IsOnline subscriber has active connection
+func (s *Type) IsOnline() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.online
+}
+
 // Offline put session offline
 // if shutdown is true it does unsubscribe from all active subscriptions
 func (s *Type) Offline(shutdown bool) {
 	// if session is clean then remove all remaining subscriptions
+	s.lock.Lock()
+	s.online = false
+	s.lock.Unlock()
+
 	if shutdown {
 		for topic := range s.subscriptions {
 			s.UnSubscribe(topic)
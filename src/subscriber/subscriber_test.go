@@ -0,0 +1,59 @@
+package subscriber
+
+import (
+	"testing"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/VolantMQ/vlapi/subscriber"
+	"topics/memLockFree"
+	"topics/types"
+)
+
+// newTopics in-memory topics provider, stopped once test finishes
+func newTopics(t *testing.T) topicsTypes.Provider {
+	p, err := memLockFree.NewMemProvider(topicsTypes.NewMemConfig())
+	if err != nil {
+		t.Fatalf("topics provider: %v", err)
+	}
+
+	t.Cleanup(func() {
+		p.Shutdown() // nolint: errcheck
+	})
+
+	return p
+}
+
+func TestSubscribeMaxQoS(t *testing.T) {
+	for _, v := range []mqttp.ProtocolVersion{mqttp.ProtocolV311, mqttp.ProtocolV50} {
+		for max := mqttp.QoS0; max <= mqttp.QoS2; max++ {
+			s := New(Config{ID: "c", Topics: newTopics(t), Version: v, MaxQoS: max})
+
+			for qos := mqttp.QoS0; qos <= mqttp.QoS2; qos++ {
+				// retain handling and no local bits must survive downgrade
+				ops := mqttp.SubscriptionOptions(byte(qos) | 0x04 | 0x10)
+				params := &vlsubscriber.SubscriptionParams{Ops: ops}
+
+				if _, err := s.Subscribe("a/b", params); err != nil {
+					t.Fatalf("v%d: subscribe: %v", v, err)
+				}
+
+				expected := qos
+				if expected > max {
+					expected = max
+				}
+
+				if params.Granted != expected {
+					t.Errorf("v%d: max QoS%d, requested QoS%d: expected granted QoS%d, got QoS%d", v, max, qos, expected, params.Granted)
+				}
+
+				if params.Ops.QoS() != expected || params.Ops.Raw()&^byte(mqttp.QoS1|mqttp.QoS2) != ops.Raw()&^byte(mqttp.QoS1|mqttp.QoS2) {
+					t.Errorf("v%d: max QoS%d, requested QoS%d: unexpected options %#x", v, max, qos, params.Ops.Raw())
+				}
+
+				if sub := s.Subscriptions()["a/b"]; sub == nil || sub.Granted != expected {
+					t.Errorf("v%d: max QoS%d, requested QoS%d: subscription not stored with granted QoS", v, max, qos)
+				}
+			}
+		}
+	}
+}
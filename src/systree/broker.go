@@ -0,0 +1,208 @@
+package systree
+
+import (
+	"math"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+	"types"
+)
+
+// brokerTopic root of the mosquitto compatible topics
+const brokerTopic = "$SYS/broker"
+
+// periods of load averages in seconds
+var loadPeriods = []struct {
+	name    string
+	seconds float64
+}{
+	{"1min", 60},
+	{"5min", 300},
+	{"15min", 900},
+}
+
+// storeStat messages held by the broker
+type storeStat struct {
+	count *dynamicValueInteger
+	bytes *dynamicValueInteger
+}
+
+// loadAverage exponentially weighted rate per minute of the counter
+type loadAverage struct {
+	counter *dynamicValueInteger
+	last    uint64
+	values  []*dynamicValueFloat
+}
+
+// broker mosquitto compatible $SYS/broker topics
+type broker struct {
+	lock       sync.Mutex
+	lastUpdate time.Time
+	loads      []*loadAverage
+	retained   storeStat
+	queued     storeStat
+	expired    *dynamicValueInteger
+	dropped    *dynamicValueInteger
+	heap       *dynamicValueInteger
+	heapMax    *dynamicValueInteger
+}
+
+func newStoreStat(topicPrefix string) storeStat {
+	return storeStat{
+		count: newDynamicValueInteger(topicPrefix + "/count"),
+		bytes: newDynamicValueInteger(topicPrefix + "/bytes"),
+	}
+}
+
+func newLoadAverage(topicPrefix string, counter *dynamicValueInteger, retained *[]types.RetainObject) *loadAverage {
+	l := &loadAverage{
+		counter: counter,
+	}
+
+	for _, p := range loadPeriods {
+		v := newDynamicValueFloat(topicPrefix + "/" + p.name)
+		l.values = append(l.values, v)
+		*retained = append(*retained, v)
+	}
+
+	return l
+}
+
+func newBroker(t *impl, retained, staticRetains *[]types.RetainObject) *broker {
+	b := &broker{
+		lastUpdate: time.Now(),
+		retained:   newStoreStat(brokerTopic + "/retained messages"),
+		queued:     newStoreStat(brokerTopic + "/queued messages"),
+		expired:    newDynamicValueInteger(brokerTopic + "/clients/expired"),
+		dropped:    newDynamicValueInteger(brokerTopic + "/messages/dropped"),
+		heap:       newDynamicValueInteger(brokerTopic + "/heap/current"),
+		heapMax:    newDynamicValueInteger(brokerTopic + "/heap/maximum"),
+	}
+
+	pm := t.metrics.packets
+	bm := t.metrics.bytes
+
+	b.loads = []*loadAverage{
+		newLoadAverage(brokerTopic+"/load/messages/received", pm.total.recv, retained),
+		newLoadAverage(brokerTopic+"/load/messages/sent", pm.total.sent, retained),
+		newLoadAverage(brokerTopic+"/load/bytes/received", bm.recv, retained),
+		newLoadAverage(brokerTopic+"/load/bytes/sent", bm.sent, retained),
+		newLoadAverage(brokerTopic+"/load/publish/received", pm.publish.recv, retained),
+		newLoadAverage(brokerTopic+"/load/publish/sent", pm.publish.sent, retained),
+	}
+
+	counterValue := func(v *dynamicValueInteger) func() []byte {
+		return v.get
+	}
+
+	storeCount := func() []byte {
+		return []byte(strconv.FormatUint(atomic.LoadUint64(&b.retained.count.val)+atomic.LoadUint64(&b.queued.count.val), 10))
+	}
+
+	storeBytes := func() []byte {
+		return []byte(strconv.FormatUint(atomic.LoadUint64(&b.retained.bytes.val)+atomic.LoadUint64(&b.queued.bytes.val), 10))
+	}
+
+	// durable sessions without connection
+	disconnected := func() []byte {
+		total := atomic.LoadUint64(&t.sessions.curr.val)
+		connected := atomic.LoadUint64(&t.clients.curr.val)
+		if connected > total {
+			connected = total
+		}
+		return []byte(strconv.FormatUint(total-connected, 10))
+	}
+
+	startTime := time.Now()
+
+	*retained = append(*retained,
+		newDynamicValueFunc(brokerTopic+"/uptime", func() []byte {
+			return []byte(strconv.FormatInt(int64(time.Since(startTime).Seconds()), 10) + " seconds")
+		}),
+		newDynamicValueFunc(brokerTopic+"/messages/received", counterValue(pm.total.recv)),
+		newDynamicValueFunc(brokerTopic+"/messages/sent", counterValue(pm.total.sent)),
+		newDynamicValueFunc(brokerTopic+"/bytes/received", counterValue(bm.recv)),
+		newDynamicValueFunc(brokerTopic+"/bytes/sent", counterValue(bm.sent)),
+		newDynamicValueFunc(brokerTopic+"/publish/messages/received", counterValue(pm.publish.recv)),
+		newDynamicValueFunc(brokerTopic+"/publish/messages/sent", counterValue(pm.publish.sent)),
+		newDynamicValueFunc(brokerTopic+"/clients/connected", counterValue(t.clients.curr)),
+		newDynamicValueFunc(brokerTopic+"/clients/active", counterValue(t.clients.curr)),
+		newDynamicValueFunc(brokerTopic+"/clients/maximum", counterValue(t.clients.max)),
+		newDynamicValueFunc(brokerTopic+"/clients/total", counterValue(t.sessions.curr)),
+		newDynamicValueFunc(brokerTopic+"/clients/disconnected", disconnected),
+		newDynamicValueFunc(brokerTopic+"/clients/inactive", disconnected),
+		b.expired,
+		b.dropped,
+		b.retained.count,
+		newDynamicValueFunc(brokerTopic+"/messages/stored", storeCount),
+		newDynamicValueFunc(brokerTopic+"/store/messages/count", storeCount),
+		newDynamicValueFunc(brokerTopic+"/store/messages/bytes", storeBytes),
+		newDynamicValueFunc(brokerTopic+"/subscriptions/count", counterValue(t.subscriptions.curr)),
+		b.heap,
+		b.heapMax,
+	)
+
+	m, _ := mqttp.New(mqttp.ProtocolV311, mqttp.PUBLISH)
+	msg, _ := m.(*mqttp.Publish)
+	msg.SetQoS(mqttp.QoS0)                 // nolint: errcheck
+	msg.SetTopic(brokerTopic + "/version") // nolint: errcheck
+	msg.SetPayload([]byte("nicemqtt version " + t.server.version))
+
+	*staticRetains = append(*staticRetains, msg)
+
+	return b
+}
+
+// update load averages and heap usage at given time
+// rates are per minute as reported by mosquitto
+func (b *broker) update(now time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	elapsed := now.Sub(b.lastUpdate).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	b.lastUpdate = now
+
+	for _, l := range b.loads {
+		curr := atomic.LoadUint64(&l.counter.val)
+		rate := float64(curr-l.last) * 60 / elapsed
+		l.last = curr
+
+		for i, p := range loadPeriods {
+			exponent := math.Exp(-elapsed / p.seconds)
+			l.values[i].set(l.values[i].value()*exponent + rate*(1-exponent))
+		}
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	atomic.StoreUint64(&b.heap.val, ms.HeapAlloc)
+	if atomic.LoadUint64(&b.heapMax.val) < ms.HeapAlloc {
+		atomic.StoreUint64(&b.heapMax.val, ms.HeapAlloc)
+	}
+}
+
+// Dropped count message discarded from offline queue
+func (b *broker) Dropped() {
+	atomic.AddUint64(&b.dropped.val, 1)
+}
+
+// Stored add message to store statistic
+func (t *storeStat) Stored(bytes uint64) {
+	atomic.AddUint64(&t.count.val, 1)
+	atomic.AddUint64(&t.bytes.val, bytes)
+}
+
+// Released remove message from store statistic
+func (t *storeStat) Released(bytes uint64) {
+	atomic.AddUint64(&t.count.val, ^uint64(0))
+	atomic.AddUint64(&t.bytes.val, ^(bytes - 1))
+}
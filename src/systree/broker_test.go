@@ -0,0 +1,103 @@
+package systree
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestBroker(t *testing.T) (*impl, time.Time) {
+	p, _, _, err := NewTree("$SYS/servers/test")
+	if err != nil {
+		t.Fatalf("new tree: %v", err)
+	}
+
+	tr := p.(*impl)
+	start := time.Now()
+	tr.broker.lastUpdate = start
+
+	return tr, start
+}
+
+func TestBrokerLoad(t *testing.T) {
+	tr, start := newTestBroker(t)
+	recv := tr.metrics.packets.total.recv
+	load := tr.broker.loads[0]
+
+	if load.counter != recv {
+		t.Fatalf("first load average is not of received messages")
+	}
+
+	// rate is per minute whatever the update interval is
+	steps := []struct {
+		delta uint64
+		at    time.Duration
+		rate  float64
+		load1 string
+	}{
+		{600, time.Minute, 600, "379.27"},
+		{150, 90 * time.Second, 300, "348.08"},
+		{0, 150 * time.Second, 0, "128.05"},
+	}
+
+	want := make([]float64, len(loadPeriods))
+	last := time.Duration(0)
+
+	for _, st := range steps {
+		atomic.AddUint64(&recv.val, st.delta)
+		tr.broker.update(start.Add(st.at))
+
+		elapsed := (st.at - last).Seconds()
+		last = st.at
+
+		for i, p := range loadPeriods {
+			exponent := math.Exp(-elapsed / p.seconds)
+			want[i] = want[i]*exponent + st.rate*(1-exponent)
+
+			if v := load.values[i].value(); math.Abs(v-want[i]) > 1e-9 {
+				t.Errorf("%s at %v: load %f, want %f", p.name, st.at, v, want[i])
+			}
+		}
+
+		// published as mosquitto does with two decimals
+		if v := string(load.values[0].get()); v != st.load1 {
+			t.Errorf("1min at %v: published %s, want %s", st.at, v, st.load1)
+		}
+	}
+
+	// counters without traffic keep zero load
+	for _, l := range tr.broker.loads[1:] {
+		for i := range loadPeriods {
+			if v := l.values[i].value(); v != 0 {
+				t.Errorf("idle load %f, want 0", v)
+			}
+		}
+	}
+
+	// update without time passed does not change loads
+	tr.broker.update(start.Add(150 * time.Second))
+	if v := load.values[0].value(); math.Abs(v-want[0]) > 1e-9 {
+		t.Errorf("load changed without time passed: %f", v)
+	}
+}
+
+func TestBrokerHeap(t *testing.T) {
+	tr, start := newTestBroker(t)
+	b := tr.broker
+
+	b.update(start.Add(time.Second))
+
+	heap := atomic.LoadUint64(&b.heap.val)
+	if heap == 0 || atomic.LoadUint64(&b.heapMax.val) != heap {
+		t.Errorf("heap %d, maximum %d, want equal non zero", heap, atomic.LoadUint64(&b.heapMax.val))
+	}
+
+	// maximum is kept once usage goes down
+	atomic.StoreUint64(&b.heapMax.val, math.MaxUint64)
+	b.update(start.Add(2 * time.Second))
+
+	if v := atomic.LoadUint64(&b.heapMax.val); v != math.MaxUint64 {
+		t.Errorf("heap maximum lowered to %d", v)
+	}
+}
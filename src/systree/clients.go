@@ -53,7 +53,7 @@ func newClients(topicPrefix string, retained *[]types.RetainObject) clients {
 }
 
 // Connected add to statistic new client
-func (t *clients) Connected(id string, status *ClientConnectStatus) {
+func (t *clients) Connected(ns, id string, status *ClientConnectStatus) {
 	newVal := atomic.AddUint64(&t.curr.val, 1)
 	if atomic.LoadUint64(&t.max.val) < newVal {
 		atomic.StoreUint64(&t.max.val, newVal)
@@ -63,8 +63,8 @@ func (t *clients) Connected(id string, status *ClientConnectStatus) {
 	nm, _ := mqttp.New(mqttp.ProtocolV311, mqttp.PUBLISH)
 	notifyMsg, _ := nm.(*mqttp.Publish)
 	notifyMsg.SetRetain(false)
-	notifyMsg.SetQoS(mqttp.QoS0)                    // nolint: errcheck
-	notifyMsg.SetTopic(t.topic + id + "/connected") // nolint: errcheck
+	notifyMsg.SetQoS(mqttp.QoS0)                                          // nolint: errcheck
+	notifyMsg.SetTopic(types.NamespaceTopic(ns, t.topic+id+"/connected")) // nolint: errcheck
 	log.Debug("topic(%s) id(%s) connected", t.topic, id)
 	if out, err := json.Marshal(&status); err != nil {
 		// todo: put reliable message
@@ -80,20 +80,20 @@ func (t *clients) Connected(id string, status *ClientConnectStatus) {
 	nm, _ = mqttp.New(mqttp.ProtocolV311, mqttp.PUBLISH)
 	notifyMsg, _ = nm.(*mqttp.Publish)
 	notifyMsg.SetRetain(false)
-	notifyMsg.SetQoS(mqttp.QoS0)                       // nolint: errcheck
-	notifyMsg.SetTopic(t.topic + id + "/disconnected") // nolint: errcheck
-	t.topicsManager.Retain(notifyMsg)                  // nolint: errcheck
+	notifyMsg.SetQoS(mqttp.QoS0)                                             // nolint: errcheck
+	notifyMsg.SetTopic(types.NamespaceTopic(ns, t.topic+id+"/disconnected")) // nolint: errcheck
+	t.topicsManager.Retain(notifyMsg)                                        // nolint: errcheck
 }
 
 // Disconnected remove client from statistic
-func (t *clients) Disconnected(id string, reason mqttp.ReasonCode) {
+func (t *clients) Disconnected(ns, id string, reason mqttp.ReasonCode) {
 	atomic.AddUint64(&t.curr.val, ^uint64(0))
 
 	nm, _ := mqttp.New(mqttp.ProtocolV311, mqttp.PUBLISH)
 	notifyMsg, _ := nm.(*mqttp.Publish)
 	notifyMsg.SetRetain(false)
-	notifyMsg.SetQoS(mqttp.QoS0)                       // nolint: errcheck
-	notifyMsg.SetTopic(t.topic + id + "/disconnected") // nolint: errcheck
+	notifyMsg.SetQoS(mqttp.QoS0)                                             // nolint: errcheck
+	notifyMsg.SetTopic(types.NamespaceTopic(ns, t.topic+id+"/disconnected")) // nolint: errcheck
 	notifyPayload := clientDisconnectStatus{
 		Reason:    "normal",
 		Timestamp: time.Now().Format(time.RFC3339),
@@ -111,7 +111,7 @@ func (t *clients) Disconnected(id string, reason mqttp.ReasonCode) {
 	nm, _ = mqttp.New(mqttp.ProtocolV311, mqttp.PUBLISH)
 	notifyMsg, _ = nm.(*mqttp.Publish)
 	notifyMsg.SetRetain(false)
-	notifyMsg.SetQoS(mqttp.QoS0)                    // nolint: errcheck
-	notifyMsg.SetTopic(t.topic + id + "/connected") // nolint: errcheck
-	t.topicsManager.Retain(notifyMsg)               // nolint: errcheck
+	notifyMsg.SetQoS(mqttp.QoS0)                                          // nolint: errcheck
+	notifyMsg.SetTopic(types.NamespaceTopic(ns, t.topic+id+"/connected")) // nolint: errcheck
+	t.topicsManager.Retain(notifyMsg)                                     // nolint: errcheck
 }
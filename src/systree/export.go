@@ -0,0 +1,155 @@
+package systree
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// FamilyType kind of the exported metric
+type FamilyType string
+
+// Metric kinds as defined by prometheus exposition format
+const (
+	// FamilyCounter value only grows
+	FamilyCounter FamilyType = "counter"
+	// FamilyGauge value may go up and down
+	FamilyGauge FamilyType = "gauge"
+)
+
+// Label of the sample
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample single value of the metric family
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Family metrics of the same name exported to monitoring systems
+type Family struct {
+	Name    string
+	Help    string
+	Type    FamilyType
+	Samples []Sample
+}
+
+// Exporter provides current values of the systree metrics
+type Exporter interface {
+	Families() []Family
+}
+
+func gauge(name, help string, val *dynamicValueInteger) Family {
+	return Family{
+		Name:    name,
+		Help:    help,
+		Type:    FamilyGauge,
+		Samples: []Sample{{Value: float64(atomic.LoadUint64(&val.val))}},
+	}
+}
+
+func counter(name, help string, val *dynamicValueInteger) Family {
+	f := gauge(name, help, val)
+	f.Type = FamilyCounter
+	return f
+}
+
+// Families snapshot of all metrics of the tree
+// totals of packets are not exported as those are sum over type label
+func (t *impl) Families() []Family {
+	pm := t.metrics.packets
+
+	entries := []struct {
+		name  string
+		entry *metricEntry
+	}{
+		{"connect", pm.connect},
+		{"connack", pm.connAck},
+		{"publish", pm.publish},
+		{"subscribe", pm.subscribe},
+		{"suback", pm.suback},
+		{"unsubscribe", pm.unsubscribe},
+		{"unsuback", pm.unSubAck},
+		{"pingreq", pm.pingReq},
+		{"pingresp", pm.pingResp},
+		{"disconnect", pm.disconnect},
+		{"auth", pm.auth},
+	}
+
+	sent := Family{Name: "mqtt_packets_sent_total", Help: "MQTT packets sent by type", Type: FamilyCounter}
+	recv := Family{Name: "mqtt_packets_received_total", Help: "MQTT packets received by type", Type: FamilyCounter}
+
+	for _, e := range entries {
+		labels := []Label{{Name: "type", Value: e.name}}
+		sent.Samples = append(sent.Samples, Sample{Labels: labels, Value: float64(atomic.LoadUint64(&e.entry.sent.val))})
+		recv.Samples = append(recv.Samples, Sample{Labels: labels, Value: float64(atomic.LoadUint64(&e.entry.recv.val))})
+	}
+
+	rm := t.metrics.retransmit
+
+	resent := Family{
+		Name: "mqtt_retransmit_total",
+		Help: "Unacknowledged packets resent by type",
+		Type: FamilyCounter,
+		Samples: []Sample{
+			{Labels: []Label{{Name: "type", Value: "publish"}}, Value: float64(atomic.LoadUint64(&rm.publish.val))},
+			{Labels: []Label{{Name: "type", Value: "pubrel"}}, Value: float64(atomic.LoadUint64(&rm.pubRel.val))},
+		},
+	}
+
+	families := []Family{
+		sent,
+		recv,
+		counter("mqtt_bytes_sent_total", "Bytes sent over all listeners", t.metrics.bytes.sent),
+		counter("mqtt_bytes_received_total", "Bytes received over all listeners", t.metrics.bytes.recv),
+		resent,
+		counter("mqtt_retransmit_exhausted_total", "Connections closed as retransmission retries exhausted", rm.exhausted),
+		gauge("mqtt_topics", "Current topics count", t.topics.curr),
+		gauge("mqtt_topics_max", "Max topics count", t.topics.max),
+		gauge("mqtt_subscriptions", "Current subscriptions count", t.subscriptions.curr),
+		gauge("mqtt_subscriptions_max", "Max subscriptions count", t.subscriptions.max),
+		gauge("mqtt_clients_connected", "Currently connected clients", t.clients.curr),
+		gauge("mqtt_clients_connected_max", "Max connected clients", t.clients.max),
+		gauge("mqtt_sessions", "Current sessions count", t.sessions.curr),
+		gauge("mqtt_sessions_max", "Max sessions count", t.sessions.max),
+		counter("mqtt_sessions_expired_total", "Sessions removed on expiry", t.broker.expired),
+		counter("mqtt_offline_dropped_total", "Messages dropped as offline queue of the session is full", t.broker.dropped),
+		gauge("mqtt_retained_messages", "Retained messages count", t.broker.retained.count),
+		gauge("mqtt_retained_bytes", "Payload bytes of retained messages", t.broker.retained.bytes),
+		gauge("mqtt_queued_messages", "Messages queued for delivery to connected clients", t.broker.queued.count),
+		gauge("mqtt_queued_bytes", "Payload bytes of messages queued for delivery", t.broker.queued.bytes),
+	}
+
+	return append(families, t.metrics.listenerFamilies()...)
+}
+
+func (t *metric) listenerFamilies() []Family {
+	var listeners []*listenerMetric
+
+	t.listeners.Range(func(k, v interface{}) bool {
+		listeners = append(listeners, v.(*listenerMetric))
+		return true
+	})
+
+	sort.Slice(listeners, func(i, j int) bool {
+		return listeners[i].id < listeners[j].id
+	})
+
+	sent := Family{Name: "mqtt_listener_bytes_sent_total", Help: "Bytes sent by listener", Type: FamilyCounter}
+	recv := Family{Name: "mqtt_listener_bytes_received_total", Help: "Bytes received by listener", Type: FamilyCounter}
+	accepted := Family{Name: "mqtt_listener_connections_total", Help: "Connections accepted by listener", Type: FamilyCounter}
+	active := Family{Name: "mqtt_listener_connections", Help: "Open connections of listener", Type: FamilyGauge}
+
+	for _, l := range listeners {
+		labels := []Label{{Name: "listener", Value: l.id}}
+
+		sent.Samples = append(sent.Samples, Sample{Labels: labels, Value: float64(atomic.LoadUint64(&l.sent))})
+		recv.Samples = append(recv.Samples, Sample{Labels: labels, Value: float64(atomic.LoadUint64(&l.recv))})
+		accepted.Samples = append(accepted.Samples, Sample{Labels: labels, Value: float64(atomic.LoadUint64(&l.accepted))})
+		active.Samples = append(active.Samples, Sample{Labels: labels, Value: float64(atomic.LoadInt64(&l.active))})
+	}
+
+	return []Family{sent, recv, accepted, active}
+}
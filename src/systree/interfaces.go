@@ -13,12 +13,24 @@ type Provider interface {
 	Subscriptions() SubscriptionsStat
 	Clients() Clients
 	Sessions() Sessions
+	// Retained statistic of retained messages
+	Retained() StoreStat
+	// Queued statistic of messages queued for delivery to connected clients
+	Queued() StoreStat
+	// Offline statistic of messages queued for offline sessions
+	Offline() OfflineStat
+	// Update recalculate load averages, invoked every systree update interval
+	Update()
+	Exporter
 }
 
 // Metric is wrap around all of metrics
 type Metric interface {
 	Bytes() BytesMetric
 	Packets() PacketsMetric
+	Retransmit() RetransmitMetric
+	// Listener bytes and connections metric of the listener, bytes are also added to totals
+	Listener(id string) ListenerMetric
 }
 
 // PacketsMetric packets metric
@@ -27,6 +39,22 @@ type PacketsMetric interface {
 	Received(t mqttp.Type)
 }
 
+// RetransmitMetric resends of unacknowledged QoS1/2 messages
+type RetransmitMetric interface {
+	Resent(t mqttp.Type)
+	// Exhausted connection closed as acknowledgment has not been received within retries
+	Exhausted()
+}
+
+// ListenerMetric metric of the listener
+type ListenerMetric interface {
+	BytesMetric
+	// Accepted new connection accepted by listener
+	Accepted()
+	// Closed connection of the listener closed
+	Closed()
+}
+
 // BytesMetric bytes metric
 type BytesMetric interface {
 	Sent(bytes uint64)
@@ -34,15 +62,29 @@ type BytesMetric interface {
 }
 
 // Sessions Statistic of sessions
+// ns is topic namespace of the client project notifications are published to, empty if none
 type Sessions interface {
-	Created(id string, status *SessionCreatedStatus)
-	Removed(id string, status *SessionDeletedStatus)
+	Created(ns, id string, status *SessionCreatedStatus)
+	Removed(ns, id string, status *SessionDeletedStatus)
 }
 
 // Clients Statistic of sessions
+// ns is topic namespace of the client project notifications are published to, empty if none
 type Clients interface {
-	Connected(id string, status *ClientConnectStatus)
-	Disconnected(id string, reason mqttp.ReasonCode)
+	Connected(ns, id string, status *ClientConnectStatus)
+	Disconnected(ns, id string, reason mqttp.ReasonCode)
+}
+
+// StoreStat messages held by server
+type StoreStat interface {
+	Stored(bytes uint64)
+	Released(bytes uint64)
+}
+
+// OfflineStat messages queued for offline sessions
+type OfflineStat interface {
+	// Dropped message discarded as offline queue of the session is full
+	Dropped()
 }
 
 // TopicsStat statistic of topics
@@ -1,6 +1,7 @@
 package systree
 
 import (
+	"sync"
 	"sync/atomic"
 
 	"github.com/VolantMQ/vlapi/mqttp"
@@ -31,9 +32,28 @@ type bytesMetric struct {
 	metricEntry
 }
 
+// retransmitMetric resends of unacknowledged messages
+type retransmitMetric struct {
+	publish   *dynamicValueInteger
+	pubRel    *dynamicValueInteger
+	exhausted *dynamicValueInteger
+}
+
+// listenerMetric metric of the single listener, exported to monitoring only
+type listenerMetric struct {
+	id       string
+	total    *bytesMetric
+	sent     uint64
+	recv     uint64
+	accepted uint64
+	active   int64
+}
+
 type metric struct {
-	packets *packetsMetric
-	bytes   *bytesMetric
+	packets    *packetsMetric
+	bytes      *bytesMetric
+	retransmit *retransmitMetric
+	listeners  *sync.Map
 }
 
 func newMetricEntry(topicPrefix string, retained *[]types.RetainObject) *metricEntry {
@@ -52,10 +72,23 @@ func newBytesMetric(topicPrefix string, retained *[]types.RetainObject) *bytesMe
 	}
 }
 
+func newRetransmitMetric(topicPrefix string, retained *[]types.RetainObject) *retransmitMetric {
+	m := &retransmitMetric{
+		publish:   newDynamicValueInteger(topicPrefix + "/publish"),
+		pubRel:    newDynamicValueInteger(topicPrefix + "/pubrel"),
+		exhausted: newDynamicValueInteger(topicPrefix + "/exhausted"),
+	}
+
+	*retained = append(*retained, m.publish, m.pubRel, m.exhausted)
+	return m
+}
+
 func newMetric(topicPrefix string, retained *[]types.RetainObject) metric {
 	return metric{
-		packets: newPacketsMetric(topicPrefix+"/metrics", retained),
-		bytes:   newBytesMetric(topicPrefix+"/metrics", retained),
+		packets:    newPacketsMetric(topicPrefix+"/metrics", retained),
+		bytes:      newBytesMetric(topicPrefix+"/metrics", retained),
+		retransmit: newRetransmitMetric(topicPrefix+"/metrics/retransmit", retained),
+		listeners:  &sync.Map{},
 	}
 }
 
@@ -144,6 +177,55 @@ func (t *metric) Packets() PacketsMetric {
 	return t.packets
 }
 
+// Retransmit get retransmit metric provider
+func (t *metric) Retransmit() RetransmitMetric {
+	return t.retransmit
+}
+
+// Resent add resent packet to metrics
+func (t *retransmitMetric) Resent(mt mqttp.Type) {
+	switch mt {
+	case mqttp.PUBLISH:
+		atomic.AddUint64(&t.publish.val, 1)
+	case mqttp.PUBREL:
+		atomic.AddUint64(&t.pubRel.val, 1)
+	}
+}
+
+// Exhausted count connections closed as retries run out
+func (t *retransmitMetric) Exhausted() {
+	atomic.AddUint64(&t.exhausted.val, 1)
+}
+
+// Listener get metric of the listener
+func (t *metric) Listener(id string) ListenerMetric {
+	value, _ := t.listeners.LoadOrStore(id, &listenerMetric{id: id, total: t.bytes})
+	return value.(*listenerMetric)
+}
+
+// Sent add sent bytes to listener and total statistic
+func (t *listenerMetric) Sent(bytes uint64) {
+	atomic.AddUint64(&t.sent, bytes)
+	t.total.Sent(bytes)
+}
+
+// Received add received bytes to listener and total statistic
+func (t *listenerMetric) Received(bytes uint64) {
+	atomic.AddUint64(&t.recv, bytes)
+	t.total.Received(bytes)
+}
+
+// Accepted add accepted connection
+func (t *listenerMetric) Accepted() {
+	atomic.AddUint64(&t.accepted, 1)
+	atomic.AddInt64(&t.active, 1)
+}
+
+// Closed remove closed connection
+func (t *listenerMetric) Closed() {
+	atomic.AddInt64(&t.active, -1)
+}
+
 // Sent add sent bytes to statistic
 func (t *bytesMetric) Sent(bytes uint64) {
 	atomic.AddUint64(&t.sent.val, bytes)
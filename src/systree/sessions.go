@@ -28,6 +28,8 @@ type sessions struct {
 
 	topicsManager types.TopicMessenger
 	topic         string
+	// expired count of sessions removed on expiry
+	expired *dynamicValueInteger
 }
 
 func newSessions(topicPrefix string, retained *[]types.RetainObject) sessions {
@@ -40,7 +42,7 @@ func newSessions(topicPrefix string, retained *[]types.RetainObject) sessions {
 }
 
 // Created add to statistic new client
-func (t *sessions) Created(id string, status *SessionCreatedStatus) {
+func (t *sessions) Created(ns, id string, status *SessionCreatedStatus) {
 	newVal := atomic.AddUint64(&t.curr.val, 1)
 	if atomic.LoadUint64(&t.max.val) < newVal {
 		atomic.StoreUint64(&t.max.val, newVal)
@@ -51,8 +53,8 @@ func (t *sessions) Created(id string, status *SessionCreatedStatus) {
 		nm, _ := mqttp.New(mqttp.ProtocolV311, mqttp.PUBLISH)
 		notifyMsg, _ := nm.(*mqttp.Publish)
 		notifyMsg.SetRetain(false)
-		notifyMsg.SetQoS(mqttp.QoS0)     // nolint: errcheck
-		notifyMsg.SetTopic(t.topic + id) // nolint: errcheck
+		notifyMsg.SetQoS(mqttp.QoS0)                             // nolint: errcheck
+		notifyMsg.SetTopic(types.NamespaceTopic(ns, t.topic+id)) // nolint: errcheck
 
 		if out, err := json.Marshal(&status); err != nil {
 			// todo: put reliable message
@@ -67,22 +69,26 @@ func (t *sessions) Created(id string, status *SessionCreatedStatus) {
 }
 
 // Removed remove client from statistic
-func (t *sessions) Removed(id string, status *SessionDeletedStatus) {
+func (t *sessions) Removed(ns, id string, status *SessionDeletedStatus) {
 	atomic.AddUint64(&t.curr.val, ^uint64(0))
+	if t.expired != nil && status != nil && status.Reason == "expired" {
+		atomic.AddUint64(&t.expired.val, 1)
+	}
+
 	if t.topicsManager != nil {
 		nm, _ := mqttp.New(mqttp.ProtocolV311, mqttp.PUBLISH)
 		notifyMsg, _ := nm.(*mqttp.Publish)
 		notifyMsg.SetRetain(false)
-		notifyMsg.SetQoS(mqttp.QoS0)     // nolint: errcheck
-		notifyMsg.SetTopic(t.topic + id) // nolint: errcheck
+		notifyMsg.SetQoS(mqttp.QoS0)                             // nolint: errcheck
+		notifyMsg.SetTopic(types.NamespaceTopic(ns, t.topic+id)) // nolint: errcheck
 
 		t.topicsManager.Retain(notifyMsg) // nolint: errcheck
 
 		nm, _ = mqttp.New(mqttp.ProtocolV311, mqttp.PUBLISH)
 		notifyMsg, _ = nm.(*mqttp.Publish)
 		notifyMsg.SetRetain(false)
-		notifyMsg.SetQoS(mqttp.QoS0)                  // nolint: errcheck
-		notifyMsg.SetTopic(t.topic + id + "/removed") // nolint: errcheck
+		notifyMsg.SetQoS(mqttp.QoS0)                                        // nolint: errcheck
+		notifyMsg.SetTopic(types.NamespaceTopic(ns, t.topic+id+"/removed")) // nolint: errcheck
 		if out, err := json.Marshal(&status); err != nil {
 			notifyMsg.SetPayload([]byte("data error"))
 		} else {
@@ -1,6 +1,8 @@
 package systree
 
 import (
+	"time"
+
 	"types"
 )
 
@@ -11,6 +13,7 @@ type impl struct {
 	subscriptions subscriptionsStat
 	clients       clients
 	sessions      sessions
+	broker        *broker
 }
 
 // NewTree allocate systree provider
@@ -25,8 +28,12 @@ func NewTree(base string) (Provider, []types.RetainObject, []DynamicValue, error
 		newStatSubscription(base+"/stats", &retains),
 		newClients(base, &retains),
 		newSessions(base, &retains),
+		nil,
 	}
 
+	tr.broker = newBroker(tr, &retains, &staticRetains)
+	tr.sessions.expired = tr.broker.expired
+
 	var dynUpdates []DynamicValue
 	for _, d := range retains {
 		v := d.(DynamicValue)
@@ -58,6 +65,26 @@ func (t *impl) Topics() TopicsStat {
 	return &t.topics
 }
 
+// Retained get retained messages stat provider
+func (t *impl) Retained() StoreStat {
+	return &t.broker.retained
+}
+
+// Queued get queued messages stat provider
+func (t *impl) Queued() StoreStat {
+	return &t.broker.queued
+}
+
+// Offline get offline queues stat provider
+func (t *impl) Offline() OfflineStat {
+	return t.broker
+}
+
+// Update recalculate load averages
+func (t *impl) Update() {
+	t.broker.update(time.Now())
+}
+
 // Metric get metric provider
 func (t *impl) Metric() Metric {
 	return &t.metrics
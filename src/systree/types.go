@@ -1,6 +1,7 @@
 package systree
 
 import (
+	"math"
 	"strconv"
 	"sync/atomic"
 	"time"
@@ -29,6 +30,17 @@ type dynamicValueInteger struct {
 	dynamicValue
 }
 
+// dynamicValueFloat float value stored as bits to be accessed atomically
+type dynamicValueFloat struct {
+	bits uint64
+	dynamicValue
+}
+
+// dynamicValueFunc value computed on every publish
+type dynamicValueFunc struct {
+	dynamicValue
+}
+
 type dynamicValueUpTime struct {
 	dynamicValue
 	startTime time.Time
@@ -46,6 +58,22 @@ func newDynamicValueInteger(topic string) *dynamicValueInteger {
 	return v
 }
 
+func newDynamicValueFloat(topic string) *dynamicValueFloat {
+	v := &dynamicValueFloat{}
+	v.topic = topic
+	v.getValue = v.get
+
+	return v
+}
+
+func newDynamicValueFunc(topic string, get func() []byte) *dynamicValueFunc {
+	v := &dynamicValueFunc{}
+	v.topic = topic
+	v.getValue = get
+
+	return v
+}
+
 func newDynamicValueUpTime(topic string) *dynamicValueUpTime {
 	v := &dynamicValueUpTime{
 		startTime: time.Now(),
@@ -70,6 +98,18 @@ func (v *dynamicValueInteger) get() []byte {
 	return []byte(val)
 }
 
+func (v *dynamicValueFloat) value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.bits))
+}
+
+func (v *dynamicValueFloat) set(val float64) {
+	atomic.StoreUint64(&v.bits, math.Float64bits(val))
+}
+
+func (v *dynamicValueFloat) get() []byte {
+	return []byte(strconv.FormatFloat(v.value(), 'f', 2, 64))
+}
+
 func (v *dynamicValueUpTime) get() []byte {
 	diff := time.Since(v.startTime)
 
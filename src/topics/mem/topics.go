@@ -190,6 +190,15 @@ func (mT *provider) Retained(filter string) ([]*mqttp.Publish, error) {
 	return r, nil
 }
 
+func (mT *provider) Queues() []topicsTypes.QueueStat {
+	return []topicsTypes.QueueStat{
+		{Name: "publish", Len: len(mT.inbound), Cap: cap(mT.inbound)},
+		{Name: "retain", Len: len(mT.inRetained), Cap: cap(mT.inRetained)},
+		{Name: "subscribe", Len: len(mT.subIn), Cap: cap(mT.subIn)},
+		{Name: "unsubscribe", Len: len(mT.unSubIn), Cap: cap(mT.unSubIn)},
+	}
+}
+
 func (mT *provider) Shutdown() error {
 	defer mT.smu.Unlock()
 	mT.smu.Lock()
@@ -50,6 +50,7 @@ type node struct {
 	retained  atomic.Value
 	wgDeleted sync.WaitGroup
 	subs      sync.Map
+	shares    sync.Map
 	children  sync.Map
 	kidsCount int32
 	subsCount int32
@@ -116,6 +117,10 @@ func (mT *provider) leafSearchNode(levels []string) *node {
 }
 
 func (mT *provider) subscriptionInsert(filter string, sub topicsTypes.Subscriber, p *vlsubscriber.SubscriptionParams) bool {
+	if group, topic, ok := splitShared(filter); ok {
+		return mT.shareInsert(group, topic, sub, p)
+	}
+
 	levels := strings.Split(filter, "/")
 
 	root := mT.leafInsertNode(levels)
@@ -138,6 +143,10 @@ func (mT *provider) subscriptionInsert(filter string, sub topicsTypes.Subscriber
 }
 
 func (mT *provider) subscriptionRemove(topic string, sub topicsTypes.Subscriber) error {
+	if group, filter, ok := splitShared(topic); ok && sub != nil {
+		return mT.shareRemove(group, filter, sub)
+	}
+
 	levels := strings.Split(topic, "/")
 
 	var err error
@@ -201,38 +210,45 @@ func (mT *provider) nodesCleanup(root *node, levels []string) {
 	}
 }
 
-func (mT *provider) subscriptionRecurseSearch(root *node, levels []string, publishID uintptr, p *publishes) {
+// matchedSubscribers collect subscribers of the node matching topic
+// shared subscriptions are kept apart as they are not merged with overlapping ones
+func (mT *provider) matchedSubscribers(sn *node, publishID uintptr, p *publishes, shared *[]*shareGroup) {
+	mT.nodeSubscribers(sn, publishID, p)
+	mT.sharedSubscribers(sn, shared)
+}
+
+func (mT *provider) subscriptionRecurseSearch(root *node, levels []string, publishID uintptr, p *publishes, shared *[]*shareGroup) {
 	if len(levels) == 0 {
 		// leaf level of the topic
 		// get all subscribers and return
-		mT.nodeSubscribers(root, publishID, p)
+		mT.matchedSubscribers(root, publishID, p, shared)
 		if n, ok := root.children.Load(topicsTypes.MWC); ok {
-			mT.nodeSubscribers(n.(*node), publishID, p)
+			mT.matchedSubscribers(n.(*node), publishID, p, shared)
 		}
 	} else {
 		if n, ok := root.children.Load(topicsTypes.MWC); ok && len(levels[0]) != 0 {
-			mT.nodeSubscribers(n.(*node), publishID, p)
+			mT.matchedSubscribers(n.(*node), publishID, p, shared)
 		}
 
 		if n, ok := root.children.Load(levels[0]); ok {
-			mT.subscriptionRecurseSearch(n.(*node), levels[1:], publishID, p)
+			mT.subscriptionRecurseSearch(n.(*node), levels[1:], publishID, p, shared)
 		}
 
 		if n, ok := root.children.Load(topicsTypes.SWC); ok {
-			mT.subscriptionRecurseSearch(n.(*node), levels[1:], publishID, p)
+			mT.subscriptionRecurseSearch(n.(*node), levels[1:], publishID, p, shared)
 		}
 	}
 }
 
-func (mT *provider) subscriptionSearch(topic string, publishID uintptr, p *publishes) {
+func (mT *provider) subscriptionSearch(topic string, publishID uintptr, p *publishes, shared *[]*shareGroup) {
 	root := mT.root
 	levels := strings.Split(topic, "/")
 	level := levels[0]
 
 	if !strings.HasPrefix(level, "$") {
-		mT.subscriptionRecurseSearch(root, levels, publishID, p)
+		mT.subscriptionRecurseSearch(root, levels, publishID, p, shared)
 	} else if n, ok := root.children.Load(level); ok {
-		mT.subscriptionRecurseSearch(n.(*node), levels[1:], publishID, p)
+		mT.subscriptionRecurseSearch(n.(*node), levels[1:], publishID, p, shared)
 	}
 }
 
@@ -241,7 +257,12 @@ func (mT *provider) retainInsert(topic string, obj types.RetainObject) {
 
 	root := mT.leafInsertNode(levels)
 
-	root.retained.Store(retainer{val: obj})
+	old := root.retained.Swap(retainer{val: obj})
+	if old != nil {
+		mT.retainRelease(old.(retainer).val)
+	}
+	mT.retainStored(obj)
+
 	atomic.AddInt32(&root.subsCount, -1)
 }
 
@@ -253,37 +274,58 @@ func (mT *provider) retainRemove(topic string) error {
 		return topicsTypes.ErrNotFound
 	}
 
-	root.retained.Store(retainer{})
+	mT.retainRelease(root.retained.Swap(retainer{}).(retainer).val)
 
 	mT.nodesCleanup(root, levels)
 
 	return nil
 }
 
-func retainRecurseSearch(root *node, levels []string, retained *[]*mqttp.Publish) {
+// retainedSize payload bytes of the retained message, dynamic values are not accounted
+func retainedSize(obj interface{}) uint64 {
+	if p, ok := obj.(*mqttp.Publish); ok {
+		return uint64(len(p.Payload()))
+	}
+
+	return 0
+}
+
+func (mT *provider) retainStored(obj types.RetainObject) {
+	if mT.retainedStat != nil {
+		mT.retainedStat.Stored(retainedSize(obj))
+	}
+}
+
+func (mT *provider) retainRelease(obj interface{}) {
+	if obj != nil && mT.retainedStat != nil {
+		mT.retainedStat.Released(retainedSize(obj))
+	}
+}
+
+func (mT *provider) retainRecurseSearch(root *node, levels []string, retained *[]*mqttp.Publish) {
 	if len(levels) == 0 {
 		// leaf level of the topic
-		root.getRetained(retained)
+		mT.getRetained(root, retained)
 		if value, ok := root.children.Load(topicsTypes.MWC); ok {
 			n := value.(*node)
-			n.allRetained(retained)
+			mT.allRetained(n, retained)
 		}
 	} else {
 		switch levels[0] {
 		case topicsTypes.MWC:
 			// If '#', add all retained messages starting this node
-			root.allRetained(retained)
+			mT.allRetained(root, retained)
 			return
 		case topicsTypes.SWC:
 			// If '+', check all nodes at this level. Next levels must be matched.
 			root.children.Range(func(key, value interface{}) bool {
-				retainRecurseSearch(value.(*node), levels[1:], retained)
+				mT.retainRecurseSearch(value.(*node), levels[1:], retained)
 
 				return true
 			})
 		default:
 			if value, ok := root.children.Load(levels[0]); ok {
-				retainRecurseSearch(value.(*node), levels[1:], retained)
+				mT.retainRecurseSearch(value.(*node), levels[1:], retained)
 			}
 		}
 	}
@@ -299,7 +341,7 @@ func (mT *provider) retainSearch(filter string, retained *[]*mqttp.Publish) {
 			n := value.(*node)
 
 			if t != "" && !strings.HasPrefix(t, "$") {
-				n.allRetained(retained)
+				mT.allRetained(n, retained)
 			}
 
 			return true
@@ -310,13 +352,13 @@ func (mT *provider) retainSearch(filter string, retained *[]*mqttp.Publish) {
 		if ok {
 			n = value.(*node)
 		}
-		retainRecurseSearch(n, levels[1:], retained)
+		mT.retainRecurseSearch(n, levels[1:], retained)
 	} else {
-		retainRecurseSearch(mT.root, levels, retained)
+		mT.retainRecurseSearch(mT.root, levels, retained)
 	}
 }
 
-func (sn *node) getRetained(retained *[]*mqttp.Publish) {
+func (mT *provider) getRetained(sn *node, retained *[]*mqttp.Publish) {
 	rt := sn.retained.Load().(retainer)
 
 	switch val := rt.val.(type) {
@@ -335,17 +377,19 @@ func (sn *node) getRetained(retained *[]*mqttp.Publish) {
 			*retained = append(*retained, p)
 		} else {
 			// publish has expired, thus nobody should get it
-			sn.retained.Store(retainer{})
+			if sn.retained.CompareAndSwap(rt, retainer{}) {
+				mT.retainRelease(val)
+			}
 		}
 	}
 }
 
-func (sn *node) allRetained(retained *[]*mqttp.Publish) {
-	sn.getRetained(retained)
+func (mT *provider) allRetained(sn *node, retained *[]*mqttp.Publish) {
+	mT.getRetained(sn, retained)
 
 	sn.children.Range(func(key, value interface{}) bool {
 		n := value.(*node)
-		n.allRetained(retained)
+		mT.allRetained(n, retained)
 		return true
 	})
 }
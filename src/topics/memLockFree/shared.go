@@ -0,0 +1,222 @@
+package memLockFree
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VolantMQ/vlapi/subscriber"
+	"topics/types"
+)
+
+// shareGroup members of the shared subscription
+// every message matching the filter is delivered to one of them
+type shareGroup struct {
+	lock    sync.RWMutex
+	members []*topicSubscriber
+	next    uint32
+	removed bool
+}
+
+// splitShared split $share/{ShareName}/{filter} into share name and filter
+func splitShared(filter string) (string, string, bool) {
+	if !strings.HasPrefix(filter, topicsTypes.SharePrefix) {
+		return "", filter, false
+	}
+
+	rest := filter[len(topicsTypes.SharePrefix):]
+
+	idx := strings.Index(rest, topicsTypes.SEP)
+	if idx <= 0 {
+		return "", filter, false
+	}
+
+	return rest[:idx], rest[idx+1:], true
+}
+
+// insert add subscriber to the group or update params if already member
+// false returned if group has been removed from the node
+func (g *shareGroup) insert(sub topicsTypes.Subscriber, p *vlsubscriber.SubscriptionParams) (bool, bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.removed {
+		return false, false
+	}
+
+	for _, m := range g.members {
+		if m.s.Hash() == sub.Hash() {
+			m.Lock()
+			m.p = p
+			m.Unlock()
+			return true, true
+		}
+	}
+
+	g.members = append(g.members, &topicSubscriber{s: sub, p: p})
+
+	return false, true
+}
+
+// remove subscriber from the group
+// returns false if subscriber is not a member and true if group has no members left
+func (g *shareGroup) remove(sub topicsTypes.Subscriber) (bool, bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for i, m := range g.members {
+		if m.s.Hash() == sub.Hash() {
+			g.members = append(g.members[:i], g.members[i+1:]...)
+			g.removed = len(g.members) == 0
+			return true, g.removed
+		}
+	}
+
+	return false, false
+}
+
+// pick member message is delivered to
+// members without active connection get messages only if whole group is offline
+func (g *shareGroup) pick(strategy string, publisher string) *publish {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	count := 0
+	for _, m := range g.members {
+		if m.s.IsOnline() {
+			count++
+		}
+	}
+
+	online := count > 0
+	if !online {
+		count = len(g.members)
+	}
+
+	if count == 0 {
+		return nil
+	}
+
+	if strategy == topicsTypes.SharedSticky && len(publisher) > 0 {
+		return g.rendezvous(publisher, online)
+	}
+
+	var idx int
+
+	if strategy == topicsTypes.SharedRandom {
+		idx = rand.Intn(count)
+	} else {
+		idx = int(atomic.AddUint32(&g.next, 1) % uint32(count))
+	}
+
+	for _, m := range g.members {
+		if online && !m.s.IsOnline() {
+			continue
+		}
+
+		if idx == 0 {
+			m.RLock()
+			defer m.RUnlock()
+			return m.acquire()
+		}
+
+		idx--
+	}
+
+	return nil
+}
+
+// rendezvous member with highest weight of the publisher and member client ids
+// publisher keeps its member while member stays in the group, only publishers
+// of the member left or gone offline are spread over the rest
+func (g *shareGroup) rendezvous(publisher string, online bool) *publish {
+	var best *topicSubscriber
+	var bestWeight uint64
+
+	for _, m := range g.members {
+		if online && !m.s.IsOnline() {
+			continue
+		}
+
+		h := fnv.New64a()
+		h.Write([]byte(publisher))   // nolint: errcheck
+		h.Write([]byte{0})           // nolint: errcheck
+		h.Write([]byte(m.s.GetID())) // nolint: errcheck
+
+		if w := h.Sum64(); best == nil || w > bestWeight {
+			best = m
+			bestWeight = w
+		}
+	}
+
+	best.RLock()
+	defer best.RUnlock()
+
+	return best.acquire()
+}
+
+func (mT *provider) shareInsert(group string, filter string, sub topicsTypes.Subscriber, p *vlsubscriber.SubscriptionParams) bool {
+	levels := strings.Split(filter, "/")
+
+	root := mT.leafInsertNode(levels)
+
+	for {
+		value, _ := root.shares.LoadOrStore(group, &shareGroup{})
+
+		exists, ok := value.(*shareGroup).insert(sub, p)
+		if !ok {
+			// group emptied concurrently, wait until it is gone and create new one
+			runtime.Gosched()
+			continue
+		}
+
+		if exists {
+			atomic.AddInt32(&root.subsCount, -1)
+		}
+
+		return exists
+	}
+}
+
+func (mT *provider) shareRemove(group string, filter string, sub topicsTypes.Subscriber) error {
+	levels := strings.Split(filter, "/")
+
+	root := mT.leafSearchNode(levels)
+	if root == nil {
+		return topicsTypes.ErrNotFound
+	}
+
+	value, ok := root.shares.Load(group)
+	if !ok {
+		return topicsTypes.ErrNotFound
+	}
+
+	g := value.(*shareGroup)
+
+	found, empty := g.remove(sub)
+	if !found {
+		return topicsTypes.ErrNotFound
+	}
+
+	if empty {
+		root.shares.Delete(group)
+	}
+
+	atomic.AddInt32(&root.subsCount, -1)
+
+	mT.nodesCleanup(root, levels)
+
+	return nil
+}
+
+// sharedSubscribers collect share groups of the node
+// member is picked once message is known to match, see publisher
+func (mT *provider) sharedSubscribers(sn *node, shared *[]*shareGroup) {
+	sn.shares.Range(func(key, value interface{}) bool {
+		*shared = append(*shared, value.(*shareGroup))
+		return true
+	})
+}
@@ -0,0 +1,225 @@
+package memLockFree
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/VolantMQ/vlapi/mqttp"
+	"github.com/VolantMQ/vlapi/subscriber"
+	"topics/types"
+)
+
+// member subscriber reporting own id to delivered on every message
+type member struct {
+	id        string
+	offline   int32
+	delivered chan string
+}
+
+func (m *member) Acquire() {}
+
+func (m *member) Release() {}
+
+func (m *member) Publish(*mqttp.Publish, mqttp.QosType, mqttp.SubscriptionOptions, []uint32) error {
+	m.delivered <- m.id
+	return nil
+}
+
+func (m *member) Hash() uintptr { return uintptr(unsafe.Pointer(m)) }
+
+func (m *member) GetID() string { return m.id }
+
+func (m *member) IsOnline() bool { return atomic.LoadInt32(&m.offline) == 0 }
+
+func (m *member) setOnline(v bool) {
+	if v {
+		atomic.StoreInt32(&m.offline, 0)
+	} else {
+		atomic.StoreInt32(&m.offline, 1)
+	}
+}
+
+func newTestProvider(t *testing.T, strategy string) topicsTypes.Provider {
+	cfg := topicsTypes.NewMemConfig()
+	cfg.SharedStrategy = strategy
+
+	p, err := NewMemProvider(cfg)
+	if err != nil {
+		t.Fatalf("provider: %v", err)
+	}
+
+	t.Cleanup(func() {
+		p.Shutdown() // nolint: errcheck
+	})
+
+	return p
+}
+
+// group subscribe members to the shared filter
+func group(t *testing.T, p topicsTypes.Provider, filter string, ids ...string) ([]*member, chan string) {
+	delivered := make(chan string, 16)
+
+	var members []*member
+
+	for _, id := range ids {
+		m := &member{id: id, delivered: delivered}
+		members = append(members, m)
+
+		resp := make(chan topicsTypes.SubscribeResp, 1)
+		p.Subscribe(topicsTypes.SubscribeReq{ // nolint: errcheck
+			Filter: filter,
+			S:      m,
+			Params: &vlsubscriber.SubscriptionParams{Ops: mqttp.SubscriptionOptions(mqttp.QoS1), Granted: mqttp.QoS1},
+			Chan:   resp,
+		})
+
+		if r := <-resp; r.Err != nil {
+			t.Fatalf("subscribe %s: %v", id, r.Err)
+		}
+	}
+
+	return members, delivered
+}
+
+// deliver publish message and wait member it has been delivered to
+func deliver(t *testing.T, p topicsTypes.Provider, delivered chan string, publisher string) string {
+	pkt := mqttp.NewPublish(mqttp.ProtocolV50)
+	pkt.Set("a/b", []byte("m"), mqttp.QoS1, false, false) // nolint: errcheck
+	pkt.SetPublisher(publisher)
+
+	p.Publish(pkt) // nolint: errcheck
+
+	var id string
+
+	select {
+	case id = <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("message is not delivered")
+	}
+
+	// message goes to single member of the group
+	select {
+	case dup := <-delivered:
+		t.Fatalf("message delivered to %s and %s", id, dup)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	return id
+}
+
+func TestSharedRoundRobin(t *testing.T) {
+	p := newTestProvider(t, topicsTypes.SharedRoundRobin)
+	_, delivered := group(t, p, "$share/g/a/+", "m1", "m2", "m3")
+
+	counts := map[string]int{}
+	prev := ""
+
+	for i := 0; i < 9; i++ {
+		id := deliver(t, p, delivered, "p")
+		if id == prev {
+			t.Errorf("message %d delivered to %s twice in a row", i, id)
+		}
+
+		prev = id
+		counts[id]++
+	}
+
+	for _, id := range []string{"m1", "m2", "m3"} {
+		if counts[id] != 3 {
+			t.Errorf("%s: expected 3 messages, got %d", id, counts[id])
+		}
+	}
+}
+
+func TestSharedRandom(t *testing.T) {
+	p := newTestProvider(t, topicsTypes.SharedRandom)
+	_, delivered := group(t, p, "$share/g/a/b", "m1", "m2", "m3")
+
+	counts := map[string]int{}
+
+	for i := 0; i < 60; i++ {
+		counts[deliver(t, p, delivered, "p")]++
+	}
+
+	for _, id := range []string{"m1", "m2", "m3"} {
+		if counts[id] == 0 {
+			t.Errorf("%s: got no messages", id)
+		}
+	}
+}
+
+func TestSharedSticky(t *testing.T) {
+	p := newTestProvider(t, topicsTypes.SharedSticky)
+	members, delivered := group(t, p, "$share/g/#", "m1", "m2", "m3")
+
+	publishers := []string{"p0", "p1", "p2", "p3", "p4", "p5", "p6", "p7", "p8", "p9"}
+	assigned := map[string]string{}
+	used := map[string]bool{}
+
+	for _, pub := range publishers {
+		assigned[pub] = deliver(t, p, delivered, pub)
+		used[assigned[pub]] = true
+
+		for i := 0; i < 3; i++ {
+			if id := deliver(t, p, delivered, pub); id != assigned[pub] {
+				t.Errorf("%s: expected %s, got %s", pub, assigned[pub], id)
+			}
+		}
+	}
+
+	if len(used) < 2 {
+		t.Errorf("publishers are not spread over group: %v", assigned)
+	}
+
+	// only publishers of the offline member move to the rest
+	members[0].setOnline(false)
+
+	for _, pub := range publishers {
+		id := deliver(t, p, delivered, pub)
+
+		if assigned[pub] == "m1" {
+			if id == "m1" {
+				t.Errorf("%s: delivered to offline member", pub)
+			}
+		} else if id != assigned[pub] {
+			t.Errorf("%s: expected %s, got %s", pub, assigned[pub], id)
+		}
+	}
+
+	members[0].setOnline(true)
+
+	for _, pub := range publishers {
+		if id := deliver(t, p, delivered, pub); id != assigned[pub] {
+			t.Errorf("%s: expected %s once member is back, got %s", pub, assigned[pub], id)
+		}
+	}
+}
+
+func TestSharedOfflineFailover(t *testing.T) {
+	for _, strategy := range []string{topicsTypes.SharedRoundRobin, topicsTypes.SharedRandom, topicsTypes.SharedSticky} {
+		p := newTestProvider(t, strategy)
+		members, delivered := group(t, p, "$share/g/a/b", "m1", "m2")
+
+		members[0].setOnline(false)
+
+		for i := 0; i < 10; i++ {
+			if id := deliver(t, p, delivered, "p"); id != "m2" {
+				t.Errorf("%s: expected online member m2, got %s", strategy, id)
+			}
+		}
+
+		// whole group offline, messages are queued to offline members
+		members[1].setOnline(false)
+
+		counts := map[string]int{}
+		for i := 0; i < 10; i++ {
+			counts[deliver(t, p, delivered, "p")]++
+		}
+
+		if counts["m1"]+counts["m2"] != 10 {
+			t.Errorf("%s: messages lost when group is offline: %v", strategy, counts)
+		}
+	}
+}
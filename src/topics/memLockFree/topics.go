@@ -16,6 +16,7 @@ package memLockFree
 
 import (
 	"logs"
+	"strings"
 	"sync"
 	"time"
 
@@ -39,6 +40,8 @@ type provider struct {
 	unSubIn            chan topicsTypes.UnSubscribeReq
 	onCleanUnsubscribe func([]string)
 	nodeSubscribers    func(sn *node, publishID uintptr, p *publishes)
+	sharedStrategy     string
+	retainedStat       systree.StoreStat
 }
 
 var _ topicsTypes.Provider = (*provider)(nil)
@@ -54,6 +57,7 @@ var (
 func NewMemProvider(config *topicsTypes.MemConfig) (topicsTypes.Provider, error) {
 	p := &provider{
 		stat:               config.Stat,
+		retainedStat:       config.Retained,
 		persist:            config.Persist,
 		onCleanUnsubscribe: config.OnCleanUnsubscribe,
 		inbound:            make(chan *mqttp.Publish, 1024*512),
@@ -62,6 +66,15 @@ func NewMemProvider(config *topicsTypes.MemConfig) (topicsTypes.Provider, error)
 		unSubIn:            make(chan topicsTypes.UnSubscribeReq, 1024*512),
 	}
 
+	switch config.SharedStrategy {
+	case "":
+		p.sharedStrategy = topicsTypes.SharedRoundRobin
+	case topicsTypes.SharedRoundRobin, topicsTypes.SharedRandom, topicsTypes.SharedSticky:
+		p.sharedStrategy = config.SharedStrategy
+	default:
+		return nil, topicsTypes.ErrUnknownStrategy
+	}
+
 	if config.OverlappingSubscriptions {
 		p.nodeSubscribers = overlappingSubscribers
 	} else {
@@ -163,6 +176,15 @@ func (mT *provider) Retained(filter string) ([]*mqttp.Publish, error) {
 	return r, nil
 }
 
+func (mT *provider) Queues() []topicsTypes.QueueStat {
+	return []topicsTypes.QueueStat{
+		{Name: "publish", Len: len(mT.inbound), Cap: cap(mT.inbound)},
+		{Name: "retain", Len: len(mT.inRetained), Cap: cap(mT.inRetained)},
+		{Name: "subscribe", Len: len(mT.subIn), Cap: cap(mT.subIn)},
+		{Name: "unsubscribe", Len: len(mT.unSubIn), Cap: cap(mT.unSubIn)},
+	}
+}
+
 func (mT *provider) Shutdown() error {
 	close(mT.inbound)
 	close(mT.inRetained)
@@ -177,16 +199,29 @@ func (mT *provider) Shutdown() error {
 		mT.retainSearch("#", &res)
 		mT.retainSearch("/#", &res)
 
+		// topics starting with $ are not matched by # [MQTT-4.7.2-1], e.g. project namespaces
+		// $SYS is skipped as it is published again by systree on start
+		mT.root.children.Range(func(key, value interface{}) bool {
+			if t := key.(string); strings.HasPrefix(t, "$") && t != "$SYS" {
+				mT.retainSearch(t+"/#", &res)
+			}
+			return true
+		})
+
 		var encoded []*persistence.PersistedPacket
 
 		for _, pkt := range res {
 			// Discard retained expired and QoS0 messages
 			if expireAt, _, expired := pkt.Expired(); !expired && pkt.QoS() != mqttp.QoS0 {
+				// messages published by server itself have no packet id
+				pkt.SetPacketID(0)
+
 				if buf, err := mqttp.Encode(pkt); err != nil {
 					log.Error("Couldn't encode retained message:%s", err.Error())
 				} else {
+					// first byte is protocol version packet is decoded with on load
 					entry := &persistence.PersistedPacket{
-						Data: buf,
+						Data: append([]byte{byte(pkt.Version())}, buf...),
 					}
 					if !expireAt.IsZero() {
 						entry.ExpireAt = expireAt.Format(time.RFC3339)
@@ -242,8 +277,10 @@ func (mT *provider) subscriber() {
 			var r []*mqttp.Publish
 
 			// [MQTT-3.3.1-5]
+			// v5.0 [MQTT-4.8.2] retained messages are not sent on new shared subscription
+			_, _, shared := splitShared(req.Filter)
 			rh := req.Params.Ops.RetainHandling()
-			if (rh == mqttp.RetainHandlingRetain) || ((rh == mqttp.RetainHandlingIfNotExists) && !exists) {
+			if !shared && ((rh == mqttp.RetainHandlingRetain) || ((rh == mqttp.RetainHandlingIfNotExists) && !exists)) {
 				mT.retainSearch(req.Filter, &r)
 			}
 
@@ -278,8 +315,9 @@ func (mT *provider) publisher() {
 
 	for msg := range mT.inbound {
 		pubEntries := publishes{}
+		var shared []*shareGroup
 
-		mT.subscriptionSearch(msg.Topic(), msg.PublishID(), &pubEntries)
+		mT.subscriptionSearch(msg.Topic(), msg.PublishID(), &pubEntries, &shared)
 
 		for _, pub := range pubEntries {
 			for _, e := range pub {
@@ -289,5 +327,17 @@ func (mT *provider) publisher() {
 				e.s.Release()
 			}
 		}
+
+		for _, g := range shared {
+			e := g.pick(mT.sharedStrategy, msg.Publisher())
+			if e == nil {
+				continue
+			}
+
+			if err := e.s.Publish(msg, e.qos, e.ops, e.ids); err != nil {
+				log.Error("Publish error:%s", err.Error())
+			}
+			e.s.Release()
+		}
 	}
 }
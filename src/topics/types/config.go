@@ -9,14 +9,29 @@ import (
 // ProviderConfig interface implemented by every backend
 type ProviderConfig interface{}
 
+// Shared subscriptions dispatch strategies
+const (
+	// SharedRoundRobin members of the group receive messages in turn
+	SharedRoundRobin = "round_robin"
+	// SharedRandom message delivered to random member of the group
+	SharedRandom = "random"
+	// SharedSticky messages of the same publishing client are delivered to the same member
+	// while it stays online, client ids are mapped by rendezvous hashing
+	SharedSticky = "sticky"
+)
+
 // MemConfig of topics manager
 type MemConfig struct {
-	Stat                     systree.TopicsStat
+	Stat systree.TopicsStat
+	// Retained statistic of retained messages
+	Retained                 systree.StoreStat
 	Persist                  persistence.Retained
 	OnCleanUnsubscribe       func([]string)
 	Name                     string
 	MaxQos                   mqttp.QosType
 	OverlappingSubscriptions bool
+	// SharedStrategy dispatch strategy of shared subscriptions
+	SharedStrategy string
 }
 
 // NewMemConfig generate default config for memory
@@ -27,5 +42,6 @@ func NewMemConfig() *MemConfig {
 		MaxQos:                   mqttp.QoS2,
 		OnCleanUnsubscribe:       func([]string) {},
 		OverlappingSubscriptions: false,
+		SharedStrategy:           SharedRoundRobin,
 	}
 }
@@ -3,6 +3,7 @@ package topicsTypes
 import (
 	"errors"
 	"regexp"
+	"strings"
 
 	"github.com/VolantMQ/vlapi/mqttp"
 	"github.com/VolantMQ/vlapi/subscriber"
@@ -18,6 +19,9 @@ const (
 
 	// SEP is the topic level separator
 	SEP = "/"
+
+	// SharePrefix prefix of the shared subscription filter $share/{ShareName}/{filter}
+	SharePrefix = "$share/"
 )
 
 var (
@@ -47,6 +51,9 @@ var (
 
 	// ErrNotFound object not found
 	ErrNotFound = errors.New("topics: not found")
+
+	// ErrUnknownStrategy unknown shared subscriptions strategy
+	ErrUnknownStrategy = errors.New("topics: unknown shared subscriptions strategy")
 )
 
 // Subscriber used inside each session as an object to provide to topic manager upon subscribe
@@ -55,6 +62,10 @@ type Subscriber interface {
 	Release()
 	Publish(*mqttp.Publish, mqttp.QosType, mqttp.SubscriptionOptions, []uint32) error
 	Hash() uintptr
+	// GetID client id of the subscriber, sticky shared subscriptions map publishers to it
+	GetID() string
+	// IsOnline shared subscriptions prefer members with active connection
+	IsOnline() bool
 }
 
 // Subscribers used by topic manager to return list of subscribers matching topic
@@ -69,9 +80,18 @@ type SubscriberInterface interface {
 	Retained(string) ([]*mqttp.Publish, error)
 }
 
+// QueueStat depth of the provider queue
+type QueueStat struct {
+	Name string
+	Len  int
+	Cap  int
+}
+
 // Provider interface
 type Provider interface {
 	SubscriberInterface
+	// Queues depth of requests waiting to be processed by provider
+	Queues() []QueueStat
 	Shutdown() error
 }
 
@@ -110,3 +130,30 @@ var (
 	// ErrInvalidWildcard Wildcard characters '#' and '+' must occupy entire topic level
 	ErrInvalidWildcard = errors.New("wildcard characters '#' and '+' must occupy entire topic level")
 )
+
+// TopicMatch check if topic name matches filter
+// [MQTT-4.7.2-1] wildcards at first level do not match topics starting with $
+func TopicMatch(filter, topic string) bool {
+	fLevels := strings.Split(filter, SEP)
+	tLevels := strings.Split(topic, SEP)
+
+	if strings.HasPrefix(topic, "$") && (fLevels[0] == SWC || fLevels[0] == MWC) {
+		return false
+	}
+
+	for i, f := range fLevels {
+		if f == MWC {
+			return true
+		}
+
+		if i >= len(tLevels) {
+			return false
+		}
+
+		if f != SWC && f != tLevels[i] {
+			return false
+		}
+	}
+
+	return len(fLevels) == len(tLevels)
+}
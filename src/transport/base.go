@@ -15,6 +15,13 @@ type Config struct {
 	// AuthManager
 	AuthManager *auth.Manager
 
+	// RateLimit limits of clients connected to the listener, global limits apply if not set
+	RateLimit *types.RateLimit
+
+	// OfflineQoS0 persist QoS0 messages of offline sessions connected over the listener
+	// global option applies if not set
+	OfflineQoS0 *bool
+
 	Host string
 	// Port tcp port to listen on
 	Port string
@@ -50,6 +57,8 @@ type Provider interface {
 var (
 	// ErrListenerIsOff ...
 	ErrListenerIsOff = errors.New("listener is off")
+
+	errBanned = errors.New("banned")
 )
 
 // Port return tcp port used by transport
@@ -100,5 +109,13 @@ func (c *baseConfig) handleConnection(conn Conn) {
 	// to client. Exit regardless of error type.
 	//conn.Conn.SetReadDeadline(time.Now().Add(time.Second * time.Duration(c.ConnectTimeout))) // nolint: errcheck, gas
 
-	err = c.OnConnection(conn, c.config.AuthManager)
+	if c.config.AuthManager != nil {
+		if ban := c.config.AuthManager.BannedPeer(auth.NewPeer(conn.RemoteAddr())); ban != nil {
+			log.Debug("connection refused, remote:%s banned as %s:%s", conn.RemoteAddr().String(), ban.Kind, ban.Value)
+			err = errBanned
+			return
+		}
+	}
+
+	err = c.OnConnection(conn, &c.config)
 }
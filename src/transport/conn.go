@@ -1,9 +1,12 @@
 package transport
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"net"
+	"sync"
+	"time"
 
-	"auth"
 	"github.com/troian/easygo/netpoll"
 	"systree"
 )
@@ -12,6 +15,9 @@ import (
 // implemented to encapsulate bytes statistic
 type Conn interface {
 	net.Conn
+	// PeerCertificate verified certificate of the client
+	// nil if connection is not tls or client has not presented certificate
+	PeerCertificate() *x509.Certificate
 	// Start(cb netpoll.CallbackFn) error
 	// Stop() error
 	// Resume() error
@@ -19,7 +25,8 @@ type Conn interface {
 
 type conn struct {
 	net.Conn
-	stat systree.BytesMetric
+	stat    systree.ListenerMetric
+	onClose sync.Once
 	// desc  *netpoll.Desc
 	// ePoll netpoll.EventPoll
 }
@@ -28,10 +35,11 @@ var _ Conn = (*conn)(nil)
 
 // Handler ...
 type Handler interface {
-	OnConnection(Conn, *auth.Manager) error
+	// OnConnection handle connection accepted by listener of given config
+	OnConnection(Conn, *Config) error
 }
 
-func newConn(poll netpoll.EventPoll, cn net.Conn, stat systree.BytesMetric) (*conn, error) {
+func newConn(poll netpoll.EventPoll, cn net.Conn, stat systree.ListenerMetric) (*conn, error) {
 	// desc, err := netpoll.HandleReadOnce(cn)
 	// if err != nil {
 	// 	return nil, err
@@ -44,6 +52,8 @@ func newConn(poll netpoll.EventPoll, cn net.Conn, stat systree.BytesMetric) (*co
 		// ePoll: poll,
 	}
 
+	stat.Accepted()
+
 	return c, nil
 }
 
@@ -79,6 +89,40 @@ func (c *conn) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// PeerCertificate completes tls handshake if it has not happened yet
+func (c *conn) PeerCertificate() *x509.Certificate {
+	cn := c.Conn
+	if ws, ok := cn.(*wsConn); ok {
+		cn = ws.Conn
+	}
+
+	tc, ok := cn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	tc.SetDeadline(time.Now().Add(handshakeTimeout)) // nolint: errcheck
+	defer tc.SetDeadline(time.Time{})                // nolint: errcheck
+
+	if err := tc.Handshake(); err != nil {
+		log.Debug("tls handshake, remote:%s, err:%s", tc.RemoteAddr().String(), err.Error())
+		return nil
+	}
+
+	if chains := tc.ConnectionState().VerifiedChains; len(chains) > 0 && len(chains[0]) > 0 {
+		return chains[0][0]
+	}
+
+	return nil
+}
+
+// Close ...
+func (c *conn) Close() error {
+	c.onClose.Do(c.stat.Closed)
+
+	return c.Conn.Close()
+}
+
 // File ...
 // func (c *conn) File() (*os.File, error) {
 // 	switch t := c.Conn.(type) {
@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader serves certificate loaded from files and loads it again once files change
+// set GetCertificate of tls.Config to make new handshakes use the latest certificate
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	lock     sync.RWMutex
+	cert     *tls.Certificate
+	modTime  time.Time
+}
+
+// NewCertReloader load certificate and key from PEM files
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.cert, nil
+}
+
+// Reload load certificate again if any of files has been modified since last load
+// returns true if certificate has been replaced, on error previous certificate is kept
+func (r *CertReloader) Reload() (bool, error) {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return false, err
+	}
+
+	r.lock.RLock()
+	unchanged := r.cert != nil && modTime.Equal(r.modTime)
+	r.lock.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	// files are rotated one after another, pair which does not match is tried again on next reload
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.lock.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.lock.Unlock()
+
+	return true, nil
+}
+
+// Watch reload certificate every interval until quit is closed
+func (r *CertReloader) Watch(interval time.Duration, quit <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-t.C:
+			if ok, err := r.Reload(); err != nil {
+				log.Error("reload certificate %s, err:%s", r.certFile, err.Error())
+			} else if ok {
+				log.Info("certificate %s reloaded", r.certFile)
+			}
+		}
+	}
+}
+
+// lastModified latest modification time of the certificate and key files
+func (r *CertReloader) lastModified() (time.Time, error) {
+	var latest time.Time
+
+	for _, f := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return latest, err
+		}
+
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,124 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert generate self signed certificate with given common name into PEM files
+// modification time of files is set to mod so reloader sees change regardless of file system precision
+func writeCert(t *testing.T, certFile, keyFile, cn string, mod time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	for f, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDer},
+	} {
+		if err = ioutil.WriteFile(f, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatalf("write %s: %v", f, err)
+		}
+
+		if err = os.Chtimes(f, mod, mod); err != nil {
+			t.Fatalf("chtimes %s: %v", f, err)
+		}
+	}
+}
+
+func commonName(t *testing.T, r *CertReloader) string {
+	cert, err := r.GetCertificate(nil)
+	if err != nil || cert == nil {
+		t.Fatalf("get certificate: %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+
+	writeCert(t, certFile, keyFile, "first", start)
+
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("new reloader: %v", err)
+	}
+
+	if cn := commonName(t, r); cn != "first" {
+		t.Errorf("certificate %q, want first", cn)
+	}
+
+	if ok, err := r.Reload(); ok || err != nil {
+		t.Errorf("reload of unchanged files: got %v, %v, want false, nil", ok, err)
+	}
+
+	writeCert(t, certFile, keyFile, "second", start.Add(time.Second))
+
+	if ok, err := r.Reload(); !ok || err != nil {
+		t.Errorf("reload of rotated files: got %v, %v, want true, nil", ok, err)
+	}
+
+	if cn := commonName(t, r); cn != "second" {
+		t.Errorf("certificate %q, want second", cn)
+	}
+
+	// broken files keep previous certificate
+	if err = ioutil.WriteFile(keyFile, []byte("broken"), 0600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	os.Chtimes(keyFile, start.Add(2*time.Second), start.Add(2*time.Second)) // nolint: errcheck
+
+	if _, err := r.Reload(); err == nil {
+		t.Errorf("reload of broken key succeeded")
+	}
+
+	if cn := commonName(t, r); cn != "second" {
+		t.Errorf("certificate %q after failed reload, want second", cn)
+	}
+
+	os.Remove(certFile) // nolint: errcheck
+
+	if _, err := r.Reload(); err == nil {
+		t.Errorf("reload of missing certificate succeeded")
+	}
+
+	if _, err := NewCertReloader(certFile, keyFile); err == nil {
+		t.Errorf("new reloader with missing certificate succeeded")
+	}
+}
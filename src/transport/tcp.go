@@ -94,7 +94,7 @@ func (l *tcp) Close() error {
 	return err
 }
 
-func (l *tcp) newConn(cn net.Conn, stat systree.BytesMetric) (Conn, error) {
+func (l *tcp) newConn(cn net.Conn, stat systree.ListenerMetric) (Conn, error) {
 	c, err := newConn(l.EPoll, cn, stat)
 	if err != nil {
 		return nil, err
@@ -137,7 +137,7 @@ func (l *tcp) Serve() error {
 				default:
 				}
 
-				if inConn, e := l.newConn(cn, l.Metric.Bytes()); e != nil {
+				if inConn, e := l.newConn(cn, l.Metric.Listener(l.protocol+":"+l.Port())); e != nil {
 					log.Error("create connection interface err:%v", e.Error())
 				} else {
 					l.handleConnection(inConn)
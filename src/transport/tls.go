@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"time"
+)
+
+// handshakeTimeout time client has to complete tls handshake
+const handshakeTimeout = 10 * time.Second
+
+var (
+	// ErrNoCertificates CA bundle does not contain certificates
+	ErrNoCertificates = errors.New("tls: no certificates found")
+	// ErrCRLIssuer revocation list is not signed by any of CA
+	ErrCRLIssuer = errors.New("tls: crl is not signed by known CA")
+	// ErrCertRevoked client certificate is revoked
+	ErrCertRevoked = errors.New("tls: certificate revoked")
+)
+
+// ParseCertificates parse PEM encoded certificates bundle
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, c)
+	}
+
+	if len(certs) == 0 {
+		return nil, ErrNoCertificates
+	}
+
+	return certs, nil
+}
+
+// ParseCRL parse PEM encoded revocation lists or single DER encoded list
+// every list must be signed by one of cas
+func ParseCRL(data []byte, cas []*x509.Certificate) ([]*x509.RevocationList, error) {
+	var ders [][]byte
+
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		for {
+			var block *pem.Block
+			if block, data = pem.Decode(data); block == nil {
+				break
+			}
+
+			if block.Type == "X509 CRL" {
+				ders = append(ders, block.Bytes)
+			}
+		}
+	} else {
+		ders = append(ders, data)
+	}
+
+	var crls []*x509.RevocationList
+
+	for _, der := range ders {
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return nil, err
+		}
+
+		signed := false
+		for _, ca := range cas {
+			if crl.CheckSignatureFrom(ca) == nil {
+				signed = true
+				break
+			}
+		}
+
+		if !signed {
+			return nil, ErrCRLIssuer
+		}
+
+		if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+			log.Warn("crl of %s is outdated since %s", crl.Issuer.String(), crl.NextUpdate.Format(time.RFC3339))
+		}
+
+		crls = append(crls, crl)
+	}
+
+	return crls, nil
+}
+
+// VerifyCRL build tls.Config.VerifyPeerCertificate rejecting chains with certificate revoked by one of crls
+func VerifyCRL(crls []*x509.RevocationList) func([][]byte, [][]*x509.Certificate) error {
+	return func(_ [][]byte, chains [][]*x509.Certificate) error {
+		for _, chain := range chains {
+			for _, c := range chain {
+				if revoked(crls, c) {
+					log.Debug("certificate revoked, subject:%s, serial:%s", c.Subject.String(), c.SerialNumber.String())
+					return ErrCertRevoked
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+func revoked(crls []*x509.RevocationList, c *x509.Certificate) bool {
+	for _, crl := range crls {
+		if !bytes.Equal(crl.RawIssuer, c.RawIssuer) {
+			continue
+		}
+
+		for _, e := range crl.RevokedCertificateEntries {
+			if e.SerialNumber.Cmp(c.SerialNumber) == 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,219 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// testIssuer certificate with key able to sign certificates and revocation lists
+type testIssuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCA self signed certificate authority
+func newTestCA(t *testing.T, cn string) *testIssuer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+
+	return &testIssuer{cert: cert, key: key}
+}
+
+// issue leaf certificate of client or server with given serial
+func (ca *testIssuer) issue(t *testing.T, cn string, serial int64) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// crl revocation list of given serials in DER
+func (ca *testIssuer) crl(t *testing.T, serials ...int64) []byte {
+	tmpl := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+
+	for _, s := range serials {
+		tmpl.RevokedCertificateEntries = append(tmpl.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(s),
+			RevocationTime: time.Now(),
+		})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, tmpl, ca.cert, ca.key)
+	if err != nil {
+		t.Fatalf("create crl: %v", err)
+	}
+
+	return der
+}
+
+// handshake client presenting cert, nil for none, with server verifying client certificates as listener does
+func handshake(t *testing.T, ca *testIssuer, clientAuth tls.ClientAuthType, crls []*x509.RevocationList, cert *tls.Certificate) ([]*x509.Certificate, error) {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	srvCfg := &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "localhost", 100)},
+		ClientCAs:    pool,
+		ClientAuth:   clientAuth,
+	}
+
+	if len(crls) > 0 {
+		srvCfg.VerifyPeerCertificate = VerifyCRL(crls)
+	}
+
+	cliCfg := &tls.Config{RootCAs: pool, ServerName: "localhost"}
+	if cert != nil {
+		cliCfg.Certificates = []tls.Certificate{*cert}
+	}
+
+	c1, c2 := net.Pipe()
+	defer c1.Close() // nolint: errcheck
+	defer c2.Close() // nolint: errcheck
+
+	cli := tls.Client(c1, cliCfg)
+	srv := tls.Server(c2, srvCfg)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// client learns about rejected certificate once it reads
+		if cli.Handshake() == nil {
+			cli.Read(make([]byte, 1)) // nolint: errcheck
+		}
+	}()
+
+	err := srv.Handshake()
+	c2.Close() // nolint: errcheck
+	<-done
+
+	return srv.ConnectionState().PeerCertificates, err
+}
+
+func TestParseCRL(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	other := newTestCA(t, "other")
+
+	der := ca.crl(t, 2, 3)
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: ca.crl(t)})...)
+
+	crls, err := ParseCRL(data, []*x509.Certificate{other.cert, ca.cert})
+	if err != nil || len(crls) != 2 {
+		t.Fatalf("pem bundle: %d lists, err:%v", len(crls), err)
+	}
+
+	if crls, err = ParseCRL(der, []*x509.Certificate{ca.cert}); err != nil || len(crls) != 1 || len(crls[0].RevokedCertificateEntries) != 2 {
+		t.Fatalf("der list: %v", err)
+	}
+
+	if _, err = ParseCRL(der, []*x509.Certificate{other.cert}); err != ErrCRLIssuer {
+		t.Errorf("list of unknown issuer: got %v, want %v", err, ErrCRLIssuer)
+	}
+
+	if _, err = ParseCRL([]byte("garbage"), []*x509.Certificate{ca.cert}); err == nil {
+		t.Errorf("broken list accepted")
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	ca := newTestCA(t, "ca")
+
+	crls, err := ParseCRL(ca.crl(t, 3), []*x509.Certificate{ca.cert})
+	if err != nil {
+		t.Fatalf("parse crl: %v", err)
+	}
+
+	valid := ca.issue(t, "dev1", 2)
+	revoked := ca.issue(t, "dev2", 3)
+	foreign := newTestCA(t, "other").issue(t, "dev3", 2)
+
+	tests := []struct {
+		name       string
+		clientAuth tls.ClientAuthType
+		cert       *tls.Certificate
+		ok         bool
+		cn         string
+	}{
+		{"valid", tls.RequireAndVerifyClientCert, &valid, true, "dev1"},
+		{"revoked", tls.RequireAndVerifyClientCert, &revoked, false, ""},
+		{"revoked optional", tls.VerifyClientCertIfGiven, &revoked, false, ""},
+		{"unknown issuer", tls.RequireAndVerifyClientCert, &foreign, false, ""},
+		{"missing required", tls.RequireAndVerifyClientCert, nil, false, ""},
+		{"missing optional", tls.VerifyClientCertIfGiven, nil, true, ""},
+	}
+
+	for _, tt := range tests {
+		certs, err := handshake(t, ca, tt.clientAuth, crls, tt.cert)
+
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("%s: handshake err:%v, want success %v", tt.name, err, tt.ok)
+			continue
+		}
+
+		cn := ""
+		if len(certs) > 0 {
+			cn = certs[0].Subject.CommonName
+		}
+
+		if tt.ok && cn != tt.cn {
+			t.Errorf("%s: peer certificate %q, want %q", tt.name, cn, tt.cn)
+		}
+	}
+
+	// revoked certificate is rejected with revocation error rather than generic one
+	if _, err = handshake(t, ca, tls.RequireAndVerifyClientCert, crls, &revoked); err != ErrCertRevoked {
+		t.Errorf("revoked: got %v, want %v", err, ErrCertRevoked)
+	}
+}
@@ -0,0 +1,245 @@
+package transport
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// wsHandshakeTimeout time client is given to send headers of upgrade request
+const wsHandshakeTimeout = 10 * time.Second
+
+// ConfigWS configuration of websocket transport
+type ConfigWS struct {
+	// Path http path websocket upgrade requests are served on
+	Path string
+	// SubProtocols list of accepted websocket sub-protocols in order of preference
+	SubProtocols []string
+	TLS          *tls.Config
+	transport    *Config
+}
+
+type ws struct {
+	baseConfig
+	subProtocols []string
+	tls          *tls.Config
+	listener     net.Listener
+	s            *http.Server
+}
+
+// NewConfigWS allocate new transport config for websocket transport
+// Use of this function is preferable instead of direct allocation of ConfigWS
+func NewConfigWS(transport *Config) *ConfigWS {
+	return &ConfigWS{
+		Path:         "/mqtt",
+		SubProtocols: []string{"mqtt", "mqttv3.1"},
+		transport:    transport,
+	}
+}
+
+// NewWS create new websocket transport
+func NewWS(config *ConfigWS, internal *InternalConfig) (Provider, error) {
+	l := &ws{}
+
+	l.quit = make(chan struct{})
+	l.InternalConfig = *internal
+	l.config = *config.transport
+	l.tls = config.TLS
+	l.subProtocols = config.SubProtocols
+
+	path := config.Path
+	if len(path) == 0 {
+		path = "/"
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, l.serveWs)
+
+	l.s = &http.Server{
+		Handler:           mux,
+		TLSConfig:         l.tls,
+		ReadHeaderTimeout: wsHandshakeTimeout,
+	}
+
+	var err error
+
+	if l.listener, err = net.Listen("tcp", config.transport.Host+":"+config.transport.Port); err != nil {
+		return nil, err
+	}
+
+	if l.tls != nil {
+		l.protocol = "wss"
+		l.listener = tls.NewListener(l.listener, l.tls)
+	} else {
+		l.protocol = "ws"
+	}
+
+	return l, nil
+}
+
+// Ready ...
+func (l *ws) Ready() error {
+	if err := l.baseReady(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Alive ...
+func (l *ws) Alive() error {
+	if err := l.baseReady(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Close websocket listener
+func (l *ws) Close() error {
+	var err error
+
+	l.onceStop.Do(func() {
+		close(l.quit)
+
+		err = l.s.Close()
+
+		l.listener = nil
+	})
+
+	return err
+}
+
+// Serve start serving connections
+func (l *ws) Serve() error {
+	if err := l.s.Serve(l.listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+// negotiate pick first of sub-protocols offered by client which is supported by listener
+// empty string with true returned if client did not ask for any sub-protocol
+func (l *ws) negotiate(r *http.Request) (string, bool) {
+	offered := r.Header.Get("Sec-WebSocket-Protocol")
+	if len(offered) == 0 {
+		return "", true
+	}
+
+	for _, o := range strings.Split(offered, ",") {
+		o = strings.TrimSpace(o)
+		for _, p := range l.subProtocols {
+			if strings.EqualFold(o, p) {
+				return p, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func headerContains(h http.Header, name, value string) bool {
+	for _, v := range h[name] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// serveWs handle upgrade request within accept pool worker
+// thus websocket connections are limited the same way as tcp ones
+func (l *ws) serveWs(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-l.quit:
+		http.Error(w, "listener is off", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	done := make(chan struct{})
+
+	if err := l.AcceptPool.ScheduleTimeout(time.Millisecond, func() {
+		defer close(done)
+		l.upgrade(w, r)
+	}); err != nil {
+		http.Error(w, "server is busy", http.StatusServiceUnavailable)
+		return
+	}
+
+	<-done
+}
+
+// upgrade does websocket handshake [RFC6455 4.2] and passes upgraded connection
+// into the same pipeline as tcp transport
+func (l *ws) upgrade(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if len(key) == 0 {
+		http.Error(w, "missing websocket key", http.StatusBadRequest)
+		return
+	}
+
+	subProtocol, ok := l.negotiate(r)
+	if !ok {
+		http.Error(w, "unsupported websocket sub-protocol", http.StatusBadRequest)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket upgrade is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	cn, brw, err := hj.Hijack()
+	if err != nil {
+		log.Error("websocket hijack err:%s", err.Error())
+		return
+	}
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n"
+	if len(subProtocol) > 0 {
+		resp += "Sec-WebSocket-Protocol: " + subProtocol + "\r\n"
+	}
+	resp += "\r\n"
+
+	cn.SetDeadline(time.Time{}) // nolint: errcheck
+
+	if _, err = cn.Write([]byte(resp)); err != nil {
+		log.Error("websocket handshake err:%s", err.Error())
+		cn.Close() // nolint: errcheck
+		return
+	}
+
+	log.Debug("websocket accept, remote:%s", cn.RemoteAddr().String())
+
+	if inConn, e := newConn(l.EPoll, newWsConn(cn, brw.Reader), l.Metric.Listener(l.protocol+":"+l.Port())); e != nil {
+		log.Error("create connection interface err:%v", e.Error())
+		cn.Close() // nolint: errcheck
+	} else {
+		l.handleConnection(inConn)
+	}
+}
@@ -0,0 +1,255 @@
+package transport
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// websocket opcodes [RFC6455 5.2]
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+const (
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// wsMaxControlPayload maximum payload size of control frames [RFC6455 5.5]
+	wsMaxControlPayload = 125
+
+	wsCloseNormal        = 1000
+	wsCloseProtocolError = 1002
+	wsCloseUnsupported   = 1003
+)
+
+var (
+	// ErrWsProtocol remote violated websocket framing rules
+	ErrWsProtocol = errors.New("websocket: protocol error")
+
+	// ErrWsClosed remote sent close frame
+	ErrWsClosed = errors.New("websocket: closed by remote")
+)
+
+// wsConn implements net.Conn on top of hijacked websocket connection
+// Each Write produces single binary frame, Read returns payload of binary
+// frames as continuous stream so MQTT packets might span across frames
+type wsConn struct {
+	net.Conn
+	rd        *bufio.Reader
+	wLock     sync.Mutex
+	remaining uint64
+	mask      [4]byte
+	maskPos   int
+	masked    bool
+	closeSent bool
+	// fragmented data message started by frame without FIN is in progress
+	fragmented bool
+}
+
+var _ net.Conn = (*wsConn)(nil)
+
+func newWsConn(cn net.Conn, rd *bufio.Reader) *wsConn {
+	if rd == nil {
+		rd = bufio.NewReader(cn)
+	}
+
+	return &wsConn{
+		Conn: cn,
+		rd:   rd,
+	}
+}
+
+// wsAcceptKey compute value of the Sec-WebSocket-Accept header
+func wsAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID)) // nolint: errcheck
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Read payload of the data frames
+func (c *wsConn) Read(b []byte) (int, error) {
+	for c.remaining == 0 {
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	if uint64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+
+	n, err := c.rd.Read(b)
+	if c.masked {
+		for i := 0; i < n; i++ {
+			b[i] ^= c.mask[c.maskPos&3]
+			c.maskPos++
+		}
+	}
+
+	c.remaining -= uint64(n)
+
+	return n, err
+}
+
+// Write send b as single binary frame
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := c.writeFrame(wsOpBinary, b); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// Close send close frame if not sent yet and close underlying connection
+func (c *wsConn) Close() error {
+	c.sendClose(wsCloseNormal)
+
+	return c.Conn.Close()
+}
+
+func (c *wsConn) sendClose(code uint16) {
+	c.wLock.Lock()
+	sent := c.closeSent
+	c.closeSent = true
+	c.wLock.Unlock()
+
+	if !sent {
+		payload := make([]byte, 2)
+		binary.BigEndian.PutUint16(payload, code)
+
+		c.Conn.SetWriteDeadline(time.Now().Add(time.Second)) // nolint: errcheck
+		c.writeFrame(wsOpClose, payload)                     // nolint: errcheck
+	}
+}
+
+// nextFrame read frame headers until data frame met
+// control frames are processed in place
+func (c *wsConn) nextFrame() error {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.rd, hdr[:]); err != nil {
+		return err
+	}
+
+	// [RFC6455 5.2] extensions are not negotiated thus RSV bits must be 0
+	if hdr[0]&0x70 != 0 {
+		c.sendClose(wsCloseProtocolError)
+		return ErrWsProtocol
+	}
+
+	fin := hdr[0]&0x80 != 0
+	opcode := hdr[0] & 0x0F
+	length := uint64(hdr[1] & 0x7F)
+
+	// [RFC6455 5.3] client must mask all frames sent to server
+	if hdr[1]&0x80 == 0 {
+		c.sendClose(wsCloseProtocolError)
+		return ErrWsProtocol
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rd, ext[:]); err != nil {
+			return err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rd, ext[:]); err != nil {
+			return err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if _, err := io.ReadFull(c.rd, c.mask[:]); err != nil {
+		return err
+	}
+
+	c.masked = true
+	c.maskPos = 0
+
+	switch opcode {
+	case wsOpBinary, wsOpContinuation:
+		// [RFC6455 5.4] continuation frame must follow fragment of the message
+		// and fragments of different messages must not interleave
+		if (opcode == wsOpContinuation) != c.fragmented {
+			c.sendClose(wsCloseProtocolError)
+			return ErrWsProtocol
+		}
+
+		c.fragmented = !fin
+		c.remaining = length
+		return nil
+	case wsOpText:
+		// [MQTT-6.0.0-1] MQTT control packets must be sent in binary data frames
+		c.sendClose(wsCloseUnsupported)
+		return ErrWsProtocol
+	}
+
+	// [RFC6455 5.5] control frames must not be fragmented
+	if !fin || length > wsMaxControlPayload {
+		c.sendClose(wsCloseProtocolError)
+		return ErrWsProtocol
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.rd, payload); err != nil {
+		return err
+	}
+
+	for i := range payload {
+		payload[i] ^= c.mask[i&3]
+	}
+
+	switch opcode {
+	case wsOpPing:
+		return c.writeFrame(wsOpPong, payload)
+	case wsOpPong:
+		return nil
+	case wsOpClose:
+		c.sendClose(wsCloseNormal)
+		return ErrWsClosed
+	}
+
+	c.sendClose(wsCloseProtocolError)
+	return ErrWsProtocol
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	var hdr [10]byte
+
+	hdr[0] = 0x80 | opcode
+	size := 2
+
+	switch l := len(payload); {
+	case l <= 125:
+		hdr[1] = byte(l)
+	case l <= 0xFFFF:
+		hdr[1] = 126
+		binary.BigEndian.PutUint16(hdr[2:], uint16(l))
+		size += 2
+	default:
+		hdr[1] = 127
+		binary.BigEndian.PutUint64(hdr[2:], uint64(l))
+		size += 8
+	}
+
+	c.wLock.Lock()
+	defer c.wLock.Unlock()
+
+	bufs := net.Buffers{hdr[:size], payload}
+	_, err := bufs.WriteTo(c.Conn)
+
+	return err
+}
@@ -0,0 +1,150 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// clientFrame masked frame as sent by websocket client
+func clientFrame(fin bool, opcode byte, payload []byte) []byte {
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+
+	b := []byte{opcode, 0x80}
+	if fin {
+		b[0] |= 0x80
+	}
+
+	if l := len(payload); l <= 125 {
+		b[1] |= byte(l)
+	} else {
+		b[1] |= 126
+		b = append(b, byte(l>>8), byte(l))
+	}
+
+	b = append(b, mask[:]...)
+	for i, p := range payload {
+		b = append(b, p^mask[i&3])
+	}
+
+	return b
+}
+
+// serverFrame read unmasked frame sent by server
+func serverFrame(t *testing.T, rd *bufio.Reader) (byte, []byte) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(rd, hdr[:]); err != nil {
+		t.Fatalf("read frame header: %v", err)
+	}
+
+	payload := make([]byte, hdr[1]&0x7F)
+	if _, err := io.ReadFull(rd, payload); err != nil {
+		t.Fatalf("read frame payload: %v", err)
+	}
+
+	return hdr[0] & 0x0F, payload
+}
+
+func newTestWsConn(t *testing.T, frames ...[]byte) (*wsConn, *bufio.Reader) {
+	server, client := net.Pipe()
+
+	t.Cleanup(func() {
+		server.Close() // nolint: errcheck
+		client.Close() // nolint: errcheck
+	})
+
+	go func() {
+		for _, f := range frames {
+			if _, err := client.Write(f); err != nil {
+				return
+			}
+		}
+	}()
+
+	server.SetReadDeadline(time.Now().Add(5 * time.Second)) // nolint: errcheck
+	client.SetReadDeadline(time.Now().Add(5 * time.Second)) // nolint: errcheck
+
+	return newWsConn(server, nil), bufio.NewReader(client)
+}
+
+func TestWsFragmentedMessage(t *testing.T) {
+	c, rd := newTestWsConn(t,
+		clientFrame(false, wsOpBinary, []byte{0x10, 0x02}),
+		clientFrame(true, wsOpPing, []byte("hi")),
+		clientFrame(false, wsOpContinuation, []byte{0x00}),
+		clientFrame(true, wsOpContinuation, []byte{0x04}),
+	)
+
+	pong := make(chan []byte, 1)
+	go func() {
+		op, payload := serverFrame(t, rd)
+		if op != wsOpPong {
+			t.Errorf("expected pong, got opcode %#x", op)
+		}
+		pong <- payload
+	}()
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		t.Fatalf("read fragmented message: %v", err)
+	}
+
+	if !bytes.Equal(buf, []byte{0x10, 0x02, 0x00, 0x04}) {
+		t.Errorf("unexpected payload % x", buf)
+	}
+
+	if p := <-pong; string(p) != "hi" {
+		t.Errorf("pong payload: expected hi, got %q", p)
+	}
+}
+
+func TestWsFramingViolations(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames [][]byte
+	}{
+		{"fragmented ping", [][]byte{clientFrame(false, wsOpPing, nil)}},
+		{"fragmented close", [][]byte{clientFrame(false, wsOpClose, nil)}},
+		{"continuation without message", [][]byte{clientFrame(true, wsOpContinuation, []byte{0x01})}},
+		{"interleaved message", [][]byte{
+			clientFrame(false, wsOpBinary, []byte{0x01}),
+			clientFrame(true, wsOpBinary, []byte{0x02}),
+		}},
+		{"unmasked frame", [][]byte{{0x82, 0x01, 0x00}}},
+		{"reserved bits", [][]byte{{0xC2, 0x80, 0, 0, 0, 0}}},
+		{"oversized control", [][]byte{clientFrame(true, wsOpPing, make([]byte, wsMaxControlPayload+1))}},
+	}
+
+	for _, tt := range tests {
+		c, rd := newTestWsConn(t, tt.frames...)
+
+		closed := make(chan uint16, 1)
+		go func() {
+			op, payload := serverFrame(t, rd)
+			if op != wsOpClose || len(payload) != 2 {
+				t.Errorf("%s: expected close frame, got opcode %#x", tt.name, op)
+				closed <- 0
+				return
+			}
+			closed <- binary.BigEndian.Uint16(payload)
+		}()
+
+		buf := make([]byte, 16)
+		var err error
+		for err == nil {
+			_, err = c.Read(buf)
+		}
+
+		if err != ErrWsProtocol {
+			t.Errorf("%s: expected %v, got %v", tt.name, ErrWsProtocol, err)
+		}
+
+		if code := <-closed; code != wsCloseProtocolError {
+			t.Errorf("%s: expected close code %d, got %d", tt.name, wsCloseProtocolError, code)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package types
+
+import (
+	"strings"
+)
+
+// NamespaceLevel topic level under which topics of the project namespaces are placed
+// Regular topics are placed as $project/<ns>/<topic> and topics starting with $
+// keep first level in place, e.g. $SYS/$project/<ns>/<rest>, so wildcard filters
+// of the namespace never match namespaced $ topics [MQTT-4.7.2-1]
+const NamespaceLevel = "$project"
+
+const sharePrefix = "$share/"
+
+// NamespaceTopic place topic into namespace
+// topic returned unchanged if namespace is empty
+func NamespaceTopic(ns, topic string) string {
+	if len(ns) == 0 {
+		return topic
+	}
+
+	if strings.HasPrefix(topic, "$") {
+		idx := strings.Index(topic, "/")
+		if idx < 0 {
+			return topic + "/" + NamespaceLevel + "/" + ns
+		}
+
+		return topic[:idx] + "/" + NamespaceLevel + "/" + ns + topic[idx:]
+	}
+
+	return NamespaceLevel + "/" + ns + "/" + topic
+}
+
+// NamespaceFilter place subscription filter into namespace
+// share name of the shared subscriptions is kept in place
+func NamespaceFilter(ns, filter string) string {
+	if len(ns) == 0 {
+		return filter
+	}
+
+	if strings.HasPrefix(filter, sharePrefix) {
+		if idx := strings.Index(filter[len(sharePrefix):], "/"); idx >= 0 {
+			idx += len(sharePrefix)
+			return filter[:idx+1] + NamespaceTopic(ns, filter[idx+1:])
+		}
+	}
+
+	return NamespaceTopic(ns, filter)
+}
+
+// EscapesNamespace true if topic or filter of the client within namespace ns refers to project namespaces
+// topics of clients within namespace are placed into it, thus only clients without namespace
+// may reach others: either by $project level directly or by wildcard at second level of $ filter
+func EscapesNamespace(ns, filter string) bool {
+	if len(ns) > 0 {
+		return false
+	}
+
+	if strings.HasPrefix(filter, sharePrefix) {
+		idx := strings.Index(filter[len(sharePrefix):], "/")
+		if idx < 0 {
+			return false
+		}
+
+		filter = filter[len(sharePrefix)+idx+1:]
+	}
+
+	levels := strings.SplitN(filter, "/", 3)
+	if levels[0] == NamespaceLevel {
+		return true
+	}
+
+	if strings.HasPrefix(levels[0], "$") && len(levels) > 1 {
+		switch levels[1] {
+		case NamespaceLevel, "+", "#":
+			return true
+		}
+	}
+
+	return false
+}
+
+// StripNamespace reverts NamespaceTopic
+// false returned if topic does not belong to namespace
+func StripNamespace(ns, topic string) (string, bool) {
+	if len(ns) == 0 {
+		return topic, true
+	}
+
+	prefix := NamespaceLevel + "/" + ns
+
+	if strings.HasPrefix(topic, prefix+"/") {
+		return topic[len(prefix)+1:], true
+	}
+
+	idx := strings.Index(topic, "/")
+	if idx < 0 || !strings.HasPrefix(topic, "$") {
+		return topic, false
+	}
+
+	rest := topic[idx+1:]
+	if rest == prefix {
+		return topic[:idx], true
+	}
+
+	if strings.HasPrefix(rest, prefix+"/") {
+		return topic[:idx] + rest[len(prefix):], true
+	}
+
+	return topic, false
+}
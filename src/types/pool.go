@@ -2,6 +2,7 @@ package types
 
 import (
 	"fmt"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,12 +18,26 @@ type Pool interface {
 	Schedule(task func()) error
 	ScheduleTimeout(timeout time.Duration, task func()) error
 	Close() error
+	Stats() PoolStats
+}
+
+// PoolStats saturation of the pool
+type PoolStats struct {
+	// Size max count of workers
+	Size int
+	// Workers spawned workers
+	Workers int
+	// Busy workers running task
+	Busy int
+	// Queued tasks waiting for free worker
+	Queued int
 }
 
 type pool struct {
 	quit chan struct{}
 	sem  chan struct{}
 	work chan func()
+	busy int32
 }
 
 // NewPool creates new goroutine pool with given size. It also creates a work
@@ -81,6 +96,16 @@ func (p *pool) Close() error {
 	return nil
 }
 
+// Stats current saturation of the pool
+func (p *pool) Stats() PoolStats {
+	return PoolStats{
+		Size:    cap(p.sem),
+		Workers: len(p.sem),
+		Busy:    int(atomic.LoadInt32(&p.busy)),
+		Queued:  len(p.work),
+	}
+}
+
 func (p *pool) schedule(task func(), timeout <-chan time.Time) error {
 	select {
 	case <-timeout:
@@ -98,9 +123,16 @@ func (p *pool) worker(task func()) {
 		<-p.sem
 	}()
 
-	task()
+	p.run(task)
 
 	for t := range p.work {
-		t()
+		p.run(t)
 	}
 }
+
+func (p *pool) run(task func()) {
+	atomic.AddInt32(&p.busy, 1)
+	defer atomic.AddInt32(&p.busy, -1)
+
+	task()
+}
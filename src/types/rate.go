@@ -0,0 +1,28 @@
+package types
+
+// Policies applied once client exceeds its rate limit
+const (
+	// RatePolicyThrottle pause reading from connection until client is back within limit
+	RatePolicyThrottle = "throttle"
+	// RatePolicyDisconnect close connection, v5 clients get DISCONNECT with
+	// CodeMessageRateTooHigh or CodeQuotaExceeded
+	RatePolicyDisconnect = "disconnect"
+)
+
+// RateLimit token bucket limits of PUBLISH messages received from connection
+// zero Messages or Bytes leaves that dimension unlimited
+type RateLimit struct {
+	// Messages per second
+	Messages float64
+	// Bytes per second
+	Bytes float64
+	// Burst seconds worth of tokens bucket holds, 1 if not set
+	Burst float64
+	// Policy RatePolicyThrottle if not set
+	Policy string
+}
+
+// Enabled true if any limit is set
+func (r *RateLimit) Enabled() bool {
+	return r != nil && (r.Messages > 0 || r.Bytes > 0)
+}
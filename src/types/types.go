@@ -19,6 +19,10 @@ const (
 	DefaultTopicsProvider   = "mem"         // DefaultTopicsProvider default topics provider
 )
 
+// BridgeSessionPrefix prefix of persistence entries bridges buffer messages in
+// such entries are not client sessions
+const BridgeSessionPrefix = "$bridge/"
+
 // RetainObject general interface of the retain as not only publish message can be retained
 type RetainObject interface {
 	Topic() string
@@ -82,3 +82,74 @@ func BenchmarkOnce(b *testing.B) {
 		}
 	})
 }
+
+func TestNamespaceTopic(t *testing.T) {
+	cases := []struct {
+		ns     string
+		topic  string
+		result string
+	}{
+		{"", "a/b", "a/b"},
+		{"p1", "a/b", "$project/p1/a/b"},
+		{"p1", "/a", "$project/p1//a"},
+		{"p1", "$SYS/broker/clients/c1/connected", "$SYS/$project/p1/broker/clients/c1/connected"},
+		{"p1", "$SYS", "$SYS/$project/p1"},
+	}
+
+	for _, c := range cases {
+		if r := NamespaceTopic(c.ns, c.topic); r != c.result {
+			t.Errorf("namespace %q of %q: %q != %q", c.ns, c.topic, r, c.result)
+		}
+
+		if r, ok := StripNamespace(c.ns, c.result); !ok || r != c.topic {
+			t.Errorf("strip namespace %q of %q: %q != %q", c.ns, c.result, r, c.topic)
+		}
+	}
+}
+
+func TestNamespaceFilter(t *testing.T) {
+	if r := NamespaceFilter("p1", "$share/g/a/#"); r != "$share/g/$project/p1/a/#" {
+		t.Errorf("unexpected shared filter %q", r)
+	}
+
+	if r := NamespaceFilter("p1", "#"); r != "$project/p1/#" {
+		t.Errorf("unexpected filter %q", r)
+	}
+}
+
+func TestStripNamespaceForeign(t *testing.T) {
+	for _, topic := range []string{"a/b", "$project/p2/a", "$SYS/$project/p2/x", "$project/p10/a"} {
+		if _, ok := StripNamespace("p1", topic); ok {
+			t.Errorf("topic %q must not belong to namespace", topic)
+		}
+	}
+}
+
+func TestEscapesNamespace(t *testing.T) {
+	cases := []struct {
+		ns      string
+		filter  string
+		escapes bool
+	}{
+		{"", "a/b", false},
+		{"", "#", false},
+		{"", "+/a", false},
+		{"", "$SYS/broker/#", false},
+		{"", "$project", true},
+		{"", "$project/p2/#", true},
+		{"", "$project/p2/a/b", true},
+		{"", "$SYS/$project/p2/#", true},
+		{"", "$SYS/#", true},
+		{"", "$SYS/+/p2/#", true},
+		{"", "$share/g/$project/p2/#", true},
+		{"", "$share/g/a/#", false},
+		{"p1", "$project/p2/#", false},
+		{"p1", "$SYS/#", false},
+	}
+
+	for _, c := range cases {
+		if r := EscapesNamespace(c.ns, c.filter); r != c.escapes {
+			t.Errorf("namespace %q filter %q: escapes %v != %v", c.ns, c.filter, r, c.escapes)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"orm"
+	"server"
+	"time"
+)
+
+// dbUsers users of the user table managed over http API
+// user table keeps project id in primary key column Id
+type dbUsers struct{}
+
+var _ server.UserStore = (*dbUsers)(nil)
+
+// ListUsers implements server.UserStore
+func (d *dbUsers) ListUsers() ([]server.User, error) {
+	var users []User
+
+	if _, err := orm.NewOrm().QueryTable("user").OrderBy("name").All(&users, "id", "name"); err != nil {
+		return nil, err
+	}
+
+	list := make([]server.User, 0, len(users))
+	for _, u := range users {
+		list = append(list, server.User{
+			Name:      u.Name,
+			ProjectId: u.Id,
+		})
+	}
+
+	return list, nil
+}
+
+// AddUser implements server.UserStore
+func (d *dbUsers) AddUser(u *server.User) error {
+	o := orm.NewOrm()
+
+	if o.QueryTable("user").Filter("name", u.Name).Exist() {
+		return server.ErrUserExists
+	}
+
+	if o.QueryTable("user").Filter("id", u.ProjectId).Exist() {
+		return server.ErrProjectTaken
+	}
+
+	_, err := o.Insert(&User{
+		Id:     u.ProjectId,
+		Name:   u.Name,
+		Passwd: u.Password,
+	})
+
+	// project taken concurrently
+	if err != nil && o.QueryTable("user").Filter("id", u.ProjectId).Exist() {
+		return server.ErrProjectTaken
+	}
+
+	return err
+}
+
+// SetPassword implements server.UserStore
+func (d *dbUsers) SetPassword(name, password string) error {
+	n, err := orm.NewOrm().QueryTable("user").Filter("name", name).Update(orm.Params{"passwd": password})
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return server.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// DelUser implements server.UserStore
+func (d *dbUsers) DelUser(name string) error {
+	n, err := orm.NewOrm().QueryTable("user").Filter("name", name).Delete()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return server.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// Sync implements server.UserStore
+func (d *dbUsers) Sync() error {
+	return reloadUsers()
+}
+
+// syncUsers reload users from database every interval until quit is closed
+// picks up users changed in database directly
+func syncUsers(interval time.Duration, quit <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-t.C:
+			if err := reloadUsers(); err != nil {
+				log.Error("sync users fail:%s", err.Error())
+			}
+		}
+	}
+}